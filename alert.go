@@ -0,0 +1,250 @@
+// Copyright (c) 2015 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ppcsuite/ppcd/btcec"
+	"github.com/ppcsuite/ppcd/wire"
+)
+
+// invalidAlertSigBanScore is the ban score given to a peer for each alert it
+// sends which is not signed with the alert key of the network.
+const invalidAlertSigBanScore = 10
+
+// errInvalidAlertSig describes an error where an alert is not signed with the
+// alert key of the network.
+var errInvalidAlertSig = errors.New("alert signature is invalid")
+
+// alertManager verifies network alerts against the alert key of the active
+// network, keeps track of the alerts which are currently in effect, and relays
+// newly accepted alerts to the other connected peers.
+type alertManager struct {
+	sync.Mutex
+	server *server
+	pubKey *btcec.PublicKey
+	subVer string
+	alerts map[int32]*wire.MsgAlert
+}
+
+// newAlertManager returns a new alert manager which verifies alerts against
+// the alert key defined by the passed network parameters.  Alerts are ignored
+// when the network does not define an alert key.
+func newAlertManager(s *server) (*alertManager, error) {
+	am := alertManager{
+		server: s,
+		subVer: fmt.Sprintf("%s%s:%s/", wire.DefaultUserAgent,
+			userAgentName, userAgentVersion),
+		alerts: make(map[int32]*wire.MsgAlert),
+	}
+	if len(s.chainParams.AlertPubKey) != 0 {
+		pubKey, err := btcec.ParsePubKey(s.chainParams.AlertPubKey,
+			btcec.S256())
+		if err != nil {
+			return nil, fmt.Errorf("invalid alert key for network "+
+				"%s: %v", s.chainParams.Name, err)
+		}
+		am.pubKey = pubKey
+	}
+	return &am, nil
+}
+
+// relayableAlert returns a copy of the passed alert message which is encoded
+// with the payload exactly as it was received.  MsgAlert.BtcEncode serializes
+// the deserialized payload again when it is set, which would invalidate the
+// signature of payloads containing fields this version does not know about.
+func relayableAlert(msg *wire.MsgAlert) *wire.MsgAlert {
+	relayMsg := *msg
+	relayMsg.Payload = nil
+	return &relayMsg
+}
+
+// alertCancels returns whether or not alert a cancels alert b.
+func alertCancels(a, b *wire.Alert) bool {
+	if b.ID <= a.Cancel {
+		return true
+	}
+	for _, id := range a.SetCancel {
+		if id == b.ID {
+			return true
+		}
+	}
+	return false
+}
+
+// appliesToUs returns whether or not the passed alert is targeted at the
+// protocol version and user agent of this server.  Alerts which do not apply
+// to us are still relayed.
+func (am *alertManager) appliesToUs(alert *wire.Alert) bool {
+	if int32(maxProtocolVersion) < alert.MinVer ||
+		int32(maxProtocolVersion) > alert.MaxVer {
+		return false
+	}
+	if len(alert.SetSubVer) == 0 {
+		return true
+	}
+	for _, subVer := range alert.SetSubVer {
+		if subVer == am.subVer {
+			return true
+		}
+	}
+	return false
+}
+
+// removeExpired removes all alerts which are no longer in effect.
+//
+// This function MUST be called with the alert manager lock held.
+func (am *alertManager) removeExpired(now int64) {
+	for id, msg := range am.alerts {
+		if msg.Payload.Expiration <= now {
+			srvrLog.Debugf("Alert %d expired", id)
+			delete(am.alerts, id)
+		}
+	}
+}
+
+// ProcessAlert verifies the passed alert message received from the passed
+// peer against the network alert key.  Valid alerts which have not been seen
+// before are stored, logged, passed on to any websocket clients which
+// requested alert notifications, and relayed to the other connected peers
+// unless alert relaying is disabled.  An error is returned for alerts which
+// are rejected, which is errInvalidAlertSig when the alert is not signed with
+// the alert key of the network.
+//
+// This function is safe for concurrent access.
+func (am *alertManager) ProcessAlert(msg *wire.MsgAlert, p *peer) error {
+	if am.pubKey == nil {
+		return errors.New("no alert key is defined for the network")
+	}
+	alert := msg.Payload
+	if alert == nil {
+		return errors.New("malformed alert payload")
+	}
+
+	// The signature must be for the double sha256 of the serialized payload
+	// exactly as it was received.
+	sig, err := btcec.ParseSignature(msg.Signature, btcec.S256())
+	if err != nil {
+		return errInvalidAlertSig
+	}
+	hash := wire.DoubleSha256(msg.SerializedPayload)
+	if !sig.Verify(hash, am.pubKey) {
+		return errInvalidAlertSig
+	}
+
+	am.Lock()
+	defer am.Unlock()
+
+	now := time.Now().Unix()
+	am.removeExpired(now)
+	if alert.Expiration <= now {
+		return fmt.Errorf("alert %d has expired", alert.ID)
+	}
+
+	// Ignore alerts which have already been seen so they are not relayed
+	// again.
+	if _, ok := am.alerts[alert.ID]; ok {
+		return nil
+	}
+
+	// Reject the alert if it has been cancelled by an alert which is still
+	// in effect.
+	for id, existing := range am.alerts {
+		if alertCancels(existing.Payload, alert) {
+			return fmt.Errorf("alert %d is cancelled by alert %d",
+				alert.ID, id)
+		}
+	}
+
+	// Remove any alerts which are cancelled by the new one.
+	ntfnMgr := am.notificationManager()
+	for id, existing := range am.alerts {
+		if !alertCancels(alert, existing.Payload) {
+			continue
+		}
+		srvrLog.Infof("Alert %d cancelled by alert %d", id, alert.ID)
+		delete(am.alerts, id)
+		if ntfnMgr != nil {
+			ntfnMgr.NotifyAlert(existing.Payload, true)
+		}
+	}
+
+	am.alerts[alert.ID] = msg
+	if am.appliesToUs(alert) {
+		srvrLog.Warnf("ALERT %d: %s", alert.ID, alert.StatusBar)
+	} else {
+		srvrLog.Infof("Received alert %d which does not apply to "+
+			"this version: %s", alert.ID, alert.StatusBar)
+	}
+	if ntfnMgr != nil {
+		ntfnMgr.NotifyAlert(alert, false)
+	}
+
+	if !cfg.NoAlertRelay && now < alert.RelayUntil {
+		am.server.BroadcastMessage(relayableAlert(msg), p)
+	}
+	return nil
+}
+
+// notificationManager returns the websocket notification manager of the RPC
+// server or nil when the RPC server is disabled.
+func (am *alertManager) notificationManager() *wsNotificationManager {
+	if am.server.rpcServer == nil {
+		return nil
+	}
+	return am.server.rpcServer.ntfnMgr
+}
+
+// RelayAlerts queues all alerts which are in effect and still within their
+// relay window to the passed peer.  It is called once the version handshake
+// with a new peer has completed.
+//
+// This function is safe for concurrent access.
+func (am *alertManager) RelayAlerts(p *peer) {
+	if cfg.NoAlertRelay {
+		return
+	}
+
+	am.Lock()
+	defer am.Unlock()
+
+	now := time.Now().Unix()
+	am.removeExpired(now)
+	for _, msg := range am.alerts {
+		if now < msg.Payload.RelayUntil {
+			p.QueueMessage(relayableAlert(msg), nil)
+		}
+	}
+}
+
+// StatusBar returns the status bar message of the highest priority alert in
+// effect which applies to this server, or an empty string when there is no
+// such alert.  It is used to populate the errors field of RPC results.
+//
+// This function is safe for concurrent access.
+func (am *alertManager) StatusBar() string {
+	am.Lock()
+	defer am.Unlock()
+
+	am.removeExpired(time.Now().Unix())
+	var best *wire.Alert
+	for _, msg := range am.alerts {
+		alert := msg.Payload
+		if !am.appliesToUs(alert) {
+			continue
+		}
+		if best == nil || alert.Priority > best.Priority {
+			best = alert
+		}
+	}
+	if best == nil {
+		return ""
+	}
+	return best.StatusBar
+}
@@ -0,0 +1,192 @@
+// Copyright (c) 2015 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/ppcsuite/ppcd/btcec"
+	"github.com/ppcsuite/ppcd/wire"
+)
+
+// newTestAlertManager returns an alert manager which verifies alerts against
+// the public key of the returned private key.  Alert relaying is disabled so
+// no server is needed.
+func newTestAlertManager(t *testing.T) (*alertManager, *btcec.PrivateKey) {
+	key, err := btcec.NewPrivateKey(btcec.S256())
+	if err != nil {
+		t.Fatalf("NewPrivateKey: %v", err)
+	}
+	oldCfg := cfg
+	defer func() { cfg = oldCfg }()
+	cfg = &config{NoAlertRelay: true}
+	am := &alertManager{
+		server: &server{},
+		pubKey: key.PubKey(),
+		alerts: make(map[int32]*wire.MsgAlert),
+	}
+	return am, key
+}
+
+// newTestAlert returns an alert message with the passed id which expires at
+// the passed time, signed with the passed key.  The passed function may modify
+// the alert before it is signed.
+func newTestAlert(t *testing.T, key *btcec.PrivateKey, id int32,
+	expiration time.Time, modify func(*wire.Alert)) *wire.MsgAlert {
+
+	alert := wire.NewAlert(1, expiration.Unix(), expiration.Unix(), id, 0,
+		nil, 0, maxProtocolVersion, nil, 1, "", "test alert")
+	if modify != nil {
+		modify(alert)
+	}
+	var buf bytes.Buffer
+	if err := alert.Serialize(&buf, maxProtocolVersion); err != nil {
+		t.Fatalf("Serialize: %v", err)
+	}
+	sig, err := key.Sign(wire.DoubleSha256(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+	msg := wire.NewMsgAlert(buf.Bytes(), sig.Serialize())
+	msg.Payload = alert
+	return msg
+}
+
+// TestProcessAlertSignature ensures only alerts signed with the alert key of
+// the network are accepted.
+func TestProcessAlertSignature(t *testing.T) {
+	am, key := newTestAlertManager(t)
+	otherKey, err := btcec.NewPrivateKey(btcec.S256())
+	if err != nil {
+		t.Fatalf("NewPrivateKey: %v", err)
+	}
+	expiration := time.Now().Add(time.Hour)
+
+	malformed := newTestAlert(t, key, 1, expiration, nil)
+	malformed.Signature = []byte{0x30, 0x01}
+	tampered := newTestAlert(t, key, 2, expiration, nil)
+	tampered.SerializedPayload = append([]byte{}, tampered.SerializedPayload...)
+	tampered.SerializedPayload[len(tampered.SerializedPayload)-1] ^= 1
+
+	tests := []struct {
+		name string
+		msg  *wire.MsgAlert
+		err  error
+	}{
+		{"malformed signature", malformed, errInvalidAlertSig},
+		{"tampered payload", tampered, errInvalidAlertSig},
+		{"wrong key", newTestAlert(t, otherKey, 3, expiration, nil),
+			errInvalidAlertSig},
+		{"valid", newTestAlert(t, key, 4, expiration, nil), nil},
+	}
+	for _, test := range tests {
+		err := am.ProcessAlert(test.msg, nil)
+		if err != test.err {
+			t.Errorf("%s: got error %v, want %v", test.name, err,
+				test.err)
+		}
+		_, stored := am.alerts[test.msg.Payload.ID]
+		if stored != (test.err == nil) {
+			t.Errorf("%s: alert stored %v, want %v", test.name,
+				stored, test.err == nil)
+		}
+	}
+	if got := am.StatusBar(); got != "test alert" {
+		t.Errorf("StatusBar: got %q, want %q", got, "test alert")
+	}
+}
+
+// TestProcessAlertCancel ensures alerts cancel the alerts in effect which they
+// target and that cancelled alerts are not accepted again.
+func TestProcessAlertCancel(t *testing.T) {
+	am, key := newTestAlertManager(t)
+	expiration := time.Now().Add(time.Hour)
+
+	for id := int32(1); id <= 3; id++ {
+		msg := newTestAlert(t, key, id, expiration, nil)
+		if err := am.ProcessAlert(msg, nil); err != nil {
+			t.Fatalf("alert %d: %v", id, err)
+		}
+	}
+
+	// Alert 4 cancels alerts up to 1 and alert 3 through its set.
+	msg := newTestAlert(t, key, 4, expiration, func(alert *wire.Alert) {
+		alert.Cancel = 1
+		alert.SetCancel = []int32{3}
+	})
+	if err := am.ProcessAlert(msg, nil); err != nil {
+		t.Fatalf("alert 4: %v", err)
+	}
+	for id, want := range map[int32]bool{1: false, 2: true, 3: false, 4: true} {
+		if _, ok := am.alerts[id]; ok != want {
+			t.Errorf("alert %d in effect %v, want %v", id, ok, want)
+		}
+	}
+
+	// The cancelled alerts are rejected while alert 4 is in effect.
+	for _, id := range []int32{1, 3} {
+		msg := newTestAlert(t, key, id, expiration, nil)
+		if err := am.ProcessAlert(msg, nil); err == nil {
+			t.Errorf("cancelled alert %d was accepted", id)
+		}
+	}
+}
+
+// TestProcessAlertExpiration ensures expired alerts are rejected and that
+// alerts are no longer in effect once they expire.
+func TestProcessAlertExpiration(t *testing.T) {
+	am, key := newTestAlertManager(t)
+
+	expired := newTestAlert(t, key, 1, time.Now().Add(-time.Second), nil)
+	if err := am.ProcessAlert(expired, nil); err == nil {
+		t.Errorf("expired alert was accepted")
+	}
+
+	msg := newTestAlert(t, key, 2, time.Now().Add(time.Hour), nil)
+	if err := am.ProcessAlert(msg, nil); err != nil {
+		t.Fatalf("alert 2: %v", err)
+	}
+	msg.Payload.Expiration = time.Now().Add(-time.Second).Unix()
+	if got := am.StatusBar(); got != "" {
+		t.Errorf("StatusBar: got %q after expiration, want none", got)
+	}
+	if len(am.alerts) != 0 {
+		t.Errorf("got %d alerts in effect after expiration, want 0",
+			len(am.alerts))
+	}
+}
+
+// TestRelayableAlert ensures relayed alerts are encoded with the payload as it
+// was received and signed.
+func TestRelayableAlert(t *testing.T) {
+	_, key := newTestAlertManager(t)
+	msg := newTestAlert(t, key, 1, time.Now().Add(time.Hour), nil)
+
+	// Append data a newer version could have added to the payload.  It is
+	// lost when the payload is serialized again.
+	msg.SerializedPayload = append(msg.SerializedPayload, 0x01)
+
+	relayMsg := relayableAlert(msg)
+	if relayMsg.Payload != nil {
+		t.Errorf("relayed alert has a deserialized payload")
+	}
+	if msg.Payload == nil {
+		t.Errorf("original alert lost its deserialized payload")
+	}
+	var buf bytes.Buffer
+	if err := relayMsg.BtcEncode(&buf, maxProtocolVersion); err != nil {
+		t.Fatalf("BtcEncode: %v", err)
+	}
+	var decoded wire.MsgAlert
+	if err := decoded.BtcDecode(&buf, maxProtocolVersion); err != nil {
+		t.Fatalf("BtcDecode: %v", err)
+	}
+	if !bytes.Equal(decoded.SerializedPayload, msg.SerializedPayload) {
+		t.Errorf("relayed payload %x, want %x",
+			decoded.SerializedPayload, msg.SerializedPayload)
+	}
+}
@@ -0,0 +1,33 @@
+// Copyright (c) 2015 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"testing"
+
+	"github.com/ppcsuite/ppcd/chaincfg"
+)
+
+// BenchmarkBlockSha performs a benchmark on hashing a block header for a range
+// of nonces by serializing and hashing the entire header for each nonce.
+func BenchmarkBlockSha(b *testing.B) {
+	header := chaincfg.MainNetParams.GenesisBlock.Header
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		header.Nonce = uint32(i)
+		header.BlockSha()
+	}
+}
+
+// BenchmarkHeaderHasher performs a benchmark on hashing a block header for a
+// range of nonces with the midstate based header hasher used by the CPU miner.
+func BenchmarkHeaderHasher(b *testing.B) {
+	header := chaincfg.MainNetParams.GenesisBlock.Header
+	hasher := newHeaderHasher(&header)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		hasher.hash(uint32(i))
+	}
+}
@@ -164,6 +164,13 @@ type BlockChain struct {
 	noCheckpoints       bool
 	nextCheckpoint      *chaincfg.Checkpoint
 	checkpointBlock     *btcutil.Block
+
+	// ppc: proof-of-stake kernels of main chain and orphan blocks used to
+	// reject blocks which reuse a kernel.
+	stakeSeen            *stakeSet
+	stakeSeenOrphan      *stakeSet
+	stakeRejected        uint64
+	stakeRejectedOrphans uint64
 }
 
 // DisableVerify provides a mechanism to disable transaction script validation
@@ -211,6 +218,16 @@ func (b *BlockChain) IsKnownOrphan(hash *wire.ShaHash) bool {
 	return false
 }
 
+// NumOrphans returns the number of orphan blocks currently held in memory.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) NumOrphans() int {
+	b.orphanLock.RLock()
+	defer b.orphanLock.RUnlock()
+
+	return len(b.orphans)
+}
+
 // GetOrphanRoot returns the head of the chain for the provided hash from the
 // map of orphan blocks.
 //
@@ -270,6 +287,9 @@ func (b *BlockChain) removeOrphanBlock(orphan *orphanBlock) {
 	if len(b.prevOrphans[*prevHash]) == 0 {
 		delete(b.prevOrphans, *prevHash)
 	}
+
+	// ppc: forget the proof-of-stake kernel of the orphan
+	b.ppcOrphanBlockRemoved(orphan.block)
 }
 
 // addOrphanBlock adds the passed block (which is already determined to be
@@ -392,7 +412,8 @@ func (b *BlockChain) GenerateInitialIndex() error {
 		start += int64(len(hashList))
 	}
 
-	return nil
+	// ppc: track the proof-of-stake kernels of the loaded blocks
+	return b.rebuildStakeSeen()
 }
 
 // loadBlockNode loads the block identified by hash from the block database,
@@ -788,6 +809,9 @@ func (b *BlockChain) connectBlock(node *blockNode, block *btcutil.Block) error {
 	// This node is now the end of the best chain.
 	b.bestChain = node
 
+	// ppc: track the proof-of-stake kernel of the block
+	b.ppcBlockConnected(block)
+
 	// Notify the caller that the block was connected to the main chain.
 	// The caller would typically want to react with actions such as
 	// updating wallets.
@@ -822,6 +846,9 @@ func (b *BlockChain) disconnectBlock(node *blockNode, block *btcutil.Block) erro
 	// This node's parent is now the end of the best chain.
 	b.bestChain = node.parent
 
+	// ppc: forget the proof-of-stake kernel of the block
+	b.ppcBlockDisconnected(block)
+
 	// Notify the caller that the block was disconnected from the main
 	// chain.  The caller would typically want to react with actions such as
 	// updating wallets.
@@ -879,6 +906,10 @@ func (b *BlockChain) reorganizeChain(detachNodes, attachNodes *list.List, flags
 	}
 
 	// Disconnect blocks from the main chain.
+	ntfnData := ReorganizationNtfnsData{
+		DetachedBlocks: make([]*btcutil.Block, 0, detachNodes.Len()),
+		AttachedBlocks: make([]*btcutil.Block, 0, attachNodes.Len()),
+	}
 	for e := detachNodes.Front(); e != nil; e = e.Next() {
 		n := e.Value.(*blockNode)
 		block, err := b.db.FetchBlockBySha(n.hash)
@@ -889,6 +920,7 @@ func (b *BlockChain) reorganizeChain(detachNodes, attachNodes *list.List, flags
 		if err != nil {
 			return err
 		}
+		ntfnData.DetachedBlocks = append(ntfnData.DetachedBlocks, block)
 	}
 
 	// Connect the new best chain blocks.
@@ -900,6 +932,7 @@ func (b *BlockChain) reorganizeChain(detachNodes, attachNodes *list.List, flags
 			return err
 		}
 		delete(b.blockCache, *n.hash)
+		ntfnData.AttachedBlocks = append(ntfnData.AttachedBlocks, block)
 	}
 
 	// Log the point where the chain forked.
@@ -915,6 +948,10 @@ func (b *BlockChain) reorganizeChain(detachNodes, attachNodes *list.List, flags
 	log.Infof("REORGANIZE: Old best chain head was %v", firstDetachNode.hash)
 	log.Infof("REORGANIZE: New best chain head is %v", lastAttachNode.hash)
 
+	// Notify the caller of the blocks which were disconnected and
+	// connected.
+	b.sendNotification(NTReorganization, &ntfnData)
+
 	return nil
 }
 
@@ -1117,6 +1154,8 @@ func New(db database.Db, params *chaincfg.Params, c NotificationCallback) *Block
 		orphans:             make(map[wire.ShaHash]*orphanBlock),
 		prevOrphans:         make(map[wire.ShaHash][]*orphanBlock),
 		blockCache:          make(map[wire.ShaHash]*btcutil.Block),
+		stakeSeen:           newStakeSet(maxStakeSeen),
+		stakeSeenOrphan:     newStakeSet(maxStakeSeenOrphan),
 	}
 	return &b
 }
@@ -118,3 +118,23 @@ func TODO_TestHaveBlock(t *testing.T) {
 		}
 	}
 }
+
+// TestNumOrphans ensures NumOrphans reports the number of orphan blocks.
+func TestNumOrphans(t *testing.T) {
+	chain := blockchain.New(nil, &chaincfg.MainNetParams, nil)
+	if numOrphans := chain.NumOrphans(); numOrphans != 0 {
+		t.Errorf("NumOrphans: got %d orphans, want 0", numOrphans)
+	}
+
+	orphan := Block100000
+	chain.TstAddOrphanBlock(btcutil.NewBlock(&orphan))
+	if numOrphans := chain.NumOrphans(); numOrphans != 1 {
+		t.Errorf("NumOrphans: got %d orphans, want 1", numOrphans)
+	}
+
+	orphan.Header.Nonce++
+	chain.TstAddOrphanBlock(btcutil.NewBlock(&orphan))
+	if numOrphans := chain.NumOrphans(); numOrphans != 2 {
+		t.Errorf("NumOrphans: got %d orphans, want 2", numOrphans)
+	}
+}
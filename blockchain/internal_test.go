@@ -17,6 +17,7 @@ import (
 	"time"
 
 	"github.com/ppcsuite/btcutil"
+	"github.com/ppcsuite/ppcd/wire"
 )
 
 /* Peercoin - now it's chaincfg.Params parameter
@@ -49,3 +50,45 @@ func TstSetMaxMedianTimeEntries(val int) {
 // TstCheckBlockScripts makes the internal checkBlockScripts function available
 // to the test package.
 var TstCheckBlockScripts = checkBlockScripts
+
+// TstCoinStakeMaxReward makes the internal coinStakeMaxReward function
+// available to the test package.
+var TstCoinStakeMaxReward = coinStakeMaxReward
+
+// TstAddOrphanBlock makes the internal addOrphanBlock function available to
+// the test package.
+func (b *BlockChain) TstAddOrphanBlock(block *btcutil.Block) {
+	b.addOrphanBlock(block)
+}
+
+// TstStakeSet makes the internal stakeSet type available to the test package.
+type TstStakeSet struct {
+	s *stakeSet
+}
+
+// TstNewStakeSet makes the internal newStakeSet function available to the
+// test package.
+func TstNewStakeSet(limit int) *TstStakeSet {
+	return &TstStakeSet{s: newStakeSet(limit)}
+}
+
+// Add adds the kernel made of the passed outpoint and time to the set.
+func (s *TstStakeSet) Add(outPoint wire.OutPoint, time int64) bool {
+	return s.s.add(Stake{outPoint, time})
+}
+
+// Contains returns whether the kernel made of the passed outpoint and time is
+// in the set.
+func (s *TstStakeSet) Contains(outPoint wire.OutPoint, time int64) bool {
+	return s.s.contains(Stake{outPoint, time})
+}
+
+// Remove removes the kernel made of the passed outpoint and time from the set.
+func (s *TstStakeSet) Remove(outPoint wire.OutPoint, time int64) {
+	s.s.remove(Stake{outPoint, time})
+}
+
+// Len returns the number of kernels in the set.
+func (s *TstStakeSet) Len() int {
+	return s.s.len()
+}
@@ -104,3 +104,35 @@ func TestMedianTime(t *testing.T) {
 		}
 	}
 }
+
+// TestMedianTimeWithClock ensures the medianTime implementation reads the local
+// time from the provided clock.
+func TestMedianTimeWithClock(t *testing.T) {
+	now := time.Unix(1400000000, 0)
+	filter := blockchain.NewMedianTimeWithClock(func() time.Time {
+		return now
+	})
+
+	if got := filter.AdjustedTime(); !got.Equal(now) {
+		t.Fatalf("AdjustedTime: unexpected result -- got %v, want %v",
+			got, now)
+	}
+
+	// Add enough samples for the median offset to be applied.
+	for i, offset := range []int64{-30, 10, 20, 30, 40} {
+		sample := now.Add(time.Duration(offset) * time.Second)
+		filter.AddTimeSample(strconv.Itoa(i), sample)
+	}
+	if got, want := filter.Offset(), 20*time.Second; got != want {
+		t.Fatalf("Offset: unexpected offset -- got %v, want %v", got,
+			want)
+	}
+
+	// Advancing the clock must advance the adjusted time accordingly.
+	now = now.Add(time.Hour)
+	want := now.Add(20 * time.Second)
+	if got := filter.AdjustedTime(); !got.Equal(want) {
+		t.Fatalf("AdjustedTime: unexpected result -- got %v, want %v",
+			got, want)
+	}
+}
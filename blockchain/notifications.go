@@ -6,6 +6,8 @@ package blockchain
 
 import (
 	"fmt"
+
+	"github.com/ppcsuite/btcutil"
 )
 
 // NotificationType represents the type of a notification message.
@@ -29,6 +31,11 @@ const (
 	// NTBlockDisconnected indicates the associated block was disconnected
 	// from the main chain.
 	NTBlockDisconnected
+
+	// NTReorganization indicates the main chain was reorganized.  It is
+	// sent after the NTBlockDisconnected and NTBlockConnected notifications
+	// of the blocks involved.
+	NTReorganization
 )
 
 // notificationTypeStrings is a map of notification types back to their constant
@@ -37,6 +44,7 @@ var notificationTypeStrings = map[NotificationType]string{
 	NTBlockAccepted:     "NTBlockAccepted",
 	NTBlockConnected:    "NTBlockConnected",
 	NTBlockDisconnected: "NTBlockDisconnected",
+	NTReorganization:    "NTReorganization",
 }
 
 // String returns the NotificationType in human-readable form.
@@ -53,11 +61,21 @@ func (n NotificationType) String() string {
 // 	- NTBlockAccepted:     *btcutil.Block
 // 	- NTBlockConnected:    *btcutil.Block
 // 	- NTBlockDisconnected: *btcutil.Block
+// 	- NTReorganization:    *ReorganizationNtfnsData
 type Notification struct {
 	Type NotificationType
 	Data interface{}
 }
 
+// ReorganizationNtfnsData is the data of a NTReorganization notification.
+// DetachedBlocks holds the blocks disconnected from the old best chain head
+// down to the fork point and AttachedBlocks the blocks connected from the fork
+// point up to the new best chain head.
+type ReorganizationNtfnsData struct {
+	DetachedBlocks []*btcutil.Block
+	AttachedBlocks []*btcutil.Block
+}
+
 // sendNotification sends a notification with the passed type and data if the
 // caller requested notifications by providing a callback function in the call
 // to New.
@@ -68,8 +68,6 @@ func getProofOfStakeFromBlock(block *btcutil.Block) Stake {
 	return Stake{}
 }
 
-var stakeSeen, stakeSeenOrphan = make(map[Stake]bool), make(map[Stake]bool)
-
 // getBlockNode try to obtain a node form the memory block chain and loads it
 // form the database in not found in memory.
 func (b *BlockChain) getBlockNode(hash *wire.ShaHash) (*blockNode, error) {
@@ -636,7 +634,7 @@ func ppcCheckTransactionInputs(tx *btcutil.Tx, txStore TxStore, blockChain *Bloc
 			return fmt.Errorf("unable to get coin age for coinstake: %v", err)
 		}
 		stakeReward := satoshiOut - satoshiIn
-		maxReward := getProofOfStakeReward(int64(coinAge)) - getMinFee(tx) + MinTxFee
+		maxReward := coinStakeMaxReward(tx, coinAge)
 		if stakeReward > maxReward {
 			str := fmt.Sprintf("%v stake reward value %v exceeded %v", tx.Sha(), stakeReward, maxReward)
 			return ruleError(ErrBadCoinstakeValue, str)
@@ -729,14 +727,15 @@ func (b *BlockChain) ppcProcessOrphan(block *btcutil.Block) error {
 		// Duplicate stake allowed only when there is orphan child block
 		sha := block.Sha()
 		stake := getProofOfStakeFromBlock(block)
-		_, seen := stakeSeen[stake]
+		seen := b.stakeSeenOrphan.contains(stake)
 		childs, hasChild := b.prevOrphans[*sha]
 		hasChild = hasChild && (len(childs) > 0)
 		if seen && !hasChild {
+			b.stakeRejectedOrphans++
 			str := fmt.Sprintf("duplicate proof-of-stake (%v) for orphan block %s", stake, sha)
 			return ruleError(ErrDuplicateStake, str)
 		}
-		stakeSeenOrphan[stake] = true
+		b.stakeSeenOrphan.add(stake)
 	}
 	// TODO(kac-:dup-stake)
 	// there is explicit Ask for block not handled now
@@ -746,7 +745,25 @@ func (b *BlockChain) ppcProcessOrphan(block *btcutil.Block) error {
 
 func (b *BlockChain) ppcOrphanBlockRemoved(block *btcutil.Block) {
 	// https://github.com/ppcoin/ppcoin/blob/v0.4.0ppc/src/main.cpp#L2078
-	delete(stakeSeenOrphan, getProofOfStakeFromBlock(block))
+	if block.IsProofOfStake() {
+		b.stakeSeenOrphan.remove(getProofOfStakeFromBlock(block))
+	}
+}
+
+// ppcBlockConnected tracks the proof-of-stake kernel of a block which was
+// connected to the main chain.
+func (b *BlockChain) ppcBlockConnected(block *btcutil.Block) {
+	if block.IsProofOfStake() {
+		b.stakeSeen.add(getProofOfStakeFromBlock(block))
+	}
+}
+
+// ppcBlockDisconnected forgets the proof-of-stake kernel of a block which was
+// disconnected from the main chain.
+func (b *BlockChain) ppcBlockDisconnected(block *btcutil.Block) {
+	if block.IsProofOfStake() {
+		b.stakeSeen.remove(getProofOfStakeFromBlock(block))
+	}
 }
 
 func (b *BlockChain) ppcProcessBlock(block *btcutil.Block, phase processPhase) error {
@@ -760,11 +777,12 @@ func (b *BlockChain) ppcProcessBlock(block *btcutil.Block, phase processPhase) e
 		if block.IsProofOfStake() {
 			sha := block.Sha()
 			stake := getProofOfStakeFromBlock(block)
-			_, seen := stakeSeen[stake]
+			seen := b.stakeSeen.contains(stake)
 			childs, hasChild := b.prevOrphans[*sha]
 			hasChild = hasChild && (len(childs) > 0)
 			if seen && !hasChild {
-				str := fmt.Sprintf("duplicate proof-of-stake (%v) for orphan block %s", stake, sha)
+				b.stakeRejected++
+				str := fmt.Sprintf("duplicate proof-of-stake (%v) for block %s", stake, sha)
 				return ruleError(ErrDuplicateStake, str)
 			}
 		}
@@ -799,6 +817,52 @@ func (b *BlockChain) GetKernelStakeModifier(hash *wire.ShaHash, timeSource Media
 	return stakeModifier, err
 }
 
+// CheckStakeKernelHash checks whether the given output of txPrev, which is
+// contained in the main chain block blockFrom, meets the proof-of-stake kernel
+// target for a coinstake with the given timestamp.  It returns the kernel hash
+// along with whether or not it meets the target.
+// This function is NOT safe for concurrent access. Use blockmanager.
+func (b *BlockChain) CheckStakeKernelHash(nBits uint32, blockFrom *btcutil.Block,
+	txPrev *btcutil.Tx, prevout *wire.OutPoint, nTimeTx int64,
+	timeSource MedianTimeSource) (*wire.ShaHash, bool, error) {
+
+	nTxPrevOffset := blockFrom.Meta().TxOffsets[txPrev.Index()]
+	return b.checkStakeKernelHash(nBits, blockFrom, nTxPrevOffset, txPrev,
+		prevout, nTimeTx, timeSource, true)
+}
+
+// CheckCoinStake checks whether the given coinstake transaction meets the
+// proof-of-stake kernel target nBits and is properly signed.  It returns the
+// maximum reward the coinstake may claim, which is the proof-of-stake reward
+// for the coin age it spends less its minimum fee beyond MinTxFee.
+// This function is NOT safe for concurrent access. Use blockmanager.
+func (b *BlockChain) CheckCoinStake(tx *btcutil.Tx, nBits uint32,
+	timeSource MedianTimeSource) (int64, error) {
+
+	if _, err := b.checkTxProofOfStake(tx, timeSource, nBits); err != nil {
+		return 0, err
+	}
+
+	txStore, err := b.FetchTransactionStore(tx)
+	if err != nil {
+		return 0, err
+	}
+	coinAge, err := b.getCoinAgeTx(tx, txStore)
+	if err != nil {
+		return 0, err
+	}
+
+	return coinStakeMaxReward(tx, coinAge), nil
+}
+
+// coinStakeMaxReward returns the maximum reward the passed coinstake, which
+// spends the passed coin age in coin-days, may claim.  It is the proof-of-stake
+// reward for the coin age less the minimum fee of the coinstake beyond
+// MinTxFee, so only coinstakes of at least 1000 bytes pay a fee.
+func coinStakeMaxReward(tx *btcutil.Tx, coinAge uint64) int64 {
+	return getProofOfStakeReward(int64(coinAge)) - getMinFee(tx) + MinTxFee
+}
+
 // WantedOrphan finds block wanted by given orphan block
 //
 // This function is safe for concurrent access.
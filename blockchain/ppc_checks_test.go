@@ -2,6 +2,7 @@ package blockchain_test
 
 import (
 	"bytes"
+	"github.com/ppcsuite/btcutil"
 	"github.com/ppcsuite/ppcd/blockchain"
 	"github.com/ppcsuite/ppcd/chaincfg"
 	"github.com/ppcsuite/ppcd/wire"
@@ -30,3 +31,65 @@ func TestCheckBlockSignature(t *testing.T) {
 		t.Error("good block signature, invalid expected")
 	}
 }
+
+// TestCheckCoinStakeNotCoinStake ensures CheckCoinStake rejects transactions
+// which are not coinstakes.
+func TestCheckCoinStakeNotCoinStake(t *testing.T) {
+	chain, teardownFunc, err := chainSetup("checkcoinstake")
+	if err != nil {
+		t.Errorf("Failed to setup chain instance: %v", err)
+		return
+	}
+	defer teardownFunc()
+
+	tx := btcutil.NewTx(Block100000.Transactions[0])
+	_, err = chain.CheckCoinStake(tx, Block100000.Header.Bits,
+		blockchain.NewMedianTime())
+	if err == nil {
+		t.Error("CheckCoinStake: expected error for non-coinstake")
+	}
+}
+
+// TestCoinStakeMaxReward ensures the maximum reward of a coinstake is the
+// proof-of-stake reward of 1 cent per coin-year of the coin age it spends, less
+// the minimum fee of coinstakes of 1000 bytes or more.
+func TestCoinStakeMaxReward(t *testing.T) {
+	// newCoinStake returns a coinstake with an output script of the passed
+	// size.
+	newCoinStake := func(scriptSize int) *btcutil.Tx {
+		msgTx := wire.NewMsgTx()
+		msgTx.AddTxIn(wire.NewTxIn(&wire.OutPoint{}, nil))
+		msgTx.AddTxOut(wire.NewTxOut(0, nil))
+		msgTx.AddTxOut(wire.NewTxOut(0, make([]byte, scriptSize)))
+		return btcutil.NewTx(msgTx)
+	}
+	small := newCoinStake(100)
+	large := newCoinStake(1000)
+	if size := large.MsgTx().SerializeSize(); size < 1000 || size >= 2000 {
+		t.Fatalf("large coinstake has %d bytes", size)
+	}
+
+	tests := []struct {
+		name    string
+		tx      *btcutil.Tx
+		coinAge uint64
+		want    int64
+	}{
+		{"no coin age", small, 0, 0},
+		{"less than a coin-year", small, 365, 0},
+		{"one coin-year", small, 366, blockchain.Cent},
+		{"ten coin-years", small, 3653, 10 * blockchain.Cent},
+		{"rounded down", small, 10000, 27 * blockchain.Cent},
+		{"large coinstake", large, 3653,
+			10*blockchain.Cent - blockchain.MinTxFee},
+		{"large coinstake without reward", large, 0,
+			-blockchain.MinTxFee},
+	}
+	for _, test := range tests {
+		got := blockchain.TstCoinStakeMaxReward(test.tx, test.coinAge)
+		if got != test.want {
+			t.Errorf("%s: got %d, want %d", test.name, got,
+				test.want)
+		}
+	}
+}
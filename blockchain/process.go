@@ -92,9 +92,6 @@ func (b *BlockChain) processOrphans(hash *wire.ShaHash, timeSource MedianTimeSou
 			b.removeOrphanBlock(orphan)
 			i--
 
-			// ppc: processing
-			b.ppcOrphanBlockRemoved(orphan.block)
-
 			// Potentially accept the block into the block chain.
 			err := b.maybeAcceptBlock(orphan.block, timeSource, flags)
 			if err != nil {
@@ -8,6 +8,8 @@ import (
 	"fmt"
 	"math"
 	"runtime"
+	"sync/atomic"
+	"time"
 
 	"github.com/ppcsuite/btcutil"
 	"github.com/ppcsuite/ppcd/txscript"
@@ -21,6 +23,25 @@ type txValidateItem struct {
 	tx        *btcutil.Tx
 }
 
+// The number of transaction inputs validated by txValidator and the total time
+// spent validating them, in nanoseconds, since the process started.  They must
+// be accessed atomically.
+var (
+	scriptValInputs uint64
+	scriptValNanos  uint64
+)
+
+// ScriptValidationStats returns the number of transaction inputs whose scripts
+// were validated and the total time spent validating them since the process
+// started.
+//
+// This function is safe for concurrent access.
+func ScriptValidationStats() (uint64, time.Duration) {
+	numInputs := atomic.LoadUint64(&scriptValInputs)
+	nanos := atomic.LoadUint64(&scriptValNanos)
+	return numInputs, time.Duration(nanos)
+}
+
 // txValidator provides a type which asynchronously validates transaction
 // inputs.  It provides several channels for communication and a processing
 // function that is intended to be in run multiple goroutines.
@@ -126,6 +147,13 @@ func (v *txValidator) Validate(items []*txValidateItem) error {
 		return nil
 	}
 
+	// Account the validation time in the script validation statistics.
+	start := time.Now()
+	defer func() {
+		atomic.AddUint64(&scriptValInputs, uint64(len(items)))
+		atomic.AddUint64(&scriptValNanos, uint64(time.Since(start)))
+	}()
+
 	// Limit the number of goroutines to do script validation based on the
 	// number of processor cores.  This help ensure the system stays
 	// reasonably responsive under heavy load.
@@ -37,10 +37,18 @@ func TestCheckBlockScripts(t *testing.T) {
 	}
 
 	scriptFlags := txscript.ScriptBip16
+	inputsBefore, _ := blockchain.ScriptValidationStats()
 	err = blockchain.TstCheckBlockScripts(blocks[0], txStore, scriptFlags)
 	if err != nil {
 		t.Errorf("Transaction script validation failed: %v\n",
 			err)
 		return
 	}
+
+	// The validated inputs must be accounted in the statistics.
+	inputsAfter, _ := blockchain.ScriptValidationStats()
+	if inputsAfter <= inputsBefore {
+		t.Errorf("ScriptValidationStats: validated inputs not "+
+			"accounted - got %d, was %d", inputsAfter, inputsBefore)
+	}
 }
@@ -0,0 +1,130 @@
+// Copyright (c) 2015 PPCD developers.
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"container/list"
+)
+
+const (
+	// maxStakeSeen is the maximum number of proof-of-stake kernels of main
+	// chain blocks which are tracked in order to reject blocks reusing
+	// them.  Once the limit is reached, the kernel of the oldest tracked
+	// block is forgotten first.
+	maxStakeSeen = int(minMemoryNodes)
+
+	// maxStakeSeenOrphan is the maximum number of proof-of-stake kernels of
+	// orphan blocks which are tracked.  It matches the size of the orphan
+	// pool since kernels are forgotten along with their orphan block.
+	maxStakeSeenOrphan = maxOrphanBlocks
+)
+
+// stakeSet is a bounded set of proof-of-stake kernels.  Kernels are evicted in
+// the order they were added once the set has reached its limit.
+type stakeSet struct {
+	limit  int
+	stakes map[Stake]*list.Element
+	order  *list.List
+}
+
+// newStakeSet returns a new stake set which holds at most limit kernels.
+func newStakeSet(limit int) *stakeSet {
+	return &stakeSet{
+		limit:  limit,
+		stakes: make(map[Stake]*list.Element),
+		order:  list.New(),
+	}
+}
+
+// contains returns whether or not the passed kernel is in the set.
+func (s *stakeSet) contains(stake Stake) bool {
+	_, ok := s.stakes[stake]
+	return ok
+}
+
+// add adds the passed kernel to the set, evicting the oldest kernel if the set
+// is full.  It returns whether or not the kernel was newly added.
+func (s *stakeSet) add(stake Stake) bool {
+	if s.contains(stake) {
+		return false
+	}
+	if s.order.Len() >= s.limit {
+		oldest := s.order.Front()
+		delete(s.stakes, oldest.Value.(Stake))
+		s.order.Remove(oldest)
+	}
+	s.stakes[stake] = s.order.PushBack(stake)
+	return true
+}
+
+// remove removes the passed kernel from the set if it exists.
+func (s *stakeSet) remove(stake Stake) {
+	if el, ok := s.stakes[stake]; ok {
+		delete(s.stakes, stake)
+		s.order.Remove(el)
+	}
+}
+
+// len returns the number of kernels in the set.
+func (s *stakeSet) len() int {
+	return s.order.Len()
+}
+
+// StakeSeenInfo houses statistics about the proof-of-stake kernels tracked by
+// the chain to protect against blocks which reuse a kernel.
+type StakeSeenInfo struct {
+	// MainChain and MaxMainChain are the current and maximum number of
+	// tracked kernels of main chain blocks.
+	MainChain    int
+	MaxMainChain int
+
+	// Orphans and MaxOrphans are the current and maximum number of
+	// tracked kernels of orphan blocks.
+	Orphans    int
+	MaxOrphans int
+
+	// Rejected and RejectedOrphans are the number of blocks and orphan
+	// blocks which were rejected for reusing a tracked kernel.
+	Rejected        uint64
+	RejectedOrphans uint64
+}
+
+// rebuildStakeSeen populates the kernels of main chain blocks from the
+// proof-of-stake blocks at the end of the main chain which are in memory.
+func (b *BlockChain) rebuildStakeSeen() error {
+	var nodes []*blockNode
+	for node := b.bestChain; node != nil && len(nodes) < maxStakeSeen; node = node.parent {
+		if isProofOfStake(node.meta) {
+			nodes = append(nodes, node)
+		}
+	}
+
+	// Add the kernels from oldest to newest so the oldest are evicted
+	// first.
+	for i := len(nodes) - 1; i >= 0; i-- {
+		block, err := b.db.FetchBlockBySha(nodes[i].hash)
+		if err != nil {
+			return err
+		}
+		b.stakeSeen.add(getProofOfStakeFromBlock(block))
+	}
+	log.Debugf("Loaded %d proof-of-stake kernels", b.stakeSeen.len())
+	return nil
+}
+
+// StakeSeenInfo returns statistics about the proof-of-stake kernels tracked by
+// the chain.
+//
+// This function is NOT safe for concurrent access.
+func (b *BlockChain) StakeSeenInfo() *StakeSeenInfo {
+	return &StakeSeenInfo{
+		MainChain:       b.stakeSeen.len(),
+		MaxMainChain:    maxStakeSeen,
+		Orphans:         b.stakeSeenOrphan.len(),
+		MaxOrphans:      maxStakeSeenOrphan,
+		Rejected:        b.stakeRejected,
+		RejectedOrphans: b.stakeRejectedOrphans,
+	}
+}
@@ -0,0 +1,60 @@
+// Copyright (c) 2015 PPCD developers.
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain_test
+
+import (
+	"testing"
+
+	"github.com/ppcsuite/ppcd/blockchain"
+	"github.com/ppcsuite/ppcd/wire"
+)
+
+// TestStakeSet tests the bounded proof-of-stake kernel set used to reject
+// blocks which reuse a kernel.
+func TestStakeSet(t *testing.T) {
+	outPoint := func(index uint32) wire.OutPoint {
+		return wire.OutPoint{Hash: wire.ShaHash{0x01}, Index: index}
+	}
+
+	set := blockchain.TstNewStakeSet(3)
+	for i := uint32(0); i < 3; i++ {
+		if !set.Add(outPoint(i), 1000) {
+			t.Fatalf("Add #%d: kernel not added", i)
+		}
+	}
+
+	// Adding a kernel which is already tracked must not change the set.
+	if set.Add(outPoint(0), 1000) {
+		t.Fatalf("Add: duplicate kernel added")
+	}
+	if set.Len() != 3 {
+		t.Fatalf("Len: got %d, want %d", set.Len(), 3)
+	}
+
+	// The same outpoint with a different time is a different kernel.
+	if set.Contains(outPoint(0), 1001) {
+		t.Fatalf("Contains: unexpected kernel with different time")
+	}
+
+	// Adding a kernel to a full set must evict the oldest one.
+	set.Add(outPoint(3), 1000)
+	if set.Contains(outPoint(0), 1000) {
+		t.Fatalf("Contains: oldest kernel was not evicted")
+	}
+	for i := uint32(1); i < 4; i++ {
+		if !set.Contains(outPoint(i), 1000) {
+			t.Fatalf("Contains #%d: kernel missing", i)
+		}
+	}
+
+	// Removed kernels must no longer be tracked.
+	set.Remove(outPoint(2), 1000)
+	if set.Contains(outPoint(2), 1000) {
+		t.Fatalf("Contains: removed kernel still tracked")
+	}
+	if set.Len() != 2 {
+		t.Fatalf("Len: got %d, want %d", set.Len(), 2)
+	}
+}
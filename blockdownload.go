@@ -0,0 +1,500 @@
+// Copyright (c) 2015 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"container/list"
+	"sort"
+	"time"
+
+	"github.com/ppcsuite/ppcd/btcjson"
+	"github.com/ppcsuite/ppcd/wire"
+)
+
+const (
+	// minBlockFetchBatch is the minimum number of free request slots a
+	// download peer must have before more blocks are requested from it
+	// while in headers-first mode.  This keeps getdata messages from being
+	// sent for every single block that is received.
+	minBlockFetchBatch = 10
+
+	// blockDownloadWindow is the maximum number of blocks beyond the next
+	// block to be processed that may be requested while in headers-first
+	// mode.  Blocks arriving out of order are held in memory until all of
+	// the blocks before them have been processed, so this bounds the
+	// number of blocks that can be waiting on a slow peer.
+	blockDownloadWindow = 1024
+
+	// blockStallTimeout is the amount of time a download peer with
+	// outstanding block requests may go without delivering any block
+	// before it is considered stalled and its requests are reassigned.
+	blockStallTimeout = time.Second * 30
+
+	// blockHeadStallTimeout is the amount of time the next block to be
+	// processed may be outstanding while the download window is exhausted
+	// before the peer it was requested from is considered stalled.
+	blockHeadStallTimeout = time.Second * 5
+
+	// blockStallCheckInterval is the interval at which download peers are
+	// checked for stalls.
+	blockStallCheckInterval = time.Second * 5
+
+	// blockStallCooldown is the amount of time a download peer which
+	// stalled is not asked for more blocks so that its reassigned requests
+	// go to the other download peers.
+	blockStallCooldown = time.Second * 30
+
+	// maxBlockStalls is the number of times a download peer may stall
+	// before it is disconnected.
+	maxBlockStalls = 3
+)
+
+// inFlightBlock houses information about a block that has been requested from
+// a download peer while in headers-first mode.
+type inFlightBlock struct {
+	node      *headerNode
+	peer      *peer
+	requested time.Time
+}
+
+// downloadPeer houses the block download state for a single peer.
+type downloadPeer struct {
+	peer         *peer
+	inFlight     int
+	received     uint64
+	stalls       int32
+	lastProgress time.Time
+	cooldownEnd  time.Time
+}
+
+// blockDownloader tracks the state needed to download the blocks described by
+// the header list from several peers in parallel while in headers-first mode.
+// It is owned by the block handler goroutine and therefore is not safe for
+// concurrent access.
+type blockDownloader struct {
+	peers    map[*peer]*downloadPeer
+	inFlight map[wire.ShaHash]*inFlightBlock
+	reassign *list.List
+	buffered map[wire.ShaHash]*blockMsg
+
+	// The following fields are statistics which are reported via the
+	// getblockdownloadinfo RPC.
+	numRequested  uint64
+	numReceived   uint64
+	numDuplicates uint64
+	numStalls     uint64
+	numReassigned uint64
+}
+
+// newBlockDownloader returns a new empty block downloader.
+func newBlockDownloader() *blockDownloader {
+	return &blockDownloader{
+		peers:    make(map[*peer]*downloadPeer),
+		inFlight: make(map[wire.ShaHash]*inFlightBlock),
+		reassign: list.New(),
+		buffered: make(map[wire.ShaHash]*blockMsg),
+	}
+}
+
+// downloadPeerResultsByID provides sorting of download peer results by peer
+// id so the results returned over RPC are in a stable order.
+type downloadPeerResultsByID []btcjson.BlockDownloadPeerResult
+
+// Len returns the number of results.  It is part of the sort.Interface.
+func (s downloadPeerResultsByID) Len() int { return len(s) }
+
+// Less returns whether the result with index i should sort before the result
+// with index j.  It is part of the sort.Interface.
+func (s downloadPeerResultsByID) Less(i, j int) bool { return s[i].ID < s[j].ID }
+
+// Swap swaps the results at the passed indices.  It is part of the
+// sort.Interface.
+func (s downloadPeerResultsByID) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+
+// getBlockDownloadInfoMsg is a message type to be sent across the message
+// channel for requesting the current block download statistics.
+type getBlockDownloadInfoMsg struct {
+	reply chan *btcjson.GetBlockDownloadInfoResult
+}
+
+// addDownloadPeer adds the passed peer to the set of peers blocks are
+// downloaded from while in headers-first mode.  Only outbound peers are used
+// since they are much harder for an attacker to control.  The sync peer is
+// always added regardless of its direction.
+func (b *blockManager) addDownloadPeer(p *peer) {
+	if p.inbound && p != b.syncPeer {
+		return
+	}
+	if _, exists := b.download.peers[p]; exists {
+		return
+	}
+	b.download.peers[p] = &downloadPeer{peer: p}
+}
+
+// removeDownloadPeer removes the passed peer from the set of download peers
+// and queues any blocks that were still outstanding from it to be requested
+// from the remaining download peers.
+func (b *blockManager) removeDownloadPeer(p *peer) {
+	if _, exists := b.download.peers[p]; !exists {
+		return
+	}
+	b.reassignPeerBlocks(p)
+	delete(b.download.peers, p)
+}
+
+// resetDownloadState discards all of the block download state other than the
+// set of download peers.  It is used when the headers-first state is reset
+// such as when the sync peer disconnects.
+func (b *blockManager) resetDownloadState() {
+	for sha, ifb := range b.download.inFlight {
+		delete(b.requestedBlocks, sha)
+		if dp, ok := b.download.peers[ifb.peer]; ok {
+			dp.inFlight--
+		}
+	}
+	b.download.inFlight = make(map[wire.ShaHash]*inFlightBlock)
+	b.download.buffered = make(map[wire.ShaHash]*blockMsg)
+	b.download.reassign.Init()
+}
+
+// reassignPeerBlocks queues all blocks which are outstanding from the passed
+// peer to be requested from another download peer.  The blocks are left in
+// the request map of the peer so that a late delivery is not treated as
+// unrequested.
+func (b *blockManager) reassignPeerBlocks(p *peer) {
+	for sha, ifb := range b.download.inFlight {
+		if ifb.peer != p {
+			continue
+		}
+		delete(b.download.inFlight, sha)
+		delete(b.requestedBlocks, sha)
+		b.download.reassign.PushBack(ifb.node)
+		b.download.numReassigned++
+	}
+	if dp, ok := b.download.peers[p]; ok {
+		dp.inFlight = 0
+	}
+}
+
+// isDownloadCandidate returns whether or not the passed download peer may be
+// asked for more blocks.  Peers which recently stalled are not candidates.
+// Otherwise, the sync peer is always a candidate while other peers must have
+// announced a height at least as high as the checkpoint the headers are being
+// downloaded up to.
+func (b *blockManager) isDownloadCandidate(dp *downloadPeer) bool {
+	if !dp.peer.Connected() || time.Now().Before(dp.cooldownEnd) {
+		return false
+	}
+	if dp.peer == b.syncPeer {
+		return true
+	}
+	if b.nextCheckpoint == nil {
+		return false
+	}
+	return int64(dp.peer.lastBlock) >= b.nextCheckpoint.Height
+}
+
+// nextBlockToFetch returns the next header node to request the block for.
+// Blocks that have been reassigned due to a stall or a lost peer take
+// priority over new ones.  Nodes beyond the passed window height are not
+// returned.  Nil is returned when there is nothing left to request.
+func (b *blockManager) nextBlockToFetch(windowHeight int64) *headerNode {
+	if e := b.download.reassign.Front(); e != nil {
+		return b.download.reassign.Remove(e).(*headerNode)
+	}
+
+	for b.startHeader != nil {
+		node, ok := b.startHeader.Value.(*headerNode)
+		if !ok {
+			bmgrLog.Warn("Header list node type is not a headerNode")
+			b.startHeader = b.startHeader.Next()
+			continue
+		}
+		if node.height > windowHeight {
+			return nil
+		}
+		b.startHeader = b.startHeader.Next()
+		return node
+	}
+	return nil
+}
+
+// isBlockPending returns whether or not the block for the passed hash is
+// already outstanding, waiting to be processed, or known to the chain and
+// therefore must not be requested again.
+func (b *blockManager) isBlockPending(sha *wire.ShaHash) bool {
+	if _, ok := b.download.inFlight[*sha]; ok {
+		return true
+	}
+	if _, ok := b.download.buffered[*sha]; ok {
+		return true
+	}
+	iv := wire.NewInvVect(wire.InvTypeBlock, sha)
+	haveInv, err := b.haveInventory(iv)
+	if err != nil {
+		bmgrLog.Warnf("Unexpected failure when checking for "+
+			"existing inventory during header block fetch: %v", err)
+	}
+	return haveInv
+}
+
+// fetchHeaderBlocks creates and sends requests for the next blocks to be
+// downloaded based on the current list of headers.  The requests are spread
+// across all of the download peers which have free request slots so that a
+// single slow peer does not limit the download speed.
+func (b *blockManager) fetchHeaderBlocks() {
+	// Nothing to do if there is no front header to measure the download
+	// window from.
+	frontEl := b.headerList.Front()
+	if frontEl == nil {
+		return
+	}
+	windowHeight := frontEl.Value.(*headerNode).height + blockDownloadWindow
+
+	for _, dp := range b.download.peers {
+		if b.startHeader == nil && b.download.reassign.Len() == 0 {
+			break
+		}
+		if !b.isDownloadCandidate(dp) {
+			continue
+		}
+
+		// Only request more blocks from the peer when enough request
+		// slots are free to make sending the request worthwhile.
+		capacity := cfg.MaxBlocksInFlight - dp.inFlight
+		if capacity <= 0 || (dp.inFlight > 0 &&
+			capacity < minBlockFetchBatch) {
+			continue
+		}
+
+		// Build up a getdata request for as many blocks as the peer
+		// has free slots for.
+		now := time.Now()
+		gdmsg := wire.NewMsgGetDataSizeHint(uint(capacity))
+		for len(gdmsg.InvList) < capacity {
+			node := b.nextBlockToFetch(windowHeight)
+			if node == nil {
+				break
+			}
+			if b.isBlockPending(node.sha) {
+				continue
+			}
+
+			b.requestedBlocks[*node.sha] = struct{}{}
+			dp.peer.requestedBlocks[*node.sha] = struct{}{}
+			b.download.inFlight[*node.sha] = &inFlightBlock{
+				node:      node,
+				peer:      dp.peer,
+				requested: now,
+			}
+			gdmsg.AddInvVect(wire.NewInvVect(wire.InvTypeBlock,
+				node.sha))
+		}
+		if len(gdmsg.InvList) == 0 {
+			break
+		}
+
+		if dp.inFlight == 0 {
+			dp.lastProgress = now
+		}
+		dp.inFlight += len(gdmsg.InvList)
+		b.download.numRequested += uint64(len(gdmsg.InvList))
+		dp.peer.QueueMessage(gdmsg, nil)
+	}
+}
+
+// receiveHeaderBlock records the receipt of a block while in headers-first
+// mode.  It returns whether or not the block should be processed right away.
+// Since blocks are downloaded from several peers in parallel, they can arrive
+// ahead of the blocks before them.  Such blocks are buffered until they are
+// next in line so they can still be added with less validation.  Duplicate
+// deliveries of blocks that were reassigned to another peer are dropped.
+func (b *blockManager) receiveHeaderBlock(bmsg *blockMsg) bool {
+	blockSha := bmsg.block.Sha()
+	delete(bmsg.peer.requestedBlocks, *blockSha)
+	if dp, ok := b.download.peers[bmsg.peer]; ok {
+		dp.received++
+		dp.lastProgress = time.Now()
+	}
+
+	// Look up the header node for the block.  Blocks which are no longer
+	// in flight either were reassigned after a stall or were not
+	// requested as a part of the header list at all.
+	var node *headerNode
+	if ifb, ok := b.download.inFlight[*blockSha]; ok {
+		node = ifb.node
+		delete(b.download.inFlight, *blockSha)
+		delete(b.requestedBlocks, *blockSha)
+		if dp, ok := b.download.peers[ifb.peer]; ok {
+			dp.inFlight--
+		}
+		b.download.numReceived++
+	} else {
+		if b.isBlockPending(blockSha) {
+			b.download.numDuplicates++
+			bmgrLog.Debugf("Ignoring duplicate block %v from %s",
+				blockSha, bmsg.peer)
+			return false
+		}
+		for e := b.download.reassign.Front(); e != nil; e = e.Next() {
+			n := e.Value.(*headerNode)
+			if n.sha.IsEqual(blockSha) {
+				node = n
+				b.download.reassign.Remove(e)
+				b.download.numReceived++
+				break
+			}
+		}
+	}
+
+	// Process the block now if it is not part of the header list or is
+	// the next block in line.
+	if node == nil {
+		return true
+	}
+	frontEl := b.headerList.Front()
+	if frontEl == nil || frontEl.Value.(*headerNode).sha.IsEqual(blockSha) {
+		return true
+	}
+
+	b.download.buffered[*blockSha] = bmsg
+	return false
+}
+
+// nextBufferedBlock removes and returns the buffered block which is next in
+// line to be processed.  Nil is returned when that block has not been
+// received yet or when no longer in headers-first mode.
+func (b *blockManager) nextBufferedBlock() *blockMsg {
+	if !b.headersFirstMode {
+		return nil
+	}
+	frontEl := b.headerList.Front()
+	if frontEl == nil {
+		return nil
+	}
+	sha := frontEl.Value.(*headerNode).sha
+	bmsg, ok := b.download.buffered[*sha]
+	if !ok {
+		return nil
+	}
+	delete(b.download.buffered, *sha)
+	return bmsg
+}
+
+// stalledPeers returns the download peers which are considered stalled as of
+// the passed time.
+func (b *blockManager) stalledPeers(now time.Time) map[*peer]struct{} {
+	stalled := make(map[*peer]struct{})
+	for _, dp := range b.download.peers {
+		if dp.inFlight > 0 && now.Sub(dp.lastProgress) > blockStallTimeout {
+			stalled[dp.peer] = struct{}{}
+		}
+	}
+
+	// The next block to be processed holds up every block after it, so
+	// when nothing else can be requested because the download window is
+	// exhausted, the peer it was requested from is considered stalled
+	// much sooner.
+	frontEl := b.headerList.Front()
+	if frontEl != nil && b.download.reassign.Len() == 0 {
+		front := frontEl.Value.(*headerNode)
+		windowFull := b.startHeader == nil ||
+			b.startHeader.Value.(*headerNode).height >
+				front.height+blockDownloadWindow
+		ifb, ok := b.download.inFlight[*front.sha]
+		if windowFull && ok && len(b.download.peers) > 1 &&
+			now.Sub(ifb.requested) > blockHeadStallTimeout {
+
+			stalled[ifb.peer] = struct{}{}
+		}
+	}
+	return stalled
+}
+
+// checkBlockStalls looks for download peers which have stopped delivering the
+// blocks requested from them and reassigns their outstanding requests to the
+// other download peers.  Peers which repeatedly stall are disconnected.
+func (b *blockManager) checkBlockStalls() {
+	if !b.headersFirstMode || len(b.download.inFlight) == 0 {
+		return
+	}
+
+	now := time.Now()
+	stalled := b.stalledPeers(now)
+	if len(stalled) == 0 {
+		return
+	}
+
+	for p := range stalled {
+		dp := b.download.peers[p]
+		dp.stalls++
+		b.download.numStalls++
+		b.reassignPeerBlocks(p)
+		if dp.stalls >= maxBlockStalls && p != b.syncPeer {
+			bmgrLog.Infof("Block download from peer %s stalled %d "+
+				"times -- disconnecting", p, dp.stalls)
+			p.Disconnect()
+			continue
+		}
+		bmgrLog.Debugf("Block download from peer %s stalled -- "+
+			"reassigning outstanding requests", p)
+		// Give the peer a fresh start so it is not immediately
+		// considered stalled again once it is asked for more blocks.
+		// Unless it is the only download peer, it is also not asked
+		// for more blocks for a while so the reassigned requests are
+		// not simply sent back to it.
+		dp.lastProgress = now
+		if len(b.download.peers) > 1 {
+			dp.cooldownEnd = now.Add(blockStallCooldown)
+		}
+	}
+	b.fetchHeaderBlocks()
+}
+
+// blockDownloadInfo returns the current block download statistics.
+func (b *blockManager) blockDownloadInfo() *btcjson.GetBlockDownloadInfoResult {
+	info := &btcjson.GetBlockDownloadInfoResult{
+		HeadersFirst:       b.headersFirstMode,
+		MaxInFlightPerPeer: int32(cfg.MaxBlocksInFlight),
+		InFlight:           int32(len(b.download.inFlight)),
+		Buffered:           int32(len(b.download.buffered)),
+		Reassigning:        int32(b.download.reassign.Len()),
+		Requested:          b.download.numRequested,
+		Received:           b.download.numReceived,
+		Duplicates:         b.download.numDuplicates,
+		Stalls:             b.download.numStalls,
+		Reassigned:         b.download.numReassigned,
+		Peers:              make([]btcjson.BlockDownloadPeerResult, 0, len(b.download.peers)),
+	}
+	if b.syncPeer != nil {
+		info.SyncPeer = b.syncPeer.addr
+	}
+	for _, dp := range b.download.peers {
+		var lastProgress int64
+		if !dp.lastProgress.IsZero() {
+			lastProgress = dp.lastProgress.Unix()
+		}
+		info.Peers = append(info.Peers, btcjson.BlockDownloadPeerResult{
+			ID:           dp.peer.id,
+			Addr:         dp.peer.addr,
+			InFlight:     int32(dp.inFlight),
+			Received:     dp.received,
+			Stalls:       dp.stalls,
+			LastProgress: lastProgress,
+		})
+	}
+	sort.Sort(downloadPeerResultsByID(info.Peers))
+	return info
+}
+
+// BlockDownloadInfo returns statistics about the blocks being downloaded in
+// parallel from the download peers.
+//
+// This function is safe for concurrent access.
+func (b *blockManager) BlockDownloadInfo() *btcjson.GetBlockDownloadInfoResult {
+	reply := make(chan *btcjson.GetBlockDownloadInfoResult)
+	b.msgChan <- getBlockDownloadInfoMsg{reply: reply}
+	return <-reply
+}
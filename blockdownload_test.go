@@ -0,0 +1,223 @@
+// Copyright (c) 2015 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"container/list"
+	"testing"
+	"time"
+
+	"github.com/ppcsuite/btcutil"
+	"github.com/ppcsuite/ppcd/wire"
+)
+
+// newTestDownload returns a block manager in headers-first mode whose header
+// list holds the passed number of blocks, starting at height 1, along with the
+// blocks themselves.  The start header points to the first header.
+func newTestDownload(numBlocks int) (*blockManager, []*btcutil.Block) {
+	b := &blockManager{
+		requestedBlocks:  make(map[wire.ShaHash]struct{}),
+		headersFirstMode: true,
+		headerList:       list.New(),
+		download:         newBlockDownloader(),
+	}
+	blocks := make([]*btcutil.Block, 0, numBlocks)
+	for i := 0; i < numBlocks; i++ {
+		msgBlock := wire.MsgBlock{Header: wire.BlockHeader{
+			Nonce: uint32(i),
+		}}
+		block := btcutil.NewBlock(&msgBlock)
+		blocks = append(blocks, block)
+		b.headerList.PushBack(&headerNode{
+			height: int64(i + 1),
+			sha:    block.Sha(),
+		})
+	}
+	b.startHeader = b.headerList.Front()
+	return b, blocks
+}
+
+// newTestDownloadPeer adds a new connected download peer to the passed block
+// manager and returns it.
+func newTestDownloadPeer(b *blockManager) *downloadPeer {
+	p := &peer{
+		connected:       1,
+		requestedBlocks: make(map[wire.ShaHash]struct{}),
+	}
+	dp := &downloadPeer{peer: p}
+	b.download.peers[p] = dp
+	return dp
+}
+
+// requestTestBlock marks the block of the passed header node as requested from
+// the passed download peer at the passed time.
+func requestTestBlock(b *blockManager, dp *downloadPeer, node *headerNode,
+	requested time.Time) {
+
+	b.requestedBlocks[*node.sha] = struct{}{}
+	dp.peer.requestedBlocks[*node.sha] = struct{}{}
+	b.download.inFlight[*node.sha] = &inFlightBlock{
+		node:      node,
+		peer:      dp.peer,
+		requested: requested,
+	}
+	dp.inFlight++
+}
+
+// TestNextBlockToFetch ensures the next block to request is chosen in order,
+// with reassigned blocks first, and that the download window is respected.
+func TestNextBlockToFetch(t *testing.T) {
+	b, _ := newTestDownload(4)
+	node := func(i int) *headerNode {
+		e := b.headerList.Front()
+		for ; i > 0; i-- {
+			e = e.Next()
+		}
+		return e.Value.(*headerNode)
+	}
+
+	// Pretend the third block was reassigned after the first one was
+	// requested.
+	b.startHeader = b.startHeader.Next()
+	b.download.reassign.PushBack(node(2))
+
+	tests := []struct {
+		name         string
+		windowHeight int64
+		want         *headerNode
+	}{
+		{"reassigned first", 0, node(2)},
+		{"next in list", 2, node(1)},
+		{"beyond window", 2, nil},
+		{"window moved", 4, node(2)},
+		{"last in list", 4, node(3)},
+		{"end of list", 4, nil},
+	}
+	for _, test := range tests {
+		got := b.nextBlockToFetch(test.windowHeight)
+		if got != test.want {
+			t.Errorf("%s: got node %v, want %v", test.name, got,
+				test.want)
+		}
+	}
+}
+
+// TestReceiveHeaderBlock ensures requested blocks are processed right away
+// when they are next in line and are buffered otherwise.
+func TestReceiveHeaderBlock(t *testing.T) {
+	b, blocks := newTestDownload(3)
+	dp := newTestDownloadPeer(b)
+	now := time.Now()
+	for e := b.headerList.Front(); e != nil; e = e.Next() {
+		requestTestBlock(b, dp, e.Value.(*headerNode), now)
+	}
+
+	tests := []struct {
+		name         string
+		block        *btcutil.Block
+		wantProcess  bool
+		wantBuffered int
+	}{
+		{"ahead of front", blocks[2], false, 1},
+		{"front", blocks[0], true, 1},
+		{"still ahead of front", blocks[1], false, 2},
+	}
+	for i, test := range tests {
+		bmsg := &blockMsg{block: test.block, peer: dp.peer}
+		got := b.receiveHeaderBlock(bmsg)
+		if got != test.wantProcess {
+			t.Errorf("%s: process got %v, want %v", test.name, got,
+				test.wantProcess)
+		}
+		if len(b.download.buffered) != test.wantBuffered {
+			t.Errorf("%s: got %d buffered blocks, want %d",
+				test.name, len(b.download.buffered),
+				test.wantBuffered)
+		}
+		sha := test.block.Sha()
+		if _, ok := b.download.inFlight[*sha]; ok {
+			t.Errorf("%s: block is still in flight", test.name)
+		}
+		if _, ok := dp.peer.requestedBlocks[*sha]; ok {
+			t.Errorf("%s: block is still requested from the peer",
+				test.name)
+		}
+		if wantInFlight := len(blocks) - i - 1; dp.inFlight != wantInFlight {
+			t.Errorf("%s: got %d blocks in flight from the peer, "+
+				"want %d", test.name, dp.inFlight, wantInFlight)
+		}
+	}
+	if b.download.numReceived != uint64(len(blocks)) {
+		t.Errorf("got %d received blocks, want %d",
+			b.download.numReceived, len(blocks))
+	}
+}
+
+// TestStalledPeers ensures download peers are considered stalled when they
+// stop delivering blocks or hold up the next block while the download window
+// is exhausted.
+func TestStalledPeers(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name         string
+		numPeers     int
+		lastProgress time.Duration
+		requested    time.Duration
+		windowFull   bool
+		want         bool
+	}{
+		{"recent progress", 2, 0, 0, false, false},
+		{"no progress", 1, blockStallTimeout + time.Second, 0, false,
+			true},
+		{"front outstanding", 2, 0, blockHeadStallTimeout + time.Second,
+			false, false},
+		{"front recently requested with full window", 2, 0,
+			blockHeadStallTimeout - time.Second, true, false},
+		{"front outstanding with full window", 2, 0,
+			blockHeadStallTimeout + time.Second, true, true},
+		{"only peer holds front with full window", 1, 0,
+			blockHeadStallTimeout + time.Second, true, false},
+	}
+	for _, test := range tests {
+		b, _ := newTestDownload(2)
+		dp := newTestDownloadPeer(b)
+		for i := 1; i < test.numPeers; i++ {
+			newTestDownloadPeer(b)
+		}
+		dp.lastProgress = now.Add(-test.lastProgress)
+		front := b.headerList.Front().Value.(*headerNode)
+		requestTestBlock(b, dp, front, now.Add(-test.requested))
+		if test.windowFull {
+			b.startHeader = nil
+		}
+
+		_, got := b.stalledPeers(now)[dp.peer]
+		if got != test.want {
+			t.Errorf("%s: stalled got %v, want %v", test.name, got,
+				test.want)
+		}
+	}
+}
+
+// TestStalledPeerCooldown ensures a download peer is not asked for blocks
+// while it is cooling down after a stall.
+func TestStalledPeerCooldown(t *testing.T) {
+	b, _ := newTestDownload(1)
+	dp := newTestDownloadPeer(b)
+	b.syncPeer = dp.peer
+
+	if !b.isDownloadCandidate(dp) {
+		t.Fatalf("sync peer is not a download candidate")
+	}
+	dp.cooldownEnd = time.Now().Add(blockStallCooldown)
+	if b.isDownloadCandidate(dp) {
+		t.Errorf("sync peer is a download candidate during its cooldown")
+	}
+	dp.cooldownEnd = time.Now().Add(-time.Second)
+	if !b.isDownloadCandidate(dp) {
+		t.Errorf("sync peer is not a download candidate after its " +
+			"cooldown")
+	}
+}
@@ -23,15 +23,16 @@ import (
 const (
 	chanBufferSize = 50
 
-	// minInFlightBlocks is the minimum number of blocks that should be
-	// in the request queue for headers-first mode before requesting
-	// more.
-	minInFlightBlocks = 10
-
 	// blockDbNamePrefix is the prefix for the block database name.  The
 	// database type is appended to this value to form the full block
 	// database name.
 	blockDbNamePrefix = "blocks"
+
+	// duplicateStakeBanScore is the ban score given to a peer for each
+	// block it sends which reuses a proof-of-stake kernel that was already
+	// seen.  Such blocks are the basis of the proof-of-stake orphan block
+	// flooding attack.
+	duplicateStakeBanScore = 20
 )
 
 // newPeerMsg signifies a newly connected peer to the block handler.
@@ -198,11 +199,16 @@ type blockManager struct {
 	wg                sync.WaitGroup
 	quit              chan struct{}
 
+	// processBlockTimes tracks the time taken by the block chain to
+	// process blocks for the metrics server.
+	processBlockTimes *durationHistogram
+
 	// The following fields are used for headers-first mode.
 	headersFirstMode bool
 	headerList       *list.List
 	startHeader      *list.Element
 	nextCheckpoint   *chaincfg.Checkpoint
+	download         *blockDownloader
 }
 
 // resetHeaderState sets the headers-first mode state to values appropriate for
@@ -211,6 +217,7 @@ func (b *blockManager) resetHeaderState(newestHash *wire.ShaHash, newestHeight i
 	b.headersFirstMode = false
 	b.headerList.Init()
 	b.startHeader = nil
+	b.resetDownloadState()
 
 	// When there is a next checkpoint, add an entry for the latest known
 	// block into the header pool.  This allows the next downloaded header
@@ -352,6 +359,7 @@ func (b *blockManager) startSync(peers *list.List) {
 			bestPeer.PushGetBlocksMsg(locator, &zeroHash)
 		}
 		b.syncPeer = bestPeer
+		b.addDownloadPeer(bestPeer)
 	} else {
 		bmgrLog.Warnf("No sync peer candidates available")
 	}
@@ -401,11 +409,19 @@ func (b *blockManager) handleNewPeerMsg(peers *list.List, p *peer) {
 		return
 	}
 
-	// Add the peer as a candidate to sync from.
+	// Add the peer as a candidate to sync from and to download blocks
+	// from while in headers-first mode.
 	peers.PushBack(p)
+	b.addDownloadPeer(p)
 
 	// Start syncing by choosing the best candidate if needed.
 	b.startSync(peers)
+
+	// Put the new peer to work right away when blocks are already being
+	// downloaded.
+	if b.headersFirstMode {
+		b.fetchHeaderBlocks()
+	}
 }
 
 // handleDonePeerMsg deals with peers that have signalled they are done.  It
@@ -423,6 +439,11 @@ func (b *blockManager) handleDonePeerMsg(peers *list.List, p *peer) {
 
 	bmgrLog.Infof("Lost peer %s", p)
 
+	// Remove the peer from the set of peers blocks are downloaded from
+	// while in headers-first mode.  Any blocks still outstanding from it
+	// are requested from the remaining download peers below.
+	b.removeDownloadPeer(p)
+
 	// Remove requested transactions from the global map so that they will
 	// be fetched from elsewhere next time we get an inv.
 	for k := range p.requestedTxns {
@@ -455,6 +476,13 @@ func (b *blockManager) handleDonePeerMsg(peers *list.List, p *peer) {
 			b.resetHeaderState(newestHash, height)
 		}
 		b.startSync(peers)
+		return
+	}
+
+	// Request the blocks that were outstanding from the peer from the
+	// remaining download peers.
+	if b.headersFirstMode {
+		b.fetchHeaderBlocks()
 	}
 }
 
@@ -548,6 +576,24 @@ func (b *blockManager) handleBlockMsg(bmsg *blockMsg) {
 		}
 	}
 
+	// Blocks are downloaded from several peers in parallel while in
+	// headers-first mode, so they may arrive out of order.  Hold on to
+	// blocks which are ahead of the next one in line and process them once
+	// all of the blocks before them have been processed.
+	if b.headersFirstMode && !b.receiveHeaderBlock(bmsg) {
+		b.fetchHeaderBlocks()
+		return
+	}
+	b.processReceivedBlock(bmsg)
+	for next := b.nextBufferedBlock(); next != nil; next = b.nextBufferedBlock() {
+		b.processReceivedBlock(next)
+	}
+}
+
+// processReceivedBlock processes a block that was received from a peer and
+// handles the results such as requesting the parents of orphans and advancing
+// the headers-first state.
+func (b *blockManager) processReceivedBlock(bmsg *blockMsg) {
 	// When in headers-first mode, if the block matches the hash of the
 	// first header in the list of headers that are being fetched, it's
 	// eligible for less validation since the headers have already been
@@ -555,6 +601,7 @@ func (b *blockManager) handleBlockMsg(bmsg *blockMsg) {
 	// Also, remove the list entry for all blocks except the checkpoint
 	// since it is needed to verify the next round of headers links
 	// properly.
+	blockSha := bmsg.block.Sha()
 	isCheckpointBlock := false
 	behaviorFlags := blockchain.BFNone
 	if b.headersFirstMode {
@@ -580,8 +627,10 @@ func (b *blockManager) handleBlockMsg(bmsg *blockMsg) {
 
 	// Process the block to include validation, best chain selection, orphan
 	// handling, etc.
+	start := time.Now()
 	isOrphan, err := b.blockChain.ProcessBlock(bmsg.block,
 		b.server.timeSource, behaviorFlags)
+	b.processBlockTimes.observe(time.Since(start))
 	if err != nil {
 		// When the error is a rule error, it means the block was simply
 		// rejected as opposed to something actually going wrong, so log
@@ -600,6 +649,13 @@ func (b *blockManager) handleBlockMsg(bmsg *blockMsg) {
 		code, reason := errToRejectErr(err)
 		bmsg.peer.PushRejectMsg(wire.CmdBlock, code, reason,
 			blockSha, false)
+
+		// ppc: penalize peers sending blocks with a duplicate stake.
+		if rerr, ok := err.(blockchain.RuleError); ok &&
+			rerr.ErrorCode == blockchain.ErrDuplicateStake {
+			bmsg.peer.addBanScore(duplicateStakeBanScore,
+				rerr.Description)
+		}
 		return
 	}
 
@@ -660,6 +716,15 @@ func (b *blockManager) handleBlockMsg(bmsg *blockMsg) {
 		newestSha, newestHeight, _ := b.server.db.NewestSha()
 		b.updateChainState(newestSha, newestHeight)
 
+		// ppc: Keep the mock clock of the test networks in step with
+		// the blocks generated by other nodes once they extend the main
+		// chain so their following blocks are not rejected for being
+		// too far in the future.
+		if newestSha.IsEqual(blockSha) {
+			b.server.clock.followBlock(
+				bmsg.block.MsgBlock().Header.Timestamp)
+		}
+
 		// Update this peer's latest block height, for future
 		// potential sync node candidancy.
 		heightUpdate = int32(newestHeight)
@@ -693,29 +758,27 @@ func (b *blockManager) handleBlockMsg(bmsg *blockMsg) {
 	}
 
 	// This is headers-first mode, so if the block is not a checkpoint
-	// request more blocks using the header list when the request queue is
-	// getting short.
+	// request more blocks using the header list from the download peers
+	// which have free request slots.
 	if !isCheckpointBlock {
-		if b.startHeader != nil &&
-			len(bmsg.peer.requestedBlocks) < minInFlightBlocks {
-			b.fetchHeaderBlocks()
-		}
+		b.fetchHeaderBlocks()
 		return
 	}
 
 	// This is headers-first mode and the block is a checkpoint.  When
 	// there is a next checkpoint, get the next round of headers by asking
-	// for headers starting from the block after this one up to the next
-	// checkpoint.
+	// the sync peer for headers starting from the block after this one up
+	// to the next checkpoint.  Note that the checkpoint block itself may
+	// have been downloaded from any of the download peers.
 	prevHeight := b.nextCheckpoint.Height
 	prevHash := b.nextCheckpoint.Hash
 	b.nextCheckpoint = b.findNextHeaderCheckpoint(prevHeight)
 	if b.nextCheckpoint != nil {
 		locator := blockchain.BlockLocator([]*wire.ShaHash{prevHash})
-		err := bmsg.peer.PushGetHeadersMsg(locator, b.nextCheckpoint.Hash)
+		err := b.syncPeer.PushGetHeadersMsg(locator, b.nextCheckpoint.Hash)
 		if err != nil {
 			bmgrLog.Warnf("Failed to send getheaders message to "+
-				"peer %s: %v", bmsg.peer.addr, err)
+				"peer %s: %v", b.syncPeer.addr, err)
 			return
 		}
 		bmgrLog.Infof("Downloading headers for blocks %d to %d from "+
@@ -729,60 +792,17 @@ func (b *blockManager) handleBlockMsg(bmsg *blockMsg) {
 	// from the block after this one up to the end of the chain (zero hash).
 	b.headersFirstMode = false
 	b.headerList.Init()
+	b.resetDownloadState()
 	bmgrLog.Infof("Reached the final checkpoint -- switching to normal mode")
 	locator := blockchain.BlockLocator([]*wire.ShaHash{blockSha})
-	err = bmsg.peer.PushGetBlocksMsg(locator, &zeroHash)
+	err = b.syncPeer.PushGetBlocksMsg(locator, &zeroHash)
 	if err != nil {
 		bmgrLog.Warnf("Failed to send getblocks message to peer %s: %v",
-			bmsg.peer.addr, err)
+			b.syncPeer.addr, err)
 		return
 	}
 }
 
-// fetchHeaderBlocks creates and sends a request to the syncPeer for the next
-// list of blocks to be downloaded based on the current list of headers.
-func (b *blockManager) fetchHeaderBlocks() {
-	// Nothing to do if there is no start header.
-	if b.startHeader == nil {
-		bmgrLog.Warnf("fetchHeaderBlocks called with no start header")
-		return
-	}
-
-	// Build up a getdata request for the list of blocks the headers
-	// describe.  The size hint will be limited to wire.MaxInvPerMsg by
-	// the function, so no need to double check it here.
-	gdmsg := wire.NewMsgGetDataSizeHint(uint(b.headerList.Len()))
-	numRequested := 0
-	for e := b.startHeader; e != nil; e = e.Next() {
-		node, ok := e.Value.(*headerNode)
-		if !ok {
-			bmgrLog.Warn("Header list node type is not a headerNode")
-			continue
-		}
-
-		iv := wire.NewInvVect(wire.InvTypeBlock, node.sha)
-		haveInv, err := b.haveInventory(iv)
-		if err != nil {
-			bmgrLog.Warnf("Unexpected failure when checking for "+
-				"existing inventory during header block "+
-				"fetch: %v", err)
-		}
-		if !haveInv {
-			b.requestedBlocks[*node.sha] = struct{}{}
-			b.syncPeer.requestedBlocks[*node.sha] = struct{}{}
-			gdmsg.AddInvVect(iv)
-			numRequested++
-		}
-		b.startHeader = e.Next()
-		if numRequested >= wire.MaxInvPerMsg {
-			break
-		}
-	}
-	if len(gdmsg.InvList) > 0 {
-		b.syncPeer.QueueMessage(gdmsg, nil)
-	}
-}
-
 // handleHeadersMsghandles headers messages from all peers.
 func (b *blockManager) handleHeadersMsg(hmsg *headersMsg) {
 	// The remote peer is misbehaving if we didn't request headers.
@@ -1083,7 +1103,17 @@ func (b *blockManager) handleInvMsg(imsg *invMsg) {
 // important because the block manager controls which blocks are needed and how
 // the fetching should proceed.
 func (b *blockManager) blockHandler() {
+	// Reload the transactions which were in the memory pool when the
+	// server was last shut down.
+	if !cfg.NoPersistMempool {
+		if err := b.server.txMemPool.LoadMempool(); err != nil {
+			bmgrLog.Errorf("Unable to load the memory pool: %v", err)
+		}
+	}
+
 	candidatePeers := list.New()
+	stallTicker := time.NewTicker(blockStallCheckInterval)
+	defer stallTicker.Stop()
 out:
 	for {
 		select {
@@ -1140,6 +1170,25 @@ out:
 					err:           err,
 				}
 
+			case checkStakeKernelHashMsg: // ppc:
+				hashProofOfStake, success, err :=
+					b.blockChain.CheckStakeKernelHash(msg.nBits,
+						msg.blockFrom, msg.txPrev, msg.prevOut,
+						msg.nTimeTx, b.server.timeSource)
+				msg.reply <- checkStakeKernelHashResponse{
+					hashProofOfStake: hashProofOfStake,
+					success:          success,
+					err:              err,
+				}
+
+			case checkCoinStakeMsg: // ppc:
+				maxReward, err := b.blockChain.CheckCoinStake(msg.tx,
+					msg.nBits, b.server.timeSource)
+				msg.reply <- checkCoinStakeResponse{
+					maxReward: maxReward,
+					err:       err,
+				}
+
 			case ppcCalcNextReqDifficultyMsg: // ppc:
 				difficulty, err :=
 					b.blockChain.PPCCalcNextRequiredDifficulty(msg.proofOfStake)
@@ -1155,10 +1204,15 @@ out:
 					err:     nil,
 				}
 
+			case ppcGetStakeSeenInfoMsg: // ppc:
+				msg.reply <- b.blockChain.StakeSeenInfo()
+
 			case processBlockMsg:
+				start := time.Now()
 				isOrphan, err := b.blockChain.ProcessBlock(
 					msg.block, b.server.timeSource,
 					msg.flags)
+				b.processBlockTimes.observe(time.Since(start))
 				if err != nil {
 					msg.reply <- processBlockResponse{
 						isOrphan: false,
@@ -1180,6 +1234,9 @@ out:
 			case isCurrentMsg:
 				msg.reply <- b.current()
 
+			case getBlockDownloadInfoMsg:
+				msg.reply <- b.blockDownloadInfo()
+
 			case pauseMsg:
 				// Wait until the sender unpauses the manager.
 				<-msg.unpause
@@ -1189,6 +1246,9 @@ out:
 					"handler: %T", msg)
 			}
 
+		case <-stallTicker.C:
+			b.checkBlockStalls()
+
 		case <-b.quit:
 			break out
 		}
@@ -1238,11 +1298,14 @@ func (b *blockManager) handleNotifyMsg(notification *blockchain.Notification) {
 		// pool also removes any transactions which depend on it,
 		// recursively.
 		for _, tx := range block.Transactions()[1:] {
-			b.server.txMemPool.RemoveTransaction(tx)
+			b.server.txMemPool.RemoveTransaction(tx, true,
+				txRemovedMined)
 			b.server.txMemPool.RemoveDoubleSpends(tx)
 			b.server.txMemPool.RemoveOrphan(tx.Sha())
 			b.server.txMemPool.ProcessOrphans(tx.Sha())
+			b.server.txMemPool.ClearPrioritisation(tx.Sha())
 		}
+		b.server.txMemPool.ExpireTransactions()
 
 		if r := b.server.rpcServer; r != nil {
 			// Now that this block is in the blockchain we can mark
@@ -1257,6 +1320,11 @@ func (b *blockManager) handleNotifyMsg(notification *blockchain.Notification) {
 			r.ntfnMgr.NotifyBlockConnected(block)
 		}
 
+		// Publish the block to the notification publishers.
+		for _, publisher := range b.server.publishers {
+			publisher.NotifyBlockConnected(block)
+		}
+
 		// If we're maintaing the address index, and it is up to date
 		// then update it based off this new block.
 		if cfg.AddrIndex && b.server.addrIndexer.IsCaughtUp() {
@@ -1280,7 +1348,8 @@ func (b *blockManager) handleNotifyMsg(notification *blockchain.Notification) {
 				// Remove the transaction and all transactions
 				// that depend on it if it wasn't accepted into
 				// the transaction pool.
-				b.server.txMemPool.RemoveTransaction(tx)
+				b.server.txMemPool.RemoveTransaction(tx, true,
+					txRemovedReorg)
 			}
 		}
 
@@ -1288,6 +1357,20 @@ func (b *blockManager) handleNotifyMsg(notification *blockchain.Notification) {
 		if r := b.server.rpcServer; r != nil {
 			r.ntfnMgr.NotifyBlockDisconnected(block)
 		}
+
+	// The main block chain was reorganized.
+	case blockchain.NTReorganization:
+		data, ok := notification.Data.(*blockchain.ReorganizationNtfnsData)
+		if !ok {
+			bmgrLog.Warnf("Chain reorganization notification is " +
+				"malformed.")
+			break
+		}
+
+		// Notify registered websocket clients.
+		if r := b.server.rpcServer; r != nil {
+			r.ntfnMgr.NotifyChainReorganized(data)
+		}
 	}
 }
 
@@ -1465,7 +1548,10 @@ func newBlockManager(s *server) (*blockManager, error) {
 		progressLogger:  newBlockProgressLogger("Processed", bmgrLog),
 		msgChan:         make(chan interface{}, cfg.MaxPeers*3),
 		headerList:      list.New(),
+		download:        newBlockDownloader(),
 		quit:            make(chan struct{}),
+
+		processBlockTimes: newDurationHistogram(processBlockTimeBuckets),
 	}
 	bm.progressLogger = newBlockProgressLogger("Processed", bmgrLog)
 	bm.blockChain = blockchain.New(s.db, s.chainParams, bm.handleNotifyMsg)
@@ -38,7 +38,7 @@ func btcdMain(serverChan chan<- *server) error {
 		return err
 	}
 	cfg = tcfg
-	defer backendLog.Flush()
+	defer flushLogs()
 
 	// Show version at startup.
 	btcdLog.Infof("Version %s", version())
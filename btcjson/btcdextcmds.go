@@ -71,6 +71,19 @@ func NewGenerateCmd(numBlocks uint32) *GenerateCmd {
 	}
 }
 
+// GeneratePoSCmd defines the generatepos JSON-RPC command.
+type GeneratePoSCmd struct {
+	NumBlocks uint32
+}
+
+// NewGeneratePoSCmd returns a new instance which can be used to issue a
+// generatepos JSON-RPC command.
+func NewGeneratePoSCmd(numBlocks uint32) *GeneratePoSCmd {
+	return &GeneratePoSCmd{
+		NumBlocks: numBlocks,
+	}
+}
+
 // GetBestBlockCmd defines the getbestblock JSON-RPC command.
 type GetBestBlockCmd struct{}
 
@@ -80,6 +93,15 @@ func NewGetBestBlockCmd() *GetBestBlockCmd {
 	return &GetBestBlockCmd{}
 }
 
+// GetBlockDownloadInfoCmd defines the getblockdownloadinfo JSON-RPC command.
+type GetBlockDownloadInfoCmd struct{}
+
+// NewGetBlockDownloadInfoCmd returns a new instance which can be used to issue
+// a getblockdownloadinfo JSON-RPC command.
+func NewGetBlockDownloadInfoCmd() *GetBlockDownloadInfoCmd {
+	return &GetBlockDownloadInfoCmd{}
+}
+
 // GetCurrentNetCmd defines the getcurrentnet JSON-RPC command.
 type GetCurrentNetCmd struct{}
 
@@ -89,6 +111,19 @@ func NewGetCurrentNetCmd() *GetCurrentNetCmd {
 	return &GetCurrentNetCmd{}
 }
 
+// SetMockTimeCmd defines the setmocktime JSON-RPC command.
+type SetMockTimeCmd struct {
+	Timestamp int64
+}
+
+// NewSetMockTimeCmd returns a new instance which can be used to issue a
+// setmocktime JSON-RPC command.
+func NewSetMockTimeCmd(timestamp int64) *SetMockTimeCmd {
+	return &SetMockTimeCmd{
+		Timestamp: timestamp,
+	}
+}
+
 func init() {
 	// No special flags for commands in this file.
 	flags := UsageFlag(0)
@@ -96,6 +131,9 @@ func init() {
 	MustRegisterCmd("debuglevel", (*DebugLevelCmd)(nil), flags)
 	MustRegisterCmd("node", (*NodeCmd)(nil), flags)
 	MustRegisterCmd("generate", (*GenerateCmd)(nil), flags)
+	MustRegisterCmd("generatepos", (*GeneratePoSCmd)(nil), flags)
 	MustRegisterCmd("getbestblock", (*GetBestBlockCmd)(nil), flags)
+	MustRegisterCmd("getblockdownloadinfo", (*GetBlockDownloadInfoCmd)(nil), flags)
 	MustRegisterCmd("getcurrentnet", (*GetCurrentNetCmd)(nil), flags)
+	MustRegisterCmd("setmocktime", (*SetMockTimeCmd)(nil), flags)
 }
@@ -113,6 +113,19 @@ func TestBtcdExtCmds(t *testing.T) {
 				NumBlocks: 1,
 			},
 		},
+		{
+			name: "generatepos",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("generatepos", 1)
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewGeneratePoSCmd(1)
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"generatepos","params":[1],"id":1}`,
+			unmarshalled: &btcjson.GeneratePoSCmd{
+				NumBlocks: 1,
+			},
+		},
 		{
 			name: "getbestblock",
 			newCmd: func() (interface{}, error) {
@@ -124,6 +137,17 @@ func TestBtcdExtCmds(t *testing.T) {
 			marshalled:   `{"jsonrpc":"1.0","method":"getbestblock","params":[],"id":1}`,
 			unmarshalled: &btcjson.GetBestBlockCmd{},
 		},
+		{
+			name: "getblockdownloadinfo",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("getblockdownloadinfo")
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewGetBlockDownloadInfoCmd()
+			},
+			marshalled:   `{"jsonrpc":"1.0","method":"getblockdownloadinfo","params":[],"id":1}`,
+			unmarshalled: &btcjson.GetBlockDownloadInfoCmd{},
+		},
 		{
 			name: "getcurrentnet",
 			newCmd: func() (interface{}, error) {
@@ -135,6 +159,19 @@ func TestBtcdExtCmds(t *testing.T) {
 			marshalled:   `{"jsonrpc":"1.0","method":"getcurrentnet","params":[],"id":1}`,
 			unmarshalled: &btcjson.GetCurrentNetCmd{},
 		},
+		{
+			name: "setmocktime",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("setmocktime", 1400000000)
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewSetMockTimeCmd(1400000000)
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"setmocktime","params":[1400000000],"id":1}`,
+			unmarshalled: &btcjson.SetMockTimeCmd{
+				Timestamp: 1400000000,
+			},
+		},
 	}
 
 	t.Logf("Running %d tests", len(tests))
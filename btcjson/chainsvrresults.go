@@ -120,6 +120,12 @@ type GetBlockTemplateResult struct {
 	// Block proposal from BIP 0023.
 	Capabilities  []string `json:"capabilities,omitempty"`
 	RejectReasion string   `json:"reject-reason,omitempty"`
+
+	// ppc: Proof-of-stake template.  CoinStakeReward is the maximum reward
+	// the coinstake may claim and SignaturePubKey is the public key the
+	// block must be signed with.
+	CoinStakeReward *int64 `json:"coinstakereward,omitempty"`
+	SignaturePubKey string `json:"signaturepubkey,omitempty"`
 }
 
 // GetNetworkInfoResult models the data returned from the getnetworkinfo
@@ -157,6 +163,34 @@ type GetPeerInfoResult struct {
 	SyncNode       bool    `json:"syncnode"`
 }
 
+// BlockDownloadPeerResult models the data for a single peer returned from the
+// getblockdownloadinfo command.
+type BlockDownloadPeerResult struct {
+	ID           int32  `json:"id"`
+	Addr         string `json:"addr"`
+	InFlight     int32  `json:"inflight"`
+	Received     uint64 `json:"received"`
+	Stalls       int32  `json:"stalls"`
+	LastProgress int64  `json:"lastprogress"`
+}
+
+// GetBlockDownloadInfoResult models the data returned from the
+// getblockdownloadinfo command.
+type GetBlockDownloadInfoResult struct {
+	HeadersFirst       bool                      `json:"headersfirst"`
+	SyncPeer           string                    `json:"syncpeer,omitempty"`
+	MaxInFlightPerPeer int32                     `json:"maxinflightperpeer"`
+	InFlight           int32                     `json:"inflight"`
+	Buffered           int32                     `json:"buffered"`
+	Reassigning        int32                     `json:"reassigning"`
+	Requested          uint64                    `json:"requested"`
+	Received           uint64                    `json:"received"`
+	Duplicates         uint64                    `json:"duplicates"`
+	Stalls             uint64                    `json:"stalls"`
+	Reassigned         uint64                    `json:"reassigned"`
+	Peers              []BlockDownloadPeerResult `json:"peers"`
+}
+
 // GetRawMempoolVerboseResult models the data returned from the getrawmempool
 // command when the verbose flag is set.  When the verbose flag is not set,
 // getrawmempool returns an array of transaction hashes.
@@ -164,9 +198,18 @@ type GetRawMempoolVerboseResult struct {
 	Size             int32    `json:"size"`
 	Fee              float64  `json:"fee"`
 	Time             int64    `json:"time"`
+	TxTime           int64    `json:"txtime"`
 	Height           int64    `json:"height"`
 	StartingPriority float64  `json:"startingpriority"`
 	CurrentPriority  float64  `json:"currentpriority"`
+	PriorityDelta    float64  `json:"prioritydelta"`
+	FeeDelta         float64  `json:"feedelta"`
+	DescendantCount  int64    `json:"descendantcount"`
+	DescendantSize   int64    `json:"descendantsize"`
+	DescendantFees   float64  `json:"descendantfees"`
+	AncestorCount    int64    `json:"ancestorcount"`
+	AncestorSize     int64    `json:"ancestorsize"`
+	AncestorFees     float64  `json:"ancestorfees"`
 	Depends          []string `json:"depends"`
 }
 
@@ -256,6 +299,21 @@ type Vout struct {
 	ScriptPubKey ScriptPubKeyResult `json:"scriptPubKey"`
 }
 
+// GetMempoolInfoResult models the data returned from the getmempoolinfo
+// command.
+type GetMempoolInfoResult struct {
+	Size          int64   `json:"size"`
+	Bytes         int64   `json:"bytes"`
+	Usage         int64   `json:"usage"`
+	MaxMempool    int64   `json:"maxmempool"`
+	MempoolMinFee float64 `json:"mempoolminfee"`
+	MinRelayTxFee float64 `json:"minrelaytxfee"`
+	Orphans       int64   `json:"orphans"`
+	Evicted       uint64  `json:"evicted"`
+	EvictedBytes  uint64  `json:"evictedbytes"`
+	LastEvicted   int64   `json:"lastevicted"`
+}
+
 // GetMiningInfoResult models the data from the getmininginfo command.
 type GetMiningInfoResult struct {
 	Blocks           int64   `json:"blocks"`
@@ -23,12 +23,19 @@ func NewAuthenticateCmd(username, passphrase string) *AuthenticateCmd {
 }
 
 // NotifyBlocksCmd defines the notifyblocks JSON-RPC command.
-type NotifyBlocksCmd struct{}
+type NotifyBlocksCmd struct {
+	Verbose *bool `jsonrpcdefault:"false"` // ppc:
+}
 
 // NewNotifyBlocksCmd returns a new instance which can be used to issue a
 // notifyblocks JSON-RPC command.
-func NewNotifyBlocksCmd() *NotifyBlocksCmd {
-	return &NotifyBlocksCmd{}
+//
+// The parameters which are pointers indicate they are optional.  Passing nil
+// for optional parameters will use the default value.
+func NewNotifyBlocksCmd(verbose *bool) *NotifyBlocksCmd {
+	return &NotifyBlocksCmd{
+		Verbose: verbose,
+	}
 }
 
 // StopNotifyBlocksCmd defines the stopnotifyblocks JSON-RPC command.
@@ -40,6 +47,24 @@ func NewStopNotifyBlocksCmd() *StopNotifyBlocksCmd {
 	return &StopNotifyBlocksCmd{}
 }
 
+// NotifyAlertsCmd defines the notifyalerts JSON-RPC command.
+type NotifyAlertsCmd struct{}
+
+// NewNotifyAlertsCmd returns a new instance which can be used to issue a
+// notifyalerts JSON-RPC command.
+func NewNotifyAlertsCmd() *NotifyAlertsCmd {
+	return &NotifyAlertsCmd{}
+}
+
+// StopNotifyAlertsCmd defines the stopnotifyalerts JSON-RPC command.
+type StopNotifyAlertsCmd struct{}
+
+// NewStopNotifyAlertsCmd returns a new instance which can be used to issue a
+// stopnotifyalerts JSON-RPC command.
+func NewStopNotifyAlertsCmd() *StopNotifyAlertsCmd {
+	return &StopNotifyAlertsCmd{}
+}
+
 // NotifyNewTransactionsCmd defines the notifynewtransactions JSON-RPC command.
 type NotifyNewTransactionsCmd struct {
 	Verbose *bool `jsonrpcdefault:"false"`
@@ -68,6 +93,25 @@ func NewStopNotifyNewTransactionsCmd() *StopNotifyNewTransactionsCmd {
 	return &StopNotifyNewTransactionsCmd{}
 }
 
+// NotifyMempoolRemovalsCmd defines the notifymempoolremovals JSON-RPC command.
+type NotifyMempoolRemovalsCmd struct{}
+
+// NewNotifyMempoolRemovalsCmd returns a new instance which can be used to issue
+// a notifymempoolremovals JSON-RPC command.
+func NewNotifyMempoolRemovalsCmd() *NotifyMempoolRemovalsCmd {
+	return &NotifyMempoolRemovalsCmd{}
+}
+
+// StopNotifyMempoolRemovalsCmd defines the stopnotifymempoolremovals JSON-RPC
+// command.
+type StopNotifyMempoolRemovalsCmd struct{}
+
+// NewStopNotifyMempoolRemovalsCmd returns a new instance which can be used to
+// issue a stopnotifymempoolremovals JSON-RPC command.
+func NewStopNotifyMempoolRemovalsCmd() *StopNotifyMempoolRemovalsCmd {
+	return &StopNotifyMempoolRemovalsCmd{}
+}
+
 // NotifyReceivedCmd defines the notifyreceived JSON-RPC command.
 type NotifyReceivedCmd struct {
 	Addresses []string
@@ -101,6 +145,56 @@ func NewNotifySpentCmd(outPoints []OutPoint) *NotifySpentCmd {
 	}
 }
 
+// NotifyStakeEventsCmd defines the notifystakeevents JSON-RPC command.
+type NotifyStakeEventsCmd struct {
+	OutPoints *[]OutPoint
+}
+
+// NewNotifyStakeEventsCmd returns a new instance which can be used to issue a
+// notifystakeevents JSON-RPC command.
+//
+// The parameters which are pointers indicate they are optional.  Passing nil
+// for optional parameters will use the default value.
+func NewNotifyStakeEventsCmd(outPoints *[]OutPoint) *NotifyStakeEventsCmd {
+	return &NotifyStakeEventsCmd{
+		OutPoints: outPoints,
+	}
+}
+
+// StopNotifyStakeEventsCmd defines the stopnotifystakeevents JSON-RPC command.
+type StopNotifyStakeEventsCmd struct{}
+
+// NewStopNotifyStakeEventsCmd returns a new instance which can be used to
+// issue a stopnotifystakeevents JSON-RPC command.
+func NewStopNotifyStakeEventsCmd() *StopNotifyStakeEventsCmd {
+	return &StopNotifyStakeEventsCmd{}
+}
+
+// NotifyTemplatesCmd defines the notifytemplates JSON-RPC command.
+type NotifyTemplatesCmd struct {
+	Verbose *bool `jsonrpcdefault:"false"`
+}
+
+// NewNotifyTemplatesCmd returns a new instance which can be used to issue a
+// notifytemplates JSON-RPC command.
+//
+// The parameters which are pointers indicate they are optional.  Passing nil
+// for optional parameters will use the default value.
+func NewNotifyTemplatesCmd(verbose *bool) *NotifyTemplatesCmd {
+	return &NotifyTemplatesCmd{
+		Verbose: verbose,
+	}
+}
+
+// StopNotifyTemplatesCmd defines the stopnotifytemplates JSON-RPC command.
+type StopNotifyTemplatesCmd struct{}
+
+// NewStopNotifyTemplatesCmd returns a new instance which can be used to issue
+// a stopnotifytemplates JSON-RPC command.
+func NewStopNotifyTemplatesCmd() *StopNotifyTemplatesCmd {
+	return &StopNotifyTemplatesCmd{}
+}
+
 // StopNotifyReceivedCmd defines the stopnotifyreceived JSON-RPC command.
 type StopNotifyReceivedCmd struct {
 	Addresses []string
@@ -149,18 +243,36 @@ func NewRescanCmd(beginBlock string, addresses []string, outPoints []OutPoint, e
 	}
 }
 
+// StopRescanCmd defines the stoprescan JSON-RPC command.
+type StopRescanCmd struct{}
+
+// NewStopRescanCmd returns a new instance which can be used to issue a
+// stoprescan JSON-RPC command.
+func NewStopRescanCmd() *StopRescanCmd {
+	return &StopRescanCmd{}
+}
+
 func init() {
 	// The commands in this file are only usable by websockets.
 	flags := UFWebsocketOnly
 
 	MustRegisterCmd("authenticate", (*AuthenticateCmd)(nil), flags)
+	MustRegisterCmd("notifyalerts", (*NotifyAlertsCmd)(nil), flags)
 	MustRegisterCmd("notifyblocks", (*NotifyBlocksCmd)(nil), flags)
+	MustRegisterCmd("notifymempoolremovals", (*NotifyMempoolRemovalsCmd)(nil), flags)
 	MustRegisterCmd("notifynewtransactions", (*NotifyNewTransactionsCmd)(nil), flags)
 	MustRegisterCmd("notifyreceived", (*NotifyReceivedCmd)(nil), flags)
 	MustRegisterCmd("notifyspent", (*NotifySpentCmd)(nil), flags)
+	MustRegisterCmd("notifystakeevents", (*NotifyStakeEventsCmd)(nil), flags)
+	MustRegisterCmd("notifytemplates", (*NotifyTemplatesCmd)(nil), flags)
+	MustRegisterCmd("stopnotifyalerts", (*StopNotifyAlertsCmd)(nil), flags)
 	MustRegisterCmd("stopnotifyblocks", (*StopNotifyBlocksCmd)(nil), flags)
+	MustRegisterCmd("stopnotifymempoolremovals", (*StopNotifyMempoolRemovalsCmd)(nil), flags)
 	MustRegisterCmd("stopnotifynewtransactions", (*StopNotifyNewTransactionsCmd)(nil), flags)
 	MustRegisterCmd("stopnotifyspent", (*StopNotifySpentCmd)(nil), flags)
+	MustRegisterCmd("stopnotifystakeevents", (*StopNotifyStakeEventsCmd)(nil), flags)
+	MustRegisterCmd("stopnotifytemplates", (*StopNotifyTemplatesCmd)(nil), flags)
 	MustRegisterCmd("stopnotifyreceived", (*StopNotifyReceivedCmd)(nil), flags)
 	MustRegisterCmd("rescan", (*RescanCmd)(nil), flags)
+	MustRegisterCmd("stoprescan", (*StopRescanCmd)(nil), flags)
 }
@@ -40,16 +40,75 @@ func TestChainSvrWsCmds(t *testing.T) {
 			marshalled:   `{"jsonrpc":"1.0","method":"authenticate","params":["user","pass"],"id":1}`,
 			unmarshalled: &btcjson.AuthenticateCmd{Username: "user", Passphrase: "pass"},
 		},
+		{
+			name: "notifyalerts",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("notifyalerts")
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewNotifyAlertsCmd()
+			},
+			marshalled:   `{"jsonrpc":"1.0","method":"notifyalerts","params":[],"id":1}`,
+			unmarshalled: &btcjson.NotifyAlertsCmd{},
+		},
+		{
+			name: "stopnotifyalerts",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("stopnotifyalerts")
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewStopNotifyAlertsCmd()
+			},
+			marshalled:   `{"jsonrpc":"1.0","method":"stopnotifyalerts","params":[],"id":1}`,
+			unmarshalled: &btcjson.StopNotifyAlertsCmd{},
+		},
+		{
+			name: "notifymempoolremovals",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("notifymempoolremovals")
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewNotifyMempoolRemovalsCmd()
+			},
+			marshalled:   `{"jsonrpc":"1.0","method":"notifymempoolremovals","params":[],"id":1}`,
+			unmarshalled: &btcjson.NotifyMempoolRemovalsCmd{},
+		},
+		{
+			name: "stopnotifymempoolremovals",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("stopnotifymempoolremovals")
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewStopNotifyMempoolRemovalsCmd()
+			},
+			marshalled:   `{"jsonrpc":"1.0","method":"stopnotifymempoolremovals","params":[],"id":1}`,
+			unmarshalled: &btcjson.StopNotifyMempoolRemovalsCmd{},
+		},
 		{
 			name: "notifyblocks",
 			newCmd: func() (interface{}, error) {
 				return btcjson.NewCmd("notifyblocks")
 			},
 			staticCmd: func() interface{} {
-				return btcjson.NewNotifyBlocksCmd()
+				return btcjson.NewNotifyBlocksCmd(nil)
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"notifyblocks","params":[],"id":1}`,
+			unmarshalled: &btcjson.NotifyBlocksCmd{
+				Verbose: btcjson.Bool(false),
+			},
+		},
+		{
+			name: "notifyblocks optional",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("notifyblocks", true)
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewNotifyBlocksCmd(btcjson.Bool(true))
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"notifyblocks","params":[true],"id":1}`,
+			unmarshalled: &btcjson.NotifyBlocksCmd{
+				Verbose: btcjson.Bool(true),
 			},
-			marshalled:   `{"jsonrpc":"1.0","method":"notifyblocks","params":[],"id":1}`,
-			unmarshalled: &btcjson.NotifyBlocksCmd{},
 		},
 		{
 			name: "stopnotifyblocks",
@@ -153,6 +212,81 @@ func TestChainSvrWsCmds(t *testing.T) {
 				OutPoints: []btcjson.OutPoint{{Hash: "123", Index: 0}},
 			},
 		},
+		{
+			name: "notifystakeevents",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("notifystakeevents")
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewNotifyStakeEventsCmd(nil)
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"notifystakeevents","params":[],"id":1}`,
+			unmarshalled: &btcjson.NotifyStakeEventsCmd{
+				OutPoints: nil,
+			},
+		},
+		{
+			name: "notifystakeevents optional",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("notifystakeevents", `[{"hash":"123","index":0}]`)
+			},
+			staticCmd: func() interface{} {
+				ops := []btcjson.OutPoint{{Hash: "123", Index: 0}}
+				return btcjson.NewNotifyStakeEventsCmd(&ops)
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"notifystakeevents","params":[[{"hash":"123","index":0}]],"id":1}`,
+			unmarshalled: &btcjson.NotifyStakeEventsCmd{
+				OutPoints: &[]btcjson.OutPoint{{Hash: "123", Index: 0}},
+			},
+		},
+		{
+			name: "stopnotifystakeevents",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("stopnotifystakeevents")
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewStopNotifyStakeEventsCmd()
+			},
+			marshalled:   `{"jsonrpc":"1.0","method":"stopnotifystakeevents","params":[],"id":1}`,
+			unmarshalled: &btcjson.StopNotifyStakeEventsCmd{},
+		},
+		{
+			name: "notifytemplates",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("notifytemplates")
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewNotifyTemplatesCmd(nil)
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"notifytemplates","params":[],"id":1}`,
+			unmarshalled: &btcjson.NotifyTemplatesCmd{
+				Verbose: btcjson.Bool(false),
+			},
+		},
+		{
+			name: "notifytemplates optional",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("notifytemplates", true)
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewNotifyTemplatesCmd(btcjson.Bool(true))
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"notifytemplates","params":[true],"id":1}`,
+			unmarshalled: &btcjson.NotifyTemplatesCmd{
+				Verbose: btcjson.Bool(true),
+			},
+		},
+		{
+			name: "stopnotifytemplates",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("stopnotifytemplates")
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewStopNotifyTemplatesCmd()
+			},
+			marshalled:   `{"jsonrpc":"1.0","method":"stopnotifytemplates","params":[],"id":1}`,
+			unmarshalled: &btcjson.StopNotifyTemplatesCmd{},
+		},
 		{
 			name: "rescan",
 			newCmd: func() (interface{}, error) {
@@ -192,6 +326,17 @@ func TestChainSvrWsCmds(t *testing.T) {
 				EndBlock:   btcjson.String("456"),
 			},
 		},
+		{
+			name: "stoprescan",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("stoprescan")
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewStopRescanCmd()
+			},
+			marshalled:   `{"jsonrpc":"1.0","method":"stoprescan","params":[],"id":1}`,
+			unmarshalled: &btcjson.StopRescanCmd{},
+		},
 	}
 
 	t.Logf("Running %d tests", len(tests))
@@ -8,6 +8,10 @@
 package btcjson
 
 const (
+	// AlertNtfnMethod is the method used for notifications from the chain
+	// server that a network alert has been accepted or cancelled.
+	AlertNtfnMethod = "alert"
+
 	// BlockConnectedNtfnMethod is the method used for notifications from
 	// the chain server that a block has been connected.
 	BlockConnectedNtfnMethod = "blockconnected"
@@ -16,6 +20,33 @@ const (
 	// the chain server that a block has been disconnected.
 	BlockDisconnectedNtfnMethod = "blockdisconnected"
 
+	// BlockConnectedVerboseNtfnMethod is the method used for notifications
+	// from the chain server that a block has been connected.  This differs
+	// from BlockConnectedNtfnMethod in that it provides the header and
+	// proof-of-stake details of the block in the notification.
+	BlockConnectedVerboseNtfnMethod = "blockconnectedverbose"
+
+	// BlockDisconnectedVerboseNtfnMethod is the method used for
+	// notifications from the chain server that a block has been
+	// disconnected.  This differs from BlockDisconnectedNtfnMethod in that
+	// it provides the header and proof-of-stake details of the block in the
+	// notification.
+	BlockDisconnectedVerboseNtfnMethod = "blockdisconnectedverbose"
+
+	// ChainReorganizedNtfnMethod is the method used for notifications from
+	// the chain server that the main chain has been reorganized.
+	ChainReorganizedNtfnMethod = "chainreorganized"
+
+	// CoinStakeSpentNtfnMethod is the method used for notifications from
+	// the chain server that the coinstake of a block connected to the main
+	// chain spends a watched outpoint.
+	CoinStakeSpentNtfnMethod = "coinstakespent"
+
+	// DifficultyChangedNtfnMethod is the method used for notifications
+	// from the chain server that a block connected to the main chain
+	// changed the proof-of-work or proof-of-stake difficulty.
+	DifficultyChangedNtfnMethod = "difficultychanged"
+
 	// RecvTxNtfnMethod is the method used for notifications from the chain
 	// server that a transaction which pays to a registered address has been
 	// processed.
@@ -35,6 +66,15 @@ const (
 	// progress.
 	RescanProgressNtfnMethod = "rescanprogress"
 
+	// StakeModifierNtfnMethod is the method used for notifications from
+	// the chain server that a block connected to the main chain generated
+	// a new stake modifier.
+	StakeModifierNtfnMethod = "stakemodifier"
+
+	// TemplateChangedNtfnMethod is the method used for notifications from
+	// the chain server that a new block template is available.
+	TemplateChangedNtfnMethod = "templatechanged"
+
 	// TxAcceptedNtfnMethod is the method used for notifications from the
 	// chain server that a transaction has been accepted into the mempool.
 	TxAcceptedNtfnMethod = "txaccepted"
@@ -44,8 +84,41 @@ const (
 	// mempool.  This differs from TxAcceptedNtfnMethod in that it provides
 	// more details in the notification.
 	TxAcceptedVerboseNtfnMethod = "txacceptedverbose"
+
+	// TxRemovedNtfnMethod is the method used for notifications from the
+	// chain server that a transaction has been removed from the mempool.
+	TxRemovedNtfnMethod = "txremoved"
+
+	// TxReplacedNtfnMethod is the method used for notifications from the
+	// chain server that a transaction has been removed from the mempool
+	// since it, or a transaction it depends on, was replaced by a
+	// conflicting transaction.
+	TxReplacedNtfnMethod = "txreplaced"
 )
 
+// AlertNtfn defines the alert JSON-RPC notification.
+type AlertNtfn struct {
+	ID         int32
+	Priority   int32
+	Expiration int64
+	StatusBar  string
+	Cancelled  bool
+}
+
+// NewAlertNtfn returns a new instance which can be used to issue an alert
+// JSON-RPC notification.
+func NewAlertNtfn(id, priority int32, expiration int64, statusBar string,
+	cancelled bool) *AlertNtfn {
+
+	return &AlertNtfn{
+		ID:         id,
+		Priority:   priority,
+		Expiration: expiration,
+		StatusBar:  statusBar,
+		Cancelled:  cancelled,
+	}
+}
+
 // BlockConnectedNtfn defines the blockconnected JSON-RPC notification.
 type BlockConnectedNtfn struct {
 	Hash   string
@@ -76,6 +149,158 @@ func NewBlockDisconnectedNtfn(hash string, height int32) *BlockDisconnectedNtfn
 	}
 }
 
+// BlockVerboseDetails describes the header and proof-of-stake details of a
+// block in the blockconnectedverbose and blockdisconnectedverbose
+// notifications.  The kernel and proof hash are only set for proof-of-stake
+// blocks.
+type BlockVerboseDetails struct {
+	Hash              string    `json:"hash"`
+	Height            int32     `json:"height"`
+	Version           int32     `json:"version"`
+	PreviousHash      string    `json:"previousblockhash"`
+	MerkleRoot        string    `json:"merkleroot"`
+	Time              int64     `json:"time"`
+	Bits              string    `json:"bits"`
+	Nonce             uint32    `json:"nonce"`
+	ProofOfStake      bool      `json:"proofofstake"`
+	Mint              float64   `json:"mint"`
+	MoneySupply       float64   `json:"moneysupply"`
+	StakeModifier     uint64    `json:"modifier"`
+	GeneratedModifier bool      `json:"generatedmodifier"`
+	Kernel            *OutPoint `json:"kernel,omitempty"`
+	ProofHash         string    `json:"proofhash,omitempty"`
+}
+
+// BlockConnectedVerboseNtfn defines the blockconnectedverbose JSON-RPC
+// notification.
+type BlockConnectedVerboseNtfn struct {
+	Block BlockVerboseDetails
+}
+
+// NewBlockConnectedVerboseNtfn returns a new instance which can be used to
+// issue a blockconnectedverbose JSON-RPC notification.
+func NewBlockConnectedVerboseNtfn(block BlockVerboseDetails) *BlockConnectedVerboseNtfn {
+	return &BlockConnectedVerboseNtfn{
+		Block: block,
+	}
+}
+
+// BlockDisconnectedVerboseNtfn defines the blockdisconnectedverbose JSON-RPC
+// notification.
+type BlockDisconnectedVerboseNtfn struct {
+	Block BlockVerboseDetails
+}
+
+// NewBlockDisconnectedVerboseNtfn returns a new instance which can be used to
+// issue a blockdisconnectedverbose JSON-RPC notification.
+func NewBlockDisconnectedVerboseNtfn(block BlockVerboseDetails) *BlockDisconnectedVerboseNtfn {
+	return &BlockDisconnectedVerboseNtfn{
+		Block: block,
+	}
+}
+
+// ChainReorganizedNtfn defines the chainreorganized JSON-RPC notification.
+// Disconnected lists the hashes of the disconnected blocks from the old best
+// chain head down to the fork point and Connected the hashes of the connected
+// blocks from the fork point up to the new best chain head.
+type ChainReorganizedNtfn struct {
+	ForkHash     string
+	ForkHeight   int32
+	Disconnected []string
+	Connected    []string
+}
+
+// NewChainReorganizedNtfn returns a new instance which can be used to issue a
+// chainreorganized JSON-RPC notification.
+func NewChainReorganizedNtfn(forkHash string, forkHeight int32,
+	disconnected, connected []string) *ChainReorganizedNtfn {
+
+	return &ChainReorganizedNtfn{
+		ForkHash:     forkHash,
+		ForkHeight:   forkHeight,
+		Disconnected: disconnected,
+		Connected:    connected,
+	}
+}
+
+// CoinStakeSpentNtfn defines the coinstakespent JSON-RPC notification.
+type CoinStakeSpentNtfn struct {
+	Hash     string
+	Height   int32
+	TxID     string
+	OutPoint OutPoint
+}
+
+// NewCoinStakeSpentNtfn returns a new instance which can be used to issue a
+// coinstakespent JSON-RPC notification.
+func NewCoinStakeSpentNtfn(hash string, height int32, txID string,
+	outPoint OutPoint) *CoinStakeSpentNtfn {
+
+	return &CoinStakeSpentNtfn{
+		Hash:     hash,
+		Height:   height,
+		TxID:     txID,
+		OutPoint: outPoint,
+	}
+}
+
+// DifficultyChangedNtfn defines the difficultychanged JSON-RPC notification.
+type DifficultyChangedNtfn struct {
+	Hash               string
+	Height             int32
+	ProofOfStake       bool
+	Difficulty         float64
+	PreviousDifficulty float64
+}
+
+// NewDifficultyChangedNtfn returns a new instance which can be used to issue
+// a difficultychanged JSON-RPC notification.
+func NewDifficultyChangedNtfn(hash string, height int32, proofOfStake bool,
+	difficulty, previousDifficulty float64) *DifficultyChangedNtfn {
+
+	return &DifficultyChangedNtfn{
+		Hash:               hash,
+		Height:             height,
+		ProofOfStake:       proofOfStake,
+		Difficulty:         difficulty,
+		PreviousDifficulty: previousDifficulty,
+	}
+}
+
+// StakeModifierNtfn defines the stakemodifier JSON-RPC notification.
+type StakeModifierNtfn struct {
+	Hash          string
+	Height        int32
+	StakeModifier uint64
+}
+
+// NewStakeModifierNtfn returns a new instance which can be used to issue a
+// stakemodifier JSON-RPC notification.
+func NewStakeModifierNtfn(hash string, height int32, stakeModifier uint64) *StakeModifierNtfn {
+	return &StakeModifierNtfn{
+		Hash:          hash,
+		Height:        height,
+		StakeModifier: stakeModifier,
+	}
+}
+
+// TemplateChangedNtfn defines the templatechanged JSON-RPC notification.
+type TemplateChangedNtfn struct {
+	TemplateID string
+	Reason     string
+	Template   *GetBlockTemplateResult
+}
+
+// NewTemplateChangedNtfn returns a new instance which can be used to issue a
+// templatechanged JSON-RPC notification.
+func NewTemplateChangedNtfn(templateID, reason string, template *GetBlockTemplateResult) *TemplateChangedNtfn {
+	return &TemplateChangedNtfn{
+		TemplateID: templateID,
+		Reason:     reason,
+		Template:   template,
+	}
+}
+
 // BlockDetails describes details of a tx in a block.
 type BlockDetails struct {
 	Height        int32  `json:"height"`
@@ -178,17 +403,57 @@ func NewTxAcceptedVerboseNtfn(rawTx TxRawResult) *TxAcceptedVerboseNtfn {
 	}
 }
 
+// TxRemovedNtfn defines the txremoved JSON-RPC notification.
+type TxRemovedNtfn struct {
+	TxID   string
+	Reason string
+}
+
+// NewTxRemovedNtfn returns a new instance which can be used to issue a
+// txremoved JSON-RPC notification.
+func NewTxRemovedNtfn(txHash, reason string) *TxRemovedNtfn {
+	return &TxRemovedNtfn{
+		TxID:   txHash,
+		Reason: reason,
+	}
+}
+
+// TxReplacedNtfn defines the txreplaced JSON-RPC notification.
+type TxReplacedNtfn struct {
+	TxID       string
+	ReplacedBy string
+}
+
+// NewTxReplacedNtfn returns a new instance which can be used to issue a
+// txreplaced JSON-RPC notification.
+func NewTxReplacedNtfn(txHash, replacedBy string) *TxReplacedNtfn {
+	return &TxReplacedNtfn{
+		TxID:       txHash,
+		ReplacedBy: replacedBy,
+	}
+}
+
 func init() {
 	// The commands in this file are only usable by websockets and are
 	// notifications.
 	flags := UFWebsocketOnly | UFNotification
 
+	MustRegisterCmd(AlertNtfnMethod, (*AlertNtfn)(nil), flags)
 	MustRegisterCmd(BlockConnectedNtfnMethod, (*BlockConnectedNtfn)(nil), flags)
 	MustRegisterCmd(BlockDisconnectedNtfnMethod, (*BlockDisconnectedNtfn)(nil), flags)
+	MustRegisterCmd(BlockConnectedVerboseNtfnMethod, (*BlockConnectedVerboseNtfn)(nil), flags)
+	MustRegisterCmd(BlockDisconnectedVerboseNtfnMethod, (*BlockDisconnectedVerboseNtfn)(nil), flags)
+	MustRegisterCmd(ChainReorganizedNtfnMethod, (*ChainReorganizedNtfn)(nil), flags)
+	MustRegisterCmd(CoinStakeSpentNtfnMethod, (*CoinStakeSpentNtfn)(nil), flags)
+	MustRegisterCmd(DifficultyChangedNtfnMethod, (*DifficultyChangedNtfn)(nil), flags)
 	MustRegisterCmd(RecvTxNtfnMethod, (*RecvTxNtfn)(nil), flags)
 	MustRegisterCmd(RedeemingTxNtfnMethod, (*RedeemingTxNtfn)(nil), flags)
 	MustRegisterCmd(RescanFinishedNtfnMethod, (*RescanFinishedNtfn)(nil), flags)
 	MustRegisterCmd(RescanProgressNtfnMethod, (*RescanProgressNtfn)(nil), flags)
+	MustRegisterCmd(StakeModifierNtfnMethod, (*StakeModifierNtfn)(nil), flags)
+	MustRegisterCmd(TemplateChangedNtfnMethod, (*TemplateChangedNtfn)(nil), flags)
 	MustRegisterCmd(TxAcceptedNtfnMethod, (*TxAcceptedNtfn)(nil), flags)
 	MustRegisterCmd(TxAcceptedVerboseNtfnMethod, (*TxAcceptedVerboseNtfn)(nil), flags)
+	MustRegisterCmd(TxRemovedNtfnMethod, (*TxRemovedNtfn)(nil), flags)
+	MustRegisterCmd(TxReplacedNtfnMethod, (*TxReplacedNtfn)(nil), flags)
 }
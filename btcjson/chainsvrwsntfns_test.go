@@ -28,6 +28,23 @@ func TestChainSvrWsNtfns(t *testing.T) {
 		marshalled   string
 		unmarshalled interface{}
 	}{
+		{
+			name: "alert",
+			newNtfn: func() (interface{}, error) {
+				return btcjson.NewCmd("alert", 1001, 5000, 1420070400, "URGENT: upgrade required", false)
+			},
+			staticNtfn: func() interface{} {
+				return btcjson.NewAlertNtfn(1001, 5000, 1420070400, "URGENT: upgrade required", false)
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"alert","params":[1001,5000,1420070400,"URGENT: upgrade required",false],"id":null}`,
+			unmarshalled: &btcjson.AlertNtfn{
+				ID:         1001,
+				Priority:   5000,
+				Expiration: 1420070400,
+				StatusBar:  "URGENT: upgrade required",
+				Cancelled:  false,
+			},
+		},
 		{
 			name: "blockconnected",
 			newNtfn: func() (interface{}, error) {
@@ -56,6 +73,196 @@ func TestChainSvrWsNtfns(t *testing.T) {
 				Height: 100000,
 			},
 		},
+		{
+			name: "blockconnectedverbose",
+			newNtfn: func() (interface{}, error) {
+				return btcjson.NewCmd("blockconnectedverbose", `{"hash":"123","height":100000,"version":2,"previousblockhash":"456","merkleroot":"789","time":12345678,"bits":"1c00ffff","nonce":0,"proofofstake":true,"mint":1.5,"moneysupply":21000000,"modifier":42,"generatedmodifier":true,"kernel":{"hash":"abc","index":1},"proofhash":"def"}`)
+			},
+			staticNtfn: func() interface{} {
+				return btcjson.NewBlockConnectedVerboseNtfn(btcjson.BlockVerboseDetails{
+					Hash:              "123",
+					Height:            100000,
+					Version:           2,
+					PreviousHash:      "456",
+					MerkleRoot:        "789",
+					Time:              12345678,
+					Bits:              "1c00ffff",
+					ProofOfStake:      true,
+					Mint:              1.5,
+					MoneySupply:       21000000,
+					StakeModifier:     42,
+					GeneratedModifier: true,
+					Kernel:            &btcjson.OutPoint{Hash: "abc", Index: 1},
+					ProofHash:         "def",
+				})
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"blockconnectedverbose","params":[{"hash":"123","height":100000,"version":2,"previousblockhash":"456","merkleroot":"789","time":12345678,"bits":"1c00ffff","nonce":0,"proofofstake":true,"mint":1.5,"moneysupply":21000000,"modifier":42,"generatedmodifier":true,"kernel":{"hash":"abc","index":1},"proofhash":"def"}],"id":null}`,
+			unmarshalled: &btcjson.BlockConnectedVerboseNtfn{
+				Block: btcjson.BlockVerboseDetails{
+					Hash:              "123",
+					Height:            100000,
+					Version:           2,
+					PreviousHash:      "456",
+					MerkleRoot:        "789",
+					Time:              12345678,
+					Bits:              "1c00ffff",
+					ProofOfStake:      true,
+					Mint:              1.5,
+					MoneySupply:       21000000,
+					StakeModifier:     42,
+					GeneratedModifier: true,
+					Kernel:            &btcjson.OutPoint{Hash: "abc", Index: 1},
+					ProofHash:         "def",
+				},
+			},
+		},
+		{
+			name: "blockdisconnectedverbose",
+			newNtfn: func() (interface{}, error) {
+				return btcjson.NewCmd("blockdisconnectedverbose", `{"hash":"123","height":100000,"version":2,"previousblockhash":"456","merkleroot":"789","time":12345678,"bits":"1c00ffff","nonce":7,"proofofstake":false,"mint":1.5,"moneysupply":21000000,"modifier":42,"generatedmodifier":false}`)
+			},
+			staticNtfn: func() interface{} {
+				return btcjson.NewBlockDisconnectedVerboseNtfn(btcjson.BlockVerboseDetails{
+					Hash:          "123",
+					Height:        100000,
+					Version:       2,
+					PreviousHash:  "456",
+					MerkleRoot:    "789",
+					Time:          12345678,
+					Bits:          "1c00ffff",
+					Nonce:         7,
+					Mint:          1.5,
+					MoneySupply:   21000000,
+					StakeModifier: 42,
+				})
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"blockdisconnectedverbose","params":[{"hash":"123","height":100000,"version":2,"previousblockhash":"456","merkleroot":"789","time":12345678,"bits":"1c00ffff","nonce":7,"proofofstake":false,"mint":1.5,"moneysupply":21000000,"modifier":42,"generatedmodifier":false}],"id":null}`,
+			unmarshalled: &btcjson.BlockDisconnectedVerboseNtfn{
+				Block: btcjson.BlockVerboseDetails{
+					Hash:          "123",
+					Height:        100000,
+					Version:       2,
+					PreviousHash:  "456",
+					MerkleRoot:    "789",
+					Time:          12345678,
+					Bits:          "1c00ffff",
+					Nonce:         7,
+					Mint:          1.5,
+					MoneySupply:   21000000,
+					StakeModifier: 42,
+				},
+			},
+		},
+		{
+			name: "chainreorganized",
+			newNtfn: func() (interface{}, error) {
+				return btcjson.NewCmd("chainreorganized", "123", 100000, `["456","789"]`, `["abc","def","012"]`)
+			},
+			staticNtfn: func() interface{} {
+				return btcjson.NewChainReorganizedNtfn("123", 100000,
+					[]string{"456", "789"}, []string{"abc", "def", "012"})
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"chainreorganized","params":["123",100000,["456","789"],["abc","def","012"]],"id":null}`,
+			unmarshalled: &btcjson.ChainReorganizedNtfn{
+				ForkHash:     "123",
+				ForkHeight:   100000,
+				Disconnected: []string{"456", "789"},
+				Connected:    []string{"abc", "def", "012"},
+			},
+		},
+		{
+			name: "coinstakespent",
+			newNtfn: func() (interface{}, error) {
+				return btcjson.NewCmd("coinstakespent", "123", 100000, "456", `{"hash":"789","index":1}`)
+			},
+			staticNtfn: func() interface{} {
+				return btcjson.NewCoinStakeSpentNtfn("123", 100000, "456",
+					btcjson.OutPoint{Hash: "789", Index: 1})
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"coinstakespent","params":["123",100000,"456",{"hash":"789","index":1}],"id":null}`,
+			unmarshalled: &btcjson.CoinStakeSpentNtfn{
+				Hash:     "123",
+				Height:   100000,
+				TxID:     "456",
+				OutPoint: btcjson.OutPoint{Hash: "789", Index: 1},
+			},
+		},
+		{
+			name: "difficultychanged",
+			newNtfn: func() (interface{}, error) {
+				return btcjson.NewCmd("difficultychanged", "123", 100000, true, 12.5, 12.25)
+			},
+			staticNtfn: func() interface{} {
+				return btcjson.NewDifficultyChangedNtfn("123", 100000, true, 12.5, 12.25)
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"difficultychanged","params":["123",100000,true,12.5,12.25],"id":null}`,
+			unmarshalled: &btcjson.DifficultyChangedNtfn{
+				Hash:               "123",
+				Height:             100000,
+				ProofOfStake:       true,
+				Difficulty:         12.5,
+				PreviousDifficulty: 12.25,
+			},
+		},
+		{
+			name: "stakemodifier",
+			newNtfn: func() (interface{}, error) {
+				return btcjson.NewCmd("stakemodifier", "123", 100000, 1189962317212391482)
+			},
+			staticNtfn: func() interface{} {
+				return btcjson.NewStakeModifierNtfn("123", 100000, 1189962317212391482)
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"stakemodifier","params":["123",100000,1189962317212391482],"id":null}`,
+			unmarshalled: &btcjson.StakeModifierNtfn{
+				Hash:          "123",
+				Height:        100000,
+				StakeModifier: 1189962317212391482,
+			},
+		},
+		{
+			name: "templatechanged",
+			newNtfn: func() (interface{}, error) {
+				return btcjson.NewCmd("templatechanged", "123-1438000000", "newtip")
+			},
+			staticNtfn: func() interface{} {
+				return btcjson.NewTemplateChangedNtfn("123-1438000000", "newtip", nil)
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"templatechanged","params":["123-1438000000","newtip"],"id":null}`,
+			unmarshalled: &btcjson.TemplateChangedNtfn{
+				TemplateID: "123-1438000000",
+				Reason:     "newtip",
+			},
+		},
+		{
+			name: "templatechanged verbose",
+			newNtfn: func() (interface{}, error) {
+				return btcjson.NewCmd("templatechanged", "123-1438000000", "mempool", `{"bits":"1c00ffff","curtime":1438000000,"height":100000,"previousblockhash":"123","transactions":[],"version":1}`)
+			},
+			staticNtfn: func() interface{} {
+				template := btcjson.GetBlockTemplateResult{
+					Bits:         "1c00ffff",
+					CurTime:      1438000000,
+					Height:       100000,
+					PreviousHash: "123",
+					Version:      1,
+					Transactions: []btcjson.GetBlockTemplateResultTx{},
+				}
+				return btcjson.NewTemplateChangedNtfn("123-1438000000", "mempool", &template)
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"templatechanged","params":["123-1438000000","mempool",{"bits":"1c00ffff","curtime":1438000000,"height":100000,"previousblockhash":"123","transactions":[],"version":1}],"id":null}`,
+			unmarshalled: &btcjson.TemplateChangedNtfn{
+				TemplateID: "123-1438000000",
+				Reason:     "mempool",
+				Template: &btcjson.GetBlockTemplateResult{
+					Bits:         "1c00ffff",
+					CurTime:      1438000000,
+					Height:       100000,
+					PreviousHash: "123",
+					Version:      1,
+					Transactions: []btcjson.GetBlockTemplateResultTx{},
+				},
+			},
+		},
 		{
 			name: "recvtx",
 			newNtfn: func() (interface{}, error) {
@@ -180,6 +387,34 @@ func TestChainSvrWsNtfns(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "txremoved",
+			newNtfn: func() (interface{}, error) {
+				return btcjson.NewCmd("txremoved", "123", "evicted")
+			},
+			staticNtfn: func() interface{} {
+				return btcjson.NewTxRemovedNtfn("123", "evicted")
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"txremoved","params":["123","evicted"],"id":null}`,
+			unmarshalled: &btcjson.TxRemovedNtfn{
+				TxID:   "123",
+				Reason: "evicted",
+			},
+		},
+		{
+			name: "txreplaced",
+			newNtfn: func() (interface{}, error) {
+				return btcjson.NewCmd("txreplaced", "123", "456")
+			},
+			staticNtfn: func() interface{} {
+				return btcjson.NewTxReplacedNtfn("123", "456")
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"txreplaced","params":["123","456"],"id":null}`,
+			unmarshalled: &btcjson.TxReplacedNtfn{
+				TxID:       "123",
+				ReplacedBy: "456",
+			},
+		},
 	}
 
 	t.Logf("Running %d tests", len(tests))
@@ -17,6 +17,7 @@ func init() {
 	MustRegisterCmd("getkernelstakemodifier", (*GetKernelStakeModifierCmd)(nil), flags)
 	MustRegisterCmd("getnextrequiredtarget", (*GetNextRequiredTargetCmd)(nil), flags)
 	MustRegisterCmd("getlastproofofworkreward", (*GetLastProofOfWorkRewardCmd)(nil), flags)
+	MustRegisterCmd("getstakeseeninfo", (*GetStakeSeenInfoCmd)(nil), flags)
 	MustRegisterCmd("sendcoinstaketransaction", (*SendCoinStakeTransactionCmd)(nil), flags)
 	MustRegisterCmd("sendmintblocksignature", (*SendMintBlockSignatureCmd)(nil), flags)
 
@@ -153,6 +154,25 @@ type LastProofOfWorkRewardResult struct {
 	Subsidy BlockReward `json:"subsidy"`
 }
 
+// GetStakeSeenInfoCmd defines the getstakeseeninfo JSON-RPC command.
+type GetStakeSeenInfoCmd struct{}
+
+// NewGetStakeSeenInfoCmd returns a new instance which can be used to issue a
+// getstakeseeninfo JSON-RPC command.
+func NewGetStakeSeenInfoCmd() *GetStakeSeenInfoCmd {
+	return &GetStakeSeenInfoCmd{}
+}
+
+// GetStakeSeenInfoResult models the data from the getstakeseeninfo command.
+type GetStakeSeenInfoResult struct {
+	MainChain       int32  `json:"mainchain"`
+	MaxMainChain    int32  `json:"maxmainchain"`
+	Orphans         int32  `json:"orphans"`
+	MaxOrphans      int32  `json:"maxorphans"`
+	Rejected        uint64 `json:"rejected"`
+	RejectedOrphans uint64 `json:"rejectedorphans"`
+}
+
 // FindStakeCmd is a type handling custom marshaling and
 // unmarshaling of FindStake JSON RPC commands.
 type FindStakeCmd struct {
@@ -5,6 +5,7 @@
 package chaincfg
 
 import (
+	"encoding/hex"
 	"errors"
 	"math/big"
 
@@ -116,6 +117,11 @@ type Params struct {
 	// Modifier interval: time to elapse before new modifier is computed
 	ModifierInterval         int64
 	StakeModifierCheckpoints map[int64]uint32
+
+	// AlertPubKey is the serialized public key which must have signed
+	// network alert messages for them to be accepted and relayed.  Alerts
+	// are ignored on networks that do not define one.
+	AlertPubKey []byte
 }
 
 // MainNetParams defines the network parameters for the main Bitcoin network.
@@ -179,6 +185,10 @@ var MainNetParams = Params{
 		30583: uint32(0xdc7bf136),
 		99999: uint32(0xf555cfd2),
 	},
+	// ppc: alert key used by the reference client
+	AlertPubKey: hexDecode("04a0a849dd49b113d3179a332dd77715c43be4d0076e2f19" +
+		"e66de23dd707e56630f792f298dfd209bf042bb3561f4af6983f3d81e439737ab0" +
+		"bf7f898fecd21aab"),
 }
 
 // RegressionNetParams defines the network parameters for the regression test
@@ -227,6 +237,12 @@ var RegressionNetParams = Params{
 	// BIP44 coin type used in the hierarchical deterministic path for
 	// address generation.
 	HDCoinType: 1,
+
+	// Peercoin
+	StakeMinAge:              60 * 60, // regression test min age is 1 hour
+	InitialHashTargetBits:    0x207fffff,
+	ModifierInterval:         60, // regression test modifier interval is 1 minute
+	StakeModifierCheckpoints: map[int64]uint32{},
 }
 
 // TestNet3Params defines the network parameters for the test Bitcoin network
@@ -282,6 +298,9 @@ var TestNet3Params = Params{
 	InitialHashTargetBits:    0x1d07ffff,
 	ModifierInterval:         60 * 20, // test net modifier interval is 20 minutes
 	StakeModifierCheckpoints: map[int64]uint32{},
+	AlertPubKey: hexDecode("0471dc165db490094d35cde15b1f5d755fa6ad6f2b5ed0f3" +
+		"40e3f17f57389c3c2af113a8cbcc885bde73305a553b5640c83021128008ddf882" +
+		"e856336269080496"),
 }
 
 // SimNetParams defines the network parameters for the simulation test Bitcoin
@@ -334,6 +353,12 @@ var SimNetParams = Params{
 	// BIP44 coin type used in the hierarchical deterministic path for
 	// address generation.
 	HDCoinType: 115, // ASCII for s
+
+	// Peercoin
+	StakeMinAge:              60 * 60, // simulation test min age is 1 hour
+	InitialHashTargetBits:    0x207fffff,
+	ModifierInterval:         60, // simulation test modifier interval is 1 minute
+	StakeModifierCheckpoints: map[int64]uint32{},
 }
 
 var (
@@ -454,3 +479,14 @@ func newShaHashFromStr(hexStr string) *wire.ShaHash {
 	}
 	return sha
 }
+
+// hexDecode returns the bytes represented by the passed hex string.  Like
+// newShaHashFromStr, it panics on an error since it must only be called with
+// hard-coded, and therefore known good, values.
+func hexDecode(hexStr string) []byte {
+	b, err := hex.DecodeString(hexStr)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
@@ -0,0 +1,145 @@
+// Copyright (c) 2015 PPCD developers.
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"sync"
+	"time"
+
+	"github.com/ppcsuite/ppcd/blockchain"
+	"github.com/ppcsuite/ppcd/database"
+)
+
+// maxFollowAdvance is the maximum duration the clock is advanced by a single
+// block generated by another node.  It is the target block spacing the clock
+// is advanced by before each block generated locally.
+const maxFollowAdvance = time.Duration(blockchain.StakeTargetSpacing) * time.Second
+
+// nodeClock provides the local time used by the block chain, memory pool,
+// miner and peer code.  On the regression and simulation test networks the
+// time may be mocked, either by setting it to a fixed time with the
+// setmocktime RPC or by advancing it past the system time while generating
+// blocks, so tests of the time dependent stake rules are reproducible.  On the
+// other networks it always returns the system time.
+type nodeClock struct {
+	mockable bool
+
+	mtx      sync.Mutex
+	mockTime time.Time     // fixed time when not zero
+	offset   time.Duration // offset from the system time otherwise
+}
+
+// newNodeClock returns a new clock which may only be mocked when mockable is
+// set.
+func newNodeClock(mockable bool) *nodeClock {
+	return &nodeClock{mockable: mockable}
+}
+
+// Now returns the current local time.
+//
+// This function is safe for concurrent access.
+func (c *nodeClock) Now() time.Time {
+	if !c.mockable {
+		return time.Now()
+	}
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	if !c.mockTime.IsZero() {
+		return c.mockTime
+	}
+	return time.Now().Add(c.offset)
+}
+
+// setMockTime fixes the clock to the passed time.  Passing the zero time
+// releases the clock so it follows the system time again.  It has no effect
+// when the clock is not mockable.
+//
+// This function is safe for concurrent access.
+func (c *nodeClock) setMockTime(t time.Time) {
+	if !c.mockable {
+		return
+	}
+
+	c.mtx.Lock()
+	c.mockTime = t
+	c.mtx.Unlock()
+}
+
+// advanceTo advances the clock to the passed time.  It has no effect when the
+// clock is not mockable or is already after the passed time.
+//
+// This function is safe for concurrent access.
+func (c *nodeClock) advanceTo(t time.Time) {
+	if !c.mockable {
+		return
+	}
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	if !c.mockTime.IsZero() {
+		if t.After(c.mockTime) {
+			c.mockTime = t
+		}
+		return
+	}
+	if offset := t.Sub(time.Now()); offset > c.offset {
+		c.offset = offset
+	}
+}
+
+// followBlock advances the clock towards the timestamp of a block generated by
+// another node which was accepted to the main chain, so the following blocks
+// of that node are not rejected for being too far in the future.  The clock is
+// advanced by at most maxFollowAdvance per block so blocks with bogus
+// timestamps can not push it forward arbitrarily.  It has no effect when the
+// clock is not mockable or is fixed to a time set with setMockTime.
+//
+// This function is safe for concurrent access.
+func (c *nodeClock) followBlock(t time.Time) {
+	if !c.mockable {
+		return
+	}
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	if !c.mockTime.IsZero() {
+		return
+	}
+	now := time.Now()
+	if limit := now.Add(c.offset + maxFollowAdvance); t.After(limit) {
+		t = limit
+	}
+	if offset := t.Sub(now); offset > c.offset {
+		c.offset = offset
+	}
+}
+
+// advanceToBestBlock advances the clock to the timestamp of the best block in
+// the passed database since the clock may have been advanced past the system
+// time before the node was restarted.  It has no effect when the clock is not
+// mockable.
+func (c *nodeClock) advanceToBestBlock(db database.Db) error {
+	if !c.mockable {
+		return nil
+	}
+
+	sha, height, err := db.NewestSha()
+	if err != nil {
+		return err
+	}
+	if height < 0 {
+		return nil
+	}
+	header, _, err := db.FetchBlockHeaderBySha(sha)
+	if err != nil {
+		return err
+	}
+	c.advanceTo(header.Timestamp)
+	return nil
+}
@@ -0,0 +1,51 @@
+// Copyright (c) 2015 PPCD developers.
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// TestNodeClockFollowBlock ensures the clock follows the timestamps of blocks
+// generated by other nodes by at most maxFollowAdvance per block and neither
+// moves back nor overrides a fixed mock time.
+func TestNodeClockFollowBlock(t *testing.T) {
+	const slack = time.Minute
+	tests := []struct {
+		name     string
+		mockable bool
+		mockTime time.Time
+		offset   time.Duration // offset of the block timestamp
+		want     time.Duration // wanted offset of the clock
+	}{
+		{"not mockable", false, time.Time{}, maxFollowAdvance, 0},
+		{"past block", true, time.Time{}, -time.Hour, 0},
+		{"future block", true, time.Time{}, maxFollowAdvance / 2,
+			maxFollowAdvance / 2},
+		{"far future block", true, time.Time{}, 100 * maxFollowAdvance,
+			maxFollowAdvance},
+		{"fixed mock time", true, time.Unix(1420070400, 0),
+			maxFollowAdvance, 0},
+	}
+	for _, test := range tests {
+		c := newNodeClock(test.mockable)
+		c.setMockTime(test.mockTime)
+		c.followBlock(time.Now().Add(test.offset))
+
+		if !test.mockTime.IsZero() {
+			if got := c.Now(); !got.Equal(test.mockTime) {
+				t.Errorf("%s: got time %v, want %v", test.name,
+					got, test.mockTime)
+			}
+			continue
+		}
+		got := c.Now().Sub(time.Now())
+		if got < test.want-slack || got > test.want+slack {
+			t.Errorf("%s: got offset %v, want %v", test.name, got,
+				test.want)
+		}
+	}
+}
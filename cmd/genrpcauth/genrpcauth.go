@@ -0,0 +1,88 @@
+// Copyright (c) 2015 PPCD developers.
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"os"
+
+	"github.com/btcsuite/fastsha256"
+	flags "github.com/btcsuite/go-flags"
+)
+
+type config struct {
+	User     string `short:"u" long:"user" description:"Username of the RPC user" required:"true"`
+	Password string `short:"p" long:"password" description:"Password of the RPC user -- A random password is generated when not specified"`
+}
+
+func main() {
+	cfg := config{}
+	parser := flags.NewParser(&cfg, flags.Default)
+	_, err := parser.Parse()
+	if err != nil {
+		if e, ok := err.(*flags.Error); !ok || e.Type != flags.ErrHelp {
+			parser.WriteHelp(os.Stderr)
+		}
+		return
+	}
+
+	password := cfg.Password
+	if password == "" {
+		password, err = randomString(32)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "cannot generate password: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	salt, err := randomHex(16)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "cannot generate salt: %v\n", err)
+		os.Exit(1)
+	}
+
+	// The hash is the HMAC-SHA256 of the password keyed by the salt, which
+	// is the same as the rpcauth option of Bitcoin Core.
+	mac := hmac.New(fastsha256.New, []byte(salt))
+	mac.Write([]byte(password))
+	hash := hex.EncodeToString(mac.Sum(nil))
+
+	fmt.Println("String to be appended to ppcd.conf:")
+	fmt.Printf("rpcauth=%s:%s$%s\n", cfg.User, salt, hash)
+	if cfg.Password == "" {
+		fmt.Printf("Your password:\n%s\n", password)
+	}
+}
+
+// randomBytes returns n cryptographically random bytes.
+func randomBytes(n int) ([]byte, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// randomHex returns n cryptographically random bytes encoded as hex.
+func randomHex(n int) (string, error) {
+	b, err := randomBytes(n)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// randomString returns n cryptographically random bytes encoded as URL safe
+// base64.
+func randomString(n int) (string, error) {
+	b, err := randomBytes(n)
+	if err != nil {
+		return "", err
+	}
+	return base64.URLEncoding.EncodeToString(b), nil
+}
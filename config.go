@@ -31,10 +31,15 @@ const (
 	defaultLogLevel          = "info"
 	defaultLogDirname        = "logs"
 	defaultLogFilename       = "ppcd.log"
+	defaultLogFormat         = logFormatText
+	defaultLogMaxSize        = 10
+	defaultLogMaxRolls       = 3
 	defaultMaxPeers          = 125
 	defaultBanDuration       = time.Hour * 24
+	defaultBanThreshold      = 100
 	defaultMaxRPCClients     = 10
 	defaultMaxRPCWebsockets  = 25
+	defaultMaxRPCRescans     = 4
 	defaultVerifyEnabled     = false
 	defaultDbType            = "leveldb"
 	defaultFreeTxRelayLimit  = 15.0
@@ -44,7 +49,13 @@ const (
 	blockMaxSizeMax          = wire.MaxBlockPayload - 1000
 	defaultBlockPrioritySize = 50000
 	defaultGenerate          = false
+	defaultStratumDifficulty = 1.0
+	defaultTemplateFeeDelta  = 0.1
+	defaultMetricsPort       = "9904"
 	defaultAddrIndex         = false
+	defaultMaxBlocksInFlight = 128
+	defaultMaxMempool        = 300
+	defaultMempoolExpiry     = time.Hour * 24 * 14
 )
 
 var (
@@ -69,22 +80,41 @@ type config struct {
 	ConfigFile         string        `short:"C" long:"configfile" description:"Path to configuration file"`
 	DataDir            string        `short:"b" long:"datadir" description:"Directory to store data"`
 	LogDir             string        `long:"logdir" description:"Directory to log output."`
+	LogFormat          string        `long:"logformat" description:"Format of log messages {text, json} -- The json format writes an object per line with the time, level, subsystem and message, and the first peer, hash and height mentioned in the message"`
+	LogMaxSize         int           `long:"logmaxsize" description:"Maximum size in MiB of a log file before it is rotated"`
+	LogMaxAge          time.Duration `long:"logmaxage" description:"Maximum time a log file is written to before it is rotated (eg. 24h) -- 0 to only rotate by size"`
+	LogMaxRolls        int           `long:"logmaxrolls" description:"Number of rotated log files to keep"`
+	LogSubsystemFiles  bool          `long:"logsubsystemfiles" description:"Also write the messages of each subsystem to its own log file named after the subsystem, such as peer.log"`
 	AddPeers           []string      `short:"a" long:"addpeer" description:"Add a peer to connect with at startup"`
 	ConnectPeers       []string      `long:"connect" description:"Connect only to the specified peers at startup"`
 	DisableListen      bool          `long:"nolisten" description:"Disable listening for incoming connections -- NOTE: Listening is automatically disabled if the --connect or --proxy options are used without also specifying listen interfaces via --listen"`
 	Listeners          []string      `long:"listen" description:"Add an interface/port to listen for connections (default all interfaces port: 8333, testnet: 18333)"`
 	MaxPeers           int           `long:"maxpeers" description:"Max number of inbound and outbound peers"`
 	BanDuration        time.Duration `long:"banduration" description:"How long to ban misbehaving peers.  Valid time units are {s, m, h}.  Minimum 1 second"`
+	BanThreshold       uint32        `long:"banthreshold" description:"Ban score at which misbehaving peers are disconnected and banned"`
+	MaxBlocksInFlight  int           `long:"maxblocksinflight" description:"Max number of blocks to request from a single peer at once while downloading blocks during the initial sync"`
+	NoAlertRelay       bool          `long:"noalertrelay" description:"Do not relay network alerts to other peers -- Valid alerts are still logged and reported"`
 	RPCUser            string        `short:"u" long:"rpcuser" description:"Username for RPC connections"`
 	RPCPass            string        `short:"P" long:"rpcpass" default-mask:"-" description:"Password for RPC connections"`
 	RPCLimitUser       string        `long:"rpclimituser" description:"Username for limited RPC connections"`
 	RPCLimitPass       string        `long:"rpclimitpass" default-mask:"-" description:"Password for limited RPC connections"`
+	RPCAuth            []string      `long:"rpcauth" description:"Add an RPC user authenticated by a salted password hash in the form <user>:<salt>$<hash> -- Use genrpcauth to create one"`
+	RPCAuthMethods     []string      `long:"rpcauthmethods" description:"Set the comma-separated RPC methods and roles (admin, limited) an --rpcauth user may invoke in the form <user>:<methods> -- Users have the limited role by default"`
+	RPCAuthAllowIPs    []string      `long:"rpcauthallowip" description:"Only allow an --rpcauth user to connect from an IP address or CIDR network in the form <user>:<ip or network>"`
 	RPCListeners       []string      `long:"rpclisten" description:"Add an interface/port to listen for RPC connections (default port: 8334, testnet: 18334)"`
 	RPCCert            string        `long:"rpccert" description:"File containing the certificate file"`
 	RPCKey             string        `long:"rpckey" description:"File containing the certificate key"`
 	RPCMaxClients      int           `long:"rpcmaxclients" description:"Max number of RPC clients for standard connections"`
 	RPCMaxWebsockets   int           `long:"rpcmaxwebsockets" description:"Max number of RPC websocket connections"`
-	DisableRPC         bool          `long:"norpc" description:"Disable built-in RPC server -- NOTE: The RPC server is disabled by default if no rpcuser/rpcpass or rpclimituser/rpclimitpass is specified"`
+	RPCMaxRescans      int           `long:"rpcmaxrescans" description:"Max number of rescans a single RPC websocket client may have running or queued at once"`
+	RPCMaxRescanBlocks int64         `long:"rpcmaxrescanblocks" description:"Max number of blocks a single rescan may cover -- 0 for no limit"`
+	DisableRPC         bool          `long:"norpc" description:"Disable built-in RPC server -- NOTE: The RPC server is disabled by default if no rpcuser/rpcpass, rpclimituser/rpclimitpass or rpcauth is specified"`
+	REST               bool          `long:"rest" description:"Enable the unauthenticated REST interface for read-only chain data on the RPC listeners"`
+	PubHashBlock       string        `long:"pubhashblock" description:"Publish the hashes of the blocks connected to the main chain to ZeroMQ subscribers of the hashblock topic on the given address (eg. tcp://127.0.0.1:28332)"`
+	PubHashTx          string        `long:"pubhashtx" description:"Publish the hashes of the transactions accepted to the memory pool or connected to the main chain to ZeroMQ subscribers of the hashtx topic on the given address"`
+	PubRawBlock        string        `long:"pubrawblock" description:"Publish the serialized blocks connected to the main chain to ZeroMQ subscribers of the rawblock topic on the given address"`
+	PubRawTx           string        `long:"pubrawtx" description:"Publish the serialized transactions accepted to the memory pool or connected to the main chain to ZeroMQ subscribers of the rawtx topic on the given address"`
+	MetricsListeners   []string      `long:"metricslisten" description:"Add an interface/port to serve Prometheus metrics of the node at /metrics on (default port: 9904) -- The metrics server is disabled unless at least one is specified"`
 	DisableTLS         bool          `long:"notls" description:"Disable TLS for the RPC server -- NOTE: This is only allowed if the RPC server is bound to localhost"`
 	DisableDNSSeed     bool          `long:"nodnsseed" description:"Disable DNS seeding for peers"`
 	ExternalIPs        []string      `long:"externalip" description:"Add an ip to the list of local addresses we claim to listen on to peers"`
@@ -103,16 +133,24 @@ type config struct {
 	DbType             string        `long:"dbtype" description:"Database backend to use for the Block Chain"`
 	Profile            string        `long:"profile" description:"Enable HTTP profiling on given port -- NOTE port must be between 1024 and 65536"`
 	CPUProfile         string        `long:"cpuprofile" description:"Write CPU profile to the specified file"`
-	DebugLevel         string        `short:"d" long:"debuglevel" description:"Logging level for all subsystems {trace, debug, info, warn, error, critical} -- You may also specify <subsystem>=<level>,<subsystem2>=<level>,... to set the log level for individual subsystems -- Use show to list available subsystems"`
+	DebugLevel         string        `short:"d" long:"debuglevel" description:"Logging level for all subsystems {trace, debug, info, warn, error, critical} -- You may also specify <subsystem>=<level>,<subsystem2>=<level>,... to set the log level for individual subsystems -- Use show to list available subsystems -- Levels set with the debuglevel RPC are saved to the debuglevels file in the data directory and restored on startup unless this option is set to anything but the default"`
 	Upnp               bool          `long:"upnp" description:"Use UPnP to map our listening port outside of NAT"`
 	FreeTxRelayLimit   float64       `long:"limitfreerelay" description:"Limit relay of transactions with no transaction fee to the given amount in thousands of bytes per minute"`
 	NoRelayPriority    bool          `long:"norelaypriority" description:"Do not require free or low-fee transactions to have high priority for relaying"`
 	MaxOrphanTxs       int           `long:"maxorphantx" description:"Max number of orphan transactions to keep in memory"`
+	MaxMempool         uint32        `long:"maxmempool" description:"Max size in megabytes of the transactions to keep in the memory pool -- Transactions paying the lowest fee per kilobyte are evicted once the limit is reached"`
+	MempoolExpiry      time.Duration `long:"mempoolexpiry" description:"Remove transactions from the memory pool which have not been mined after this duration, along with any transactions which depend on them.  Valid time units are {s, m, h}.  Minimum 1 hour"`
+	NoPersistMempool   bool          `long:"nopersistmempool" description:"Do not save the memory pool on shutdown and reload it on startup"`
+	MempoolReplacement bool          `long:"mempoolreplacement" description:"Allow transactions in the memory pool which signal replaceability (BIP125) to be replaced by conflicting transactions paying higher fees"`
 	Generate           bool          `long:"generate" description:"Generate (mine) bitcoins using the CPU"`
 	MiningAddrs        []string      `long:"miningaddr" description:"Add the specified payment address to the list of addresses to use for generated blocks -- At least one address is required if the generate option is set"`
+	TestKeys           []string      `long:"testkey" description:"Add the specified WIF-encoded private key to the keys used to sign generated blocks and to mint blocks with the generatepos RPC -- Only allowed on the regtest and simnet networks"`
 	BlockMinSize       uint32        `long:"blockminsize" description:"Mininum block size in bytes to be used when creating a block"`
 	BlockMaxSize       uint32        `long:"blockmaxsize" description:"Maximum block size in bytes to be used when creating a block"`
 	BlockPrioritySize  uint32        `long:"blockprioritysize" description:"Size in bytes for high-priority/low-fee transactions when creating a block"`
+	StratumListeners   []string      `long:"stratumlisten" description:"Add an interface/port to listen for stratum mining connections (default port: 3333, testnet: 13333) -- The stratum server is disabled unless at least one is specified"`
+	StratumDifficulty  float64       `long:"stratumdiff" description:"Minimum and initial share difficulty for stratum mining clients"`
+	TemplateFeeDelta   float64       `long:"templatefeedelta" description:"Minimum increase in PPC of the fees of a block template for notifytemplates clients to be notified of it when the best block did not change"`
 	GetWorkKeys        []string      `long:"getworkkey" description:"DEPRECATED -- Use the --miningaddr option instead"`
 	AddrIndex          bool          `long:"addrindex" description:"Build and maintain a full address index. Currently only supported by leveldb."`
 	DropAddrIndex      bool          `long:"dropaddrindex" description:"Deletes the address-based transaction index from the database on start up, and the exits."`
@@ -121,6 +159,8 @@ type config struct {
 	oniondial          func(string, string) (net.Conn, error)
 	dial               func(string, string) (net.Conn, error)
 	miningAddrs        []btcutil.Address
+	testKeys           []*btcutil.WIF
+	rpcAuthUsers       map[string]*rpcAuthUser
 }
 
 // serviceOptions defines the configuration options for btcd as a service on
@@ -310,10 +350,16 @@ func loadConfig() (*config, []string, error) {
 		DebugLevel:        defaultLogLevel,
 		MaxPeers:          defaultMaxPeers,
 		BanDuration:       defaultBanDuration,
+		BanThreshold:      defaultBanThreshold,
+		MaxBlocksInFlight: defaultMaxBlocksInFlight,
 		RPCMaxClients:     defaultMaxRPCClients,
 		RPCMaxWebsockets:  defaultMaxRPCWebsockets,
+		RPCMaxRescans:     defaultMaxRPCRescans,
 		DataDir:           defaultDataDir,
 		LogDir:            defaultLogDir,
+		LogFormat:         defaultLogFormat,
+		LogMaxSize:        defaultLogMaxSize,
+		LogMaxRolls:       defaultLogMaxRolls,
 		DbType:            defaultDbType,
 		RPCKey:            defaultRPCKeyFile,
 		RPCCert:           defaultRPCCertFile,
@@ -322,7 +368,11 @@ func loadConfig() (*config, []string, error) {
 		BlockMaxSize:      defaultBlockMaxSize,
 		BlockPrioritySize: defaultBlockPrioritySize,
 		MaxOrphanTxs:      maxOrphanTransactions,
+		MaxMempool:        defaultMaxMempool,
+		MempoolExpiry:     defaultMempoolExpiry,
 		Generate:          defaultGenerate,
+		StratumDifficulty: defaultStratumDifficulty,
+		TemplateFeeDelta:  defaultTemplateFeeDelta,
 		AddrIndex:         defaultAddrIndex,
 	}
 
@@ -462,8 +512,31 @@ func loadConfig() (*config, []string, error) {
 		os.Exit(0)
 	}
 
+	// Validate the format of log messages.
+	if cfg.LogFormat != logFormatText && cfg.LogFormat != logFormatJSON {
+		str := "%s: The specified log format [%v] is invalid -- " +
+			"supported formats are %s and %s"
+		err := fmt.Errorf(str, funcName, cfg.LogFormat, logFormatText,
+			logFormatJSON)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
+	// Validate the rotation of log files.
+	if cfg.LogMaxSize < 1 || cfg.LogMaxAge < 0 || cfg.LogMaxRolls < 0 {
+		str := "%s: The logmaxsize option must be at least 1 and the " +
+			"logmaxage and logmaxrolls options can't be negative " +
+			"-- parsed [%d, %v, %d]"
+		err := fmt.Errorf(str, funcName, cfg.LogMaxSize, cfg.LogMaxAge,
+			cfg.LogMaxRolls)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
 	// Initialize logging at the default logging level.
-	initSeelogLogger(filepath.Join(cfg.LogDir, defaultLogFilename))
+	initSeelogLogger(&cfg)
 	setLogLevels(defaultLogLevel)
 
 	// Parse, validate, and set debug log level(s).
@@ -474,6 +547,32 @@ func loadConfig() (*config, []string, error) {
 		return nil, nil, err
 	}
 
+	// Restore the debug levels set with the debuglevel RPC unless the
+	// debuglevel option is set to anything but the default level, in which
+	// case the option takes precedence.
+	debugLevelsFile := filepath.Join(cfg.DataDir, debugLevelsFilename)
+	if cfg.DebugLevel != defaultLogLevel {
+		if fileExists(debugLevelsFile) {
+			btcdLog.Infof("Ignoring the debug levels saved to %s "+
+				"since the debuglevel option is set",
+				debugLevelsFile)
+		}
+	} else {
+		restored, err := loadDebugLevels(debugLevelsFile)
+		if err != nil {
+			str := "%s: Unable to restore the debug levels from " +
+				"%s: %v -- remove the file or set the " +
+				"debuglevel option"
+			err := fmt.Errorf(str, funcName, debugLevelsFile, err)
+			fmt.Fprintln(os.Stderr, err)
+			return nil, nil, err
+		}
+		if restored {
+			btcdLog.Infof("Restored the debug levels saved to %s",
+				debugLevelsFile)
+		}
+	}
+
 	// Validate database type.
 	if !validDbType(cfg.DbType) {
 		str := "%s: The specified database type [%v] is invalid -- " +
@@ -521,6 +620,45 @@ func loadConfig() (*config, []string, error) {
 		return nil, nil, err
 	}
 
+	// Don't allow a ban threshold of zero.
+	if cfg.BanThreshold < 1 {
+		str := "%s: The banthreshold option may not be less than 1 -- " +
+			"parsed [%d]"
+		err := fmt.Errorf(str, funcName, cfg.BanThreshold)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
+	// Limit the number of blocks in flight per peer to a sane value.
+	if cfg.MaxBlocksInFlight < 1 || cfg.MaxBlocksInFlight > wire.MaxInvPerMsg {
+		str := "%s: The maxblocksinflight option must be in between 1 " +
+			"and %d -- parsed [%d]"
+		err := fmt.Errorf(str, funcName, wire.MaxInvPerMsg,
+			cfg.MaxBlocksInFlight)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
+	// Limit the number of rescans per websocket client to a sane value.
+	if cfg.RPCMaxRescans < 1 {
+		str := "%s: The rpcmaxrescans option must be at least 1 " +
+			"-- parsed [%d]"
+		err := fmt.Errorf(str, funcName, cfg.RPCMaxRescans)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+	if cfg.RPCMaxRescanBlocks < 0 {
+		str := "%s: The rpcmaxrescanblocks option may not be " +
+			"negative -- parsed [%d]"
+		err := fmt.Errorf(str, funcName, cfg.RPCMaxRescanBlocks)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
 	// --addPeer and --connect do not mix.
 	if len(cfg.AddPeers) > 0 && len(cfg.ConnectPeers) > 0 {
 		str := "%s: the --addpeer and --connect options can not be " +
@@ -571,9 +709,44 @@ func loadConfig() (*config, []string, error) {
 		return nil, nil, err
 	}
 
-	// The RPC server is disabled if no username or password is provided.
+	// Parse the RPC users authenticated by salted password hashes along
+	// with their access rules.
+	rpcAuthUsers, err := parseRPCAuthUsers(cfg.RPCAuth, cfg.RPCAuthMethods,
+		cfg.RPCAuthAllowIPs)
+	if err != nil {
+		str := "%s: %v"
+		err := fmt.Errorf(str, funcName, err)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+	for _, user := range []string{cfg.RPCUser, cfg.RPCLimitUser} {
+		if _, ok := rpcAuthUsers[user]; ok {
+			str := "%s: --rpcauth must not specify the same " +
+				"username as --rpcuser or --rpclimituser"
+			err := fmt.Errorf(str, funcName)
+			fmt.Fprintln(os.Stderr, err)
+			fmt.Fprintln(os.Stderr, usageMessage)
+			return nil, nil, err
+		}
+	}
+	cfg.rpcAuthUsers = rpcAuthUsers
+
+	// The REST interface is served by the RPC server.
+	if cfg.DisableRPC && cfg.REST {
+		str := "%s: the --norpc and --rest options can't be used " +
+			"together"
+		err := fmt.Errorf(str, funcName)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
+	// The RPC server is disabled if no username or password is provided
+	// unless the REST interface is enabled.
 	if (cfg.RPCUser == "" || cfg.RPCPass == "") &&
-		(cfg.RPCLimitUser == "" || cfg.RPCLimitPass == "") {
+		(cfg.RPCLimitUser == "" || cfg.RPCLimitPass == "") &&
+		len(cfg.rpcAuthUsers) == 0 && !cfg.REST {
 		cfg.DisableRPC = true
 	}
 
@@ -613,6 +786,27 @@ func loadConfig() (*config, []string, error) {
 		return nil, nil, err
 	}
 
+	// The memory pool must be able to hold at least one transaction.
+	if cfg.MaxMempool < 1 {
+		str := "%s: The maxmempool option may not be less than 1 " +
+			"-- parsed [%d]"
+		err := fmt.Errorf(str, funcName, cfg.MaxMempool)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
+	// Don't allow transactions to expire before they had a chance to be
+	// mined.
+	if cfg.MempoolExpiry < time.Hour {
+		str := "%s: The mempoolexpiry option may not be less than 1h " +
+			"-- parsed [%v]"
+		err := fmt.Errorf(str, funcName, cfg.MempoolExpiry)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
 	// Limit the block priority and minimum block sizes to max block size.
 	cfg.BlockPrioritySize = minUint32(cfg.BlockPrioritySize, cfg.BlockMaxSize)
 	cfg.BlockMinSize = minUint32(cfg.BlockMinSize, cfg.BlockMaxSize)
@@ -660,6 +854,53 @@ func loadConfig() (*config, []string, error) {
 		cfg.miningAddrs = append(cfg.miningAddrs, addr)
 	}
 
+	// Test keys hold private keys in the clear, so only allow them on the
+	// test networks where the coins are worthless.
+	if len(cfg.TestKeys) > 0 && !(cfg.RegressionTest || cfg.SimNet) {
+		str := "%s: the testkey option is only allowed on the regtest " +
+			"and simnet networks"
+		err := fmt.Errorf(str, funcName)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
+	// Check test keys are valid and save parsed versions.  Blocks must pay
+	// to a public key to be signed, so the test keys are also used as the
+	// mining addresses when none are specified.
+	testKeyAddrs := make([]btcutil.Address, 0, len(cfg.TestKeys))
+	for _, strKey := range cfg.TestKeys {
+		wif, err := btcutil.DecodeWIF(strKey)
+		if err != nil {
+			str := "%s: test key failed to decode: %v"
+			err := fmt.Errorf(str, funcName, err)
+			fmt.Fprintln(os.Stderr, err)
+			fmt.Fprintln(os.Stderr, usageMessage)
+			return nil, nil, err
+		}
+		if !wif.IsForNet(activeNetParams.Params) {
+			str := "%s: test key is on the wrong network"
+			err := fmt.Errorf(str, funcName)
+			fmt.Fprintln(os.Stderr, err)
+			fmt.Fprintln(os.Stderr, usageMessage)
+			return nil, nil, err
+		}
+		addr, err := btcutil.NewAddressPubKey(wif.SerializePubKey(),
+			activeNetParams.Params)
+		if err != nil {
+			str := "%s: test key public key is invalid: %v"
+			err := fmt.Errorf(str, funcName, err)
+			fmt.Fprintln(os.Stderr, err)
+			fmt.Fprintln(os.Stderr, usageMessage)
+			return nil, nil, err
+		}
+		cfg.testKeys = append(cfg.testKeys, wif)
+		testKeyAddrs = append(testKeyAddrs, addr)
+	}
+	if len(cfg.miningAddrs) == 0 {
+		cfg.miningAddrs = testKeyAddrs
+	}
+
 	// Ensure there is at least one mining address when the generate flag is
 	// set.
 	if cfg.Generate && len(cfg.MiningAddrs) == 0 {
@@ -671,6 +912,65 @@ func loadConfig() (*config, []string, error) {
 		return nil, nil, err
 	}
 
+	// Ensure there is at least one mining address when the stratum server
+	// is enabled.
+	if len(cfg.StratumListeners) > 0 && len(cfg.miningAddrs) == 0 {
+		str := "%s: the stratumlisten option is set, but there are no " +
+			"mining addresses specified"
+		err := fmt.Errorf(str, funcName)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
+	// The share difficulty must be positive.
+	if cfg.StratumDifficulty <= 0 {
+		str := "%s: the stratumdiff option must be greater than 0 " +
+			"-- parsed [%v]"
+		err := fmt.Errorf(str, funcName, cfg.StratumDifficulty)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
+	// The fee delta of block template notifications can't be negative.
+	if cfg.TemplateFeeDelta < 0 {
+		str := "%s: the templatefeedelta option may not be less than 0 " +
+			"-- parsed [%v]"
+		err := fmt.Errorf(str, funcName, cfg.TemplateFeeDelta)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
+	// Convert the ZMQ endpoints to listen addresses.
+	pubOptions := []struct {
+		name string
+		addr *string
+	}{
+		{"pubhashblock", &cfg.PubHashBlock},
+		{"pubhashtx", &cfg.PubHashTx},
+		{"pubrawblock", &cfg.PubRawBlock},
+		{"pubrawtx", &cfg.PubRawTx},
+	}
+	for _, option := range pubOptions {
+		if *option.addr == "" {
+			continue
+		}
+		addr, err := zmqEndpointAddr(*option.addr)
+		if err != nil {
+			str := "%s: the %s option must be an address with a " +
+				"port or an endpoint of the form " +
+				"tcp://<host>:<port> -- parsed [%s]"
+			err := fmt.Errorf(str, funcName, option.name,
+				*option.addr)
+			fmt.Fprintln(os.Stderr, err)
+			fmt.Fprintln(os.Stderr, usageMessage)
+			return nil, nil, err
+		}
+		*option.addr = addr
+	}
+
 	// Add default port to all listener addresses if needed and remove
 	// duplicate addresses.
 	cfg.Listeners = normalizeAddresses(cfg.Listeners,
@@ -681,6 +981,16 @@ func loadConfig() (*config, []string, error) {
 	cfg.RPCListeners = normalizeAddresses(cfg.RPCListeners,
 		activeNetParams.rpcPort)
 
+	// Add default port to all stratum listener addresses if needed and
+	// remove duplicate addresses.
+	cfg.StratumListeners = normalizeAddresses(cfg.StratumListeners,
+		activeNetParams.stratumPort)
+
+	// Add default port to all metrics listener addresses if needed and
+	// remove duplicate addresses.
+	cfg.MetricsListeners = normalizeAddresses(cfg.MetricsListeners,
+		defaultMetricsPort)
+
 	// Add default port to all added peer addresses if needed and remove
 	// duplicate addresses.
 	if !cfg.DisableRPC && cfg.DisableTLS {
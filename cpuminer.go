@@ -5,8 +5,13 @@
 package main
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"encoding"
+	"encoding/binary"
 	"errors"
 	"fmt"
+	"hash"
 	"math/rand"
 	"runtime"
 	"sync"
@@ -44,6 +49,70 @@ var (
 	defaultNumWorkers = uint32(runtime.NumCPU())
 )
 
+// headerHasher hashes a block header for a series of nonces.  The first 64
+// bytes of the serialized header, which make up the first SHA256 block, do not
+// depend on the nonce, so the SHA256 state after hashing them (the midstate) is
+// only computed once and merely the remaining bytes are hashed for each nonce.
+type headerHasher struct {
+	sha      hash.Hash
+	midstate []byte
+	tail     [wire.MaxBlockHeaderPayload - sha256.BlockSize]byte
+	digest   [sha256.Size]byte
+}
+
+// newHeaderHasher returns a new header hasher for the passed block header.  It
+// must be recreated whenever a header field other than the nonce changes.
+func newHeaderHasher(header *wire.BlockHeader) *headerHasher {
+	// Ignore the error returns since there is no way the encode could fail
+	// except being out of memory which would cause a run-time panic.
+	var buf bytes.Buffer
+	buf.Grow(wire.MaxBlockHeaderPayload)
+	_ = header.Serialize(&buf)
+	serialized := buf.Bytes()
+
+	sha := sha256.New()
+	sha.Write(serialized[:sha256.BlockSize])
+	midstate, _ := sha.(encoding.BinaryMarshaler).MarshalBinary()
+
+	h := &headerHasher{sha: sha, midstate: midstate}
+	copy(h.tail[:], serialized[sha256.BlockSize:])
+	return h
+}
+
+// hash returns the block hash of the header with the passed nonce.
+func (h *headerHasher) hash(nonce uint32) wire.ShaHash {
+	// The nonce is the last field of the header.
+	binary.LittleEndian.PutUint32(h.tail[len(h.tail)-4:], nonce)
+
+	_ = h.sha.(encoding.BinaryUnmarshaler).UnmarshalBinary(h.midstate)
+	h.sha.Write(h.tail[:])
+	return wire.ShaHash(sha256.Sum256(h.sha.Sum(h.digest[:0])))
+}
+
+// nonceRange returns the first and last nonce of the part of the nonce range
+// searched by the passed worker so the workers never search the same nonces.
+func nonceRange(worker, numWorkers uint32) (uint32, uint32) {
+	span := (uint64(maxNonce) + 1) / uint64(numWorkers)
+	first := uint64(worker) * span
+	last := first + span - 1
+	if worker == numWorkers-1 {
+		last = uint64(maxNonce)
+	}
+	return uint32(first), uint32(last)
+}
+
+// copyBlockForSolving returns a copy of the passed block which may be solved
+// independently of the original.  Only the header and the coinbase transaction
+// are modified while solving a block, so the remaining transactions are
+// shared.
+func copyBlockForSolving(msgBlock *wire.MsgBlock) *wire.MsgBlock {
+	blockCopy := *msgBlock
+	blockCopy.Transactions = make([]*wire.MsgTx, len(msgBlock.Transactions))
+	copy(blockCopy.Transactions, msgBlock.Transactions)
+	blockCopy.Transactions[0] = msgBlock.Transactions[0].Copy()
+	return &blockCopy
+}
+
 // CPUMiner provides facilities for solving blocks (mining) using the CPU in
 // a concurrency-safe manner.  It consists of two main goroutines -- a speed
 // monitor and a controller for worker goroutines which generate and solve
@@ -131,6 +200,15 @@ func (m *CPUMiner) submitBlock(block *btcutil.Block) bool {
 		return false
 	}
 
+	// ppc: Sign the block with the test key it pays to when running on
+	// the test networks with test keys.
+	if len(msgBlock.Signature) == 0 && len(cfg.testKeys) > 0 {
+		if err := signBlock(msgBlock); err != nil {
+			minrLog.Debugf("Unable to sign block submitted via CPU "+
+				"miner: %v", err)
+		}
+	}
+
 	// Process this block using the same rules as blocks coming from other
 	// nodes.  This will in turn relay it to the network like normal.
 	isOrphan, err := m.server.blockManager.ProcessBlock(block, blockchain.BFNone)
@@ -158,26 +236,34 @@ func (m *CPUMiner) submitBlock(block *btcutil.Block) bool {
 	return true
 }
 
+// randomExtraNonceOffset returns a random offset for the extra nonces used
+// while solving a block template.
+func randomExtraNonceOffset() uint64 {
+	enOffset, err := wire.RandomUint64()
+	if err != nil {
+		minrLog.Errorf("Unexpected error while generating random "+
+			"extra nonce offset: %v", err)
+		enOffset = 0
+	}
+	return enOffset
+}
+
 // solveBlock attempts to find some combination of a nonce, extra nonce, and
 // current timestamp which makes the passed block hash to a value less than the
 // target difficulty.  The timestamp is updated periodically and the passed
 // block is modified with all tweaks during this process.  This means that
 // when the function returns true, the block is ready for submission.
 //
+// Only the nonces from firstNonce to lastNonce are searched for each extra
+// nonce, which start at the passed extra nonce offset.  This allows multiple
+// workers to solve the same block template without duplicating work.
+//
 // This function will return early with false when conditions that trigger a
 // stale block such as a new block showing up or periodically when there are
 // new transactions and enough time has elapsed without finding a solution.
 func (m *CPUMiner) solveBlock(msgBlock *wire.MsgBlock, blockHeight int64,
-	ticker *time.Ticker, quit chan struct{}) bool {
-
-	// Choose a random extra nonce offset for this block template and
-	// worker.
-	enOffset, err := wire.RandomUint64()
-	if err != nil {
-		minrLog.Errorf("Unexpected error while generating random "+
-			"extra nonce offset: %v", err)
-		enOffset = 0
-	}
+	enOffset uint64, firstNonce, lastNonce uint32, ticker *time.Ticker,
+	quit chan struct{}) bool {
 
 	// Create a couple of convenience variables.
 	header := &msgBlock.Header
@@ -196,11 +282,12 @@ func (m *CPUMiner) solveBlock(msgBlock *wire.MsgBlock, blockHeight int64,
 		// new value by regenerating the coinbase script and
 		// setting the merkle root to the new value.  The
 		UpdateExtraNonce(msgBlock, blockHeight, extraNonce+enOffset)
+		hasher := newHeaderHasher(header)
 
-		// Search through the entire nonce range for a solution while
+		// Search through the assigned nonce range for a solution while
 		// periodically checking for early quit and stale block
 		// conditions along with updates to the speed monitor.
-		for i := uint32(0); i <= maxNonce; i++ {
+		for i := firstNonce; ; i++ {
 			select {
 			case <-quit:
 				return false
@@ -227,40 +314,95 @@ func (m *CPUMiner) solveBlock(msgBlock *wire.MsgBlock, blockHeight int64,
 				}
 
 				UpdateBlockTime(msgBlock, m.server.blockManager)
+				hasher = newHeaderHasher(header)
 
 			default:
 				// Non-blocking select to fall through
 			}
 
-			// Update the nonce and hash the block header.  Each
-			// hash is actually a double sha256 (two hashes), so
-			// increment the number of hashes completed for each
-			// attempt accordingly.
-			header.Nonce = i
-			hash := header.BlockSha()
+			// Hash the block header with the nonce.  Each hash is
+			// actually a double sha256 (two hashes), so increment
+			// the number of hashes completed for each attempt
+			// accordingly.
+			hash := hasher.hash(i)
 			hashesCompleted += 2
 
 			// The block is solved when the new block hash is less
 			// than the target difficulty.  Yay!
 			if blockchain.ShaHashToBig(&hash).Cmp(targetDifficulty) <= 0 {
+				header.Nonce = i
 				m.updateHashes <- hashesCompleted
 				return true
 			}
+
+			// Move on to the next extra nonce once the assigned
+			// nonce range is exhausted.
+			if i == lastNonce {
+				break
+			}
 		}
 	}
 
 	return false
 }
 
+// solveBlockConcurrently attempts to solve the passed block like solveBlock
+// with the passed number of workers.  The workers share the extra nonces and
+// each of them searches a separate part of the nonce range.  When the function
+// returns true, the passed block is updated with the solution and ready for
+// submission.  Each worker has its own ticker so that all of them check for
+// stale work and update the speed monitor.
+func (m *CPUMiner) solveBlockConcurrently(msgBlock *wire.MsgBlock,
+	blockHeight int64, numWorkers uint32) bool {
+
+	enOffset := randomExtraNonceOffset()
+	quit := make(chan struct{})
+	solved := make(chan *wire.MsgBlock, numWorkers)
+	var wg sync.WaitGroup
+	for i := uint32(0); i < numWorkers; i++ {
+		workBlock := copyBlockForSolving(msgBlock)
+		firstNonce, lastNonce := nonceRange(i, numWorkers)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ticker := time.NewTicker(time.Second * hashUpdateSecs)
+			defer ticker.Stop()
+			if m.solveBlock(workBlock, blockHeight, enOffset,
+				firstNonce, lastNonce, ticker, quit) {
+
+				solved <- workBlock
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(solved)
+	}()
+
+	// Stop the remaining workers as soon as the first solution is found or
+	// all of them gave up.
+	solution, ok := <-solved
+	close(quit)
+	for range solved {
+	}
+	if !ok {
+		return false
+	}
+	*msgBlock = *solution
+	return true
+}
+
 // generateBlocks is a worker that is controlled by the miningWorkerController.
 // It is self contained in that it creates block templates and attempts to solve
 // them while detecting when it is performing stale work and reacting
 // accordingly by generating a new block template.  When a block is solved, it
-// is submitted.
+// is submitted.  The worker only searches its own part of the nonce range
+// which is determined by its index among the passed number of workers.
 //
 // It must be run as a goroutine.
-func (m *CPUMiner) generateBlocks(quit chan struct{}) {
+func (m *CPUMiner) generateBlocks(quit chan struct{}, worker, numWorkers uint32) {
 	minrLog.Tracef("Starting generate blocks worker")
+	firstNonce, lastNonce := nonceRange(worker, numWorkers)
 
 	// Start a ticker which is used to signal checks for stale work and
 	// updates to the speed monitor.
@@ -317,7 +459,10 @@ out:
 		// with false when conditions that trigger a stale block, so
 		// a new block template can be generated.  When the return is
 		// true a solution was found, so submit the solved block.
-		if m.solveBlock(template.block, curHeight+1, ticker, quit) {
+		if m.solveBlock(template.block, curHeight+1,
+			randomExtraNonceOffset(), firstNonce, lastNonce, ticker,
+			quit) {
+
 			block := btcutil.NewBlock(template.block)
 			m.submitBlock(block)
 		}
@@ -342,7 +487,7 @@ func (m *CPUMiner) miningWorkerController() {
 			runningWorkers = append(runningWorkers, quit)
 
 			m.workerWg.Add(1)
-			go m.generateBlocks(quit)
+			go m.generateBlocks(quit, i, numWorkers)
 		}
 	}
 
@@ -361,18 +506,15 @@ out:
 				continue
 			}
 
-			// Add new workers.
-			if m.numWorkers > numRunning {
-				launchWorkers(m.numWorkers - numRunning)
-				continue
-			}
-
-			// Signal the most recently created goroutines to exit.
-			for i := numRunning - 1; i >= m.numWorkers; i-- {
-				close(runningWorkers[i])
-				runningWorkers[i] = nil
-				runningWorkers = runningWorkers[:i]
+			// The part of the nonce range each worker searches
+			// depends on the number of workers, so signal all of
+			// the running goroutines to exit and launch the new
+			// number of workers.
+			for _, quit := range runningWorkers {
+				close(quit)
 			}
+			runningWorkers = make([]chan struct{}, 0, m.numWorkers)
+			launchWorkers(m.numWorkers)
 
 		case <-m.quit:
 			for _, quit := range runningWorkers {
@@ -506,7 +648,8 @@ func (m *CPUMiner) NumWorkers() int32 {
 // contained in that it creates block templates and attempts to solve them while
 // detecting when it is performing stale work and reacting accordingly by
 // generating a new block template.  When a block is solved, it is submitted.
-// The function returns a list of the hashes of generated blocks.
+// Each block template is solved concurrently by the configured number of
+// workers.  The function returns a list of the hashes of generated blocks.
 func (m *CPUMiner) GenerateNBlocks(n uint32) ([]*wire.ShaHash, error) {
 	m.Lock()
 
@@ -527,6 +670,10 @@ func (m *CPUMiner) GenerateNBlocks(n uint32) ([]*wire.ShaHash, error) {
 
 	m.started = true
 	m.discreteMining = true
+	numWorkers := m.numWorkers
+	if numWorkers == 0 {
+		numWorkers = 1
+	}
 
 	m.speedMonitorQuit = make(chan struct{})
 	m.wg.Add(1)
@@ -539,20 +686,21 @@ func (m *CPUMiner) GenerateNBlocks(n uint32) ([]*wire.ShaHash, error) {
 	i := uint32(0)
 	blockHashes := make([]*wire.ShaHash, n, n)
 
-	// Start a ticker which is used to signal checks for stale work and
-	// updates to the speed monitor.
-	ticker := time.NewTicker(time.Second * hashUpdateSecs)
-	defer ticker.Stop()
-
 	for {
 		// Read updateNumWorkers in case someone tries a `setgenerate` while
-		// we're generating. We can ignore it as the `generate` RPC call only
-		// uses 1 worker.
+		// we're generating. We can ignore it as the `generate` RPC call keeps
+		// using the number of workers it started with.
 		select {
 		case <-m.updateNumWorkers:
 		default:
 		}
 
+		// ppc: Space the generated blocks out in time on the test
+		// networks.
+		if err := m.advanceMockTime(); err != nil {
+			minrLog.Errorf("Failed to advance mock time: %v", err)
+		}
+
 		// Grab the lock used for block submission, since the current block will
 		// be changing and this would otherwise end up building a new block
 		// template on a block that is in the process of becoming stale.
@@ -579,7 +727,9 @@ func (m *CPUMiner) GenerateNBlocks(n uint32) ([]*wire.ShaHash, error) {
 		// with false when conditions that trigger a stale block, so
 		// a new block template can be generated.  When the return is
 		// true a solution was found, so submit the solved block.
-		if m.solveBlock(template.block, curHeight+1, ticker, nil) {
+		if m.solveBlockConcurrently(template.block, curHeight+1,
+			numWorkers) {
+
 			block := btcutil.NewBlock(template.block)
 			m.submitBlock(block)
 			blockHashes[i] = block.Sha()
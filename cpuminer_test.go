@@ -0,0 +1,88 @@
+// Copyright (c) 2015 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ppcsuite/ppcd/chaincfg"
+)
+
+// TestHeaderHasher ensures the midstate based header hasher produces the same
+// hashes as serializing and hashing the entire header.
+func TestHeaderHasher(t *testing.T) {
+	headers := []struct {
+		name   string
+		params *chaincfg.Params
+	}{
+		{"mainnet genesis", &chaincfg.MainNetParams},
+		{"testnet genesis", &chaincfg.TestNet3Params},
+	}
+	for _, test := range headers {
+		header := test.params.GenesisBlock.Header
+		hasher := newHeaderHasher(&header)
+		for _, nonce := range []uint32{0, 1, header.Nonce, maxNonce} {
+			header.Nonce = nonce
+			got, want := hasher.hash(nonce), header.BlockSha()
+			if got != want {
+				t.Errorf("%s: hash for nonce %d: got %v, want %v",
+					test.name, nonce, got, want)
+			}
+		}
+
+		// The hasher must be recreated after changing any other
+		// field of the header.
+		header.Timestamp = header.Timestamp.Add(time.Second)
+		hasher = newHeaderHasher(&header)
+		if got, want := hasher.hash(header.Nonce), header.BlockSha(); got != want {
+			t.Errorf("%s: hash with new timestamp: got %v, want %v",
+				test.name, got, want)
+		}
+	}
+}
+
+// TestNonceRange ensures the nonce range is split between the workers without
+// gaps or overlaps.
+func TestNonceRange(t *testing.T) {
+	tests := []struct {
+		worker     uint32
+		numWorkers uint32
+		first      uint32
+		last       uint32
+	}{
+		{0, 1, 0, maxNonce},
+		{0, 2, 0, 0x7fffffff},
+		{1, 2, 0x80000000, maxNonce},
+		{0, 3, 0, 1431655764},
+		{1, 3, 1431655765, 2863311529},
+		{2, 3, 2863311530, maxNonce},
+	}
+	for _, test := range tests {
+		first, last := nonceRange(test.worker, test.numWorkers)
+		if first != test.first || last != test.last {
+			t.Errorf("nonceRange(%d, %d): got %d-%d, want %d-%d",
+				test.worker, test.numWorkers, first, last,
+				test.first, test.last)
+		}
+	}
+
+	for _, numWorkers := range []uint32{1, 2, 3, 7, 16, 255} {
+		next := uint64(0)
+		for worker := uint32(0); worker < numWorkers; worker++ {
+			first, last := nonceRange(worker, numWorkers)
+			if uint64(first) != next || last < first {
+				t.Errorf("nonceRange(%d, %d): got %d-%d, want "+
+					"start at %d", worker, numWorkers, first,
+					last, next)
+			}
+			next = uint64(last) + 1
+		}
+		if next != uint64(maxNonce)+1 {
+			t.Errorf("nonce ranges of %d workers end at %d, want %d",
+				numWorkers, next-1, maxNonce)
+		}
+	}
+}
@@ -35,10 +35,27 @@ Application Options:
       --maxpeers=          Max number of inbound and outbound peers (125)
       --banduration=       How long to ban misbehaving peers.  Valid time units
                            are {s, m, h}.  Minimum 1 second (24h0m0s)
+      --banthreshold=      Ban score at which misbehaving peers are
+                           disconnected and banned (100)
+      --maxblocksinflight= Max number of blocks to request from a single peer at
+                           once while downloading blocks during the initial
+                           sync (128)
+      --noalertrelay       Do not relay network alerts to other peers -- Valid
+                           alerts are still logged and reported
   -u, --rpcuser=           Username for RPC connections
   -P, --rpcpass=           Password for RPC connections
       --rpclimituser=      Username for limited RPC connections
       --rpclimitpass=      Password for limited RPC connections
+      --rpcauth=           Add an RPC user authenticated by a salted password
+                           hash in the form <user>:<salt>$<hash> -- Use
+                           genrpcauth to create one
+      --rpcauthmethods=    Set the comma-separated RPC methods and roles
+                           (admin, limited) an --rpcauth user may invoke in the
+                           form <user>:<methods> -- Users have the limited role
+                           by default
+      --rpcauthallowip=    Only allow an --rpcauth user to connect from an IP
+                           address or CIDR network in the form
+                           <user>:<ip or network>
       --rpclisten=         Add an interface/port to listen for RPC connections
                            (default port: 8334, testnet: 18334)
       --rpccert=           File containing the certificate file
@@ -47,9 +64,32 @@ Application Options:
                            (10)
       --rpcmaxwebsockets=  Max number of RPC clients for standard connections
                            (25)
+      --rpcmaxrescans=     Max number of rescans a single RPC websocket client
+                           may have running or queued at once (4)
+      --rpcmaxrescanblocks= Max number of blocks a single rescan may cover --
+                           0 for no limit
       --norpc              Disable built-in RPC server -- NOTE: The RPC server
                            is disabled by default if no rpcuser/rpcpass is
                            specified
+      --rest               Enable the unauthenticated REST interface for
+                           read-only chain data on the RPC listeners
+      --pubhashblock=      Publish the hashes of the blocks connected to the
+                           main chain to ZeroMQ subscribers of the hashblock
+                           topic on the given address (eg. tcp://127.0.0.1:28332)
+      --pubhashtx=         Publish the hashes of the transactions accepted to
+                           the memory pool or connected to the main chain to
+                           ZeroMQ subscribers of the hashtx topic on the given
+                           address
+      --pubrawblock=       Publish the serialized blocks connected to the main
+                           chain to ZeroMQ subscribers of the rawblock topic on
+                           the given address
+      --pubrawtx=          Publish the serialized transactions accepted to the
+                           memory pool or connected to the main chain to ZeroMQ
+                           subscribers of the rawtx topic on the given address
+      --metricslisten=     Add an interface/port to serve Prometheus metrics of
+                           the node at /metrics on (default port: 9904) -- The
+                           metrics server is disabled unless at least one is
+                           specified
       --notls              Disable TLS for the RPC server -- NOTE: This is only
                            allowed if the RPC server is bound to localhost
       --nodnsseed          Disable DNS seeding for peers
@@ -77,23 +117,64 @@ Application Options:
                            warn, error, critical} -- You may also specify
                            <subsystem>=<level>,<subsystem2>=<level>,... to set
                            the log level for individual subsystems -- Use show
-                           to list available subsystems (info)
+                           to list available subsystems -- Levels set with the
+                           debuglevel RPC are saved to the debuglevels file in
+                           the data directory and restored on startup unless
+                           this option is set to anything but the default
+                           (info)
+      --logformat=         Format of log messages {text, json} -- The json
+                           format writes an object per line with the time,
+                           level, subsystem and message, and the first peer,
+                           hash and height mentioned in the message (text)
+      --logmaxsize=        Maximum size in MiB of a log file before it is
+                           rotated (10)
+      --logmaxage=         Maximum time a log file is written to before it is
+                           rotated (eg. 24h) -- 0 to only rotate by size
+      --logmaxrolls=       Number of rotated log files to keep (3)
+      --logsubsystemfiles  Also write the messages of each subsystem to its own
+                           log file named after the subsystem, such as peer.log
       --upnp               Use UPnP to map our listening port outside of NAT
       --limitfreerelay=    Limit relay of transactions with no transaction fee
                            to the given amount in thousands of bytes per minute
                            (15)
       --maxorphantx=       Max number of orphan transactions to keep in memory
                            (1000)
+      --maxmempool=        Max size in megabytes of the transactions to keep in
+                           the memory pool -- Transactions paying the lowest
+                           fee per kilobyte are evicted once the limit is
+                           reached (300)
+      --mempoolexpiry=     Remove transactions from the memory pool which have
+                           not been mined after this duration, along with any
+                           transactions which depend on them.  Valid time units
+                           are {s, m, h}.  Minimum 1 hour (336h0m0s)
+      --nopersistmempool   Do not save the memory pool on shutdown and reload
+                           it on startup
+      --mempoolreplacement Allow transactions in the memory pool which signal
+                           replaceability (BIP125) to be replaced by
+                           conflicting transactions paying higher fees
       --generate=          Generate (mine) bitcoins using the CPU
       --miningaddr=        Add the specified payment address to the list of
                            addresses to use for generated blocks -- At least
                            one address is required if the generate option is set
+      --testkey=           Add the specified WIF-encoded private key to the keys
+                           used to sign generated blocks and to mint blocks with
+                           the generatepos RPC -- Only allowed on the regtest
+                           and simnet networks
       --blockminsize=      Mininum block size in bytes to be used when creating
                            a block
       --blockmaxsize=      Maximum block size in bytes to be used when creating
                            a block (750000)
       --blockprioritysize= Size in bytes for high-priority/low-fee transactions
                            when creating a block (50000)
+      --stratumlisten=     Add an interface/port to listen for stratum mining
+                           connections (default port: 3333, testnet: 13333) --
+                           The stratum server is disabled unless at least one
+                           is specified
+      --stratumdiff=       Minimum and initial share difficulty for stratum
+                           mining clients (1)
+      --templatefeedelta=  Minimum increase in PPC of the fees of a block
+                           template for notifytemplates clients to be notified
+                           of it when the best block did not change (0.1)
       --getworkkey=        DEPRECATED -- Use the --miningaddr option instead
       --addrindex=         Build and maintain a full address index. Currently
                            only supported by leveldb.
@@ -0,0 +1,335 @@
+// Copyright (c) 2015 PPCD developers.
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/ppcsuite/btcutil"
+	"github.com/ppcsuite/ppcd/blockchain"
+	"github.com/ppcsuite/ppcd/btcec"
+	"github.com/ppcsuite/ppcd/txscript"
+	"github.com/ppcsuite/ppcd/wire"
+)
+
+// testKeyForScript returns the test key the passed public key script pays to
+// either directly or by its hash, or nil when it does not pay to any of them.
+func testKeyForScript(pkScript []byte) *btcutil.WIF {
+	_, addrs, _, err := txscript.ExtractPkScriptAddrs(pkScript,
+		activeNetParams.Params)
+	if err != nil || len(addrs) != 1 {
+		return nil
+	}
+
+	for _, key := range cfg.testKeys {
+		pubKey := key.SerializePubKey()
+		switch addr := addrs[0].(type) {
+		case *btcutil.AddressPubKey:
+			if bytes.Equal(addr.ScriptAddress(), pubKey) {
+				return key
+			}
+		case *btcutil.AddressPubKeyHash:
+			if bytes.Equal(addr.ScriptAddress(), btcutil.Hash160(pubKey)) {
+				return key
+			}
+		}
+	}
+
+	return nil
+}
+
+// signBlock signs the passed block with the test key it pays to.  Peercoin
+// blocks must be signed by the public key the coinbase of proof-of-work blocks,
+// or the second output of the coinstake of proof-of-stake blocks, pays to.
+func signBlock(msgBlock *wire.MsgBlock) error {
+	var txOut *wire.TxOut
+	if msgBlock.IsProofOfStake() {
+		txOut = msgBlock.Transactions[1].TxOut[1]
+	} else {
+		txOut = msgBlock.Transactions[0].TxOut[0]
+	}
+
+	key := testKeyForScript(txOut.PkScript)
+	if key == nil || txscript.GetScriptClass(txOut.PkScript) != txscript.PubKeyTy {
+		return errors.New("block does not pay to the public key of a " +
+			"test key")
+	}
+
+	sha := msgBlock.BlockSha()
+	sig, err := key.PrivKey.Sign(sha.Bytes())
+	if err != nil {
+		return err
+	}
+	msgBlock.Signature = sig.Serialize()
+	return nil
+}
+
+// advanceMockTime advances the mock time of the test networks to one target
+// block spacing after the timestamp of the current best block.  It has no
+// effect on the other networks.
+func (m *CPUMiner) advanceMockTime() error {
+	clock := m.server.clock
+	if !clock.mockable {
+		return nil
+	}
+
+	sha, _ := m.server.blockManager.chainState.Best()
+	header, _, err := m.server.db.FetchBlockHeaderBySha(sha)
+	if err != nil {
+		return err
+	}
+	spacing := time.Duration(blockchain.StakeTargetSpacing) * time.Second
+	clock.advanceTo(header.Timestamp.Add(spacing))
+	return nil
+}
+
+// stakeCandidate describes an unspent transaction output paying to one of the
+// test keys which may be used as the kernel of a coinstake transaction.
+type stakeCandidate struct {
+	blockFrom *btcutil.Block
+	tx        *btcutil.Tx
+	outPoint  wire.OutPoint
+	key       *btcutil.WIF
+}
+
+// findStakeCandidates returns all unspent outputs in the main chain which pay
+// to one of the test keys and are not spent by a transaction in the memory
+// pool.  It scans every block of the main chain, so it is only suitable for the
+// short chains of the test networks.
+func (m *CPUMiner) findStakeCandidates() ([]*stakeCandidate, error) {
+	db := m.server.db
+	_, height, err := db.NewestSha()
+	if err != nil {
+		return nil, err
+	}
+	shas, err := db.FetchHeightRange(1, height+1)
+	if err != nil {
+		return nil, err
+	}
+
+	var candidates []*stakeCandidate
+	var txShas []*wire.ShaHash
+	for i := range shas {
+		block, err := db.FetchBlockBySha(&shas[i])
+		if err != nil {
+			return nil, err
+		}
+		for _, tx := range block.Transactions() {
+			found := false
+			for txOutIdx, txOut := range tx.MsgTx().TxOut {
+				key := testKeyForScript(txOut.PkScript)
+				if key == nil {
+					continue
+				}
+				candidates = append(candidates, &stakeCandidate{
+					blockFrom: block,
+					tx:        tx,
+					outPoint:  *wire.NewOutPoint(tx.Sha(), uint32(txOutIdx)),
+					key:       key,
+				})
+				found = true
+			}
+			if found {
+				txShas = append(txShas, tx.Sha())
+			}
+		}
+	}
+
+	// Look up which of the outputs are still unspent.  Fully spent
+	// transactions are not returned by the database.
+	spent := make(map[wire.ShaHash][]bool, len(txShas))
+	for _, reply := range db.FetchUnSpentTxByShaList(txShas) {
+		if reply.Err == nil {
+			spent[*reply.Sha] = reply.TxSpent
+		}
+	}
+
+	mp := m.server.txMemPool
+	mp.RLock()
+	defer mp.RUnlock()
+
+	unspent := candidates[:0]
+	for _, c := range candidates {
+		txSpent, ok := spent[c.outPoint.Hash]
+		if !ok || txSpent[c.outPoint.Index] {
+			continue
+		}
+		if _, ok := mp.outpoints[c.outPoint]; ok {
+			continue
+		}
+		unspent = append(unspent, c)
+	}
+
+	return unspent, nil
+}
+
+// createCoinStake returns a signed coinstake transaction with the passed
+// timestamp which spends the output of the passed stake candidate and pays it
+// back along with the proof-of-stake reward to the public key of its test key.
+func createCoinStake(c *stakeCandidate, nTime time.Time) (*wire.MsgTx, error) {
+	prevOut := c.tx.MsgTx().TxOut[c.outPoint.Index]
+
+	// The coin age is the value of the output multiplied by the time since
+	// it was created, in coin-days.
+	timeDiff := nTime.Unix() - c.tx.MsgTx().Time.Unix()
+	centSeconds := new(big.Int).Div(new(big.Int).Mul(
+		big.NewInt(prevOut.Value), big.NewInt(timeDiff)),
+		big.NewInt(blockchain.Cent))
+	coinAge := new(big.Int).Div(new(big.Int).Mul(centSeconds,
+		big.NewInt(blockchain.Cent)),
+		big.NewInt(blockchain.Coin*24*60*60)).Int64()
+	reward := blockchain.PPCGetProofOfStakeReward(coinAge)
+
+	addr, err := btcutil.NewAddressPubKey(c.key.SerializePubKey(),
+		activeNetParams.Params)
+	if err != nil {
+		return nil, err
+	}
+	pkScript, err := txscript.PayToAddrScript(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	// A coinstake has an empty first output followed by the outputs which
+	// receive the stake and reward.
+	msgTx := wire.NewMsgTx()
+	msgTx.Time = nTime
+	msgTx.AddTxIn(wire.NewTxIn(&c.outPoint, nil))
+	msgTx.AddTxOut(wire.NewTxOut(0, nil))
+	msgTx.AddTxOut(wire.NewTxOut(prevOut.Value+int64(reward), pkScript))
+
+	getKey := txscript.KeyClosure(func(btcutil.Address) (*btcec.PrivateKey, bool, error) {
+		return c.key.PrivKey, c.key.CompressPubKey, nil
+	})
+	sigScript, err := txscript.SignTxOutput(activeNetParams.Params, msgTx,
+		0, prevOut.PkScript, txscript.SigHashAll, getKey, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	msgTx.TxIn[0].SignatureScript = sigScript
+
+	return msgTx, nil
+}
+
+// generateProofOfStakeBlock advances the mock time by one target block spacing
+// and mints a proof-of-stake block using the first unspent output of the test
+// keys which meets the kernel target.
+func (m *CPUMiner) generateProofOfStakeBlock() (*wire.ShaHash, error) {
+	if err := m.advanceMockTime(); err != nil {
+		return nil, err
+	}
+
+	bManager := m.server.blockManager
+	nTime, err := medianAdjustedTime(&bManager.chainState,
+		m.server.timeSource)
+	if err != nil {
+		return nil, err
+	}
+	nBits, err := bManager.PPCCalcNextRequiredDifficulty(true)
+	if err != nil {
+		return nil, err
+	}
+
+	candidates, err := m.findStakeCandidates()
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range candidates {
+		// Skip the outputs which do not meet the minimum age yet.
+		blockFromTime := c.blockFrom.MsgBlock().Header.Timestamp.Unix()
+		if blockFromTime+m.server.chainParams.StakeMinAge > nTime.Unix() {
+			continue
+		}
+
+		_, success, err := bManager.CheckStakeKernelHash(nBits,
+			c.blockFrom, c.tx, &c.outPoint, nTime.Unix())
+		if err != nil {
+			minrLog.Debugf("Unable to check stake kernel %v: %v",
+				c.outPoint, err)
+			continue
+		}
+		if !success {
+			continue
+		}
+
+		coinStakeTx, err := createCoinStake(c, nTime)
+		if err != nil {
+			return nil, err
+		}
+		template := m.BuildMintBlock(coinStakeTx)
+		if template == nil {
+			return nil, fmt.Errorf("unable to create a block template "+
+				"for the coinstake of %v", c.outPoint)
+		}
+		block := btcutil.NewBlock(template.block)
+		if !m.submitBlock(block) {
+			return nil, fmt.Errorf("proof-of-stake block %v was "+
+				"rejected", block.Sha())
+		}
+		return block.Sha(), nil
+	}
+
+	return nil, errors.New("no unspent output of the test keys meets the " +
+		"proof-of-stake kernel target")
+}
+
+// GenerateNProofOfStakeBlocks mints the requested number of proof-of-stake
+// blocks on the test networks from the unspent outputs of the test keys.  The
+// mock time is advanced by one target block spacing before each block.  It
+// returns the hashes of the generated blocks.
+func (m *CPUMiner) GenerateNProofOfStakeBlocks(n uint32) ([]*wire.ShaHash, error) {
+	m.Lock()
+
+	// Respond with an error if the current network has no mock time.
+	if !m.server.clock.mockable {
+		m.Unlock()
+		return nil, errors.New("No support for `generatepos` on the " +
+			"current network, " + m.server.chainParams.Net.String() +
+			", as it is only available on the regtest and simnet " +
+			"networks.")
+	}
+
+	// Respond with an error if there are no keys to stake with.
+	if len(cfg.testKeys) == 0 {
+		m.Unlock()
+		return nil, errors.New("No keys to stake with specified via " +
+			"--testkey")
+	}
+
+	// Respond with an error if server is already mining.
+	if m.started || m.discreteMining {
+		m.Unlock()
+		return nil, errors.New("Server is already CPU mining. Please call " +
+			"`setgenerate 0` before calling discrete `generatepos` " +
+			"commands.")
+	}
+
+	m.discreteMining = true
+	m.Unlock()
+
+	defer func() {
+		m.Lock()
+		m.discreteMining = false
+		m.Unlock()
+	}()
+
+	minrLog.Tracef("Generating %d proof-of-stake blocks", n)
+
+	blockHashes := make([]*wire.ShaHash, 0, n)
+	for i := uint32(0); i < n; i++ {
+		hash, err := m.generateProofOfStakeBlock()
+		if err != nil {
+			return nil, err
+		}
+		blockHashes = append(blockHashes, hash)
+	}
+
+	minrLog.Tracef("Generated %d proof-of-stake blocks", n)
+	return blockHashes, nil
+}
@@ -5,8 +5,14 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
 	"strings"
 	"time"
 
@@ -30,6 +36,21 @@ const (
 	// maxRejectReasonLen is the maximum length of a sanitized reject reason
 	// that will be logged.
 	maxRejectReasonLen = 250
+
+	// The formats of log messages which may be selected with the logformat
+	// option.
+	logFormatText = "text"
+	logFormatJSON = "json"
+
+	// textLogFormat and jsonLogFormat are the seelog formats of log messages
+	// in the text and JSON formats.
+	textLogFormat = "%Time %Date [%LEV] %Msg%n"
+	jsonLogFormat = "%PpcdJSON%n"
+
+	// debugLevelsFilename is the name of the file in the data directory
+	// which holds the log levels set with the debuglevel RPC, so they are
+	// restored on startup.
+	debugLevelsFilename = "debuglevels"
 )
 
 // Loggers per subsytem.  Note that backendLog is a seelog logger that all of
@@ -51,6 +72,7 @@ var (
 	scrpLog    = btclog.Disabled
 	srvrLog    = btclog.Disabled
 	txmpLog    = btclog.Disabled
+	zmqpLog    = btclog.Disabled
 )
 
 // subsystemLoggers maps each subsystem identifier to its associated logger.
@@ -68,6 +90,29 @@ var subsystemLoggers = map[string]btclog.Logger{
 	"SCRP": scrpLog,
 	"SRVR": srvrLog,
 	"TXMP": txmpLog,
+	"ZMQP": zmqpLog,
+}
+
+// subsystemLevels maps each subsystem identifier to its logging level.
+var subsystemLevels = make(map[string]string)
+
+// logSettings are the settings of the log files and the format of the log
+// messages used to create the seelog loggers of the subsystems as needed.
+var logSettings struct {
+	dir            string
+	format         string
+	maxSize        int64
+	maxAge         time.Duration
+	maxRolls       int
+	subsystemFiles bool
+
+	// output is where the messages of all subsystems are written to, which
+	// is the console and the main log file.
+	output io.Writer
+
+	// subsystemBackends are the seelog loggers writing to the log files of
+	// the subsystems, which are flushed along with backendLog.
+	subsystemBackends []seelog.LoggerInterface
 }
 
 // logClosure is used to provide a closure over expensive logging operations
@@ -137,32 +182,186 @@ func useLogger(subsystemID string, logger btclog.Logger) {
 
 	case "TXMP":
 		txmpLog = logger
+
+	case "ZMQP":
+		zmqpLog = logger
 	}
 }
 
+// The patterns of the peers, hashes and heights in log messages which are
+// reported as separate fields of the messages in the JSON format.  The
+// subsystem loggers only pass formatted messages to the backend, so the fields
+// are found heuristically in the text of the messages: peers are logged with
+// the address followed by the direction of the connection, any 64 digit
+// lowercase hex string is taken to be a hash, whether it is the hash of a block,
+// a transaction or something else, and a height is a number following the word
+// height.
+var (
+	logPeerRegexp   = regexp.MustCompile(`(\S+) \((?:inbound|outbound)\)`)
+	logHashRegexp   = regexp.MustCompile(`\b[0-9a-f]{64}\b`)
+	logHeightRegexp = regexp.MustCompile(`\bheight (\d+)\b`)
+)
+
+// jsonLogEntry is a log message in the JSON format.  The peer, hash and height
+// are the first ones matching logPeerRegexp, logHashRegexp and logHeightRegexp
+// in the message, if any, so they are a best effort aid for filtering logs.
+type jsonLogEntry struct {
+	Time      string `json:"time"`
+	Level     string `json:"level"`
+	Subsystem string `json:"subsystem,omitempty"`
+	Message   string `json:"message"`
+	Peer      string `json:"peer,omitempty"`
+	Hash      string `json:"hash,omitempty"`
+	Height    *int64 `json:"height,omitempty"`
+}
+
+// formatJSONLogEntry returns the passed log message of the passed level, as
+// routed to the backend by a subsystem logger, in the JSON format.
+func formatJSONLogEntry(t time.Time, level, message string) string {
+	entry := jsonLogEntry{
+		Time:    t.Format(time.RFC3339Nano),
+		Level:   level,
+		Message: message,
+	}
+
+	// The subsystem loggers prefix messages with the subsystem identifier.
+	if i := strings.Index(message, ": "); i > 0 {
+		if _, ok := subsystemLoggers[message[:i]]; ok {
+			entry.Subsystem = message[:i]
+			entry.Message = message[i+2:]
+		}
+	}
+
+	if match := logPeerRegexp.FindStringSubmatch(entry.Message); match != nil {
+		entry.Peer = match[1]
+	}
+	entry.Hash = logHashRegexp.FindString(entry.Message)
+	match := logHeightRegexp.FindStringSubmatch(entry.Message)
+	if match != nil {
+		height, err := strconv.ParseInt(match[1], 10, 64)
+		if err == nil {
+			entry.Height = &height
+		}
+	}
+
+	marshalled, err := json.Marshal(&entry)
+	if err != nil {
+		return fmt.Sprintf(`{"level":%q,"message":%q}`, level, message)
+	}
+	return string(marshalled)
+}
+
+// newJSONLogFormatter returns the seelog formatter of the JSON format of log
+// messages.
+func newJSONLogFormatter(params string) seelog.FormatterFunc {
+	return func(message string, level seelog.LogLevel,
+		context seelog.LogContextInterface) interface{} {
+
+		return formatJSONLogEntry(time.Now(), level.String(), message)
+	}
+}
+
+// openLogFile opens the rotating log file with the passed name in the log
+// directory.
+func openLogFile(name string) (*rotatingFile, error) {
+	return newRotatingFile(filepath.Join(logSettings.dir, name),
+		logSettings.maxSize, logSettings.maxAge, logSettings.maxRolls)
+}
+
+// newSeelogLogger returns a new asynchronous seelog logger which writes
+// messages in the configured format to the passed writer.  It behaves like the
+// adaptive logger of a seelog configuration with a minimum interval of 2ms, a
+// maximum interval of 100ms and a critical message count of 500.
+func newSeelogLogger(w io.Writer) seelog.LoggerInterface {
+	format := textLogFormat
+	if logSettings.format == logFormatJSON {
+		format = jsonLogFormat
+	}
+	constraints, err := seelog.NewMinMaxConstraints(seelog.TraceLvl,
+		seelog.CriticalLvl)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to create logger: %v", err)
+		os.Exit(1)
+	}
+	formatter, err := seelog.NewFormatter(format)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to create logger: %v", err)
+		os.Exit(1)
+	}
+	dispatcher, err := seelog.NewSplitDispatcher(formatter,
+		[]interface{}{w})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to create logger: %v", err)
+		os.Exit(1)
+	}
+	config := seelog.NewLoggerConfig(constraints, nil, dispatcher)
+	logger, err := seelog.NewAsyncAdaptiveLogger(config,
+		2*time.Millisecond, 100*time.Millisecond, 500)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to create logger: %v", err)
+		os.Exit(1)
+	}
+	return logger
+}
+
+// flushLogs writes all pending log messages of all subsystems.  It must be
+// called before shutting down so no messages are lost.
+func flushLogs() {
+	for _, logger := range logSettings.subsystemBackends {
+		logger.Flush()
+	}
+	backendLog.Flush()
+}
+
 // initSeelogLogger initializes a new seelog logger that is used as the backend
-// for all logging subsytems.
-func initSeelogLogger(logFile string) {
-	config := `
-	<seelog type="adaptive" mininterval="2000000" maxinterval="100000000"
-		critmsgcount="500" minlevel="trace">
-		<outputs formatid="all">
-			<console />
-			<rollingfile type="size" filename="%s" maxsize="10485760" maxrolls="3" />
-		</outputs>
-		<formats>
-			<format id="all" format="%%Time %%Date [%%LEV] %%Msg%%n" />
-		</formats>
-	</seelog>`
-	config = fmt.Sprintf(config, logFile)
-
-	logger, err := seelog.LoggerFromConfigAsString(config)
+// for all logging subsytems according to the log options of the passed
+// configuration.
+func initSeelogLogger(cfg *config) {
+	logSettings.dir = cfg.LogDir
+	logSettings.format = cfg.LogFormat
+	logSettings.maxSize = int64(cfg.LogMaxSize) * 1024 * 1024
+	logSettings.maxAge = cfg.LogMaxAge
+	logSettings.maxRolls = cfg.LogMaxRolls
+	logSettings.subsystemFiles = cfg.LogSubsystemFiles
+
+	if cfg.LogFormat == logFormatJSON {
+		err := seelog.RegisterCustomFormatter("PpcdJSON",
+			newJSONLogFormatter)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to create logger: %v", err)
+			os.Exit(1)
+		}
+	}
+
+	logFile, err := openLogFile(defaultLogFilename)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "failed to create logger: %v", err)
 		os.Exit(1)
 	}
+	logSettings.output = io.MultiWriter(os.Stdout, logFile)
 
-	backendLog = logger
+	backendLog = newSeelogLogger(logSettings.output)
+}
+
+// subsystemBackendLog returns the seelog logger the logger of the passed
+// subsystem routes its messages to.  When subsystems have their own log files,
+// it is a new logger which writes to the log file of the subsystem in addition
+// to the output of all subsystems.
+func subsystemBackendLog(subsystemID string) seelog.LoggerInterface {
+	if !logSettings.subsystemFiles {
+		return backendLog
+	}
+
+	logFile, err := openLogFile(strings.ToLower(subsystemID) + ".log")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to create log file of %s: %v\n",
+			subsystemID, err)
+		return backendLog
+	}
+	logger := newSeelogLogger(io.MultiWriter(logSettings.output, logFile))
+	logSettings.subsystemBackends = append(logSettings.subsystemBackends,
+		logger)
+	return logger
 }
 
 // setLogLevel sets the logging level for provided subsystem.  Invalid
@@ -179,14 +378,17 @@ func setLogLevel(subsystemID string, logLevel string) {
 	level, ok := btclog.LogLevelFromString(logLevel)
 	if !ok {
 		level = btclog.InfoLvl
+		logLevel = "info"
 	}
 
 	// Create new logger for the subsystem if needed.
 	if logger == btclog.Disabled {
-		logger = btclog.NewSubsystemLogger(backendLog, subsystemID+": ")
+		logger = btclog.NewSubsystemLogger(
+			subsystemBackendLog(subsystemID), subsystemID+": ")
 		useLogger(subsystemID, logger)
 	}
 	logger.SetLevel(level)
+	subsystemLevels[subsystemID] = logLevel
 }
 
 // setLogLevels sets the log level for all subsystem loggers to the passed
@@ -200,6 +402,42 @@ func setLogLevels(logLevel string) {
 	}
 }
 
+// debugLevels returns the logging levels of all subsystems in the form of the
+// debuglevel option.
+func debugLevels() string {
+	subsystems := supportedSubsystems()
+	levelPairs := make([]string, 0, len(subsystems))
+	for _, subsystemID := range subsystems {
+		levelPairs = append(levelPairs, subsystemID+"="+
+			subsystemLevels[subsystemID])
+	}
+	return strings.Join(levelPairs, ",")
+}
+
+// saveDebugLevels writes the logging levels of all subsystems to the file at
+// the passed path, so they can be restored with loadDebugLevels.
+func saveDebugLevels(path string) error {
+	return ioutil.WriteFile(path, []byte(debugLevels()+"\n"), 0600)
+}
+
+// loadDebugLevels sets the logging levels saved to the file at the passed path
+// by saveDebugLevels and returns whether or not they were set.  Nothing is done
+// when the file does not exist.
+func loadDebugLevels(path string) (bool, error) {
+	levels, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	err = parseAndSetDebugLevels(strings.TrimSpace(string(levels)))
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
 // directionString is a helper function that returns a string that represents
 // the direction of a connection (inbound or outbound).
 func directionString(inbound bool) string {
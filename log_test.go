@@ -0,0 +1,82 @@
+// Copyright (c) 2015 PPCD developers.
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// TestFormatJSONLogEntry ensures log messages are formatted as JSON objects
+// with the subsystem and the first peer, hash and height found in the text of
+// the messages.
+func TestFormatJSONLogEntry(t *testing.T) {
+	hash := "000000000019d6689c085ae165831e934ff763ae46a2a6c172b3f1b60a8ce26f"
+	other := "4a5e1e4baab89f3a32518a88c31bc87f618f76673e2cc77ab2127b7afdeda33b"
+	tm := time.Date(2015, 6, 1, 12, 30, 0, 500000000, time.UTC)
+	prefix := `{"time":"2015-06-01T12:30:00.5Z","level":"Info",`
+	tests := []struct {
+		name    string
+		message string
+		want    string
+	}{
+		{
+			"plain message",
+			"Server listening",
+			`"message":"Server listening"}`,
+		},
+		{
+			"subsystem",
+			"BMGR: Syncing to block height 1000 from peer " +
+				"1.2.3.4:9901 (outbound)",
+			`"subsystem":"BMGR","message":"Syncing to block height ` +
+				`1000 from peer 1.2.3.4:9901 (outbound)",` +
+				`"peer":"1.2.3.4:9901","height":1000}`,
+		},
+		{
+			"unknown subsystem",
+			"XYZW: message",
+			`"message":"XYZW: message"}`,
+		},
+		{
+			"first hash",
+			"CHAN: Block " + hash + " spends " + other,
+			`"subsystem":"CHAN","message":"Block ` + hash + ` spends ` +
+				other + `","hash":"` + hash + `"}`,
+		},
+		{
+			// Any 64 digit hex string is taken to be a hash.
+			"hex string",
+			"Key " + other,
+			`"message":"Key ` + other + `","hash":"` + other + `"}`,
+		},
+		{
+			"too long for a hash",
+			"Data " + hash + "00",
+			`"message":"Data ` + hash + `00"}`,
+		},
+		{
+			"height 0",
+			"Genesis block at height 0",
+			`"message":"Genesis block at height 0","height":0}`,
+		},
+		{
+			"height out of range",
+			"At height 99999999999999999999",
+			`"message":"At height 99999999999999999999"}`,
+		},
+		{
+			"escaped",
+			"Quote \" and\nnewline",
+			`"message":"Quote \" and\nnewline"}`,
+		},
+	}
+	for _, test := range tests {
+		got := formatJSONLogEntry(tm, "Info", test.message)
+		if want := prefix + test.want; got != want {
+			t.Errorf("%s: got %s, want %s", test.name, got, want)
+		}
+	}
+}
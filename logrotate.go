@@ -0,0 +1,150 @@
+// Copyright (c) 2015 PPCD developers.
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// errLogFileClosed describes an error where a closed log file is written to.
+var errLogFileClosed = errors.New("log file is closed")
+
+// rotatingFile is a log file which is rotated once it grows larger than a
+// maximum size or has been written to for longer than a maximum age.  Rotated
+// files are renamed by appending a number to the path, with .1 being the most
+// recent, and only a maximum number of them is kept.
+type rotatingFile struct {
+	mtx      sync.Mutex
+	path     string
+	maxSize  int64
+	maxAge   time.Duration
+	maxRolls int
+	file     *os.File
+	size     int64
+	opened   time.Time
+	closed   bool
+}
+
+// newRotatingFile opens the log file at the passed path for appending, creating
+// it and its directory as needed.  A maximum age of 0 disables the rotation by
+// age.
+func newRotatingFile(path string, maxSize int64, maxAge time.Duration,
+	maxRolls int) (*rotatingFile, error) {
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, err
+	}
+	f := &rotatingFile{
+		path:     path,
+		maxSize:  maxSize,
+		maxAge:   maxAge,
+		maxRolls: maxRolls,
+	}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// open opens the log file for appending.
+//
+// This function MUST be called with the mutex held (for writes) once the file
+// is in use.
+func (f *rotatingFile) open() error {
+	file, err := os.OpenFile(f.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE,
+		0600)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	f.file = file
+	f.size = info.Size()
+	f.opened = time.Now()
+	return nil
+}
+
+// rollPath returns the path of the rotated log file with the passed number.
+func (f *rotatingFile) rollPath(n int) string {
+	return fmt.Sprintf("%s.%d", f.path, n)
+}
+
+// rotate closes the log file, shifts the rotated files, removing the oldest
+// one, and opens a new log file.  The log file is left closed on error, so the
+// next write tries to open it again.
+//
+// This function MUST be called with the mutex held (for writes).
+func (f *rotatingFile) rotate() error {
+	err := f.file.Close()
+	f.file = nil
+	if err != nil {
+		return err
+	}
+	os.Remove(f.rollPath(f.maxRolls))
+	for n := f.maxRolls - 1; n > 0; n-- {
+		os.Rename(f.rollPath(n), f.rollPath(n+1))
+	}
+	if f.maxRolls > 0 {
+		if err := os.Rename(f.path, f.rollPath(1)); err != nil {
+			return err
+		}
+	} else if err := os.Remove(f.path); err != nil {
+		return err
+	}
+	return f.open()
+}
+
+// Write appends p to the log file after rotating it when needed.  It is part
+// of the io.Writer interface.
+//
+// This function is safe for concurrent access.
+func (f *rotatingFile) Write(p []byte) (int, error) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+
+	if f.closed {
+		return 0, errLogFileClosed
+	}
+	if f.file == nil {
+		if err := f.open(); err != nil {
+			return 0, err
+		}
+	}
+	if f.size > 0 && (f.size+int64(len(p)) > f.maxSize ||
+		(f.maxAge > 0 && time.Since(f.opened) >= f.maxAge)) {
+
+		if err := f.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+// Close closes the log file.
+//
+// This function is safe for concurrent access.
+func (f *rotatingFile) Close() error {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+
+	if f.closed || f.file == nil {
+		f.closed = true
+		return nil
+	}
+	err := f.file.Close()
+	f.file = nil
+	f.closed = true
+	return err
+}
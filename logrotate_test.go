@@ -0,0 +1,160 @@
+// Copyright (c) 2015 PPCD developers.
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// readLogFile returns the contents of the log file at the passed path or a
+// description of the error when it cannot be read.
+func readLogFile(path string) string {
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "error: " + err.Error()
+	}
+	return string(contents)
+}
+
+// TestRotatingFileSize ensures log files are rotated once they would grow
+// larger than the maximum size and only the maximum number of rotated files is
+// kept.
+func TestRotatingFileSize(t *testing.T) {
+	dir, err := ioutil.TempDir("", "logrotate")
+	if err != nil {
+		t.Fatalf("TempDir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// The directory of the log file is created as needed.
+	path := filepath.Join(dir, "logs", "ppcd.log")
+	f, err := newRotatingFile(path, 10, 0, 2)
+	if err != nil {
+		t.Fatalf("newRotatingFile: %v", err)
+	}
+	defer f.Close()
+
+	// A message larger than the maximum size is still written to an empty
+	// file.
+	for _, msg := range []string{"aaaa\n", "bbbb\n", "cccc\n", "dddd\n",
+		"eeee\n", "ffff\n", "0123456789abc\n"} {
+
+		if n, err := f.Write([]byte(msg)); n != len(msg) || err != nil {
+			t.Fatalf("Write(%q): got %d, %v", msg, n, err)
+		}
+	}
+
+	tests := []struct {
+		path string
+		want string
+	}{
+		{path, "0123456789abc\n"},
+		{path + ".1", "eeee\nffff\n"},
+		{path + ".2", "cccc\ndddd\n"},
+	}
+	for _, test := range tests {
+		if got := readLogFile(test.path); got != test.want {
+			t.Errorf("%s: got %q, want %q", filepath.Base(test.path),
+				got, test.want)
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Errorf("more rotated files than the maximum kept: %v", err)
+	}
+}
+
+// TestRotatingFileReopen ensures an existing log file is appended to and its
+// size counts toward the maximum size.
+func TestRotatingFileReopen(t *testing.T) {
+	dir, err := ioutil.TempDir("", "logrotate")
+	if err != nil {
+		t.Fatalf("TempDir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "ppcd.log")
+	if err := ioutil.WriteFile(path, []byte("old\n"), 0600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	f, err := newRotatingFile(path, 8, 0, 1)
+	if err != nil {
+		t.Fatalf("newRotatingFile: %v", err)
+	}
+	defer f.Close()
+
+	f.Write([]byte("new\n"))
+	if got := readLogFile(path); got != "old\nnew\n" {
+		t.Errorf("got %q, want %q", got, "old\nnew\n")
+	}
+	f.Write([]byte("next\n"))
+	if got := readLogFile(path); got != "next\n" {
+		t.Errorf("got %q, want %q", got, "next\n")
+	}
+	if got := readLogFile(path + ".1"); got != "old\nnew\n" {
+		t.Errorf("rotated: got %q, want %q", got, "old\nnew\n")
+	}
+}
+
+// TestRotatingFileAge ensures log files are rotated once they have been written
+// to for longer than the maximum age and that rotated files are removed when no
+// rotated files are kept.
+func TestRotatingFileAge(t *testing.T) {
+	dir, err := ioutil.TempDir("", "logrotate")
+	if err != nil {
+		t.Fatalf("TempDir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "ppcd.log")
+	f, err := newRotatingFile(path, 1000, time.Hour, 0)
+	if err != nil {
+		t.Fatalf("newRotatingFile: %v", err)
+	}
+	defer f.Close()
+
+	f.Write([]byte("first\n"))
+	f.Write([]byte("second\n"))
+	if got := readLogFile(path); got != "first\nsecond\n" {
+		t.Errorf("got %q, want %q", got, "first\nsecond\n")
+	}
+
+	f.opened = f.opened.Add(-time.Hour)
+	f.Write([]byte("third\n"))
+	if got := readLogFile(path); got != "third\n" {
+		t.Errorf("got %q, want %q", got, "third\n")
+	}
+	if _, err := os.Stat(path + ".1"); !os.IsNotExist(err) {
+		t.Errorf("rotated file kept without rolls: %v", err)
+	}
+}
+
+// TestRotatingFileClose ensures closed log files refuse writes and may be
+// closed more than once.
+func TestRotatingFileClose(t *testing.T) {
+	dir, err := ioutil.TempDir("", "logrotate")
+	if err != nil {
+		t.Fatalf("TempDir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	f, err := newRotatingFile(filepath.Join(dir, "ppcd.log"), 1000, 0, 1)
+	if err != nil {
+		t.Fatalf("newRotatingFile: %v", err)
+	}
+	if err := f.Close(); err != nil {
+		t.Errorf("Close: %v", err)
+	}
+	if err := f.Close(); err != nil {
+		t.Errorf("second Close: %v", err)
+	}
+	if _, err := f.Write([]byte("late\n")); err != errLogFileClosed {
+		t.Errorf("Write after Close: got %v, want %v", err,
+			errLogFileClosed)
+	}
+}
@@ -84,6 +84,72 @@ type TxDesc struct {
 	Height           int64       // Blockheight when added to pool.
 	Fee              int64       // Transaction fees.
 	startingPriority float64     // Priority when added to the pool.
+	size             int64       // Serialized size in bytes.
+	feePerKB         int64       // Fee per 1000 bytes.
+	heapIndex        int         // Index in the fee heap.
+
+	// parents and children are the in-pool transactions this one spends
+	// and the in-pool transactions which spend it.  ancestorPkg and
+	// descendantPkg aggregate this transaction together with all of its
+	// in-pool ancestors and descendants respectively.
+	parents       map[wire.ShaHash]*TxDesc
+	children      map[wire.ShaHash]*TxDesc
+	ancestorPkg   txPackage
+	descendantPkg txPackage
+}
+
+// txRemovalReason describes why a transaction was removed from the memory
+// pool.  Transactions which depend on a removed transaction and are removed
+// along with it are removed for the same reason.
+type txRemovalReason int
+
+// These constants are used to identify why a transaction was removed from the
+// memory pool.
+const (
+	// txRemovedMined indicates the transaction was included in a block
+	// connected to the main chain.
+	txRemovedMined txRemovalReason = iota
+
+	// txRemovedDoubleSpent indicates the transaction spends an output which
+	// is also spent by a transaction in a block connected to the main
+	// chain.
+	txRemovedDoubleSpent
+
+	// txRemovedEvicted indicates the transaction was evicted from the full
+	// memory pool due to low fees.
+	txRemovedEvicted
+
+	// txRemovedExpired indicates the transaction was not mined before the
+	// duration set by the mempoolexpiry option elapsed.
+	txRemovedExpired
+
+	// txRemovedReorg indicates the transaction depends on a transaction
+	// from a block disconnected from the main chain during a reorganize
+	// which could not be added back to the memory pool.
+	txRemovedReorg
+
+	// txRemovedReplaced indicates the transaction was replaced by a
+	// conflicting transaction paying higher fees.
+	txRemovedReplaced
+)
+
+// Map of txRemovalReason values back to their constant names for pretty
+// printing.
+var txRemovalReasonStrings = map[txRemovalReason]string{
+	txRemovedMined:       "mined",
+	txRemovedDoubleSpent: "doublespent",
+	txRemovedEvicted:     "evicted",
+	txRemovedExpired:     "expired",
+	txRemovedReorg:       "reorg",
+	txRemovedReplaced:    "replaced",
+}
+
+// String returns the txRemovalReason as a human-readable name.
+func (r txRemovalReason) String() string {
+	if s, ok := txRemovalReasonStrings[r]; ok {
+		return s
+	}
+	return fmt.Sprintf("Unknown txRemovalReason (%d)", int(r))
 }
 
 // txMemPool is used as a source of transactions that need to be mined into
@@ -100,6 +166,29 @@ type txMemPool struct {
 	lastUpdated   time.Time // last time pool was updated
 	pennyTotal    float64   // exponentially decaying total for penny spends.
 	lastPennyUnix int64     // unix time of last ``penny spend''
+
+	// ppc: the pool is limited in size by evicting the transactions
+	// paying the lowest fee per kilobyte.
+	feeHeap              txFeeHeap
+	totalSize            int64     // total serialized size of pool txns
+	rollingFeeRate       float64   // rolling min fee rate in Satoshi/KB
+	lastRollingFeeUpdate time.Time // last time rolling fee rate was updated
+	numEvicted           uint64    // number of evicted transactions
+	evictedBytes         uint64    // total size of evicted transactions
+	lastEvicted          time.Time // last time a transaction was evicted
+	lastExpiryCheck      time.Time // last time pool was scanned for expiry
+
+	// priorityDeltas holds the adjustments made through the
+	// prioritisetransaction RPC which are applied when selecting
+	// transactions for a block.
+	priorityDeltas map[wire.ShaHash]*txPriorityDelta
+}
+
+// txPriorityDelta houses the adjustments to the priority and fee of a
+// transaction which are applied when selecting transactions for a block.
+type txPriorityDelta struct {
+	priority float64
+	fee      int64
 }
 
 // isDust returns whether or not the passed transaction output amount is
@@ -387,6 +476,19 @@ func calcMinRequiredTxRelayFee(serializedSize int64) int64 {
 	return minFee
 }
 
+// minRelayFeeRate returns the minimum fee in Satoshi/1000 bytes a transaction
+// must pay to be accepted into the memory pool and relayed.  It is the larger
+// of the base fee used by calcMinRequiredTxRelayFee and the base fee the block
+// chain rules require through blockchain.GetMinFee, both of which are charged
+// per started kilobyte.
+func minRelayFeeRate() int64 {
+	minFee := calcMinRequiredTxRelayFee(0)
+	if blockchain.MinTxFee > minFee {
+		minFee = blockchain.MinTxFee
+	}
+	return minFee
+}
+
 // removeOrphan is the internal function which implements the public
 // RemoveOrphan.  See the comment for RemoveOrphan for more details.
 //
@@ -589,30 +691,29 @@ func (mp *txMemPool) HaveTransaction(hash *wire.ShaHash) bool {
 // RemoveTransaction.  See the comment for RemoveTransaction for more details.
 //
 // This function MUST be called with the mempool lock held (for writes).
-func (mp *txMemPool) removeTransaction(tx *btcutil.Tx) {
-	// Remove any transactions which rely on this one.
+func (mp *txMemPool) removeTransaction(tx *btcutil.Tx, removeRedeemers bool, reason txRemovalReason) {
 	txHash := tx.Sha()
-	for i := uint32(0); i < uint32(len(tx.MsgTx().TxOut)); i++ {
-		outpoint := wire.NewOutPoint(txHash, i)
-		if txRedeemer, exists := mp.outpoints[*outpoint]; exists {
-			mp.removeTransaction(txRedeemer)
+	if removeRedeemers {
+		// Remove any transactions which rely on this one.
+		for i := uint32(0); i < uint32(len(tx.MsgTx().TxOut)); i++ {
+			outpoint := wire.NewOutPoint(txHash, i)
+			if txRedeemer, exists := mp.outpoints[*outpoint]; exists {
+				mp.removeTransaction(txRedeemer, true, reason)
+			}
 		}
 	}
 
 	// Remove the transaction and mark the referenced outpoints as unspent
 	// by the pool.
 	if txDesc, exists := mp.pool[*txHash]; exists {
-		if cfg.AddrIndex {
-			mp.removeTransactionFromAddrIndex(tx)
-		}
+		mp.detachTransaction(txDesc)
 
-		for _, txIn := range txDesc.Tx.MsgTx().TxIn {
-			delete(mp.outpoints, txIn.PreviousOutPoint)
+		// Notify websocket clients about the removal.
+		if mp.server.rpcServer != nil {
+			mp.server.rpcServer.ntfnMgr.NotifyMempoolTxRemoved(tx,
+				reason)
 		}
-		delete(mp.pool, *txHash)
-		mp.lastUpdated = time.Now()
 	}
-
 }
 
 // removeTransactionFromAddrIndex removes the passed transaction from our
@@ -657,16 +758,18 @@ func (mp *txMemPool) removeScriptFromAddrIndex(pkScript []byte, tx *btcutil.Tx)
 	return nil
 }
 
-// RemoveTransaction removes the passed transaction and any transactions which
-// depend on it from the memory pool.
+// RemoveTransaction removes the passed transaction from the memory pool.  When
+// removeRedeemers is true, any transactions which depend on it are removed as
+// well, recursively.  The passed reason is reported to websocket clients which
+// have registered for removal notifications.
 //
 // This function is safe for concurrent access.
-func (mp *txMemPool) RemoveTransaction(tx *btcutil.Tx) {
+func (mp *txMemPool) RemoveTransaction(tx *btcutil.Tx, removeRedeemers bool, reason txRemovalReason) {
 	// Protect concurrent access.
 	mp.Lock()
 	defer mp.Unlock()
 
-	mp.removeTransaction(tx)
+	mp.removeTransaction(tx, removeRedeemers, reason)
 }
 
 // RemoveDoubleSpends removes all transactions which spend outputs spent by the
@@ -684,12 +787,52 @@ func (mp *txMemPool) RemoveDoubleSpends(tx *btcutil.Tx) {
 	for _, txIn := range tx.MsgTx().TxIn {
 		if txRedeemer, ok := mp.outpoints[txIn.PreviousOutPoint]; ok {
 			if !txRedeemer.Sha().IsEqual(tx.Sha()) {
-				mp.removeTransaction(txRedeemer)
+				mp.removeTransaction(txRedeemer, true,
+					txRemovedDoubleSpent)
 			}
 		}
 	}
 }
 
+// detachTransaction removes the transaction of the passed descriptor from the
+// memory pool and marks the outpoints it references as unspent by the pool.
+// Unlike removeTransaction, it neither removes the transactions which depend
+// on it nor notifies websocket clients.
+//
+// This function MUST be called with the mempool lock held (for writes).
+func (mp *txMemPool) detachTransaction(txD *TxDesc) {
+	if cfg.AddrIndex {
+		mp.removeTransactionFromAddrIndex(txD.Tx)
+	}
+
+	for _, txIn := range txD.Tx.MsgTx().TxIn {
+		delete(mp.outpoints, txIn.PreviousOutPoint)
+	}
+	mp.unlinkTransaction(txD)
+	delete(mp.pool, *txD.Tx.Sha())
+	mp.removeFromFeeHeap(txD)
+	mp.lastUpdated = mp.server.clock.Now()
+}
+
+// attachTransaction adds the transaction of the passed descriptor to the
+// memory pool and marks the outpoints it references as spent by the pool.
+//
+// This function MUST be called with the mempool lock held (for writes).
+func (mp *txMemPool) attachTransaction(txD *TxDesc) {
+	tx := txD.Tx
+	mp.pool[*tx.Sha()] = txD
+	mp.addToFeeHeap(txD)
+	mp.linkTransaction(txD)
+	for _, txIn := range tx.MsgTx().TxIn {
+		mp.outpoints[txIn.PreviousOutPoint] = tx
+	}
+	mp.lastUpdated = mp.server.clock.Now()
+
+	if cfg.AddrIndex {
+		mp.addTransactionToAddrIndex(tx)
+	}
+}
+
 // addTransaction adds the passed transaction to the memory pool.  It should
 // not be called directly as it doesn't perform any validation.  This is a
 // helper for maybeAcceptTransaction.
@@ -698,20 +841,12 @@ func (mp *txMemPool) RemoveDoubleSpends(tx *btcutil.Tx) {
 func (mp *txMemPool) addTransaction(tx *btcutil.Tx, height, fee int64) {
 	// Add the transaction to the pool and mark the referenced outpoints
 	// as spent by the pool.
-	mp.pool[*tx.Sha()] = &TxDesc{
+	mp.attachTransaction(&TxDesc{
 		Tx:     tx,
-		Added:  time.Now(),
+		Added:  mp.server.clock.Now(),
 		Height: height,
 		Fee:    fee,
-	}
-	for _, txIn := range tx.MsgTx().TxIn {
-		mp.outpoints[txIn.PreviousOutPoint] = tx
-	}
-	mp.lastUpdated = time.Now()
-
-	if cfg.AddrIndex {
-		mp.addTransactionToAddrIndex(tx)
-	}
+	})
 }
 
 // addTransactionToAddrIndex adds all addresses related to the transaction to
@@ -895,18 +1030,38 @@ func (txD *TxDesc) CurrentPriority(txStore blockchain.TxStore, nextBlockHeight i
 // Note it does not check for double spends against transactions already in the
 // main chain.
 //
+// When the mempoolreplacement option is set, conflicting transactions which
+// signal replaceability are not treated as an error.  They are returned instead
+// so the caller can check whether the passed transaction may replace them.
+//
 // This function MUST be called with the mempool lock held (for reads).
-func (mp *txMemPool) checkPoolDoubleSpend(tx *btcutil.Tx) error {
+func (mp *txMemPool) checkPoolDoubleSpend(tx *btcutil.Tx) (map[wire.ShaHash]*TxDesc, error) {
+	var conflicts map[wire.ShaHash]*TxDesc
 	for _, txIn := range tx.MsgTx().TxIn {
-		if txR, exists := mp.outpoints[txIn.PreviousOutPoint]; exists {
-			str := fmt.Sprintf("output %v already spent by "+
-				"transaction %v in the memory pool",
-				txIn.PreviousOutPoint, txR.Sha())
-			return txRuleError(wire.RejectDuplicate, str)
+		txR, exists := mp.outpoints[txIn.PreviousOutPoint]
+		if !exists {
+			continue
+		}
+
+		if cfg.MempoolReplacement {
+			txRHash := txR.Sha()
+			txRDesc, exists := mp.pool[*txRHash]
+			if exists && mp.isReplaceable(txRDesc) {
+				if conflicts == nil {
+					conflicts = make(map[wire.ShaHash]*TxDesc)
+				}
+				conflicts[*txRHash] = txRDesc
+				continue
+			}
 		}
+
+		str := fmt.Sprintf("output %v already spent by "+
+			"transaction %v in the memory pool",
+			txIn.PreviousOutPoint, txR.Sha())
+		return nil, txRuleError(wire.RejectDuplicate, str)
 	}
 
-	return nil
+	return conflicts, nil
 }
 
 // fetchInputTransactions fetches the input transactions referenced by the
@@ -1062,7 +1217,7 @@ func (mp *txMemPool) maybeAcceptTransaction(tx *btcutil.Tx, isNew, rateLimit boo
 	// at this point.  There is a more in-depth check that happens later
 	// after fetching the referenced transaction inputs from the main chain
 	// which examines the actual spend data and prevents double spends.
-	err = mp.checkPoolDoubleSpend(tx)
+	conflicts, err := mp.checkPoolDoubleSpend(tx)
 	if err != nil {
 		return nil, err
 	}
@@ -1159,6 +1314,31 @@ func (mp *txMemPool) maybeAcceptTransaction(tx *btcutil.Tx, isNew, rateLimit boo
 		return nil, txRuleError(wire.RejectNonstandard, str)
 	}
 
+	// ppc: Don't allow new transactions paying less than the minimum fee
+	// of the memory pool, which rises above the minimum fee required by the
+	// block chain rules once transactions have been evicted from a full
+	// pool.  Transactions which are being added back to the memory pool
+	// from blocks that have been disconnected during a reorg are exempted.
+	if isNew {
+		minPoolFee := mp.calcMinPoolFee(tx)
+		if txFee < minPoolFee {
+			str := fmt.Sprintf("transaction %v has %d fees which is "+
+				"under the memory pool minimum of %d", txHash,
+				txFee, minPoolFee)
+			return nil, txRuleError(wire.RejectInsufficientFee, str)
+		}
+	}
+
+	// ppc: Don't allow a transaction to replace the transactions it
+	// conflicts with unless it pays sufficiently higher fees.
+	var replaced map[wire.ShaHash]*TxDesc
+	if len(conflicts) != 0 {
+		replaced, err = mp.checkReplacement(tx, txFee, conflicts)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	// Don't allow transactions with fees too low to get into a mined block.
 	//
 	// Most miners allow a free transaction area in blocks they mine to go
@@ -1186,7 +1366,7 @@ func (mp *txMemPool) maybeAcceptTransaction(tx *btcutil.Tx, isNew, rateLimit boo
 	if isNew && !cfg.NoRelayPriority && txFee < minFee {
 		txD := &TxDesc{
 			Tx:     tx,
-			Added:  time.Now(),
+			Added:  mp.server.clock.Now(),
 			Height: curHeight,
 			Fee:    txFee,
 		}
@@ -1202,7 +1382,7 @@ func (mp *txMemPool) maybeAcceptTransaction(tx *btcutil.Tx, isNew, rateLimit boo
 	// Free-to-relay transactions are rate limited here to prevent
 	// penny-flooding with tiny transactions as a form of attack.
 	if rateLimit && txFee < minFee {
-		nowUnix := time.Now().Unix()
+		nowUnix := mp.server.clock.Now().Unix()
 		// we decay passed data with an exponentially decaying ~10
 		// minutes window - matches bitcoind handling.
 		mp.pennyTotal *= math.Pow(1.0-1.0/600.0,
@@ -1234,8 +1414,34 @@ func (mp *txMemPool) maybeAcceptTransaction(tx *btcutil.Tx, isNew, rateLimit boo
 		return nil, err
 	}
 
+	// ppc: Remove the transactions replaced by this one along with all of
+	// their descendants.  They are restored when this transaction is not
+	// admitted to a full pool after all, so websocket clients are only
+	// notified about them once it is.
+	var removed []replacedTx
+	if len(replaced) != 0 {
+		removed = mp.removeReplaced(replaced)
+	}
+
 	// Add to transaction pool.
-	mp.addTransaction(tx, curHeight, txFee)
+	if err := mp.admitTransaction(tx, curHeight, txFee); err != nil {
+		mp.restoreReplaced(removed)
+		return nil, err
+	}
+
+	if len(removed) != 0 {
+		txmpLog.Debugf("Transaction %v replaced %d transactions", txHash,
+			len(removed))
+
+		if mp.server.rpcServer != nil {
+			ntfnMgr := mp.server.rpcServer.ntfnMgr
+			for _, r := range removed {
+				ntfnMgr.NotifyMempoolTxRemoved(r.txD.Tx,
+					txRemovedReplaced)
+				ntfnMgr.NotifyMempoolTxReplaced(r.txD.Tx, tx)
+			}
+		}
+	}
 
 	txmpLog.Debugf("Accepted transaction %v (pool size: %v)", txHash,
 		len(mp.pool))
@@ -1249,6 +1455,11 @@ func (mp *txMemPool) maybeAcceptTransaction(tx *btcutil.Tx, isNew, rateLimit boo
 		mp.server.rpcServer.gbtWorkState.NotifyMempoolTx(mp.lastUpdated)
 	}
 
+	// Publish the transaction to the notification publishers.
+	for _, publisher := range mp.server.publishers {
+		publisher.NotifyTx(tx)
+	}
+
 	return nil, nil
 }
 
@@ -1443,6 +1654,67 @@ func (mp *txMemPool) Count() int {
 	return len(mp.pool)
 }
 
+// PrioritiseTransaction adds the passed deltas to the priority and fee in
+// Satoshi of the transaction with the passed hash when it is considered for
+// inclusion in a block.  The fee delta only affects the selection and not the
+// fee actually paid.  The deltas are kept until the transaction is mined, so
+// the transaction does not need to be in the pool yet.
+//
+// This function is safe for concurrent access.
+func (mp *txMemPool) PrioritiseTransaction(hash *wire.ShaHash, priorityDelta float64, feeDelta int64) {
+	mp.Lock()
+	defer mp.Unlock()
+
+	delta, exists := mp.priorityDeltas[*hash]
+	if !exists {
+		delta = &txPriorityDelta{}
+		mp.priorityDeltas[*hash] = delta
+	}
+	delta.priority += priorityDelta
+	delta.fee += feeDelta
+	mp.lastUpdated = mp.server.clock.Now()
+
+	txmpLog.Infof("Prioritised transaction %v: priority delta %g, fee "+
+		"delta %d", hash, delta.priority, delta.fee)
+}
+
+// ClearPrioritisation removes the priority and fee deltas of the transaction
+// with the passed hash.  It is called once the transaction has been mined.
+//
+// This function is safe for concurrent access.
+func (mp *txMemPool) ClearPrioritisation(hash *wire.ShaHash) {
+	mp.Lock()
+	defer mp.Unlock()
+
+	delete(mp.priorityDeltas, *hash)
+}
+
+// priorityDelta returns the priority and fee deltas of the transaction with the
+// passed hash, which are zero when it has not been prioritised.
+//
+// This function MUST be called with the mempool lock held (for reads).
+func (mp *txMemPool) priorityDelta(hash *wire.ShaHash) txPriorityDelta {
+	if delta, exists := mp.priorityDeltas[*hash]; exists {
+		return *delta
+	}
+	return txPriorityDelta{}
+}
+
+// PriorityDeltas returns a copy of the priority and fee deltas of all of the
+// prioritised transactions.
+//
+// This function is safe for concurrent access.
+func (mp *txMemPool) PriorityDeltas() map[wire.ShaHash]txPriorityDelta {
+	mp.RLock()
+	defer mp.RUnlock()
+
+	deltas := make(map[wire.ShaHash]txPriorityDelta, len(mp.priorityDeltas))
+	for hash, delta := range mp.priorityDeltas {
+		deltas[hash] = *delta
+	}
+	return deltas
+}
+
 // TxShas returns a slice of hashes for all of the transactions in the memory
 // pool.
 //
@@ -1500,6 +1772,8 @@ func newTxMemPool(server *server) *txMemPool {
 		orphans:       make(map[wire.ShaHash]*btcutil.Tx),
 		orphansByPrev: make(map[wire.ShaHash]*list.List),
 		outpoints:     make(map[wire.OutPoint]*btcutil.Tx),
+
+		priorityDeltas: make(map[wire.ShaHash]*txPriorityDelta),
 	}
 	if cfg.AddrIndex {
 		memPool.addrindex = make(map[string]map[wire.ShaHash]struct{})
@@ -0,0 +1,91 @@
+// Copyright (c) 2015 PPCD developers.
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ppcsuite/ppcd/wire"
+)
+
+// TestRemoveTransactionRedeemers ensures the in-pool transactions which spend a
+// removed transaction are only removed along with it when requested, and
+// otherwise remain in the pool with their ancestor packages no longer including
+// the removed transaction.
+func TestRemoveTransactionRedeemers(t *testing.T) {
+	oldCfg := cfg
+	defer func() { cfg = oldCfg }()
+	cfg = &config{MaxMempool: 300, MempoolExpiry: defaultMempoolExpiry}
+	tests := []struct {
+		name            string
+		removeRedeemers bool
+		reason          txRemovalReason
+	}{
+		{"keep redeemers", false, txRemovedMined},
+		{"remove redeemers", true, txRemovedDoubleSpent},
+	}
+	for _, test := range tests {
+		mp := newTestMemPool(time.Unix(1420070400, 0))
+		parent := newTestPoolTx(nil, 1, 100)
+		child := newTestPoolTx(parent, 2, 100)
+		grandchild := newTestPoolTx(child, 3, 100)
+		mp.addTransaction(parent, 1, testPoolFee(parent, 10000))
+		mp.addTransaction(child, 1, testPoolFee(child, 10000))
+		mp.addTransaction(grandchild, 1, testPoolFee(grandchild, 10000))
+		childSize := mp.pool[*child.Sha()].size
+		grandchildSize := mp.pool[*grandchild.Sha()].size
+
+		mp.RemoveTransaction(parent, test.removeRedeemers, test.reason)
+		if mp.IsTransactionInPool(parent.Sha()) {
+			t.Errorf("%s: removed transaction still in the pool",
+				test.name)
+		}
+		if test.removeRedeemers {
+			if len(mp.pool) != 0 || len(mp.outpoints) != 0 ||
+				mp.totalSize != 0 {
+
+				t.Errorf("%s: got %d transactions, %d outpoints and "+
+					"%d bytes, want none", test.name,
+					len(mp.pool), len(mp.outpoints),
+					mp.totalSize)
+			}
+			continue
+		}
+
+		childD, ok := mp.pool[*child.Sha()]
+		if !ok || !mp.IsTransactionInPool(grandchild.Sha()) {
+			t.Errorf("%s: spenders of the removed transaction are no "+
+				"longer in the pool", test.name)
+			continue
+		}
+		grandchildD := mp.pool[*grandchild.Sha()]
+
+		// The child still spends the output of the removed transaction
+		// until the block is processed further, but no longer depends
+		// on it in the pool.
+		spentByChild := wire.OutPoint{Hash: *parent.Sha()}
+		if mp.outpoints[spentByChild] != child {
+			t.Errorf("%s: outpoint spent by the child not tracked",
+				test.name)
+		}
+		if len(childD.parents) != 0 {
+			t.Errorf("%s: child still has %d parents", test.name,
+				len(childD.parents))
+		}
+		if got := childD.ancestorPkg.count; got != 1 {
+			t.Errorf("%s: child ancestor package: got %d "+
+				"transactions, want 1", test.name, got)
+		}
+		if got := grandchildD.ancestorPkg.count; got != 2 {
+			t.Errorf("%s: grandchild ancestor package: got %d "+
+				"transactions, want 2", test.name, got)
+		}
+		if want := childSize + grandchildSize; mp.totalSize != want {
+			t.Errorf("%s: got pool size %d, want %d", test.name,
+				mp.totalSize, want)
+		}
+	}
+}
@@ -0,0 +1,201 @@
+// Copyright (c) 2015 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/ppcsuite/ppcd/wire"
+)
+
+// txPackage houses the aggregate number of transactions, serialized size, and
+// fees of a transaction together with either all of its ancestors or all of its
+// descendants in the memory pool.
+type txPackage struct {
+	count int64
+	size  int64
+	fees  int64
+}
+
+// add adds the passed transaction to the package.
+func (p *txPackage) add(txD *TxDesc) {
+	p.count++
+	p.size += txD.size
+	p.fees += txD.Fee
+}
+
+// remove removes the passed transaction from the package.
+func (p *txPackage) remove(txD *TxDesc) {
+	p.count--
+	p.size -= txD.size
+	p.fees -= txD.Fee
+}
+
+// newTxPackage returns the package made of the passed transaction together with
+// the passed related transactions.
+func newTxPackage(txD *TxDesc, related map[wire.ShaHash]*TxDesc) txPackage {
+	var pkg txPackage
+	pkg.add(txD)
+	for _, relative := range related {
+		pkg.add(relative)
+	}
+	return pkg
+}
+
+// ancestors returns all of the in-pool transactions the passed transaction
+// depends on, directly or indirectly.
+//
+// This function MUST be called with the mempool lock held (for reads).
+func (mp *txMemPool) ancestors(txD *TxDesc) map[wire.ShaHash]*TxDesc {
+	ancestors := make(map[wire.ShaHash]*TxDesc)
+	queue := []*TxDesc{txD}
+	for len(queue) > 0 {
+		cur := queue[0]
+		queue = queue[1:]
+		for hash, parent := range cur.parents {
+			if _, ok := ancestors[hash]; !ok {
+				ancestors[hash] = parent
+				queue = append(queue, parent)
+			}
+		}
+	}
+	return ancestors
+}
+
+// descendants returns all of the in-pool transactions which depend on the
+// passed transaction, directly or indirectly.
+//
+// This function MUST be called with the mempool lock held (for reads).
+func (mp *txMemPool) descendants(txD *TxDesc) map[wire.ShaHash]*TxDesc {
+	descendants := make(map[wire.ShaHash]*TxDesc)
+	queue := []*TxDesc{txD}
+	for len(queue) > 0 {
+		cur := queue[0]
+		queue = queue[1:]
+		for hash, child := range cur.children {
+			if _, ok := descendants[hash]; !ok {
+				descendants[hash] = child
+				queue = append(queue, child)
+			}
+		}
+	}
+	return descendants
+}
+
+// linkTransaction links the passed transaction which was just added to the
+// pool to the in-pool transactions it spends and to the in-pool transactions
+// which already spend it, and updates the ancestor and descendant packages
+// accordingly.  The latter happens when a transaction of a block disconnected
+// from the main chain is added back to the pool.
+//
+// This function MUST be called with the mempool lock held (for writes).
+func (mp *txMemPool) linkTransaction(txD *TxDesc) {
+	txD.parents = make(map[wire.ShaHash]*TxDesc)
+	txD.children = make(map[wire.ShaHash]*TxDesc)
+	txHash := txD.Tx.Sha()
+	for _, txIn := range txD.Tx.MsgTx().TxIn {
+		parentHash := txIn.PreviousOutPoint.Hash
+		if parent, exists := mp.pool[parentHash]; exists {
+			txD.parents[parentHash] = parent
+			parent.children[*txHash] = txD
+		}
+	}
+	for i := range txD.Tx.MsgTx().TxOut {
+		outpoint := wire.OutPoint{Hash: *txHash, Index: uint32(i)}
+		spender, exists := mp.outpoints[outpoint]
+		if !exists {
+			continue
+		}
+		if child, exists := mp.pool[*spender.Sha()]; exists {
+			txD.children[*spender.Sha()] = child
+			child.parents[*txHash] = txD
+		}
+	}
+
+	ancestors := mp.ancestors(txD)
+	descendants := mp.descendants(txD)
+	txD.ancestorPkg = newTxPackage(txD, ancestors)
+	txD.descendantPkg = newTxPackage(txD, descendants)
+
+	// Without descendants, the transaction is simply added to the packages
+	// of its ancestors.  Otherwise, the descendants may already be related
+	// to some of the ancestors, so the affected packages are recalculated.
+	for _, ancestor := range ancestors {
+		if len(descendants) == 0 {
+			ancestor.descendantPkg.add(txD)
+			continue
+		}
+		ancestor.descendantPkg = newTxPackage(ancestor,
+			mp.descendants(ancestor))
+	}
+	for _, descendant := range descendants {
+		descendant.ancestorPkg = newTxPackage(descendant,
+			mp.ancestors(descendant))
+	}
+}
+
+// unlinkTransaction unlinks the passed transaction which is being removed from
+// the pool and updates the ancestor and descendant packages accordingly.
+//
+// This function MUST be called with the mempool lock held (for writes).
+func (mp *txMemPool) unlinkTransaction(txD *TxDesc) {
+	for _, ancestor := range mp.ancestors(txD) {
+		ancestor.descendantPkg.remove(txD)
+	}
+	for _, descendant := range mp.descendants(txD) {
+		descendant.ancestorPkg.remove(txD)
+	}
+
+	txHash := txD.Tx.Sha()
+	for _, parent := range txD.parents {
+		delete(parent.children, *txHash)
+	}
+	for _, child := range txD.children {
+		delete(child.parents, *txHash)
+	}
+	txD.parents = nil
+	txD.children = nil
+}
+
+// TxAncestors returns the descriptors of all of the in-pool transactions the
+// transaction with the passed hash depends on, directly or indirectly.
+//
+// This function is safe for concurrent access.
+func (mp *txMemPool) TxAncestors(hash *wire.ShaHash) ([]*TxDesc, error) {
+	mp.RLock()
+	defer mp.RUnlock()
+
+	txD, exists := mp.pool[*hash]
+	if !exists {
+		return nil, fmt.Errorf("transaction is not in the pool")
+	}
+	ancestors := mp.ancestors(txD)
+	descs := make([]*TxDesc, 0, len(ancestors))
+	for _, ancestor := range ancestors {
+		descs = append(descs, ancestor)
+	}
+	return descs, nil
+}
+
+// TxDescendants returns the descriptors of all of the in-pool transactions
+// which depend on the transaction with the passed hash, directly or
+// indirectly.
+//
+// This function is safe for concurrent access.
+func (mp *txMemPool) TxDescendants(hash *wire.ShaHash) ([]*TxDesc, error) {
+	mp.RLock()
+	defer mp.RUnlock()
+
+	txD, exists := mp.pool[*hash]
+	if !exists {
+		return nil, fmt.Errorf("transaction is not in the pool")
+	}
+	descendants := mp.descendants(txD)
+	descs := make([]*TxDesc, 0, len(descendants))
+	for _, descendant := range descendants {
+		descs = append(descs, descendant)
+	}
+	return descs, nil
+}
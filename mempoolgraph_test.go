@@ -0,0 +1,105 @@
+// Copyright (c) 2015 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"testing"
+
+	"github.com/ppcsuite/btcutil"
+	"github.com/ppcsuite/ppcd/wire"
+)
+
+// TestLinkTransactionChildFirst ensures the ancestor and descendant graph of the
+// memory pool is correct when a transaction is added after the in-pool
+// transactions which spend it, as happens when a block is disconnected.
+func TestLinkTransactionChildFirst(t *testing.T) {
+	mp := &txMemPool{
+		pool:      make(map[wire.ShaHash]*TxDesc),
+		outpoints: make(map[wire.OutPoint]*btcutil.Tx),
+	}
+
+	// newTx returns a transaction with a single output spending the
+	// first output of the passed transaction, or a made up outpoint when
+	// nil.
+	newTx := func(spends *btcutil.Tx, lockTime uint32) *btcutil.Tx {
+		msgTx := wire.NewMsgTx()
+		prevOut := wire.OutPoint{Index: lockTime}
+		if spends != nil {
+			prevOut = wire.OutPoint{Hash: *spends.Sha()}
+		}
+		msgTx.AddTxIn(wire.NewTxIn(&prevOut, nil))
+		msgTx.AddTxOut(wire.NewTxOut(1000, nil))
+		msgTx.LockTime = lockTime
+		return btcutil.NewTx(msgTx)
+	}
+
+	// addTx adds the passed transaction to the pool the same way
+	// addTransaction does.
+	addTx := func(tx *btcutil.Tx, fee int64) *TxDesc {
+		txD := &TxDesc{Tx: tx, Fee: fee, size: 100}
+		mp.pool[*tx.Sha()] = txD
+		mp.linkTransaction(txD)
+		for _, txIn := range tx.MsgTx().TxIn {
+			mp.outpoints[txIn.PreviousOutPoint] = tx
+		}
+		return txD
+	}
+
+	// The chain of spends is grandparent -> parent -> child -> grandchild,
+	// with the parent added last.
+	grandparentTx := newTx(nil, 1)
+	parentTx := newTx(grandparentTx, 2)
+	childTx := newTx(parentTx, 3)
+	grandchildTx := newTx(childTx, 4)
+	grandparent := addTx(grandparentTx, 1)
+	child := addTx(childTx, 4)
+	grandchild := addTx(grandchildTx, 8)
+	parent := addTx(parentTx, 2)
+
+	if _, ok := parent.parents[*grandparentTx.Sha()]; !ok ||
+		len(parent.parents) != 1 {
+
+		t.Errorf("parent has parents %v, want the grandparent",
+			parent.parents)
+	}
+	if _, ok := parent.children[*childTx.Sha()]; !ok ||
+		len(parent.children) != 1 {
+
+		t.Errorf("parent has children %v, want the child",
+			parent.children)
+	}
+	if _, ok := child.parents[*parentTx.Sha()]; !ok {
+		t.Errorf("child is not linked to the parent")
+	}
+
+	tests := []struct {
+		name string
+		got  txPackage
+		want txPackage
+	}{
+		{"grandparent ancestors", grandparent.ancestorPkg,
+			txPackage{count: 1, size: 100, fees: 1}},
+		{"grandparent descendants", grandparent.descendantPkg,
+			txPackage{count: 4, size: 400, fees: 15}},
+		{"parent ancestors", parent.ancestorPkg,
+			txPackage{count: 2, size: 200, fees: 3}},
+		{"parent descendants", parent.descendantPkg,
+			txPackage{count: 3, size: 300, fees: 14}},
+		{"child ancestors", child.ancestorPkg,
+			txPackage{count: 3, size: 300, fees: 7}},
+		{"child descendants", child.descendantPkg,
+			txPackage{count: 2, size: 200, fees: 12}},
+		{"grandchild ancestors", grandchild.ancestorPkg,
+			txPackage{count: 4, size: 400, fees: 15}},
+		{"grandchild descendants", grandchild.descendantPkg,
+			txPackage{count: 1, size: 100, fees: 8}},
+	}
+	for _, test := range tests {
+		if test.got != test.want {
+			t.Errorf("%s: got %+v, want %+v", test.name, test.got,
+				test.want)
+		}
+	}
+}
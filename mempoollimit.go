@@ -0,0 +1,317 @@
+// Copyright (c) 2015 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"container/heap"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/ppcsuite/btcutil"
+	"github.com/ppcsuite/ppcd/blockchain"
+	"github.com/ppcsuite/ppcd/wire"
+)
+
+const (
+	// rollingFeeHalfLife is the amount of time it takes for the rolling
+	// minimum fee rate of a pool which is at least half full to decay to
+	// half of its value.  The rolling minimum fee rate of emptier pools
+	// decays faster.
+	rollingFeeHalfLife = time.Hour * 12
+
+	// rollingFeeUpdateInterval is the minimum amount of time between two
+	// decays of the rolling minimum fee rate.
+	rollingFeeUpdateInterval = time.Second * 10
+
+	// rollingFeeIncrement is the amount in Satoshi/1000 bytes the rolling
+	// minimum fee rate is raised above the fee rate of evicted
+	// transactions.  It ensures a transaction replacing an evicted one
+	// pays for the relay bandwidth the evicted one consumed.
+	rollingFeeIncrement = blockchain.MinRelayTxFee
+
+	// expiryCheckInterval is the minimum amount of time between two scans
+	// of the memory pool for transactions which have expired.
+	expiryCheckInterval = time.Minute * 5
+)
+
+// txFeeHeap is a min-heap of the descriptors of the transactions in the memory
+// pool ordered by fee per kilobyte.  It implements heap.Interface.
+type txFeeHeap []*TxDesc
+
+// Len returns the number of descriptors in the heap.  It is part of the
+// heap.Interface implementation.
+func (h txFeeHeap) Len() int { return len(h) }
+
+// Less returns whether the descriptor with index i pays a lower fee per
+// kilobyte than the descriptor with index j.  Descriptors paying the same fee
+// rate are ordered by the time they were added so the newest are evicted
+// first.  It is part of the heap.Interface implementation.
+func (h txFeeHeap) Less(i, j int) bool {
+	if h[i].feePerKB == h[j].feePerKB {
+		return h[i].Added.After(h[j].Added)
+	}
+	return h[i].feePerKB < h[j].feePerKB
+}
+
+// Swap swaps the descriptors at the passed indices.  It is part of the
+// heap.Interface implementation.
+func (h txFeeHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].heapIndex = i
+	h[j].heapIndex = j
+}
+
+// Push pushes the passed descriptor onto the heap.  It is part of the
+// heap.Interface implementation.
+func (h *txFeeHeap) Push(x interface{}) {
+	txD := x.(*TxDesc)
+	txD.heapIndex = len(*h)
+	*h = append(*h, txD)
+}
+
+// Pop removes the last descriptor from the heap.  It is part of the
+// heap.Interface implementation.
+func (h *txFeeHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	txD := old[n-1]
+	old[n-1] = nil
+	txD.heapIndex = -1
+	*h = old[:n-1]
+	return txD
+}
+
+// maxPoolBytes returns the maximum size in bytes of the transactions in the
+// main pool.
+func maxPoolBytes() int64 {
+	return int64(cfg.MaxMempool) * 1000000
+}
+
+// rollingMinFeeRate returns the current rolling minimum fee rate in
+// Satoshi/1000 bytes after decaying it based on the amount of time elapsed
+// since it was last updated.  The rate decays faster when the pool is mostly
+// empty.
+//
+// This function MUST be called with the mempool lock held (for writes).
+func (mp *txMemPool) rollingMinFeeRate() int64 {
+	if mp.rollingFeeRate == 0 {
+		return 0
+	}
+
+	now := mp.server.clock.Now()
+	elapsed := now.Sub(mp.lastRollingFeeUpdate)
+	if elapsed > rollingFeeUpdateInterval {
+		halfLife := rollingFeeHalfLife
+		if mp.totalSize < maxPoolBytes()/4 {
+			halfLife /= 4
+		} else if mp.totalSize < maxPoolBytes()/2 {
+			halfLife /= 2
+		}
+		mp.rollingFeeRate /= math.Pow(2, elapsed.Seconds()/
+			halfLife.Seconds())
+		mp.lastRollingFeeUpdate = now
+
+		// Stop requiring a higher fee once the rate has decayed to a
+		// negligible amount.
+		if mp.rollingFeeRate < float64(rollingFeeIncrement)/2 {
+			mp.rollingFeeRate = 0
+			return 0
+		}
+	}
+
+	return int64(math.Max(mp.rollingFeeRate, float64(rollingFeeIncrement)))
+}
+
+// calcMinPoolFee returns the minimum fee the passed transaction must pay to be
+// accepted into the memory pool.  It is the minimum fee required by the block
+// chain rules unless the rolling minimum fee rate, which is raised when
+// transactions are evicted from a full pool, requires more.
+//
+// This function MUST be called with the mempool lock held (for writes).
+func (mp *txMemPool) calcMinPoolFee(tx *btcutil.Tx) int64 {
+	minFee := blockchain.GetMinFee(tx.MsgTx())
+	serializedSize := int64(tx.MsgTx().SerializeSize())
+	rollingFee := mp.rollingMinFeeRate() * serializedSize / 1000
+	if rollingFee > minFee {
+		minFee = rollingFee
+	}
+	return minFee
+}
+
+// limitPoolSize evicts the transactions paying the lowest fee per kilobyte,
+// along with any transactions which depend on them, until the total size of
+// the pool is within the limit set by the maxmempool option.  The rolling
+// minimum fee rate is raised above the fee rate of the evicted transactions
+// so they cannot simply be replaced by others paying the same fee rate.
+//
+// This function MUST be called with the mempool lock held (for writes).
+func (mp *txMemPool) limitPoolSize() {
+	maxBytes := maxPoolBytes()
+	for mp.totalSize > maxBytes && len(mp.feeHeap) > 0 {
+		txD := mp.feeHeap[0]
+		feeRate := float64(txD.feePerKB + rollingFeeIncrement)
+		if feeRate > mp.rollingFeeRate {
+			mp.rollingFeeRate = feeRate
+			mp.lastRollingFeeUpdate = mp.server.clock.Now()
+		}
+
+		numTxns, totalSize := len(mp.pool), mp.totalSize
+		mp.removeTransaction(txD.Tx, true, txRemovedEvicted)
+		numEvicted := numTxns - len(mp.pool)
+		mp.numEvicted += uint64(numEvicted)
+		mp.evictedBytes += uint64(totalSize - mp.totalSize)
+		mp.lastEvicted = mp.server.clock.Now()
+
+		txmpLog.Debugf("Evicted transaction %v paying %d per kB and %d "+
+			"dependent transactions from the full memory pool",
+			txD.Tx.Sha(), txD.feePerKB, numEvicted-1)
+	}
+}
+
+// expireTransactions removes the transactions which have been in the memory
+// pool for longer than the duration set by the mempoolexpiry option, along
+// with any transactions which depend on them.  The pool is scanned at most
+// once every expiryCheckInterval.
+//
+// This function MUST be called with the mempool lock held (for writes).
+func (mp *txMemPool) expireTransactions() {
+	now := mp.server.clock.Now()
+	if now.Sub(mp.lastExpiryCheck) < expiryCheckInterval {
+		return
+	}
+	mp.lastExpiryCheck = now
+
+	numTxns := len(mp.pool)
+	cutoff := now.Add(-cfg.MempoolExpiry)
+	for _, txD := range mp.pool {
+		if txD.Added.Before(cutoff) {
+			mp.removeTransaction(txD.Tx, true, txRemovedExpired)
+		}
+	}
+	if numExpired := numTxns - len(mp.pool); numExpired > 0 {
+		txmpLog.Debugf("Expired %d transactions from the memory pool "+
+			"(pool size: %v)", numExpired, len(mp.pool))
+	}
+}
+
+// admitTransaction adds the passed transaction to the memory pool, then expires
+// old transactions and evicts the transactions paying the lowest fee rate if
+// the pool exceeds its maximum size.  A rule error is returned when this
+// evicts the new transaction.
+//
+// This function MUST be called with the mempool lock held (for writes).
+func (mp *txMemPool) admitTransaction(tx *btcutil.Tx, height, fee int64) error {
+	mp.addTransaction(tx, height, fee)
+	mp.expireTransactions()
+	mp.limitPoolSize()
+	if _, exists := mp.pool[*tx.Sha()]; !exists {
+		str := fmt.Sprintf("transaction %v was evicted from the full "+
+			"memory pool due to low fees", tx.Sha())
+		return txRuleError(wire.RejectInsufficientFee, str)
+	}
+	return nil
+}
+
+// ExpireTransactions removes the transactions which have been in the memory
+// pool for longer than the duration set by the mempoolexpiry option, along
+// with any transactions which depend on them.
+//
+// This function is safe for concurrent access.
+func (mp *txMemPool) ExpireTransactions() {
+	mp.Lock()
+	defer mp.Unlock()
+
+	mp.expireTransactions()
+}
+
+// addToFeeHeap adds the passed descriptor of a transaction which was added to
+// the pool to the fee heap and accounts for its size.
+//
+// This function MUST be called with the mempool lock held (for writes).
+func (mp *txMemPool) addToFeeHeap(txD *TxDesc) {
+	txD.size = int64(txD.Tx.MsgTx().SerializeSize())
+	txD.feePerKB = txD.Fee * 1000 / txD.size
+	heap.Push(&mp.feeHeap, txD)
+	mp.totalSize += txD.size
+}
+
+// removeFromFeeHeap removes the passed descriptor of a transaction which was
+// removed from the pool from the fee heap and accounts for its size.
+//
+// This function MUST be called with the mempool lock held (for writes).
+func (mp *txMemPool) removeFromFeeHeap(txD *TxDesc) {
+	if txD.heapIndex >= 0 && txD.heapIndex < len(mp.feeHeap) &&
+		mp.feeHeap[txD.heapIndex] == txD {
+
+		heap.Remove(&mp.feeHeap, txD.heapIndex)
+	}
+	mp.totalSize -= txD.size
+}
+
+// Approximate amounts of memory in bytes used for the transactions in the pool
+// in addition to their serialized size.  They account for the deserialized
+// transaction structures, the transaction descriptor, and the entries in the
+// maps and the fee heap which reference them.
+const (
+	txMemOverhead       = 400
+	txInputMemOverhead  = 136
+	txOutputMemOverhead = 40
+)
+
+// mempoolInfo houses information about the size of the memory pool, the fees
+// required to enter it, and the transactions which were evicted to keep it
+// within its limit.
+type mempoolInfo struct {
+	Count           int
+	Size            int64
+	Usage           int64
+	MaxSize         int64
+	MinFeeRate      int64
+	MinRelayFeeRate int64
+	NumOrphans      int
+	NumEvicted      uint64
+	EvictedBytes    uint64
+	LastEvicted     time.Time
+}
+
+// Info returns information about the size and approximate memory usage of the
+// memory pool, the minimum fee rates in Satoshi/1000 bytes currently required
+// to enter it and to be relayed, and the transactions which were evicted to
+// keep it within its limit.
+//
+// This function is safe for concurrent access.
+func (mp *txMemPool) Info() *mempoolInfo {
+	// The lock is held for writes since the rolling minimum fee rate is
+	// decayed as a side effect.
+	mp.Lock()
+	defer mp.Unlock()
+
+	usage := mp.totalSize
+	for _, txD := range mp.pool {
+		msgTx := txD.Tx.MsgTx()
+		usage += txMemOverhead +
+			int64(len(msgTx.TxIn))*txInputMemOverhead +
+			int64(len(msgTx.TxOut))*txOutputMemOverhead
+	}
+
+	minRelayFeeRate := minRelayFeeRate()
+	minFeeRate := mp.rollingMinFeeRate()
+	if minFeeRate < minRelayFeeRate {
+		minFeeRate = minRelayFeeRate
+	}
+	return &mempoolInfo{
+		Count:           len(mp.pool),
+		Size:            mp.totalSize,
+		Usage:           usage,
+		MaxSize:         maxPoolBytes(),
+		MinFeeRate:      minFeeRate,
+		MinRelayFeeRate: minRelayFeeRate,
+		NumOrphans:      len(mp.orphans),
+		NumEvicted:      mp.numEvicted,
+		EvictedBytes:    mp.evictedBytes,
+		LastEvicted:     mp.lastEvicted,
+	}
+}
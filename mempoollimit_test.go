@@ -0,0 +1,229 @@
+// Copyright (c) 2015 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ppcsuite/btcutil"
+	"github.com/ppcsuite/ppcd/wire"
+)
+
+// newTestMemPool returns an empty memory pool whose clock is fixed at the
+// passed time.
+func newTestMemPool(now time.Time) *txMemPool {
+	clock := newNodeClock(true)
+	clock.setMockTime(now)
+	return &txMemPool{
+		server:         &server{clock: clock},
+		pool:           make(map[wire.ShaHash]*TxDesc),
+		orphans:        make(map[wire.ShaHash]*btcutil.Tx),
+		outpoints:      make(map[wire.OutPoint]*btcutil.Tx),
+		priorityDeltas: make(map[wire.ShaHash]*txPriorityDelta),
+	}
+}
+
+// newTestPoolTx returns a transaction with a single output whose script has
+// the passed size.  It spends the first output of the passed transaction, or a
+// made up outpoint identified by id when nil.
+func newTestPoolTx(spends *btcutil.Tx, id uint32, scriptSize int) *btcutil.Tx {
+	msgTx := wire.NewMsgTx()
+	prevOut := wire.OutPoint{Index: id}
+	if spends != nil {
+		prevOut = wire.OutPoint{Hash: *spends.Sha()}
+	}
+	msgTx.AddTxIn(wire.NewTxIn(&prevOut, nil))
+	msgTx.AddTxOut(wire.NewTxOut(1000, make([]byte, scriptSize)))
+	return btcutil.NewTx(msgTx)
+}
+
+// testPoolFee returns the fee the passed transaction pays at the passed fee
+// rate in Satoshi/1000 bytes.
+func testPoolFee(tx *btcutil.Tx, feePerKB int64) int64 {
+	return feePerKB * int64(tx.MsgTx().SerializeSize()) / 1000
+}
+
+// TestLimitPoolSize ensures the transactions paying the lowest fee rate are
+// evicted along with their descendants until the pool is within its limit, and
+// that the rolling minimum fee rate is raised above the evicted fee rate.
+func TestLimitPoolSize(t *testing.T) {
+	oldCfg := cfg
+	defer func() { cfg = oldCfg }()
+	cfg = &config{MaxMempool: 1, MempoolExpiry: defaultMempoolExpiry}
+	now := time.Unix(1420070400, 0)
+	mp := newTestMemPool(now)
+
+	// Four transactions of about 300 kB exceed the limit of 1 MB.  The
+	// cheapest one is evicted with its child, which pays the highest fee
+	// rate, and the pool is then within its limit.
+	high := newTestPoolTx(nil, 1, 300000)
+	low := newTestPoolTx(nil, 2, 300000)
+	medium := newTestPoolTx(nil, 3, 300000)
+	lowChild := newTestPoolTx(low, 4, 300000)
+	mp.addTransaction(high, 1, testPoolFee(high, 30000))
+	mp.addTransaction(low, 1, testPoolFee(low, 10000))
+	mp.addTransaction(medium, 1, testPoolFee(medium, 20000))
+	mp.addTransaction(lowChild, 1, testPoolFee(lowChild, 50000))
+	lowD := mp.pool[*low.Sha()]
+	evictedBytes := lowD.size + mp.pool[*lowChild.Sha()].size
+
+	mp.limitPoolSize()
+	for _, test := range []struct {
+		name string
+		tx   *btcutil.Tx
+		want bool
+	}{
+		{"high", high, true},
+		{"low", low, false},
+		{"medium", medium, true},
+		{"low child", lowChild, false},
+	} {
+		if _, ok := mp.pool[*test.tx.Sha()]; ok != test.want {
+			t.Errorf("%s fee transaction in pool %v, want %v",
+				test.name, ok, test.want)
+		}
+	}
+	if len(mp.feeHeap) != len(mp.pool) {
+		t.Errorf("got %d transactions in the fee heap, want %d",
+			len(mp.feeHeap), len(mp.pool))
+	}
+	if mp.numEvicted != 2 || mp.evictedBytes != uint64(evictedBytes) {
+		t.Errorf("got %d evicted transactions of %d bytes, want 2 of %d",
+			mp.numEvicted, mp.evictedBytes, evictedBytes)
+	}
+	wantRate := float64(lowD.feePerKB + rollingFeeIncrement)
+	if mp.rollingFeeRate != wantRate {
+		t.Errorf("got rolling fee rate %v, want %v", mp.rollingFeeRate,
+			wantRate)
+	}
+	if !mp.lastRollingFeeUpdate.Equal(now) || !mp.lastEvicted.Equal(now) {
+		t.Errorf("rolling fee rate updated at %v and last eviction at "+
+			"%v, want %v", mp.lastRollingFeeUpdate, mp.lastEvicted, now)
+	}
+}
+
+// TestRollingMinFeeRate ensures the rolling minimum fee rate decays faster the
+// emptier the pool is and stops applying once it is negligible.
+func TestRollingMinFeeRate(t *testing.T) {
+	oldCfg := cfg
+	defer func() { cfg = oldCfg }()
+	cfg = &config{MaxMempool: 1}
+	maxBytes := maxPoolBytes()
+	now := time.Unix(1420070400, 0)
+
+	tests := []struct {
+		name      string
+		rate      float64
+		totalSize int64
+		elapsed   time.Duration
+		want      int64
+		wantRate  float64
+	}{
+		{"no rate", 0, maxBytes, time.Hour * 12, 0, 0},
+		{"within update interval", 100000, maxBytes,
+			rollingFeeUpdateInterval, 100000, 100000},
+		{"half full", 100000, maxBytes / 2, time.Hour * 12, 50000, 50000},
+		{"quarter full", 100000, maxBytes / 4, time.Hour * 6, 50000,
+			50000},
+		{"almost empty", 100000, 0, time.Hour * 3, 50000, 50000},
+		{"two half lives", 100000, maxBytes, time.Hour * 24, 25000,
+			25000},
+		{"below increment", 16000, maxBytes, time.Hour * 12,
+			rollingFeeIncrement, 8000},
+		{"negligible", 8000, maxBytes, time.Hour * 12, 0, 0},
+	}
+	for _, test := range tests {
+		mp := newTestMemPool(now.Add(test.elapsed))
+		mp.rollingFeeRate = test.rate
+		mp.lastRollingFeeUpdate = now
+		mp.totalSize = test.totalSize
+
+		if got := mp.rollingMinFeeRate(); got != test.want {
+			t.Errorf("%s: got rolling minimum fee rate %d, want %d",
+				test.name, got, test.want)
+		}
+		if mp.rollingFeeRate != test.wantRate {
+			t.Errorf("%s: got decayed rate %v, want %v", test.name,
+				mp.rollingFeeRate, test.wantRate)
+		}
+	}
+}
+
+// TestExpireTransactions ensures transactions which have been in the pool for
+// too long are removed along with their descendants, and that the pool is only
+// scanned once per expiry check interval.
+func TestExpireTransactions(t *testing.T) {
+	oldCfg := cfg
+	defer func() { cfg = oldCfg }()
+	cfg = &config{MaxMempool: 1, MempoolExpiry: time.Hour * 72}
+	start := time.Unix(1420070400, 0)
+	mp := newTestMemPool(start)
+
+	parent := newTestPoolTx(nil, 1, 25)
+	mp.addTransaction(parent, 1, 0)
+	mp.server.clock.setMockTime(start.Add(time.Hour * 2))
+	child := newTestPoolTx(parent, 2, 25)
+	unrelated := newTestPoolTx(nil, 3, 25)
+	mp.addTransaction(child, 1, 0)
+	mp.addTransaction(unrelated, 1, 0)
+
+	mp.server.clock.setMockTime(start.Add(time.Hour*72 + time.Minute))
+	mp.expireTransactions()
+	if len(mp.pool) != 1 || mp.pool[*unrelated.Sha()] == nil {
+		t.Fatalf("got %d transactions after expiry, want only the "+
+			"unrelated one", len(mp.pool))
+	}
+
+	// The unrelated transaction is past the expiry now, but the pool is
+	// not scanned again until the check interval has elapsed.
+	mp.server.clock.setMockTime(start.Add(time.Hour*74 + time.Minute))
+	mp.lastExpiryCheck = mp.server.clock.Now().Add(-expiryCheckInterval +
+		time.Second)
+	mp.expireTransactions()
+	if len(mp.pool) != 1 {
+		t.Errorf("transaction expired within the check interval")
+	}
+	mp.lastExpiryCheck = mp.server.clock.Now().Add(-expiryCheckInterval)
+	mp.expireTransactions()
+	if len(mp.pool) != 0 {
+		t.Errorf("got %d transactions after the check interval, want 0",
+			len(mp.pool))
+	}
+}
+
+// TestAdmitTransactionEvicted ensures a transaction which is evicted from the
+// full pool while it is being accepted is rejected for its low fees.
+func TestAdmitTransactionEvicted(t *testing.T) {
+	oldCfg := cfg
+	defer func() { cfg = oldCfg }()
+	cfg = &config{MaxMempool: 1, MempoolExpiry: defaultMempoolExpiry}
+	mp := newTestMemPool(time.Unix(1420070400, 0))
+	for i := uint32(0); i < 3; i++ {
+		tx := newTestPoolTx(nil, i, 300000)
+		if err := mp.admitTransaction(tx, 1, testPoolFee(tx, 20000)); err != nil {
+			t.Fatalf("admitTransaction #%d: %v", i, err)
+		}
+	}
+
+	cheap := newTestPoolTx(nil, 3, 300000)
+	err := mp.admitTransaction(cheap, 1, testPoolFee(cheap, 10000))
+	if code, ok := extractRejectCode(err); !ok ||
+		code != wire.RejectInsufficientFee {
+
+		t.Errorf("admitTransaction of cheap transaction: got error %v, "+
+			"want insufficient fee rejection", err)
+	}
+	if _, ok := mp.pool[*cheap.Sha()]; ok || len(mp.pool) != 3 {
+		t.Errorf("cheap transaction was not evicted")
+	}
+
+	// The rolling minimum fee rate now requires a higher fee rate than the
+	// cheap transaction paid.
+	if got := mp.rollingMinFeeRate(); got <= 10000 {
+		t.Errorf("got rolling minimum fee rate %d, want more than the "+
+			"evicted transaction paid", got)
+	}
+}
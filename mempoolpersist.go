@@ -0,0 +1,238 @@
+// Copyright (c) 2015 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"container/heap"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/ppcsuite/btcutil"
+	"github.com/ppcsuite/ppcd/wire"
+)
+
+const (
+	// mempoolDumpFilename is the name of the file in the data directory the
+	// transactions in the memory pool are saved to on shutdown.
+	mempoolDumpFilename = "mempool.dat"
+
+	// mempoolDumpVersion is the current version of the format of the
+	// memory pool dump file.
+	mempoolDumpVersion = 1
+)
+
+// mempoolDumpPath returns the path of the memory pool dump file.
+func mempoolDumpPath() string {
+	return filepath.Join(cfg.DataDir, mempoolDumpFilename)
+}
+
+// txDescsByAdded sorts transaction descriptors by the time they were added to
+// the memory pool so that transactions are reloaded after the transactions
+// they depend on.
+type txDescsByAdded []*TxDesc
+
+// Len returns the number of descriptors.  It is part of the sort.Interface
+// implementation.
+func (s txDescsByAdded) Len() int { return len(s) }
+
+// Less returns whether the descriptor with index i was added before the
+// descriptor with index j.  It is part of the sort.Interface implementation.
+func (s txDescsByAdded) Less(i, j int) bool {
+	return s[i].Added.Before(s[j].Added)
+}
+
+// Swap swaps the descriptors at the passed indices.  It is part of the
+// sort.Interface implementation.
+func (s txDescsByAdded) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+
+// writeMempool serializes the passed transaction descriptors to w.  The format
+// is a version and transaction count, each as a little-endian uint32, followed
+// by the time each transaction was added to the pool as a little-endian int64
+// unix timestamp and the serialized transaction.
+func writeMempool(w io.Writer, descs []*TxDesc) error {
+	err := binary.Write(w, binary.LittleEndian, uint32(mempoolDumpVersion))
+	if err != nil {
+		return err
+	}
+	err = binary.Write(w, binary.LittleEndian, uint32(len(descs)))
+	if err != nil {
+		return err
+	}
+	for _, txD := range descs {
+		err := binary.Write(w, binary.LittleEndian, txD.Added.Unix())
+		if err != nil {
+			return err
+		}
+		if err := txD.Tx.MsgTx().Serialize(w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readMempool deserializes transaction descriptors written by writeMempool from
+// r.  Only the transaction and the time it was added to the pool are set.  An
+// error is returned for truncated or otherwise malformed data.
+func readMempool(r io.Reader) ([]*TxDesc, error) {
+	var version, count uint32
+	if err := binary.Read(r, binary.LittleEndian, &version); err != nil {
+		return nil, err
+	}
+	if version != mempoolDumpVersion {
+		return nil, fmt.Errorf("unsupported memory pool dump version %d",
+			version)
+	}
+	if err := binary.Read(r, binary.LittleEndian, &count); err != nil {
+		return nil, err
+	}
+
+	// The count is not used to preallocate the descriptors since it is
+	// not trustworthy for malformed data.
+	var descs []*TxDesc
+	for i := uint32(0); i < count; i++ {
+		var addedUnix int64
+		err := binary.Read(r, binary.LittleEndian, &addedUnix)
+		if err != nil {
+			return nil, err
+		}
+		var msgTx wire.MsgTx
+		if err := msgTx.Deserialize(r); err != nil {
+			return nil, err
+		}
+		descs = append(descs, &TxDesc{
+			Tx:    btcutil.NewTx(&msgTx),
+			Added: time.Unix(addedUnix, 0),
+		})
+	}
+	return descs, nil
+}
+
+// DumpMempool saves the transactions in the main pool to the memory pool dump
+// file so they can be reloaded by LoadMempool on the next start.  The file is
+// replaced atomically.
+//
+// This function is safe for concurrent access.
+func (mp *txMemPool) DumpMempool() error {
+	descs := mp.TxDescs()
+	sort.Sort(txDescsByAdded(descs))
+
+	path := mempoolDumpPath()
+	tmpPath := path + ".new"
+	f, err := os.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	if err := writeMempool(w, descs); err != nil {
+		f.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		return err
+	}
+
+	txmpLog.Infof("Saved %d transactions from the memory pool to %s",
+		len(descs), path)
+	return nil
+}
+
+// restoreAddedTime sets the time the passed transaction was added to the pool
+// to the passed time, which is when it was originally added before the memory
+// pool was saved, so reloaded transactions still expire on time.
+//
+// This function is safe for concurrent access.
+func (mp *txMemPool) restoreAddedTime(hash *wire.ShaHash, added time.Time) {
+	mp.Lock()
+	defer mp.Unlock()
+
+	txD, exists := mp.pool[*hash]
+	if !exists || !added.Before(txD.Added) {
+		return
+	}
+	txD.Added = added
+	if txD.heapIndex >= 0 && txD.heapIndex < len(mp.feeHeap) &&
+		mp.feeHeap[txD.heapIndex] == txD {
+
+		heap.Fix(&mp.feeHeap, txD.heapIndex)
+	}
+}
+
+// LoadMempool reloads the transactions saved by DumpMempool into the memory
+// pool.  Each transaction is processed just like one received from the
+// network, so it is validated against the current chain and relayed once
+// accepted.  Transactions which have expired while the server was down are
+// skipped.  It is not an error for the dump file to not exist, but nothing is
+// loaded when it is malformed.
+//
+// This function MUST only be called from the block handler goroutine since
+// the transactions are validated against the block chain.
+func (mp *txMemPool) LoadMempool() error {
+	path := mempoolDumpPath()
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	descs, err := readMempool(bufio.NewReader(f))
+	f.Close()
+	if err != nil {
+		return fmt.Errorf("malformed memory pool dump %s: %v", path,
+			err)
+	}
+
+	txmpLog.Infof("Loading %d transactions from %s", len(descs), path)
+	cutoff := mp.server.clock.Now().Add(-cfg.MempoolExpiry)
+	added := make(map[wire.ShaHash]time.Time)
+	var numExpired int
+	for _, txD := range descs {
+		if txD.Added.Before(cutoff) {
+			numExpired++
+			continue
+		}
+
+		// Orphans are allowed since the transactions a transaction
+		// depends on may have been added to the pool later during a
+		// reorganize.
+		tx := txD.Tx
+		added[*tx.Sha()] = txD.Added
+		err := mp.ProcessTransaction(tx, true, false)
+		if err != nil {
+			txmpLog.Debugf("Rejected saved transaction %v: %v",
+				tx.Sha(), err)
+		}
+	}
+
+	// Only count the transactions which ended up in the main pool since
+	// orphans might have been accepted by a later transaction.
+	var numAccepted int
+	for hash, addedTime := range added {
+		if mp.IsTransactionInPool(&hash) {
+			mp.restoreAddedTime(&hash, addedTime)
+			numAccepted++
+		}
+	}
+	txmpLog.Infof("Loaded memory pool: %d transactions accepted, %d "+
+		"rejected, %d expired", numAccepted,
+		len(added)-numAccepted, numExpired)
+	return nil
+}
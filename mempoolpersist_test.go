@@ -0,0 +1,157 @@
+// Copyright (c) 2015 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestMempoolDumpRoundTrip ensures transactions written by writeMempool are
+// read back by readMempool along with the time they were added to the pool.
+func TestMempoolDumpRoundTrip(t *testing.T) {
+	parent := newTestPoolTx(nil, 1, 25)
+	descs := []*TxDesc{
+		{Tx: parent, Added: time.Unix(1420070400, 0)},
+		{Tx: newTestPoolTx(parent, 2, 25), Added: time.Unix(1420070500, 0)},
+		{Tx: newTestPoolTx(nil, 3, 1000), Added: time.Unix(1420070600, 0)},
+	}
+
+	for _, test := range []struct {
+		name  string
+		descs []*TxDesc
+	}{
+		{"empty", nil},
+		{"transactions", descs},
+	} {
+		var buf bytes.Buffer
+		if err := writeMempool(&buf, test.descs); err != nil {
+			t.Errorf("%s: writeMempool: %v", test.name, err)
+			continue
+		}
+		got, err := readMempool(&buf)
+		if err != nil {
+			t.Errorf("%s: readMempool: %v", test.name, err)
+			continue
+		}
+		if len(got) != len(test.descs) {
+			t.Errorf("%s: read %d transactions, want %d", test.name,
+				len(got), len(test.descs))
+			continue
+		}
+		for i, txD := range got {
+			want := test.descs[i]
+			if !txD.Tx.Sha().IsEqual(want.Tx.Sha()) ||
+				!txD.Added.Equal(want.Added) {
+
+				t.Errorf("%s: transaction #%d: got %v added at %v, "+
+					"want %v added at %v", test.name, i,
+					txD.Tx.Sha(), txD.Added, want.Tx.Sha(),
+					want.Added)
+			}
+		}
+	}
+}
+
+// TestMempoolDumpMalformed ensures truncated and corrupt dumps are rejected.
+func TestMempoolDumpMalformed(t *testing.T) {
+	descs := []*TxDesc{
+		{Tx: newTestPoolTx(nil, 1, 25), Added: time.Unix(1420070400, 0)},
+		{Tx: newTestPoolTx(nil, 2, 25), Added: time.Unix(1420070500, 0)},
+	}
+	var buf bytes.Buffer
+	if err := writeMempool(&buf, descs); err != nil {
+		t.Fatalf("writeMempool: %v", err)
+	}
+	dump := buf.Bytes()
+
+	badVersion := append([]byte{}, dump...)
+	badVersion[0] = 2
+	badCount := append([]byte{}, dump...)
+	badCount[4] = 3
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"empty", nil},
+		{"truncated header", dump[:6]},
+		{"truncated added time", dump[:12]},
+		{"truncated transaction", dump[:len(dump)-1]},
+		{"unsupported version", badVersion},
+		{"count too large", badCount},
+	}
+	for _, test := range tests {
+		if _, err := readMempool(bytes.NewReader(test.data)); err == nil {
+			t.Errorf("%s: readMempool succeeded", test.name)
+		}
+	}
+}
+
+// TestDumpMempoolFile ensures the memory pool is saved to the dump file in the
+// data directory and that a missing or corrupt dump file is handled when the
+// pool is loaded again.
+func TestDumpMempoolFile(t *testing.T) {
+	dataDir, err := ioutil.TempDir("", "mempoolpersist")
+	if err != nil {
+		t.Fatalf("TempDir: %v", err)
+	}
+	defer os.RemoveAll(dataDir)
+	oldCfg := cfg
+	defer func() { cfg = oldCfg }()
+	cfg = &config{
+		DataDir:       dataDir,
+		MaxMempool:    1,
+		MempoolExpiry: defaultMempoolExpiry,
+	}
+
+	start := time.Unix(1420070400, 0)
+	mp := newTestMemPool(start)
+	if err := mp.LoadMempool(); err != nil {
+		t.Errorf("LoadMempool without a dump file: %v", err)
+	}
+
+	// The transactions are saved in the order they were added so parents
+	// are loaded before their children.
+	parent := newTestPoolTx(nil, 1, 25)
+	child := newTestPoolTx(parent, 2, 25)
+	mp.addTransaction(parent, 1, 0)
+	mp.server.clock.setMockTime(start.Add(time.Minute))
+	mp.addTransaction(child, 1, 0)
+	if err := mp.DumpMempool(); err != nil {
+		t.Fatalf("DumpMempool: %v", err)
+	}
+
+	path := filepath.Join(dataDir, mempoolDumpFilename)
+	dump, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	descs, err := readMempool(bytes.NewReader(dump))
+	if err != nil {
+		t.Fatalf("readMempool: %v", err)
+	}
+	if len(descs) != 2 || !descs[0].Tx.Sha().IsEqual(parent.Sha()) ||
+		!descs[1].Tx.Sha().IsEqual(child.Sha()) {
+
+		t.Errorf("dump file does not hold the parent and then the child")
+	}
+	if _, err := os.Stat(path + ".new"); !os.IsNotExist(err) {
+		t.Errorf("temporary dump file was left behind")
+	}
+
+	// Nothing is loaded from a truncated dump file.
+	err = ioutil.WriteFile(path, dump[:len(dump)-1], 0600)
+	if err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	if err := newTestMemPool(start).LoadMempool(); err == nil {
+		t.Errorf("LoadMempool of truncated dump file succeeded")
+	}
+}
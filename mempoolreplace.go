@@ -0,0 +1,219 @@
+// Copyright (c) 2015 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/ppcsuite/btcutil"
+	"github.com/ppcsuite/ppcd/blockchain"
+	"github.com/ppcsuite/ppcd/wire"
+)
+
+const (
+	// maxReplacementEvictions is the maximum number of transactions,
+	// including their descendants, a single replacement transaction may
+	// evict from the memory pool.
+	maxReplacementEvictions = 100
+)
+
+// signalsReplacement returns whether or not the passed transaction signals
+// that it may be replaced by a conflicting transaction as defined by BIP125,
+// which is the case when any of its inputs has a sequence number below
+// MaxTxInSequenceNum-1.
+func signalsReplacement(tx *btcutil.Tx) bool {
+	for _, txIn := range tx.MsgTx().TxIn {
+		if txIn.Sequence < wire.MaxTxInSequenceNum-1 {
+			return true
+		}
+	}
+	return false
+}
+
+// isReplaceable returns whether or not the passed transaction in the pool may
+// be replaced by a conflicting transaction.  That is the case when either the
+// transaction itself or any of its in-pool ancestors signals replaceability.
+//
+// This function MUST be called with the mempool lock held (for reads).
+func (mp *txMemPool) isReplaceable(txD *TxDesc) bool {
+	if signalsReplacement(txD.Tx) {
+		return true
+	}
+	for _, ancestor := range mp.ancestors(txD) {
+		if signalsReplacement(ancestor.Tx) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkReplacement checks whether or not the passed transaction, which pays
+// the passed fee and conflicts with the passed replaceable transactions in the
+// pool, may replace them.  It returns all of the transactions which would be
+// evicted by the replacement, which are the conflicting transactions along with
+// their descendants.
+//
+// The replacement must pay a higher fee per kilobyte than each transaction it
+// directly conflicts with and a higher total fee than all of the transactions
+// it evicts.  The additional fee must at least cover the minimum fee required
+// for the replacement itself so it pays for its own relay bandwidth.  It may
+// neither spend the outputs of the transactions it evicts nor any other
+// unconfirmed outputs which were not already spent by the transactions it
+// directly conflicts with.
+//
+// This function MUST be called with the mempool lock held (for reads).
+func (mp *txMemPool) checkReplacement(tx *btcutil.Tx, txFee int64, conflicts map[wire.ShaHash]*TxDesc) (map[wire.ShaHash]*TxDesc, error) {
+	txHash := tx.Sha()
+	serializedSize := int64(tx.MsgTx().SerializeSize())
+	feePerKB := txFee * 1000 / serializedSize
+
+	evicted := make(map[wire.ShaHash]*TxDesc)
+	conflictParents := make(map[wire.ShaHash]struct{})
+	for hash, conflict := range conflicts {
+		if feePerKB <= conflict.feePerKB {
+			str := fmt.Sprintf("replacement transaction %v pays %d "+
+				"per kB which is not more than the %d per kB "+
+				"paid by the conflicting transaction %v", txHash,
+				feePerKB, conflict.feePerKB, &hash)
+			return nil, txRuleError(wire.RejectInsufficientFee, str)
+		}
+
+		evicted[hash] = conflict
+		for descHash, descendant := range mp.descendants(conflict) {
+			evicted[descHash] = descendant
+		}
+		for parentHash := range conflict.parents {
+			conflictParents[parentHash] = struct{}{}
+		}
+	}
+	if len(evicted) > maxReplacementEvictions {
+		str := fmt.Sprintf("replacement transaction %v would evict %d "+
+			"transactions which exceeds the maximum of %d", txHash,
+			len(evicted), maxReplacementEvictions)
+		return nil, txRuleError(wire.RejectNonstandard, str)
+	}
+
+	for _, txIn := range tx.MsgTx().TxIn {
+		prevHash := txIn.PreviousOutPoint.Hash
+		if _, exists := evicted[prevHash]; exists {
+			str := fmt.Sprintf("replacement transaction %v spends "+
+				"an output of transaction %v which it replaces",
+				txHash, &prevHash)
+			return nil, txRuleError(wire.RejectInvalid, str)
+		}
+		if _, exists := mp.pool[prevHash]; !exists {
+			continue
+		}
+		if _, exists := conflictParents[prevHash]; !exists {
+			str := fmt.Sprintf("replacement transaction %v spends "+
+				"an output of unconfirmed transaction %v which "+
+				"is not spent by the transactions it replaces",
+				txHash, &prevHash)
+			return nil, txRuleError(wire.RejectNonstandard, str)
+		}
+	}
+
+	var evictedFees int64
+	for _, txD := range evicted {
+		evictedFees += txD.Fee
+	}
+	if txFee < evictedFees {
+		str := fmt.Sprintf("replacement transaction %v has %d fees "+
+			"which is less than the %d fees of the transactions it "+
+			"replaces", txHash, txFee, evictedFees)
+		return nil, txRuleError(wire.RejectInsufficientFee, str)
+	}
+
+	// ppc: The additional fee is based on the minimum fee required by the
+	// block chain rules rather than on the minimum relay fee.
+	minIncrement := blockchain.GetMinFee(tx.MsgTx())
+	if txFee-evictedFees < minIncrement {
+		str := fmt.Sprintf("replacement transaction %v pays %d more "+
+			"fees than the transactions it replaces which is under "+
+			"the required increment of %d", txHash,
+			txFee-evictedFees, minIncrement)
+		return nil, txRuleError(wire.RejectInsufficientFee, str)
+	}
+
+	return evicted, nil
+}
+
+// replacedTx is a transaction removed from the pool since it is replaced by a
+// new transaction, along with the in-pool transactions it spent, so it can be
+// restored when the new transaction is not admitted after all.
+type replacedTx struct {
+	txD     *TxDesc
+	parents []wire.ShaHash
+}
+
+// replacedTxsByDepth sorts replaced transactions by the number of their in-pool
+// ancestors so each transaction follows all of its ancestors.  It implements
+// sort.Interface.
+type replacedTxsByDepth []replacedTx
+
+// Len returns the number of transactions.  It is part of the sort.Interface
+// implementation.
+func (s replacedTxsByDepth) Len() int { return len(s) }
+
+// Less returns whether the transaction with index i has fewer in-pool ancestors
+// than the transaction with index j.  It is part of the sort.Interface
+// implementation.
+func (s replacedTxsByDepth) Less(i, j int) bool {
+	return s[i].txD.ancestorPkg.count < s[j].txD.ancestorPkg.count
+}
+
+// Swap swaps the transactions at the passed indices.  It is part of the
+// sort.Interface implementation.
+func (s replacedTxsByDepth) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+
+// removeReplaced removes the passed transactions, which are evicted by a
+// replacement as returned by checkReplacement, from the pool without notifying
+// websocket clients.  The removed transactions are returned ordered so each one
+// follows its in-pool ancestors.
+//
+// This function MUST be called with the mempool lock held (for writes).
+func (mp *txMemPool) removeReplaced(replaced map[wire.ShaHash]*TxDesc) []replacedTx {
+	removed := make([]replacedTx, 0, len(replaced))
+	for _, txD := range replaced {
+		parents := make([]wire.ShaHash, 0, len(txD.parents))
+		for parentHash := range txD.parents {
+			parents = append(parents, parentHash)
+		}
+		removed = append(removed, replacedTx{txD: txD, parents: parents})
+	}
+	sort.Sort(replacedTxsByDepth(removed))
+
+	for _, r := range removed {
+		mp.detachTransaction(r.txD)
+	}
+	return removed
+}
+
+// restoreReplaced adds the passed transactions removed by removeReplaced back
+// to the pool after the replacement was not admitted.  Transactions whose
+// in-pool ancestors were evicted in the meantime are not restored, and
+// websocket clients are notified about their eviction instead.
+//
+// This function MUST be called with the mempool lock held (for writes).
+func (mp *txMemPool) restoreReplaced(removed []replacedTx) {
+	for _, r := range removed {
+		restorable := true
+		for i := range r.parents {
+			if _, exists := mp.pool[r.parents[i]]; !exists {
+				restorable = false
+				break
+			}
+		}
+		if !restorable {
+			if mp.server.rpcServer != nil {
+				mp.server.rpcServer.ntfnMgr.NotifyMempoolTxRemoved(
+					r.txD.Tx, txRemovedEvicted)
+			}
+			continue
+		}
+		mp.attachTransaction(r.txD)
+	}
+}
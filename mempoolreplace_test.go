@@ -0,0 +1,299 @@
+// Copyright (c) 2015 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ppcsuite/btcutil"
+	"github.com/ppcsuite/ppcd/wire"
+)
+
+// newTestReplacement returns a transaction spending the passed outpoints with a
+// single output whose script has the passed size.
+func newTestReplacement(prevOuts []wire.OutPoint, scriptSize int) *btcutil.Tx {
+	msgTx := wire.NewMsgTx()
+	for i := range prevOuts {
+		msgTx.AddTxIn(wire.NewTxIn(&prevOuts[i], nil))
+	}
+	msgTx.AddTxOut(wire.NewTxOut(1000, make([]byte, scriptSize)))
+	return btcutil.NewTx(msgTx)
+}
+
+// TestIsReplaceable ensures transactions are replaceable when they or any of
+// their in-pool ancestors signal replaceability.
+func TestIsReplaceable(t *testing.T) {
+	oldCfg := cfg
+	defer func() { cfg = oldCfg }()
+	cfg = &config{MaxMempool: 300, MempoolExpiry: defaultMempoolExpiry}
+	mp := newTestMemPool(time.Unix(1420070400, 0))
+
+	// newTx returns a transaction spending the passed transaction, or a
+	// made up outpoint identified by id when nil, with the passed sequence
+	// number and adds it to the pool.
+	newTx := func(spends *btcutil.Tx, id uint32, sequence uint32) *btcutil.Tx {
+		tx := newTestPoolTx(spends, id, 100)
+		tx.MsgTx().TxIn[0].Sequence = sequence
+		tx = btcutil.NewTx(tx.MsgTx())
+		mp.addTransaction(tx, 1, 10000)
+		return tx
+	}
+	final := newTx(nil, 1, wire.MaxTxInSequenceNum)
+	maxNonSignalling := newTx(nil, 2, wire.MaxTxInSequenceNum-1)
+	signalling := newTx(nil, 3, wire.MaxTxInSequenceNum-2)
+	child := newTx(signalling, 4, wire.MaxTxInSequenceNum)
+	grandchild := newTx(child, 5, wire.MaxTxInSequenceNum)
+	finalChild := newTx(final, 6, wire.MaxTxInSequenceNum)
+
+	tests := []struct {
+		name string
+		tx   *btcutil.Tx
+		want bool
+	}{
+		{"final", final, false},
+		{"highest non-signalling sequence", maxNonSignalling, false},
+		{"signalling", signalling, true},
+		{"child of signalling", child, true},
+		{"grandchild of signalling", grandchild, true},
+		{"child of final", finalChild, false},
+	}
+	for _, test := range tests {
+		got := mp.isReplaceable(mp.pool[*test.tx.Sha()])
+		if got != test.want {
+			t.Errorf("%s: got %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+// TestCheckReplacement ensures replacements are only allowed when they pay a
+// higher fee rate than each transaction they directly conflict with, higher
+// fees than all of the transactions they evict by at least the minimum fee, do
+// not spend outputs of evicted or other unconfirmed transactions, and do not
+// evict too many transactions.
+func TestCheckReplacement(t *testing.T) {
+	oldCfg := cfg
+	defer func() { cfg = oldCfg }()
+	cfg = &config{MaxMempool: 300, MempoolExpiry: defaultMempoolExpiry}
+
+	// The conflicting transaction spends a confirmed outpoint, or the
+	// output of an unconfirmed parent in the pool.  It may have in-pool
+	// descendants and there may be an unrelated transaction in the pool.
+	confirmed := wire.OutPoint{Index: 1}
+	tests := []struct {
+		name           string
+		spendParent    bool
+		numDescendants int
+		conflictFee    int64
+		descendantFee  int64
+		spendConflict  bool
+		spendUnrelated bool
+		scriptSize     int
+		fee            int64
+		code           wire.RejectCode
+		numEvicted     int
+	}{
+		{
+			name:        "replaces",
+			conflictFee: 10000,
+			scriptSize:  100,
+			fee:         20000,
+			numEvicted:  1,
+		},
+		{
+			name:           "replaces with descendants",
+			numDescendants: 2,
+			conflictFee:    10000,
+			descendantFee:  10000,
+			scriptSize:     100,
+			fee:            40000,
+			numEvicted:     3,
+		},
+		{
+			name:        "spends the parent of the conflict",
+			spendParent: true,
+			conflictFee: 10000,
+			scriptSize:  100,
+			fee:         20000,
+			numEvicted:  1,
+		},
+		{
+			name:        "fee rate not above conflict",
+			conflictFee: 20000,
+			scriptSize:  1000,
+			fee:         30000,
+			code:        wire.RejectInsufficientFee,
+		},
+		{
+			name:           "fees below evicted fees",
+			numDescendants: 1,
+			conflictFee:    10000,
+			descendantFee:  50000,
+			scriptSize:     10,
+			fee:            40000,
+			code:           wire.RejectInsufficientFee,
+		},
+		{
+			name:        "increment below minimum fee",
+			conflictFee: 10000,
+			scriptSize:  100,
+			fee:         15000,
+			code:        wire.RejectInsufficientFee,
+		},
+		{
+			name:          "spends output of evicted transaction",
+			conflictFee:   10000,
+			spendConflict: true,
+			scriptSize:    100,
+			fee:           50000,
+			code:          wire.RejectInvalid,
+		},
+		{
+			name:           "spends new unconfirmed output",
+			conflictFee:    10000,
+			spendUnrelated: true,
+			scriptSize:     100,
+			fee:            50000,
+			code:           wire.RejectNonstandard,
+		},
+		{
+			name:           "evicts too many transactions",
+			numDescendants: maxReplacementEvictions,
+			conflictFee:    10000,
+			descendantFee:  100,
+			scriptSize:     100,
+			fee:            10000000,
+			code:           wire.RejectNonstandard,
+		},
+	}
+	for _, test := range tests {
+		mp := newTestMemPool(time.Unix(1420070400, 0))
+		var conflict *btcutil.Tx
+		spent := confirmed
+		if test.spendParent {
+			parent := newTestPoolTx(nil, 2, 100)
+			mp.addTransaction(parent, 1, 10000)
+			conflict = newTestPoolTx(parent, 0, 100)
+			spent = wire.OutPoint{Hash: *parent.Sha()}
+		} else {
+			conflict = newTestPoolTx(nil, confirmed.Index, 100)
+		}
+		mp.addTransaction(conflict, 1, test.conflictFee)
+		descendant := conflict
+		for i := 0; i < test.numDescendants; i++ {
+			descendant = newTestPoolTx(descendant, 0, 100)
+			mp.addTransaction(descendant, 1, test.descendantFee)
+		}
+		unrelated := newTestPoolTx(nil, 3, 100)
+		mp.addTransaction(unrelated, 1, 10000)
+
+		prevOuts := []wire.OutPoint{spent}
+		if test.spendConflict {
+			prevOuts = append(prevOuts,
+				wire.OutPoint{Hash: *conflict.Sha()})
+		}
+		if test.spendUnrelated {
+			prevOuts = append(prevOuts,
+				wire.OutPoint{Hash: *unrelated.Sha()})
+		}
+		tx := newTestReplacement(prevOuts, test.scriptSize)
+		conflicts := map[wire.ShaHash]*TxDesc{
+			*conflict.Sha(): mp.pool[*conflict.Sha()],
+		}
+
+		evicted, err := mp.checkReplacement(tx, test.fee, conflicts)
+		if test.code != 0 {
+			code, ok := extractRejectCode(err)
+			if !ok || code != test.code {
+				t.Errorf("%s: got error %v, want reject code %v",
+					test.name, err, test.code)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+			continue
+		}
+		if len(evicted) != test.numEvicted {
+			t.Errorf("%s: got %d evicted transactions, want %d",
+				test.name, len(evicted), test.numEvicted)
+		}
+		for hash := range mp.descendants(mp.pool[*conflict.Sha()]) {
+			if _, ok := evicted[hash]; !ok {
+				t.Errorf("%s: descendant %v not evicted", test.name,
+					hash)
+			}
+		}
+		if _, ok := evicted[*conflict.Sha()]; !ok {
+			t.Errorf("%s: conflict not evicted", test.name)
+		}
+		if _, ok := evicted[*unrelated.Sha()]; ok {
+			t.Errorf("%s: unrelated transaction evicted", test.name)
+		}
+	}
+}
+
+// TestRestoreReplaced ensures transactions removed for a replacement which is
+// not admitted are restored along with their links, unless an in-pool ancestor
+// they spend was evicted meanwhile.
+func TestRestoreReplaced(t *testing.T) {
+	oldCfg := cfg
+	defer func() { cfg = oldCfg }()
+	cfg = &config{MaxMempool: 300, MempoolExpiry: defaultMempoolExpiry}
+
+	for _, evictParent := range []bool{false, true} {
+		mp := newTestMemPool(time.Unix(1420070400, 0))
+		parent := newTestPoolTx(nil, 1, 100)
+		conflict := newTestPoolTx(parent, 0, 100)
+		child := newTestPoolTx(conflict, 0, 100)
+		mp.addTransaction(parent, 1, 10000)
+		mp.addTransaction(conflict, 1, 10000)
+		mp.addTransaction(child, 1, 10000)
+		replaced := map[wire.ShaHash]*TxDesc{
+			*child.Sha():    mp.pool[*child.Sha()],
+			*conflict.Sha(): mp.pool[*conflict.Sha()],
+		}
+		totalSize := mp.totalSize
+
+		removed := mp.removeReplaced(replaced)
+		if len(removed) != 2 || removed[0].txD.Tx != conflict {
+			t.Fatalf("evict parent %v: removed transactions not "+
+				"ordered by depth", evictParent)
+		}
+		if len(mp.pool) != 1 || len(mp.outpoints) != 1 {
+			t.Errorf("evict parent %v: got %d transactions and %d "+
+				"outpoints, want 1", evictParent, len(mp.pool),
+				len(mp.outpoints))
+		}
+
+		if evictParent {
+			mp.removeTransaction(parent, true, txRemovedEvicted)
+		}
+		mp.restoreReplaced(removed)
+		if evictParent {
+			if len(mp.pool) != 0 || mp.totalSize != 0 {
+				t.Errorf("spenders of an evicted transaction " +
+					"restored")
+			}
+			continue
+		}
+
+		if len(mp.pool) != 3 || len(mp.outpoints) != 3 ||
+			mp.totalSize != totalSize {
+
+			t.Errorf("got %d transactions, %d outpoints and %d "+
+				"bytes, want 3, 3 and %d", len(mp.pool),
+				len(mp.outpoints), mp.totalSize, totalSize)
+		}
+		if got := mp.pool[*parent.Sha()].descendantPkg.count; got != 3 {
+			t.Errorf("parent descendant package: got %d "+
+				"transactions, want 3", got)
+		}
+		if got := mp.pool[*child.Sha()].ancestorPkg.count; got != 3 {
+			t.Errorf("child ancestor package: got %d transactions, "+
+				"want 3", got)
+		}
+	}
+}
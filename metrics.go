@@ -0,0 +1,332 @@
+// Copyright (c) 2015 PPCD developers.
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ppcsuite/ppcd/blockchain"
+	"github.com/ppcsuite/ppcd/database"
+	"github.com/ppcsuite/ppcd/wire"
+)
+
+const (
+	// metricsReadTimeout is the time a metrics client has to send its
+	// request.
+	metricsReadTimeout = 10 * time.Second
+
+	// metricsContentType is the content type of the text exposition format
+	// of Prometheus.
+	metricsContentType = "text/plain; version=0.0.4"
+)
+
+// processBlockTimeBuckets are the upper bounds, in seconds, of the buckets of
+// the histogram of the time taken by the block chain to process blocks.
+var processBlockTimeBuckets = []float64{
+	0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30,
+}
+
+// durationHistogram counts observed durations in buckets of increasing upper
+// bounds along with their total, which is the data of a Prometheus histogram.
+type durationHistogram struct {
+	mtx     sync.Mutex
+	buckets []float64
+	counts  []uint64
+	count   uint64
+	sum     float64
+}
+
+// newDurationHistogram returns a new histogram with buckets of the passed
+// increasing upper bounds in seconds.
+func newDurationHistogram(buckets []float64) *durationHistogram {
+	return &durationHistogram{
+		buckets: buckets,
+		counts:  make([]uint64, len(buckets)),
+	}
+}
+
+// observe counts the passed duration in the histogram.
+//
+// This function is safe for concurrent access.
+func (h *durationHistogram) observe(d time.Duration) {
+	seconds := d.Seconds()
+
+	h.mtx.Lock()
+	for i, bound := range h.buckets {
+		if seconds <= bound {
+			h.counts[i]++
+			break
+		}
+	}
+	h.count++
+	h.sum += seconds
+	h.mtx.Unlock()
+}
+
+// metricsWriter writes metrics in the text exposition format of Prometheus.
+type metricsWriter struct {
+	buf bytes.Buffer
+}
+
+// header writes the help and type lines of the passed metric.
+func (w *metricsWriter) header(name, kind, help string) {
+	fmt.Fprintf(&w.buf, "# HELP %s %s\n", name, help)
+	fmt.Fprintf(&w.buf, "# TYPE %s %s\n", name, kind)
+}
+
+// sample writes a sample of the passed metric with the passed labels, which
+// are either empty or of the form {name="value",...}.
+func (w *metricsWriter) sample(name, labels string, value float64) {
+	fmt.Fprintf(&w.buf, "%s%s %s\n", name, labels,
+		strconv.FormatFloat(value, 'g', -1, 64))
+}
+
+// metric writes the passed metric with a single sample without labels.
+func (w *metricsWriter) metric(name, kind, help string, value float64) {
+	w.header(name, kind, help)
+	w.sample(name, "", value)
+}
+
+// histogram writes the passed histogram as a metric.
+func (w *metricsWriter) histogram(name, help string, h *durationHistogram) {
+	h.mtx.Lock()
+	counts := make([]uint64, len(h.counts))
+	copy(counts, h.counts)
+	count, sum := h.count, h.sum
+	h.mtx.Unlock()
+
+	w.header(name, "histogram", help)
+	var cumulative uint64
+	for i, bound := range h.buckets {
+		cumulative += counts[i]
+		labels := fmt.Sprintf(`{le="%s"}`,
+			strconv.FormatFloat(bound, 'g', -1, 64))
+		w.sample(name+"_bucket", labels, float64(cumulative))
+	}
+	w.sample(name+"_bucket", `{le="+Inf"}`, float64(count))
+	w.sample(name+"_sum", "", sum)
+	w.sample(name+"_count", "", float64(count))
+}
+
+// stakeModifierAge returns the time between the block with the passed hash and
+// the block which generated its stake modifier.
+func stakeModifierAge(db database.Db, sha *wire.ShaHash) (time.Duration, error) {
+	header, meta, err := db.FetchBlockHeaderBySha(sha)
+	if err != nil {
+		return 0, err
+	}
+	blockTime := header.Timestamp
+	for meta.Flags&blockchain.FBlockStakeModifier == 0 {
+		header, meta, err = db.FetchBlockHeaderBySha(&header.PrevBlock)
+		if err != nil {
+			return 0, err
+		}
+	}
+	return blockTime.Sub(header.Timestamp), nil
+}
+
+// metricsServer serves metrics about the internals of the node over HTTP in
+// the text exposition format of Prometheus.
+type metricsServer struct {
+	started   int32 // atomic
+	shutdown  int32 // atomic
+	server    *server
+	listeners []net.Listener
+	wg        sync.WaitGroup
+}
+
+// writeMetrics writes the current metrics of the node.  Metrics which can't be
+// determined are left out.
+func (m *metricsServer) writeMetrics(w *metricsWriter) {
+	s := m.server
+
+	var inbound, outbound int
+	for _, peer := range s.PeerInfo() {
+		if peer.Inbound {
+			inbound++
+		} else {
+			outbound++
+		}
+	}
+	w.header("ppcd_peers", "gauge", "Number of connected peers by direction.")
+	w.sample("ppcd_peers", `{direction="inbound"}`, float64(inbound))
+	w.sample("ppcd_peers", `{direction="outbound"}`, float64(outbound))
+
+	received, sent := s.NetTotals()
+	w.metric("ppcd_net_received_bytes_total", "counter",
+		"Total bytes received from all peers.", float64(received))
+	w.metric("ppcd_net_sent_bytes_total", "counter",
+		"Total bytes sent to all peers.", float64(sent))
+
+	info := s.txMemPool.Info()
+	w.metric("ppcd_mempool_transactions", "gauge",
+		"Number of transactions in the memory pool.", float64(info.Count))
+	w.metric("ppcd_mempool_bytes", "gauge",
+		"Total serialized size of the transactions in the memory pool.",
+		float64(info.Size))
+	w.metric("ppcd_mempool_orphan_transactions", "gauge",
+		"Number of orphan transactions.", float64(info.NumOrphans))
+
+	bm := s.blockManager
+	w.metric("ppcd_orphan_blocks", "gauge", "Number of orphan blocks.",
+		float64(bm.blockChain.NumOrphans()))
+	w.histogram("ppcd_block_processing_seconds",
+		"Time taken by the block chain to process blocks.",
+		bm.processBlockTimes)
+
+	numInputs, scriptTime := blockchain.ScriptValidationStats()
+	w.metric("ppcd_script_validation_inputs_total", "counter",
+		"Total transaction inputs whose scripts were validated.",
+		float64(numInputs))
+	w.metric("ppcd_script_validation_seconds_total", "counter",
+		"Total time spent validating transaction scripts.",
+		scriptTime.Seconds())
+
+	sha, height := bm.chainState.Best()
+	w.metric("ppcd_best_block_height", "gauge",
+		"Height of the best block of the main chain.", float64(height))
+
+	if cfg.AddrIndex {
+		// The tip height is -1 when the index hasn't been built yet.
+		_, indexTip, err := s.db.FetchAddrIndexTip()
+		if err == nil || err == database.ErrAddrIndexDoesNotExist {
+			w.metric("ppcd_addrindex_lag_blocks", "gauge",
+				"Number of main chain blocks not yet in the "+
+					"address index.", float64(height-indexTip))
+		} else {
+			srvrLog.Debugf("Unable to fetch the address index tip: %v",
+				err)
+		}
+	}
+
+	powDifficulty, err := ppcGetDifficultyRatio(s.db, sha, false)
+	if err == nil {
+		var posDifficulty float64
+		posDifficulty, err = ppcGetDifficultyRatio(s.db, sha, true)
+		if err == nil {
+			w.header("ppcd_difficulty", "gauge", "Difficulty of the "+
+				"last proof-of-work and proof-of-stake blocks.")
+			w.sample("ppcd_difficulty", `{type="proofofwork"}`,
+				powDifficulty)
+			w.sample("ppcd_difficulty", `{type="proofofstake"}`,
+				posDifficulty)
+		}
+	}
+	if err != nil {
+		srvrLog.Debugf("Unable to determine the difficulty: %v", err)
+	}
+
+	if age, err := stakeModifierAge(s.db, sha); err == nil {
+		w.metric("ppcd_stake_modifier_age_seconds", "gauge",
+			"Time between the best block and the block which "+
+				"generated its stake modifier.", age.Seconds())
+	} else {
+		srvrLog.Debugf("Unable to determine the stake modifier age: %v",
+			err)
+	}
+}
+
+// handleMetrics responds to scrape requests with the current metrics.
+func (m *metricsServer) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" && r.Method != "HEAD" {
+		http.Error(w, "405 Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var mw metricsWriter
+	m.writeMetrics(&mw)
+	w.Header().Set("Content-Type", metricsContentType)
+	w.Write(mw.buf.Bytes())
+}
+
+// Start begins serving metrics on the listeners.
+func (m *metricsServer) Start() {
+	if atomic.AddInt32(&m.started, 1) != 1 {
+		return
+	}
+
+	srvrLog.Trace("Starting metrics server")
+	serveMux := http.NewServeMux()
+	serveMux.HandleFunc("/metrics", m.handleMetrics)
+	httpServer := &http.Server{
+		Handler:     serveMux,
+		ReadTimeout: metricsReadTimeout,
+	}
+	for _, listener := range m.listeners {
+		m.wg.Add(1)
+		go func(listener net.Listener) {
+			srvrLog.Infof("Metrics server listening on %s",
+				listener.Addr())
+			httpServer.Serve(listener)
+			srvrLog.Tracef("Metrics listener done for %s",
+				listener.Addr())
+			m.wg.Done()
+		}(listener)
+	}
+}
+
+// Stop stops serving metrics.
+func (m *metricsServer) Stop() error {
+	if atomic.AddInt32(&m.shutdown, 1) != 1 {
+		srvrLog.Infof("Metrics server is already in the process of " +
+			"shutting down")
+		return nil
+	}
+	srvrLog.Warnf("Metrics server shutting down")
+	for _, listener := range m.listeners {
+		err := listener.Close()
+		if err != nil {
+			srvrLog.Errorf("Problem shutting down metrics server: %v",
+				err)
+			return err
+		}
+	}
+	m.wg.Wait()
+	srvrLog.Infof("Metrics server shutdown complete")
+	return nil
+}
+
+// newMetricsServer returns a new metrics server listening on the passed
+// addresses.
+func newMetricsServer(listenAddrs []string, s *server) (*metricsServer, error) {
+	ipv4ListenAddrs, ipv6ListenAddrs, _, err := parseListeners(listenAddrs)
+	if err != nil {
+		return nil, err
+	}
+	listeners := make([]net.Listener, 0,
+		len(ipv6ListenAddrs)+len(ipv4ListenAddrs))
+	for _, addr := range ipv4ListenAddrs {
+		listener, err := net.Listen("tcp4", addr)
+		if err != nil {
+			srvrLog.Warnf("Can't listen on %s: %v", addr, err)
+			continue
+		}
+		listeners = append(listeners, listener)
+	}
+	for _, addr := range ipv6ListenAddrs {
+		listener, err := net.Listen("tcp6", addr)
+		if err != nil {
+			srvrLog.Warnf("Can't listen on %s: %v", addr, err)
+			continue
+		}
+		listeners = append(listeners, listener)
+	}
+	if len(listeners) == 0 {
+		return nil, errors.New("METRICS: No valid listen address")
+	}
+
+	return &metricsServer{
+		server:    s,
+		listeners: listeners,
+	}, nil
+}
@@ -0,0 +1,70 @@
+// Copyright (c) 2015 PPCD developers.
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// TestMetricsWriter ensures metrics are written in the text exposition format
+// of Prometheus.
+func TestMetricsWriter(t *testing.T) {
+	h := newDurationHistogram([]float64{0.25, 1})
+	for _, d := range []time.Duration{
+		time.Millisecond * 250,
+		time.Millisecond * 500,
+		time.Second * 2,
+		time.Second,
+	} {
+		h.observe(d)
+	}
+
+	var w metricsWriter
+	w.metric("test_total", "counter", "Test counter.", 1000000)
+	w.header("test_peers", "gauge", "Test gauge.")
+	w.sample("test_peers", `{direction="inbound"}`, 8)
+	w.sample("test_peers", `{direction="outbound"}`, 0.5)
+	w.histogram("test_seconds", "Test histogram.", h)
+
+	// The buckets of the histogram are cumulative, and the +Inf bucket
+	// counts the observations beyond the largest bound as well.
+	want := `# HELP test_total Test counter.
+# TYPE test_total counter
+test_total 1e+06
+# HELP test_peers Test gauge.
+# TYPE test_peers gauge
+test_peers{direction="inbound"} 8
+test_peers{direction="outbound"} 0.5
+# HELP test_seconds Test histogram.
+# TYPE test_seconds histogram
+test_seconds_bucket{le="0.25"} 1
+test_seconds_bucket{le="1"} 3
+test_seconds_bucket{le="+Inf"} 4
+test_seconds_sum 3.75
+test_seconds_count 4
+`
+	if got := w.buf.String(); got != want {
+		t.Errorf("got metrics:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+// TestDurationHistogramEmpty ensures an empty histogram is written with all of
+// its buckets.
+func TestDurationHistogramEmpty(t *testing.T) {
+	var w metricsWriter
+	w.histogram("test_seconds", "Test histogram.",
+		newDurationHistogram([]float64{0.005}))
+	want := `# HELP test_seconds Test histogram.
+# TYPE test_seconds histogram
+test_seconds_bucket{le="0.005"} 0
+test_seconds_bucket{le="+Inf"} 0
+test_seconds_sum 0
+test_seconds_count 0
+`
+	if got := w.buf.String(); got != want {
+		t.Errorf("got metrics:\n%s\nwant:\n%s", got, want)
+	}
+}
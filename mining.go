@@ -46,14 +46,51 @@ const (
 type txPrioItem struct {
 	tx       *btcutil.Tx
 	fee      int64
+	size     int64
 	priority float64
 	feePerKB float64
 
+	// modifiedFee is the fee adjusted by the fee delta set through the
+	// prioritisetransaction RPC.  It is used in place of the actual fee to
+	// prioritize the transaction.
+	modifiedFee int64
+
+	// ancestorFeePerKB is the fee per kilobyte of the transaction together
+	// with the transactions it depends on which have not been added to the
+	// block yet.  It is used to order transactions by fee so a transaction
+	// paying a high fee can pull in ancestors paying a low fee.
+	ancestorFeePerKB float64
+
 	// dependsOn holds a map of transaction hashes which this one depends
 	// on.  It will only be set when the transaction references other
 	// transactions in the memory pool and hence must come after them in
 	// a block.
 	dependsOn map[wire.ShaHash]struct{}
+
+	// parents holds the hashes of the transactions in the memory pool this
+	// one depends on.  Unlike dependsOn, it is not modified while the
+	// transactions are selected.
+	parents []wire.ShaHash
+}
+
+// setFees sets the fee and size of the item from the passed fee and the size of
+// its transaction, and applies the passed adjustments made through the
+// prioritisetransaction RPC to the priority and to the fee used to prioritize
+// the transaction.
+func (item *txPrioItem) setFees(fee int64, delta txPriorityDelta) {
+	item.priority += delta.priority
+	item.modifiedFee = fee + delta.fee
+
+	// Calculate the fee in Satoshi/KB.
+	// NOTE: This is a more precise value than the one calculated during
+	// calcMinRelayFee which rounds up to the nearest full kilobyte
+	// boundary.  This is beneficial since it provides an incentive to
+	// create smaller transactions.
+	txSize := item.tx.MsgTx().SerializeSize()
+	item.feePerKB = float64(item.modifiedFee) / (float64(txSize) / 1000)
+	item.ancestorFeePerKB = item.feePerKB
+	item.fee = fee
+	item.size = int64(txSize)
 }
 
 // txPriorityQueueLessFunc describes a function that can be used as a compare
@@ -122,15 +159,16 @@ func txPQByPriority(pq *txPriorityQueue, i, j int) bool {
 
 }
 
-// txPQByFee sorts a txPriorityQueue by fees per kilobyte and then transaction
-// priority.
+// txPQByFee sorts a txPriorityQueue by fees per kilobyte of the transactions
+// together with their ancestors which are not in the block yet and then
+// transaction priority.
 func txPQByFee(pq *txPriorityQueue, i, j int) bool {
 	// Using > here so that pop gives the highest fee item as opposed
 	// to the lowest.  Sort by fee first, then priority.
-	if pq.items[i].feePerKB == pq.items[j].feePerKB {
+	if pq.items[i].ancestorFeePerKB == pq.items[j].ancestorFeePerKB {
 		return pq.items[i].priority > pq.items[j].priority
 	}
-	return pq.items[i].feePerKB > pq.items[j].feePerKB
+	return pq.items[i].ancestorFeePerKB > pq.items[j].ancestorFeePerKB
 }
 
 // newTxPriorityQueue returns a new transaction priority queue that reserves the
@@ -266,6 +304,73 @@ func logSkippedDeps(tx *btcutil.Tx, deps *list.List) {
 	}
 }
 
+// unminedAncestors returns the transactions the passed transaction depends on
+// which have not been considered for the block yet, ordered so that each
+// transaction comes after the transactions it depends on.  The considered map
+// holds whether or not each transaction considered so far was added to the
+// block.  False is returned when the transaction depends on a transaction
+// which was skipped or which is not a candidate for the block.
+func unminedAncestors(item *txPrioItem, prioItems map[wire.ShaHash]*txPrioItem,
+	considered map[wire.ShaHash]bool) ([]*txPrioItem, bool) {
+
+	var ancestors []*txPrioItem
+	visited := make(map[wire.ShaHash]struct{})
+	var visit func(*txPrioItem) bool
+	visit = func(cur *txPrioItem) bool {
+		for _, parentHash := range cur.parents {
+			if _, ok := visited[parentHash]; ok {
+				continue
+			}
+			visited[parentHash] = struct{}{}
+			if included, ok := considered[parentHash]; ok {
+				if included {
+					continue
+				}
+				return false
+			}
+			parent, ok := prioItems[parentHash]
+			if !ok || !visit(parent) {
+				return false
+			}
+			ancestors = append(ancestors, parent)
+		}
+		return true
+	}
+	if !visit(item) {
+		return nil, false
+	}
+	return ancestors, true
+}
+
+// packageFeePerKB returns the fee per kilobyte, based on the modified fees, of
+// the passed transaction together with the passed ancestors.
+func packageFeePerKB(item *txPrioItem, ancestors []*txPrioItem) float64 {
+	fee, size := item.modifiedFee, item.size
+	for _, ancestor := range ancestors {
+		fee += ancestor.modifiedFee
+		size += ancestor.size
+	}
+	return float64(fee) / (float64(size) / 1000)
+}
+
+// queuePackage pushes the passed transaction onto the priority queue ordered
+// by the fee per kilobyte of the transaction together with its ancestors which
+// have not been considered for the block yet.  The transaction is not queued
+// if it depends on a transaction which can't be added to the block.  A copy of
+// the item is queued so entries which are already queued are left intact.
+// Entries which turn out to be outdated once popped are requeued.
+func queuePackage(pq *txPriorityQueue, item *txPrioItem,
+	prioItems map[wire.ShaHash]*txPrioItem, considered map[wire.ShaHash]bool) {
+
+	ancestors, ok := unminedAncestors(item, prioItems, considered)
+	if !ok {
+		return
+	}
+	entry := *item
+	entry.ancestorFeePerKB = packageFeePerKB(item, ancestors)
+	heap.Push(pq, &entry)
+}
+
 // minimumMedianTime returns the minimum allowed timestamp for a block building
 // on the end of the current best chain.  In particular, it is one second after
 // the median timestamp of the last several blocks per the chain consensus
@@ -319,8 +424,9 @@ func medianAdjustedTime(chainState *chainState, timeSource blockchain.MedianTime
 // value, age of inputs, and size.  Transactions which consist of larger
 // amounts, older inputs, and small sizes have the highest priority.  Second, a
 // fee per kilobyte is calculated for each transaction.  Transactions with a
-// higher fee per kilobyte are preferred.  Finally, the block generation related
-// configuration options are all taken into account.
+// higher fee per kilobyte are preferred.  Both are adjusted by the deltas set
+// through the prioritisetransaction RPC, if any.  Finally, the block generation
+// related configuration options are all taken into account.
 //
 // Transactions which only spend outputs from other transactions already in the
 // block chain are immediately added to a priority queue which either
@@ -333,7 +439,13 @@ func medianAdjustedTime(chainState *chainState, timeSource blockchain.MedianTime
 //
 // Once the high-priority area (if configured) has been filled with transactions,
 // or the priority falls below what is considered high-priority, the priority
-// queue is updated to prioritize by fees per kilobyte (then priority).
+// queue is updated to prioritize by fees per kilobyte (then priority).  From
+// then on, transactions which depend on other transactions in the memory pool
+// are queued right away, prioritized by the fees per kilobyte of the
+// transaction together with its ancestors which are not in the block yet, and
+// selected along with those ancestors.  This allows a transaction paying a high
+// fee to pull in the low-fee transactions it depends on (child pays for
+// parent).
 //
 // When the fees per kilobyte drop below the TxMinFreeFee configuration option,
 // the transaction will be skipped unless there is a BlockMinSize set, in which
@@ -405,6 +517,7 @@ func NewBlockTemplate(mempool *txMemPool, payToAddress btcutil.Address, coinStak
 	// whether or not there is an area allocated for high-priority
 	// transactions.
 	mempoolTxns := mempool.TxDescs()
+	priorityDeltas := mempool.PriorityDeltas()
 	sortedByFee := cfg.BlockPrioritySize == 0
 	priorityQueue := newTxPriorityQueue(len(mempoolTxns), sortedByFee)
 
@@ -428,6 +541,14 @@ func NewBlockTemplate(mempool *txMemPool, payToAddress btcutil.Address, coinStak
 	// in the block once each transaction has been included.
 	dependers := make(map[wire.ShaHash]*list.List)
 
+	// prioItems holds all of the transactions which are candidates for
+	// inclusion in the block and childItems the candidates which depend on
+	// each transaction.  considered tracks whether or not each transaction
+	// which was considered for inclusion has been added to the block.
+	prioItems := make(map[wire.ShaHash]*txPrioItem)
+	childItems := make(map[wire.ShaHash][]*txPrioItem)
+	considered := make(map[wire.ShaHash]bool)
+
 	// Create slices to hold the fees and number of signature operations
 	// for each of the selected transactions and add an entry for the
 	// coinbase.  This allows the code below to simply append details about
@@ -501,6 +622,8 @@ mempoolLoop:
 						map[wire.ShaHash]struct{})
 				}
 				prioItem.dependsOn[*originHash] = struct{}{}
+				prioItem.parents = append(prioItem.parents,
+					*originHash)
 
 				// Skip the check below. We already know the
 				// referenced transaction is available.
@@ -524,14 +647,12 @@ mempoolLoop:
 		// formula is: sum(inputValue * inputAge) / adjustedTxSize
 		prioItem.priority = txDesc.CurrentPriority(txStore, nextBlockHeight)
 
-		// Calculate the fee in Satoshi/KB.
-		// NOTE: This is a more precise value than the one calculated
-		// during calcMinRelayFee which rounds up to the nearest full
-		// kilobyte boundary.  This is beneficial since it provides an
-		// incentive to create smaller transactions.
-		txSize := tx.MsgTx().SerializeSize()
-		prioItem.feePerKB = float64(txDesc.Fee) / (float64(txSize) / 1000)
-		prioItem.fee = txDesc.Fee
+		prioItem.setFees(txDesc.Fee, priorityDeltas[*tx.Sha()])
+		prioItems[*tx.Sha()] = prioItem
+		for _, parentHash := range prioItem.parents {
+			childItems[parentHash] = append(childItems[parentHash],
+				prioItem)
+		}
 
 		// Add the transaction to the priority queue to mark it ready
 		// for inclusion in the block unless it has dependencies.
@@ -545,6 +666,17 @@ mempoolLoop:
 		mergeTxStore(blockTxStore, txStore)
 	}
 
+	// Transactions with dependencies are queued right away when
+	// prioritizing by fee.
+	if sortedByFee {
+		for _, prioItem := range prioItems {
+			if prioItem.dependsOn != nil {
+				queuePackage(priorityQueue, prioItem, prioItems,
+					considered)
+			}
+		}
+	}
+
 	minrLog.Tracef("Priority queue len %d, dependers len %d",
 		priorityQueue.Len(), len(dependers))
 
@@ -555,12 +687,62 @@ mempoolLoop:
 	blockSigOps := numCoinbaseSigOps
 	totalFees := int64(0)
 
-	// Choose which transactions make it into the block.
-	for priorityQueue.Len() > 0 {
-		// Grab the highest priority (or highest fee per kilobyte
-		// depending on the sort order) transaction.
-		prioItem := heap.Pop(priorityQueue).(*txPrioItem)
+	// Choose which transactions make it into the block.  pkgItems holds
+	// the remaining transactions of the package which is being added.
+	var pkgItems []*txPrioItem
+	for priorityQueue.Len() > 0 || len(pkgItems) > 0 {
+		// Grab the next transaction of the current package if there is
+		// one.  Otherwise, grab the highest priority (or highest fee
+		// per kilobyte depending on the sort order) transaction.
+		var prioItem *txPrioItem
+		inPackage := len(pkgItems) > 0
+		if inPackage {
+			prioItem = pkgItems[0]
+			pkgItems = pkgItems[1:]
+		} else {
+			prioItem = heap.Pop(priorityQueue).(*txPrioItem)
+		}
 		tx := prioItem.tx
+		txHash := *tx.Sha()
+
+		// Skip transactions which have already been considered through
+		// another entry.
+		if _, ok := considered[txHash]; ok {
+			continue
+		}
+
+		// When prioritizing by fee, select the transaction together
+		// with its ancestors which are not in the block yet.  Entries
+		// which are outdated since ancestors have been considered in
+		// the mean time are requeued.
+		if sortedByFee {
+			ancestors, ok := unminedAncestors(prioItem, prioItems,
+				considered)
+			if !ok || (inPackage && len(ancestors) != 0) {
+				minrLog.Tracef("Skipping tx %s because it depends "+
+					"on a skipped tx", tx.Sha())
+				considered[txHash] = false
+				continue
+			}
+			if !inPackage {
+				feePerKB := packageFeePerKB(prioItem, ancestors)
+				if feePerKB != prioItem.ancestorFeePerKB {
+					queuePackage(priorityQueue, prioItem,
+						prioItems, considered)
+					continue
+				}
+				if len(ancestors) != 0 {
+					for _, ancestor := range ancestors {
+						entry := *ancestor
+						entry.ancestorFeePerKB = feePerKB
+						pkgItems = append(pkgItems, &entry)
+					}
+					pkgItems = append(pkgItems, prioItem)
+					continue
+				}
+			}
+		}
+		considered[txHash] = false
 
 		// Grab the list of transactions which depend on this one (if
 		// any) and remove the entry for this transaction as it will
@@ -615,12 +797,12 @@ mempoolLoop:
 
 		// Skip free transactions once the block is larger than the
 		// minimum block size.
-		if sortedByFee && prioItem.feePerKB < minTxRelayFee &&
+		if sortedByFee && prioItem.ancestorFeePerKB < minTxRelayFee &&
 			blockPlusTxSize >= cfg.BlockMinSize {
 
 			minrLog.Tracef("Skipping tx %s with feePerKB %.2f "+
 				"< minTxRelayFee %d and block size %d >= "+
-				"minBlockSize %d", tx.Sha(), prioItem.feePerKB,
+				"minBlockSize %d", tx.Sha(), prioItem.ancestorFeePerKB,
 				minTxRelayFee, blockPlusTxSize,
 				cfg.BlockMinSize)
 			logSkippedDeps(tx, deps)
@@ -642,6 +824,19 @@ mempoolLoop:
 			sortedByFee = true
 			priorityQueue.SetLessFunc(txPQByFee)
 
+			// Queue the transactions which are still waiting
+			// for their dependencies, which might include this
+			// one.
+			delete(considered, txHash)
+			for _, item := range prioItems {
+				_, ok := considered[*item.tx.Sha()]
+				if !ok && len(item.dependsOn) != 0 {
+					queuePackage(priorityQueue, item,
+						prioItems, considered)
+				}
+			}
+			considered[txHash] = false
+
 			// Put the transaction back into the priority queue and
 			// skip it so it is re-priortized by fees if it won't
 			// fit into the high-priority section or the priority is
@@ -651,6 +846,7 @@ mempoolLoop:
 			if blockPlusTxSize > cfg.BlockPrioritySize ||
 				prioItem.priority < minHighPriority {
 
+				delete(considered, txHash)
 				heap.Push(priorityQueue, prioItem)
 				continue
 			}
@@ -700,6 +896,32 @@ mempoolLoop:
 		minrLog.Tracef("Adding tx %s (priority %.2f, feePerKB %.2f)",
 			prioItem.tx.Sha(), prioItem.priority, prioItem.feePerKB)
 
+		considered[txHash] = true
+
+		// When prioritizing by fee, the transactions which depend on
+		// this one are already queued, so requeue them with the fee
+		// per kilobyte of their remaining packages.
+		if sortedByFee {
+			visited := make(map[wire.ShaHash]struct{})
+			queue := childItems[txHash]
+			for len(queue) > 0 {
+				item := queue[0]
+				queue = queue[1:]
+				itemHash := *item.tx.Sha()
+				if _, ok := visited[itemHash]; ok {
+					continue
+				}
+				visited[itemHash] = struct{}{}
+				if _, ok := considered[itemHash]; ok {
+					continue
+				}
+				queuePackage(priorityQueue, item, prioItems,
+					considered)
+				queue = append(queue, childItems[itemHash]...)
+			}
+			continue
+		}
+
 		// Add transactions which depend on this one (and also do not
 		// have any other unsatisified dependencies) to the priority
 		// queue.
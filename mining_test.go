@@ -0,0 +1,127 @@
+// Copyright (c) 2015 PPCD developers.
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"container/heap"
+	"testing"
+	"time"
+
+	"github.com/ppcsuite/btcutil"
+	"github.com/ppcsuite/ppcd/wire"
+)
+
+// TestPriorityDeltaSelection ensures the fee and priority deltas set through
+// the prioritisetransaction RPC change the order in which transactions and
+// their unmined ancestors are selected for a block without changing the fees
+// they actually pay.
+func TestPriorityDeltaSelection(t *testing.T) {
+	parent := newTestPoolTx(nil, 1, 100)
+	child := newTestPoolTx(parent, 0, 100)
+	other := newTestPoolTx(nil, 2, 100)
+	fees := map[*btcutil.Tx]int64{parent: 1000, child: 500, other: 5000}
+
+	tests := []struct {
+		name      string
+		sortByFee bool
+		tx        *btcutil.Tx
+		delta     txPriorityDelta
+		want      *btcutil.Tx
+	}{
+		{"no delta", true, nil, txPriorityDelta{}, other},
+		{"fee delta", true, parent, txPriorityDelta{fee: 20000}, parent},
+		{"fee delta of child pulls in parent", true, child,
+			txPriorityDelta{fee: 20000}, child},
+		{"negative fee delta", true, other,
+			txPriorityDelta{fee: -4500}, parent},
+		{"priority delta ignored by fee", true, parent,
+			txPriorityDelta{priority: 1e9}, other},
+		{"no priority delta", false, nil, txPriorityDelta{}, other},
+		{"priority delta", false, parent,
+			txPriorityDelta{priority: 1e9}, parent},
+	}
+	for _, test := range tests {
+		deltas := make(map[wire.ShaHash]txPriorityDelta)
+		if test.tx != nil {
+			deltas[*test.tx.Sha()] = test.delta
+		}
+
+		// The other transaction has the highest priority without any
+		// adjustments.
+		prioItems := make(map[wire.ShaHash]*txPrioItem)
+		for _, tx := range []*btcutil.Tx{parent, child, other} {
+			item := &txPrioItem{tx: tx}
+			if tx == other {
+				item.priority = 1
+			}
+			if tx == child {
+				item.parents = []wire.ShaHash{*parent.Sha()}
+			}
+			item.setFees(fees[tx], deltas[*tx.Sha()])
+			if item.fee != fees[tx] {
+				t.Errorf("%s: got fee %d, want %d", test.name,
+					item.fee, fees[tx])
+			}
+			prioItems[*tx.Sha()] = item
+		}
+
+		pq := newTxPriorityQueue(len(prioItems), test.sortByFee)
+		considered := make(map[wire.ShaHash]bool)
+		for _, item := range prioItems {
+			if !test.sortByFee && item.parents != nil {
+				continue
+			}
+			queuePackage(pq, item, prioItems, considered)
+		}
+		got := heap.Pop(pq).(*txPrioItem).tx
+		if got != test.want {
+			t.Errorf("%s: got first tx %v, want %v", test.name,
+				got.Sha(), test.want.Sha())
+		}
+	}
+}
+
+// TestPrioritiseTransaction ensures the deltas set through the
+// prioritisetransaction RPC accumulate, are kept for transactions which are not
+// in the pool and are cleared once the transaction is mined.
+func TestPrioritiseTransaction(t *testing.T) {
+	oldCfg := cfg
+	defer func() { cfg = oldCfg }()
+	cfg = &config{MaxMempool: 300, MempoolExpiry: defaultMempoolExpiry}
+	mp := newTestMemPool(time.Unix(1420070400, 0))
+
+	tx := newTestPoolTx(nil, 1, 100)
+	mp.addTransaction(tx, 1, 10000)
+	notInPool := newTestPoolTx(nil, 2, 100)
+
+	mp.PrioritiseTransaction(tx.Sha(), 100, 1000)
+	mp.PrioritiseTransaction(tx.Sha(), 50, -3000)
+	mp.PrioritiseTransaction(notInPool.Sha(), 0, 5000)
+
+	want := txPriorityDelta{priority: 150, fee: -2000}
+	if got := mp.priorityDelta(tx.Sha()); got != want {
+		t.Errorf("got delta %+v, want %+v", got, want)
+	}
+	deltas := mp.PriorityDeltas()
+	if len(deltas) != 2 || deltas[*notInPool.Sha()].fee != 5000 {
+		t.Errorf("got deltas %+v, want 2 with a fee delta of 5000 "+
+			"for the transaction not in the pool", deltas)
+	}
+	if mp.pool[*tx.Sha()].Fee != 10000 {
+		t.Errorf("fee delta changed the fee of the transaction")
+	}
+
+	// Clear the deltas of the transaction as done once it is mined.
+	mp.ClearPrioritisation(tx.Sha())
+	if got := mp.priorityDelta(tx.Sha()); got != (txPriorityDelta{}) {
+		t.Errorf("got delta %+v of mined transaction, want none", got)
+	}
+	if len(deltas) != 2 {
+		t.Errorf("clearing deltas changed the returned copy")
+	}
+	if deltas := mp.PriorityDeltas(); len(deltas) != 1 {
+		t.Errorf("got %d deltas, want 1", len(deltas))
+	}
+}
@@ -17,8 +17,9 @@ var activeNetParams = &mainNetParams
 // network and test networks.
 type params struct {
 	*chaincfg.Params
-	rpcPort  string
-	dnsSeeds []string
+	rpcPort     string
+	stratumPort string
+	dnsSeeds    []string
 }
 
 // mainNetParams contains parameters specific to the main network
@@ -28,8 +29,9 @@ type params struct {
 // it does not handle on to btcd.  This approach allows the wallet process
 // to emulate the full reference implementation RPC API.
 var mainNetParams = params{
-	Params:  &chaincfg.MainNetParams,
-	rpcPort: "9902",
+	Params:      &chaincfg.MainNetParams,
+	rpcPort:     "9902",
+	stratumPort: "3333",
 	dnsSeeds: []string{
 		"seed.ppcoin.net",
 		"seedppc.ppcoin.net",
@@ -44,17 +46,19 @@ var mainNetParams = params{
 // than the reference implementation - see the mainNetParams comment for
 // details.
 var regressionNetParams = params{
-	Params:   &chaincfg.RegressionNetParams,
-	rpcPort:  "18334",
-	dnsSeeds: []string{},
+	Params:      &chaincfg.RegressionNetParams,
+	rpcPort:     "18334",
+	stratumPort: "13333",
+	dnsSeeds:    []string{},
 }
 
 // testNet3Params contains parameters specific to the test network (version 3)
 // (wire.TestNet3).  NOTE: The RPC port is intentionally different than the
 // reference implementation - see the mainNetParams comment for details.
 var testNet3Params = params{
-	Params:  &chaincfg.TestNet3Params,
-	rpcPort: "18334",
+	Params:      &chaincfg.TestNet3Params,
+	rpcPort:     "18334",
+	stratumPort: "13333",
 	dnsSeeds: []string{
 		"tnseed.ppcoin.net",
 		"tnseedppc.ppcoin.net",
@@ -64,9 +68,10 @@ var testNet3Params = params{
 // simNetParams contains parameters specific to the simulation test network
 // (wire.SimNet).
 var simNetParams = params{
-	Params:   &chaincfg.SimNetParams,
-	rpcPort:  "18556",
-	dnsSeeds: []string{}, // NOTE: There must NOT be any seeds.
+	Params:      &chaincfg.SimNetParams,
+	rpcPort:     "18556",
+	stratumPort: "18557",
+	dnsSeeds:    []string{}, // NOTE: There must NOT be any seeds.
 }
 
 // netName returns the name used when referring to a bitcoin network.  At the
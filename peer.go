@@ -202,6 +202,7 @@ type peer struct {
 	lastPingNonce      uint64    // Set to nonce if we have a pending ping.
 	lastPingTime       time.Time // Time we sent last ping.
 	lastPingMicros     int64     // Time for last ping to return.
+	banScore           uint32
 
 	msgSignatureCache *ppcutil.Cache
 }
@@ -309,6 +310,7 @@ func (p *peer) pushVersionMsg() error {
 	msg := wire.NewMsgVersion(
 		p.server.addrManager.GetBestLocalAddress(p.na), theirNa,
 		p.server.nonce, int32(blockNum))
+	msg.Timestamp = time.Unix(p.server.clock.Now().Unix(), 0)
 	msg.AddUserAgent(userAgentName, userAgentVersion)
 
 	// XXX: bitcoind appears to always enable the full node services flag
@@ -440,7 +442,7 @@ func (p *peer) handleVersionMsg(msg *wire.MsgVersion) {
 	p.userAgent = msg.UserAgent
 
 	// Set the peer's time offset.
-	p.timeOffset = msg.Timestamp.Unix() - time.Now().Unix()
+	p.timeOffset = msg.Timestamp.Unix() - p.server.clock.Now().Unix()
 
 	// Set the peer's ID.
 	p.id = atomic.AddInt32(&nodeCount, 1)
@@ -495,7 +497,8 @@ func (p *peer) handleVersionMsg(msg *wire.MsgVersion) {
 	// Signal the block manager this peer is a new sync candidate.
 	p.server.blockManager.NewPeer(p)
 
-	// TODO: Relay alerts.
+	// Relay the alerts which are currently in effect to the new peer.
+	p.server.alertManager.RelayAlerts(p)
 }
 
 // pushTxMsg sends a tx message for the provided transaction hash to the
@@ -1272,6 +1275,43 @@ func (p *peer) handlePingMsg(msg *wire.MsgPing) {
 	}
 }
 
+// addBanScore increases the ban score of the peer by the passed amount for the
+// passed reason.  The peer is disconnected and banned once its ban score
+// reaches the configured ban threshold.  It returns whether or not the peer
+// was banned.
+func (p *peer) addBanScore(increment uint32, reason string) bool {
+	p.StatsMtx.Lock()
+	p.banScore += increment
+	banScore := p.banScore
+	p.StatsMtx.Unlock()
+
+	peerLog.Warnf("Misbehaving peer %s: %s -- ban score increased to %d",
+		p, reason, banScore)
+	if banScore < cfg.BanThreshold {
+		return false
+	}
+
+	peerLog.Warnf("Misbehaving peer %s -- banning and disconnecting", p)
+	p.server.BanPeer(p)
+	p.Disconnect()
+	return true
+}
+
+// handleAlertMsg is invoked when a peer receives an alert bitcoin message.  The
+// alert is verified against the network alert key and relayed to the other
+// peers by the alert manager when it is valid.  Peers sending alerts which are
+// not signed with the alert key are penalized.
+func (p *peer) handleAlertMsg(msg *wire.MsgAlert) {
+	err := p.server.alertManager.ProcessAlert(msg, p)
+	if err == errInvalidAlertSig {
+		p.addBanScore(invalidAlertSigBanScore, err.Error())
+		return
+	}
+	if err != nil {
+		peerLog.Debugf("Rejected alert from %s: %v", p, err)
+	}
+}
+
 // handlePongMsg is invoked when a peer received a pong bitcoin message.
 // recent clients (protocol version > BIP0031Version), and if we had send a ping
 // previosuly we update our ping time statistics. If the client is too old or
@@ -1565,14 +1605,7 @@ out:
 			p.handlePongMsg(msg)
 
 		case *wire.MsgAlert:
-			// Intentionally ignore alert messages.
-			//
-			// The reference client currently bans peers that send
-			// alerts not signed with its key.  We could verify
-			// against their key, but since the reference client
-			// is currently unwilling to support other
-			// implementions' alert messages, we will not relay
-			// theirs.
+			p.handleAlertMsg(msg)
 
 		case *wire.MsgMemPool:
 			p.handleMemPoolMsg(msg)
@@ -10,14 +10,22 @@ import (
 	"fmt"
 	"strconv"
 	"sync"
+	"time"
 
 	"github.com/ppcsuite/btcutil"
 	"github.com/ppcsuite/ppcd/blockchain"
 	"github.com/ppcsuite/ppcd/btcjson"
 	"github.com/ppcsuite/ppcd/database"
+	"github.com/ppcsuite/ppcd/txscript"
 	"github.com/ppcsuite/ppcd/wire"
 )
 
+// gbtPoSMutableFields are the manipulations the server allows to be made to
+// proof-of-stake block templates generated by the getblocktemplate RPC.  The
+// coinstake fixes the time, coinbase and previous block, so only adding
+// transactions is allowed.
+var gbtPoSMutableFields = []string{"transactions/add"}
+
 // mintState houses state that is used in between multiple RPC invocations to
 // mintblock.
 type mintState struct {
@@ -69,6 +77,35 @@ func ppcHandleGetDifficulty(s *rpcServer, cmd interface{}, closeChan <-chan stru
 	return ret, nil
 }
 
+// ppcHandleGeneratePoS implements the generatepos command.
+func ppcHandleGeneratePoS(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*btcjson.GeneratePoSCmd)
+
+	// Respond with an error if the client is requesting 0 blocks to be
+	// generated.
+	if c.NumBlocks == 0 {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCInternal.Code,
+			Message: "Please request a nonzero number of blocks to generate.",
+		}
+	}
+
+	blockHashes, err := s.server.cpuMiner.GenerateNProofOfStakeBlocks(c.NumBlocks)
+	if err != nil {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCInternal.Code,
+			Message: err.Error(),
+		}
+	}
+
+	reply := make([]string, len(blockHashes))
+	for i, hash := range blockHashes {
+		reply[i] = hash.String()
+	}
+
+	return reply, nil
+}
+
 // ppcHandleGetKernelStakeModifier implements the getkernelstakeModifier command.
 func ppcHandleGetKernelStakeModifier(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
 	c := cmd.(*btcjson.GetKernelStakeModifierCmd)
@@ -187,6 +224,65 @@ func (b *blockManager) GetKernelStakeModifier(hash *wire.ShaHash) (uint64, error
 	return response.StakeModifier, response.err
 }
 
+// checkStakeKernelHashResponse is a response sent to the reply channel of a
+// checkStakeKernelHashMsg.
+type checkStakeKernelHashResponse struct {
+	hashProofOfStake *wire.ShaHash
+	success          bool
+	err              error
+}
+
+// checkStakeKernelHashMsg is a message type to be sent across the message
+// channel for checking whether a transaction output meets the proof-of-stake
+// kernel target.
+type checkStakeKernelHashMsg struct {
+	nBits     uint32
+	blockFrom *btcutil.Block
+	txPrev    *btcutil.Tx
+	prevOut   *wire.OutPoint
+	nTimeTx   int64
+	reply     chan checkStakeKernelHashResponse
+}
+
+// CheckStakeKernelHash checks whether the passed output of txPrev, which is
+// contained in the main chain block blockFrom, meets the proof-of-stake kernel
+// target nBits for a coinstake with the timestamp nTimeTx.
+func (b *blockManager) CheckStakeKernelHash(nBits uint32, blockFrom *btcutil.Block,
+	txPrev *btcutil.Tx, prevOut *wire.OutPoint, nTimeTx int64) (*wire.ShaHash, bool, error) {
+
+	reply := make(chan checkStakeKernelHashResponse, 1)
+	b.msgChan <- checkStakeKernelHashMsg{nBits: nBits, blockFrom: blockFrom,
+		txPrev: txPrev, prevOut: prevOut, nTimeTx: nTimeTx, reply: reply}
+	response := <-reply
+	return response.hashProofOfStake, response.success, response.err
+}
+
+// checkCoinStakeResponse is a response sent to the reply channel of a
+// checkCoinStakeMsg.
+type checkCoinStakeResponse struct {
+	maxReward int64
+	err       error
+}
+
+// checkCoinStakeMsg is a message type to be sent across the message channel
+// for checking whether a coinstake transaction meets the proof-of-stake kernel
+// target.
+type checkCoinStakeMsg struct {
+	tx    *btcutil.Tx
+	nBits uint32
+	reply chan checkCoinStakeResponse
+}
+
+// CheckCoinStake checks whether the passed coinstake transaction meets the
+// proof-of-stake kernel target nBits and returns the maximum reward it may
+// claim.
+func (b *blockManager) CheckCoinStake(tx *btcutil.Tx, nBits uint32) (int64, error) {
+	reply := make(chan checkCoinStakeResponse, 1)
+	b.msgChan <- checkCoinStakeMsg{tx: tx, nBits: nBits, reply: reply}
+	response := <-reply
+	return response.maxReward, response.err
+}
+
 // ppcGetLastProofOfWorkRewardResponse is a response sent to the reply channel of a
 // ppcGetLastProofOfWorkRewardMsg query.
 type ppcGetLastProofOfWorkRewardResponse struct {
@@ -208,6 +304,33 @@ func (b *blockManager) PPCGetLastProofOfWorkReward() (int64, error) {
 	return response.subsidy, response.err
 }
 
+// ppcGetStakeSeenInfoMsg is a message type to be sent across the message
+// channel for requesting statistics about the tracked proof-of-stake kernels.
+type ppcGetStakeSeenInfoMsg struct {
+	reply chan *blockchain.StakeSeenInfo
+}
+
+// PPCStakeSeenInfo returns statistics about the proof-of-stake kernels tracked
+// by the block chain to reject blocks with a duplicate stake.
+func (b *blockManager) PPCStakeSeenInfo() *blockchain.StakeSeenInfo {
+	reply := make(chan *blockchain.StakeSeenInfo, 1)
+	b.msgChan <- ppcGetStakeSeenInfoMsg{reply: reply}
+	return <-reply
+}
+
+// ppcHandleGetStakeSeenInfo implements the getstakeseeninfo command.
+func ppcHandleGetStakeSeenInfo(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	info := s.server.blockManager.PPCStakeSeenInfo()
+	return &btcjson.GetStakeSeenInfoResult{
+		MainChain:       int32(info.MainChain),
+		MaxMainChain:    int32(info.MaxMainChain),
+		Orphans:         int32(info.Orphans),
+		MaxOrphans:      int32(info.MaxOrphans),
+		Rejected:        info.Rejected,
+		RejectedOrphans: info.RejectedOrphans,
+	}, nil
+}
+
 // ppcHandleSendCoinStakeTransaction implements the sendCoinStakeTransaction command.
 func ppcHandleSendCoinStakeTransaction(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
 	c := cmd.(*btcjson.SendCoinStakeTransactionCmd)
@@ -249,6 +372,193 @@ func ppcHandleSendCoinStakeTransaction(s *rpcServer, cmd interface{}, closeChan
 	return scstrReply, nil
 }
 
+// checkCoinStakeTime returns an error when the passed coinstake time, which is
+// also the timestamp of the proof-of-stake block, is not after the passed past
+// median time of the best chain or is too far in the future of the passed
+// adjusted time for the next block.
+func checkCoinStakeTime(coinStakeTime, pastMedianTime, adjustedTime time.Time) error {
+	maxTime := adjustedTime.Add(time.Second * blockchain.MaxTimeOffsetSeconds)
+	if !coinStakeTime.After(pastMedianTime) || coinStakeTime.After(maxTime) {
+		return &btcjson.RPCError{
+			Code: btcjson.ErrRPCOutOfRange,
+			Message: fmt.Sprintf("The coinstake time %v is outside "+
+				"the range allowed for the next block - past "+
+				"median time %v, maximum time %v", coinStakeTime,
+				pastMedianTime, maxTime),
+		}
+	}
+	return nil
+}
+
+// ppcHandleGetBlockTemplatePoS is a helper for handleGetBlockTemplate which
+// deals with generating and returning a proof-of-stake block template for the
+// signed coinstake transaction provided by the caller.  The coinstake fixes the
+// timestamp of the block and the reward it claims, so the caller only needs to
+// sign the block with the key of the returned public key before submitting it
+// with submitblock.
+func ppcHandleGetBlockTemplatePoS(s *rpcServer, request *btcjson.TemplateRequest) (interface{}, error) {
+	hexStr := request.CoinStake
+	if hexStr == "" {
+		return nil, &btcjson.RPCError{
+			Code: btcjson.ErrRPCType,
+			Message: "CoinStake must contain the hex-encoded " +
+				"serialized coinstake transaction",
+		}
+	}
+	if len(hexStr)%2 != 0 {
+		hexStr = "0" + hexStr
+	}
+	serializedTx, err := hex.DecodeString(hexStr)
+	if err != nil {
+		return nil, rpcDecodeHexError(hexStr)
+	}
+	msgTx := wire.NewMsgTx()
+	err = msgTx.Deserialize(bytes.NewReader(serializedTx))
+	if err != nil {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCDeserialization,
+			Message: "TX decode failed: " + err.Error(),
+		}
+	}
+	if !msgTx.IsCoinStake() {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCInvalidParameter,
+			Message: "Transaction is not a coinstake",
+		}
+	}
+
+	// Proof-of-stake blocks must be signed with the public key the second
+	// output of the coinstake pays to.
+	pkScript := msgTx.TxOut[1].PkScript
+	_, addrs, _, err := txscript.ExtractPkScriptAddrs(pkScript,
+		s.server.chainParams)
+	if err != nil || len(addrs) != 1 ||
+		txscript.GetScriptClass(pkScript) != txscript.PubKeyTy {
+
+		return nil, &btcjson.RPCError{
+			Code: btcjson.ErrRPCInvalidParameter,
+			Message: "The second output of the coinstake must pay " +
+				"to the public key the block is signed with",
+		}
+	}
+
+	// Return an error if there are no peers connected since there is no
+	// way to relay a found block.  However, allow this state when running
+	// in the regression test or simulation test mode.
+	if !(cfg.RegressionTest || cfg.SimNet) && s.server.ConnectedCount() == 0 {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCClientNotConnected,
+			Message: "Bitcoin is not connected",
+		}
+	}
+
+	// No point in generating work before the chain is synced.
+	bManager := s.server.blockManager
+	_, currentHeight := bManager.chainState.Best()
+	if currentHeight != 0 && !bManager.IsCurrent() {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCClientInInitialDownload,
+			Message: "Bitcoin is downloading blocks...",
+		}
+	}
+
+	// The timestamp of a proof-of-stake block is the timestamp of its
+	// coinstake, so ensure it is in the range allowed for the next block.
+	bManager.chainState.Lock()
+	pastMedianTime := bManager.chainState.pastMedianTime
+	err = bManager.chainState.pastMedianTimeErr
+	bManager.chainState.Unlock()
+	if err != nil {
+		context := "Failed to get past median time"
+		return nil, internalRPCError(err.Error(), context)
+	}
+	adjustedTime := s.server.timeSource.AdjustedTime()
+	err = checkCoinStakeTime(msgTx.Time, pastMedianTime, adjustedTime)
+	if err != nil {
+		return nil, err
+	}
+
+	// Ensure the coinstake meets the kernel target of the next block and
+	// look up the maximum reward it may claim.
+	nBits, err := bManager.PPCCalcNextRequiredDifficulty(true)
+	if err != nil {
+		context := "Error getting next required target"
+		return nil, internalRPCError(err.Error(), context)
+	}
+	coinStakeTx := btcutil.NewTx(msgTx)
+	maxReward, err := bManager.CheckCoinStake(coinStakeTx, nBits)
+	if err != nil {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCVerify,
+			Message: "Invalid coinstake: " + err.Error(),
+		}
+	}
+
+	// Grab the same lock as used for block submission, since the current
+	// block will be changing and this would otherwise end up building a
+	// new block template on a block that is in the process of becoming
+	// stale.  Creating the template also fails when the coinstake claims
+	// more than its maximum reward.
+	m := s.server.cpuMiner
+	m.submitBlockLock.Lock()
+	template, err := NewBlockTemplate(s.server.txMemPool, nil, coinStakeTx)
+	m.submitBlockLock.Unlock()
+	if err != nil {
+		return nil, &btcjson.RPCError{
+			Code: btcjson.ErrRPCVerify,
+			Message: "Failed to create new block template: " +
+				err.Error(),
+		}
+	}
+
+	transactions, err := blockTemplateTransactions(template)
+	if err != nil {
+		return nil, err
+	}
+
+	// Serialize the coinbase for conversion to hex.  Proof-of-stake blocks
+	// have an empty coinbase, so it is always returned as is.
+	msgBlock := template.block
+	header := &msgBlock.Header
+	coinbaseTx := msgBlock.Transactions[0]
+	txBuf := bytes.NewBuffer(make([]byte, 0, coinbaseTx.SerializeSize()))
+	if err := coinbaseTx.Serialize(txBuf); err != nil {
+		context := "Failed to serialize transaction"
+		return nil, internalRPCError(err.Error(), context)
+	}
+
+	// Generate the block template reply.  The time is fixed by the
+	// coinstake, so the minimum and maximum times are the same.
+	curTime := header.Timestamp.Unix()
+	reply := btcjson.GetBlockTemplateResult{
+		Bits:         strconv.FormatInt(int64(header.Bits), 16),
+		CurTime:      curTime,
+		Height:       template.height,
+		PreviousHash: header.PrevBlock.String(),
+		SigOpLimit:   blockchain.MaxSigOpsPerBlock,
+		SizeLimit:    wire.MaxBlockPayload,
+		Transactions: transactions,
+		Version:      header.Version,
+		CoinbaseTxn: &btcjson.GetBlockTemplateResultTx{
+			Data:    hex.EncodeToString(txBuf.Bytes()),
+			Hash:    coinbaseTx.TxSha().String(),
+			Depends: []int64{},
+			Fee:     template.fees[0],
+			SigOps:  template.sigOpCounts[0],
+		},
+		Target: fmt.Sprintf("%064x",
+			blockchain.CompactToBig(header.Bits)),
+		MinTime:         curTime,
+		MaxTime:         curTime,
+		Mutable:         gbtPoSMutableFields,
+		Capabilities:    gbtCapabilities,
+		CoinStakeReward: &maxReward,
+		SignaturePubKey: hex.EncodeToString(addrs[0].ScriptAddress()),
+	}
+
+	return &reply, nil
+}
+
 // ppcHandleSendMintBlockSignature implements the sendMintBlockSignature command.
 func ppcHandleSendMintBlockSignature(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
 	c := cmd.(*btcjson.SendMintBlockSignatureCmd)
@@ -0,0 +1,52 @@
+// Copyright (c) 2015 PPCD developers.
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ppcsuite/ppcd/blockchain"
+	"github.com/ppcsuite/ppcd/btcjson"
+)
+
+// TestCheckCoinStakeTime ensures the time of the coinstake of a proof-of-stake
+// block template must be after the past median time and no later than the
+// maximum time offset past the adjusted time.
+func TestCheckCoinStakeTime(t *testing.T) {
+	pastMedianTime := time.Unix(1420070400, 0)
+	adjustedTime := pastMedianTime.Add(time.Minute * 10)
+	maxTime := adjustedTime.Add(time.Second * blockchain.MaxTimeOffsetSeconds)
+	tests := []struct {
+		name  string
+		time  time.Time
+		valid bool
+	}{
+		{"before past median time", pastMedianTime.Add(-time.Second),
+			false},
+		{"at past median time", pastMedianTime, false},
+		{"after past median time", pastMedianTime.Add(time.Second),
+			true},
+		{"at adjusted time", adjustedTime, true},
+		{"at maximum time", maxTime, true},
+		{"after maximum time", maxTime.Add(time.Second), false},
+	}
+	for _, test := range tests {
+		err := checkCoinStakeTime(test.time, pastMedianTime,
+			adjustedTime)
+		if test.valid {
+			if err != nil {
+				t.Errorf("%s: unexpected error: %v", test.name,
+					err)
+			}
+			continue
+		}
+		rpcErr, ok := err.(*btcjson.RPCError)
+		if !ok || rpcErr.Code != btcjson.ErrRPCOutOfRange {
+			t.Errorf("%s: got error %v, want out of range error",
+				test.name, err)
+		}
+	}
+}
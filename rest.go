@@ -0,0 +1,600 @@
+// Copyright (c) 2015 PPCD developers.
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/ppcsuite/btcutil"
+	"github.com/ppcsuite/ppcd/blockchain"
+	"github.com/ppcsuite/ppcd/btcjson"
+	"github.com/ppcsuite/ppcd/txscript"
+	"github.com/ppcsuite/ppcd/wire"
+)
+
+const (
+	// restMaxHeaders is the maximum number of block headers which may be
+	// requested with a single /rest/headers request.
+	restMaxHeaders = 2000
+
+	// restMaxOutPoints is the maximum number of outpoints which may be
+	// requested with a single /rest/getutxos request.
+	restMaxOutPoints = 15
+
+	// restMempoolHeight is the height reported by /rest/getutxos for the
+	// outputs of transactions in the memory pool.
+	restMempoolHeight = 0x7fffffff
+)
+
+// restFormat is the output format of a REST request, which is given by the
+// extension of the requested path.
+type restFormat string
+
+// These constants define the output formats of REST requests.
+const (
+	restFormatBinary restFormat = "bin"
+	restFormatHex    restFormat = "hex"
+	restFormatJSON   restFormat = "json"
+)
+
+// restStakeInfo houses the Peercoin specific fields of the blocks and block
+// headers returned by the REST interface.
+type restStakeInfo struct {
+	Mint        float64 `json:"mint"`
+	MoneySupply float64 `json:"moneysupply"`
+	Flags       string  `json:"flags"`
+	ProofHash   string  `json:"proofhash"`
+	Modifier    string  `json:"modifier"`
+}
+
+// restBlockResult models the data returned by /rest/block in JSON format.
+type restBlockResult struct {
+	btcjson.GetBlockVerboseResult
+	restStakeInfo
+	Signature string `json:"signature"`
+}
+
+// restHeaderResult models each of the block headers returned by /rest/headers
+// in JSON format.
+type restHeaderResult struct {
+	Hash          string  `json:"hash"`
+	Confirmations uint64  `json:"confirmations"`
+	Height        int64   `json:"height"`
+	Version       int32   `json:"version"`
+	MerkleRoot    string  `json:"merkleroot"`
+	Time          int64   `json:"time"`
+	Nonce         uint32  `json:"nonce"`
+	Bits          string  `json:"bits"`
+	Difficulty    float64 `json:"difficulty"`
+	PreviousHash  string  `json:"previousblockhash"`
+	NextHash      string  `json:"nextblockhash,omitempty"`
+	restStakeInfo
+}
+
+// restChainInfoResult models the data returned by /rest/chaininfo.
+type restChainInfoResult struct {
+	Chain         string                       `json:"chain"`
+	Blocks        int64                        `json:"blocks"`
+	BestBlockHash string                       `json:"bestblockhash"`
+	Difficulty    *btcjson.GetDifficultyResult `json:"difficulty"`
+	MedianTime    int64                        `json:"mediantime"`
+	MoneySupply   float64                      `json:"moneysupply"`
+}
+
+// restUtxo models each of the unspent outputs returned by /rest/getutxos.
+type restUtxo struct {
+	TxVersion    int32                      `json:"txvers"`
+	TxTime       int64                      `json:"txtime"`
+	Height       int64                      `json:"height"`
+	Value        float64                    `json:"value"`
+	ScriptPubKey btcjson.ScriptPubKeyResult `json:"scriptPubKey"`
+}
+
+// restUtxosResult models the data returned by /rest/getutxos.
+type restUtxosResult struct {
+	ChainHeight  int64      `json:"chainHeight"`
+	ChainTipHash string     `json:"chaintipHash"`
+	Bitmap       string     `json:"bitmap"`
+	Utxos        []restUtxo `json:"utxos"`
+}
+
+// restError is an error returned by a REST request handler along with the HTTP
+// status code to respond with.
+type restError struct {
+	status  int
+	message string
+}
+
+// Error satisfies the error interface and returns the message of the error.
+func (e *restError) Error() string {
+	return e.message
+}
+
+// newRESTError returns a new REST error with the passed HTTP status code and
+// formatted message.
+func newRESTError(status int, format string, args ...interface{}) *restError {
+	return &restError{status: status, message: fmt.Sprintf(format, args...)}
+}
+
+// restRPCError converts the passed error returned by an RPC handler to a REST
+// error.  Errors about missing transactions are reported as not found, errors
+// about the request as bad requests, and all others as internal errors.
+func restRPCError(err error) *restError {
+	rpcErr, ok := err.(*btcjson.RPCError)
+	if !ok {
+		return newRESTError(http.StatusInternalServerError, "%v", err)
+	}
+	switch rpcErr.Code {
+	case btcjson.ErrRPCNoTxInfo:
+		return newRESTError(http.StatusNotFound, "%s", rpcErr.Message)
+	case btcjson.ErrRPCDecodeHexString, btcjson.ErrRPCInvalidParameter:
+		return newRESTError(http.StatusBadRequest, "%s", rpcErr.Message)
+	}
+	return newRESTError(http.StatusInternalServerError, "%s", rpcErr.Message)
+}
+
+// restSplitFormat splits the passed path into the path and the output format
+// given by its extension.
+func restSplitFormat(path string) (string, restFormat, error) {
+	dot := strings.LastIndex(path, ".")
+	if dot >= 0 {
+		format := restFormat(path[dot+1:])
+		switch format {
+		case restFormatBinary, restFormatHex, restFormatJSON:
+			return path[:dot], format, nil
+		}
+	}
+	return "", "", newRESTError(http.StatusNotFound, "output format not "+
+		"found (available: %s, %s, %s)", restFormatBinary,
+		restFormatHex, restFormatJSON)
+}
+
+// restStakeInfoFor returns the Peercoin specific fields of the block with the
+// passed hash and meta data.
+func restStakeInfoFor(sha *wire.ShaHash, meta *wire.Meta) restStakeInfo {
+	info := restStakeInfo{
+		Mint:        btcutil.Amount(meta.Mint).ToBTC(),
+		MoneySupply: btcutil.Amount(meta.MoneySupply).ToBTC(),
+		Flags:       "proof-of-work",
+		ProofHash:   sha.String(),
+		Modifier:    fmt.Sprintf("%016x", meta.StakeModifier),
+	}
+	if meta.Flags&blockchain.FBlockProofOfStake != 0 {
+		info.Flags = "proof-of-stake"
+		info.ProofHash = meta.HashProofOfStake.String()
+	}
+	if meta.Flags&blockchain.FBlockStakeModifier != 0 {
+		info.Flags += " stake-modifier"
+	}
+	return info
+}
+
+// restBlock handles /rest/block/<hash>.<format> requests.  The JSON format
+// includes the transactions of the block in full.
+func (s *rpcServer) restBlock(param string) (interface{}, restFormat, error) {
+	hashStr, format, err := restSplitFormat(param)
+	if err != nil {
+		return nil, "", err
+	}
+	sha, err := wire.NewShaHashFromStr(hashStr)
+	if err != nil {
+		return nil, "", newRESTError(http.StatusBadRequest,
+			"invalid hash: %s", hashStr)
+	}
+	blk, err := s.server.db.FetchBlockBySha(sha)
+	if err != nil {
+		return nil, "", newRESTError(http.StatusNotFound,
+			"%s not found", hashStr)
+	}
+
+	if format != restFormatJSON {
+		buf, err := blk.Bytes()
+		if err != nil {
+			return nil, "", err
+		}
+		return buf, format, nil
+	}
+
+	blockReply, err := blockVerboseResult(s, blk, true)
+	if err != nil {
+		return nil, "", restRPCError(err)
+	}
+	return &restBlockResult{
+		GetBlockVerboseResult: *blockReply,
+		restStakeInfo:         restStakeInfoFor(sha, blk.Meta()),
+		Signature:             hex.EncodeToString(blk.MsgBlock().Signature),
+	}, format, nil
+}
+
+// restTx handles /rest/tx/<txid>.<format> requests.
+func (s *rpcServer) restTx(param string) (interface{}, restFormat, error) {
+	txid, format, err := restSplitFormat(param)
+	if err != nil {
+		return nil, "", err
+	}
+
+	verbose := 0
+	if format == restFormatJSON {
+		verbose = 1
+	}
+	cmd := btcjson.NewGetRawTransactionCmd(txid, &verbose)
+	result, err := handleGetRawTransaction(s, cmd, nil)
+	if err != nil {
+		return nil, "", restRPCError(err)
+	}
+
+	if format != restFormatJSON {
+		buf, err := hex.DecodeString(result.(string))
+		if err != nil {
+			return nil, "", err
+		}
+		return buf, format, nil
+	}
+	return result, format, nil
+}
+
+// restHeaders handles /rest/headers/<count>/<hash>.<format> requests.  It
+// returns up to count main chain block headers starting with the header of
+// the passed block.
+func (s *rpcServer) restHeaders(param string) (interface{}, restFormat, error) {
+	path, format, err := restSplitFormat(param)
+	if err != nil {
+		return nil, "", err
+	}
+	parts := strings.Split(path, "/")
+	if len(parts) != 2 {
+		return nil, "", newRESTError(http.StatusBadRequest, "no header "+
+			"count specified. Use /rest/headers/<count>/<hash>.<ext>.")
+	}
+	count, err := strconv.Atoi(parts[0])
+	if err != nil || count < 1 || count > restMaxHeaders {
+		return nil, "", newRESTError(http.StatusBadRequest, "header "+
+			"count out of range: %s", parts[0])
+	}
+	sha, err := wire.NewShaHashFromStr(parts[1])
+	if err != nil {
+		return nil, "", newRESTError(http.StatusBadRequest,
+			"invalid hash: %s", parts[1])
+	}
+
+	db := s.server.db
+	height, err := db.FetchBlockHeightBySha(sha)
+	if err != nil {
+		return nil, "", newRESTError(http.StatusNotFound,
+			"%s not found", parts[1])
+	}
+	_, maxHeight, err := db.NewestSha()
+	if err != nil {
+		return nil, "", err
+	}
+	shas, err := db.FetchHeightRange(height, height+int64(count))
+	if err != nil {
+		return nil, "", err
+	}
+
+	var buf bytes.Buffer
+	headers := make([]restHeaderResult, 0, len(shas))
+	for i := range shas {
+		header, meta, err := db.FetchBlockHeaderBySha(&shas[i])
+		if err != nil {
+			return nil, "", err
+		}
+		if format != restFormatJSON {
+			if err := header.Serialize(&buf); err != nil {
+				return nil, "", err
+			}
+			continue
+		}
+
+		headerHeight := height + int64(i)
+		result := restHeaderResult{
+			Hash:          shas[i].String(),
+			Confirmations: uint64(1 + maxHeight - headerHeight),
+			Height:        headerHeight,
+			Version:       header.Version,
+			MerkleRoot:    header.MerkleRoot.String(),
+			Time:          header.Timestamp.Unix(),
+			Nonce:         header.Nonce,
+			Bits:          strconv.FormatInt(int64(header.Bits), 16),
+			Difficulty:    getDifficultyRatio(header.Bits),
+			PreviousHash:  header.PrevBlock.String(),
+			restStakeInfo: restStakeInfoFor(&shas[i], meta),
+		}
+		if headerHeight < maxHeight {
+			shaNext, err := db.FetchBlockShaByHeight(headerHeight + 1)
+			if err != nil {
+				return nil, "", err
+			}
+			result.NextHash = shaNext.String()
+		}
+		headers = append(headers, result)
+	}
+
+	if format != restFormatJSON {
+		return buf.Bytes(), format, nil
+	}
+	return headers, format, nil
+}
+
+// restChainInfo handles /rest/chaininfo.json requests.
+func (s *rpcServer) restChainInfo(param string) (interface{}, restFormat, error) {
+	_, format, err := restSplitFormat(param)
+	if err != nil {
+		return nil, "", err
+	}
+	if format != restFormatJSON {
+		return nil, "", newRESTError(http.StatusNotFound, "output "+
+			"format not found (available: %s)", restFormatJSON)
+	}
+
+	sha, height, err := s.server.db.NewestSha()
+	if err != nil {
+		return nil, "", err
+	}
+	_, meta, err := s.server.db.FetchBlockHeaderBySha(sha)
+	if err != nil {
+		return nil, "", err
+	}
+	difficulty, err := ppcHandleGetDifficulty(s, nil, nil)
+	if err != nil {
+		return nil, "", restRPCError(err)
+	}
+
+	chainState := &s.server.blockManager.chainState
+	chainState.Lock()
+	medianTime := chainState.pastMedianTime
+	chainState.Unlock()
+
+	return &restChainInfoResult{
+		Chain:         s.server.chainParams.Name,
+		Blocks:        height,
+		BestBlockHash: sha.String(),
+		Difficulty:    difficulty.(*btcjson.GetDifficultyResult),
+		MedianTime:    medianTime.Unix(),
+		MoneySupply:   btcutil.Amount(meta.MoneySupply).ToBTC(),
+	}, format, nil
+}
+
+// restParseOutPoints parses the passed /rest/getutxos path without the format
+// extension, which is an optional checkmempool followed by the outpoints to
+// look up in the <txid>-<n> form, separated by slashes.  It returns whether
+// checkmempool was given along with the outpoints.
+func restParseOutPoints(path string) (bool, []wire.OutPoint, error) {
+	parts := strings.Split(path, "/")
+	checkMempool := len(parts) > 0 && parts[0] == "checkmempool"
+	if checkMempool {
+		parts = parts[1:]
+	}
+	if len(parts) == 0 || parts[0] == "" {
+		return false, nil, newRESTError(http.StatusBadRequest, "empty "+
+			"request")
+	}
+	if len(parts) > restMaxOutPoints {
+		return false, nil, newRESTError(http.StatusBadRequest, "too "+
+			"many outpoints requested (maximum %d)",
+			restMaxOutPoints)
+	}
+	outPoints := make([]wire.OutPoint, 0, len(parts))
+	for _, part := range parts {
+		dash := strings.LastIndex(part, "-")
+		if dash < 0 {
+			return false, nil, newRESTError(http.StatusBadRequest,
+				"parse error: %s", part)
+		}
+		sha, err := wire.NewShaHashFromStr(part[:dash])
+		if err != nil {
+			return false, nil, newRESTError(http.StatusBadRequest,
+				"parse error: %s", part)
+		}
+		index, err := strconv.ParseUint(part[dash+1:], 10, 32)
+		if err != nil {
+			return false, nil, newRESTError(http.StatusBadRequest,
+				"parse error: %s", part)
+		}
+		outPoints = append(outPoints, *wire.NewOutPoint(sha, uint32(index)))
+	}
+	return checkMempool, outPoints, nil
+}
+
+// restGetUtxos handles /rest/getutxos[/checkmempool]/<txid>-<n>/...<format>
+// requests.  It returns which of the passed outpoints are unspent in the main
+// chain, or also in the memory pool when checkmempool is given, along with the
+// unspent outputs.  Only the JSON format is supported.
+func (s *rpcServer) restGetUtxos(param string) (interface{}, restFormat, error) {
+	path, format, err := restSplitFormat(param)
+	if err != nil {
+		return nil, "", err
+	}
+	if format != restFormatJSON {
+		return nil, "", newRESTError(http.StatusNotFound, "output "+
+			"format not found (available: %s)", restFormatJSON)
+	}
+
+	checkMempool, outPoints, err := restParseOutPoints(path)
+	if err != nil {
+		return nil, "", err
+	}
+	txShas := make([]*wire.ShaHash, 0, len(outPoints))
+	for i := range outPoints {
+		txShas = append(txShas, &outPoints[i].Hash)
+	}
+
+	db := s.server.db
+	tipSha, tipHeight, err := db.NewestSha()
+	if err != nil {
+		return nil, "", err
+	}
+	replies := make(map[wire.ShaHash]*restUtxoTx, len(txShas))
+	for _, reply := range db.FetchUnSpentTxByShaList(txShas) {
+		if reply.Err == nil && reply.Tx != nil {
+			replies[*reply.Sha] = &restUtxoTx{tx: reply.Tx,
+				height: reply.Height, spent: reply.TxSpent}
+		}
+	}
+
+	// Overlay the memory pool when requested.  Outputs of transactions in
+	// the memory pool are unspent unless spent by another transaction in
+	// the memory pool.
+	mp := s.server.txMemPool
+	if checkMempool {
+		mp.RLock()
+		for i := range outPoints {
+			sha := outPoints[i].Hash
+			if _, ok := replies[sha]; ok {
+				continue
+			}
+			if desc, ok := mp.pool[sha]; ok {
+				mtx := desc.Tx.MsgTx()
+				replies[sha] = &restUtxoTx{tx: mtx,
+					height: restMempoolHeight,
+					spent:  make([]bool, len(mtx.TxOut))}
+			}
+		}
+	}
+
+	result := &restUtxosResult{
+		ChainHeight:  tipHeight,
+		ChainTipHash: tipSha.String(),
+		Utxos:        make([]restUtxo, 0, len(outPoints)),
+	}
+	bitmap := make([]byte, len(outPoints))
+	for i := range outPoints {
+		bitmap[i] = '0'
+		op := &outPoints[i]
+		reply, ok := replies[op.Hash]
+		if !ok || op.Index >= uint32(len(reply.tx.TxOut)) ||
+			reply.spent[op.Index] {
+			continue
+		}
+		if checkMempool {
+			if _, ok := mp.outpoints[*op]; ok {
+				continue
+			}
+		}
+
+		bitmap[i] = '1'
+		txOut := reply.tx.TxOut[op.Index]
+		disbuf, _ := txscript.DisasmString(txOut.PkScript)
+		scriptClass, addrs, reqSigs, _ := txscript.ExtractPkScriptAddrs(
+			txOut.PkScript, s.server.chainParams)
+		addresses := make([]string, len(addrs))
+		for j, addr := range addrs {
+			addresses[j] = addr.EncodeAddress()
+		}
+		result.Utxos = append(result.Utxos, restUtxo{
+			TxVersion: reply.tx.Version,
+			TxTime:    reply.tx.Time.Unix(),
+			Height:    reply.height,
+			Value:     btcutil.Amount(txOut.Value).ToBTC(),
+			ScriptPubKey: btcjson.ScriptPubKeyResult{
+				Asm:       disbuf,
+				Hex:       hex.EncodeToString(txOut.PkScript),
+				ReqSigs:   int32(reqSigs),
+				Type:      scriptClass.String(),
+				Addresses: addresses,
+			},
+		})
+	}
+	if checkMempool {
+		mp.RUnlock()
+	}
+	result.Bitmap = string(bitmap)
+
+	return result, format, nil
+}
+
+// restUtxoTx houses a transaction looked up by /rest/getutxos along with its
+// height and which of its outputs are spent.
+type restUtxoTx struct {
+	tx     *wire.MsgTx
+	height int64
+	spent  []bool
+}
+
+// restHandlers maps the paths of the REST interface to their handlers.  Each
+// handler is passed the remainder of the requested path and returns either
+// the raw bytes of the binary and hex formats or the result to encode for the
+// JSON format.
+var restHandlers = map[string]func(*rpcServer, string) (interface{}, restFormat, error){
+	"block":     (*rpcServer).restBlock,
+	"tx":        (*rpcServer).restTx,
+	"headers":   (*rpcServer).restHeaders,
+	"chaininfo": (*rpcServer).restChainInfo,
+	"getutxos":  (*rpcServer).restGetUtxos,
+}
+
+// restSplitEndpoint splits the passed path of a REST request into the endpoint
+// and its parameters, which include the format extension.  The endpoints
+// without parameters, such as chaininfo, carry the format extension
+// themselves, so their parameters are only the extension.
+func restSplitEndpoint(path string) (string, string) {
+	path = strings.TrimPrefix(path, "/rest/")
+	if slash := strings.Index(path, "/"); slash >= 0 {
+		return path[:slash], path[slash+1:]
+	}
+	if dot := strings.LastIndex(path, "."); dot >= 0 {
+		return path[:dot], path[dot:]
+	}
+	return path, ""
+}
+
+// restHandler handles requests to the unauthenticated REST interface enabled
+// with --rest.  It serves read-only chain data in binary, hex, or JSON format.
+func (s *rpcServer) restHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "405 Method Not Allowed.",
+			http.StatusMethodNotAllowed)
+		return
+	}
+
+	endpoint, param := restSplitEndpoint(r.URL.Path)
+	handler, ok := restHandlers[endpoint]
+	if !ok {
+		http.Error(w, "404 Not Found.", http.StatusNotFound)
+		return
+	}
+
+	result, format, err := handler(s, param)
+	if err != nil {
+		restErr, ok := err.(*restError)
+		if !ok {
+			rpcsLog.Errorf("REST request %s failed: %v", r.URL.Path,
+				err)
+			restErr = newRESTError(http.StatusInternalServerError,
+				"%v", err)
+		}
+		http.Error(w, restErr.message, restErr.status)
+		return
+	}
+
+	var reply []byte
+	switch format {
+	case restFormatBinary:
+		w.Header().Set("Content-Type", "application/octet-stream")
+		reply = result.([]byte)
+	case restFormatHex:
+		w.Header().Set("Content-Type", "text/plain")
+		reply = []byte(hex.EncodeToString(result.([]byte)) + "\n")
+	case restFormatJSON:
+		w.Header().Set("Content-Type", "application/json")
+		reply, err = json.Marshal(result)
+		if err != nil {
+			rpcsLog.Errorf("Failed to marshal REST reply: %v", err)
+			http.Error(w, "500 Internal Server Error.",
+				http.StatusInternalServerError)
+			return
+		}
+		reply = append(reply, '\n')
+	}
+	if _, err := w.Write(reply); err != nil {
+		rpcsLog.Errorf("Failed to write REST reply: %v", err)
+	}
+}
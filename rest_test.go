@@ -0,0 +1,152 @@
+// Copyright (c) 2015 PPCD developers.
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// TestRestSplitEndpoint ensures the paths of REST requests are split into the
+// endpoint and its parameters, with the format extension of endpoints without
+// parameters passed on as their parameters.
+func TestRestSplitEndpoint(t *testing.T) {
+	tests := []struct {
+		path     string
+		endpoint string
+		param    string
+	}{
+		{"/rest/chaininfo.json", "chaininfo", ".json"},
+		{"/rest/chaininfo", "chaininfo", ""},
+		{"/rest/block/0a1b.hex", "block", "0a1b.hex"},
+		{"/rest/block/notxdetails/0a1b.json", "block",
+			"notxdetails/0a1b.json"},
+		{"/rest/headers/5/0a1b.bin", "headers", "5/0a1b.bin"},
+		{"/rest/getutxos/checkmempool/0a1b-0.json", "getutxos",
+			"checkmempool/0a1b-0.json"},
+		{"/rest/getutxos.json", "getutxos", ".json"},
+		{"/rest/", "", ""},
+	}
+	for _, test := range tests {
+		endpoint, param := restSplitEndpoint(test.path)
+		if endpoint != test.endpoint || param != test.param {
+			t.Errorf("%s: got %q and %q, want %q and %q", test.path,
+				endpoint, param, test.endpoint, test.param)
+		}
+	}
+}
+
+// TestRestSplitFormat ensures the format extension of REST requests is split
+// from their parameters and unknown formats are not found.
+func TestRestSplitFormat(t *testing.T) {
+	tests := []struct {
+		param  string
+		path   string
+		format restFormat
+		valid  bool
+	}{
+		{".json", "", restFormatJSON, true},
+		{"0a1b.bin", "0a1b", restFormatBinary, true},
+		{"0a1b.hex", "0a1b", restFormatHex, true},
+		{"checkmempool/0a1b-0.json", "checkmempool/0a1b-0",
+			restFormatJSON, true},
+		{"a.b.json", "a.b", restFormatJSON, true},
+		{"0a1b", "", "", false},
+		{"0a1b.xml", "", "", false},
+		{"0a1b.JSON", "", "", false},
+		{"", "", "", false},
+	}
+	for _, test := range tests {
+		path, format, err := restSplitFormat(test.param)
+		if !test.valid {
+			restErr, ok := err.(*restError)
+			if !ok || restErr.status != http.StatusNotFound {
+				t.Errorf("%q: got error %v, want not found",
+					test.param, err)
+			}
+			continue
+		}
+		if err != nil || path != test.path || format != test.format {
+			t.Errorf("%q: got %q, %q, %v, want %q, %q", test.param,
+				path, format, err, test.path, test.format)
+		}
+	}
+}
+
+// TestRestParseOutPoints ensures the outpoints of /rest/getutxos requests are
+// parsed and that malformed requests are refused.
+func TestRestParseOutPoints(t *testing.T) {
+	txid := "4a5e1e4baab89f3a32518a88c31bc87f618f76673e2cc77ab2127b7afdeda33b"
+	other := "000000000019d6689c085ae165831e934ff763ae46a2a6c172b3f1b60a8ce26f"
+	tooMany := make([]string, restMaxOutPoints+1)
+	var maxOutPoints []string
+	for i := range tooMany {
+		tooMany[i] = fmt.Sprintf("%s-%d", txid, i)
+		if i > 0 {
+			maxOutPoints = append(maxOutPoints,
+				fmt.Sprintf("%s:%d", txid, i))
+		}
+	}
+
+	tests := []struct {
+		name         string
+		path         string
+		checkMempool bool
+		outPoints    []string
+		valid        bool
+	}{
+		{"single", txid + "-0", false, []string{txid + ":0"}, true},
+		{"several", txid + "-1/" + other + "-4294967295", false,
+			[]string{txid + ":1", other + ":4294967295"}, true},
+		{"checkmempool", "checkmempool/" + txid + "-2", true,
+			[]string{txid + ":2"}, true},
+		{"maximum", strings.Join(tooMany[1:], "/"), false, maxOutPoints,
+			true},
+		{"empty", "", false, nil, false},
+		{"checkmempool only", "checkmempool", false, nil, false},
+		{"checkmempool with slash", "checkmempool/", false, nil, false},
+		{"too many", strings.Join(tooMany, "/"), false, nil, false},
+		{"no index", txid, false, nil, false},
+		{"empty index", txid + "-", false, nil, false},
+		{"negative index", txid + "--1", false, nil, false},
+		{"index too large", txid + "-4294967296", false, nil, false},
+		{"bad txid", "xyz-0", false, nil, false},
+		{"txid too long", txid + "00-0", false, nil, false},
+		{"empty outpoint", txid + "-0//" + txid + "-1", false, nil,
+			false},
+	}
+	for _, test := range tests {
+		checkMempool, outPoints, err := restParseOutPoints(test.path)
+		if !test.valid {
+			restErr, ok := err.(*restError)
+			if !ok || restErr.status != http.StatusBadRequest {
+				t.Errorf("%s: got error %v, want bad request",
+					test.name, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+			continue
+		}
+		if checkMempool != test.checkMempool {
+			t.Errorf("%s: got checkmempool %v, want %v", test.name,
+				checkMempool, test.checkMempool)
+		}
+		if len(outPoints) != len(test.outPoints) {
+			t.Errorf("%s: got %d outpoints, want %d", test.name,
+				len(outPoints), len(test.outPoints))
+			continue
+		}
+		for i, op := range outPoints {
+			if got := op.String(); got != test.outPoints[i] {
+				t.Errorf("%s: outpoint %d: got %s, want %s",
+					test.name, i, got, test.outPoints[i])
+			}
+		}
+	}
+}
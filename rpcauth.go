@@ -0,0 +1,243 @@
+// Copyright (c) 2015 PPCD developers.
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"crypto/hmac"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/btcsuite/fastsha256"
+)
+
+const (
+	// rpcRoleAdmin is the role which allows every RPC method.
+	rpcRoleAdmin = "admin"
+
+	// rpcRoleLimited is the role which allows the RPC methods available to
+	// the limited user.
+	rpcRoleLimited = "limited"
+)
+
+// rpcAccess describes the RPC methods an authenticated client may invoke.
+type rpcAccess struct {
+	// methods is the set of allowed methods.  A nil set allows every
+	// method.
+	methods map[string]struct{}
+}
+
+var (
+	// rpcAdminAccess is the access of the admin user and users with the
+	// admin role.
+	rpcAdminAccess = &rpcAccess{}
+
+	// rpcLimitedAccess is the access of the limited user and users with
+	// the limited role.
+	rpcLimitedAccess = &rpcAccess{methods: rpcLimited}
+)
+
+// allows returns whether the passed RPC method may be invoked.
+func (a *rpcAccess) allows(method string) bool {
+	if a.methods == nil {
+		return true
+	}
+	_, ok := a.methods[method]
+	return ok
+}
+
+// rpcAuthUser houses the credentials and access rules of an RPC user
+// configured with the --rpcauth option.
+type rpcAuthUser struct {
+	name        string
+	salt        string
+	hash        []byte
+	access      *rpcAccess
+	allowedNets []*net.IPNet
+}
+
+// rpcAuthHash returns the salted hash of the passed password, which is the
+// HMAC-SHA256 of the password keyed by the salt.
+func rpcAuthHash(salt, password string) []byte {
+	mac := hmac.New(fastsha256.New, []byte(salt))
+	mac.Write([]byte(password))
+	return mac.Sum(nil)
+}
+
+// checkPassword returns whether the passed password matches the salted hash of
+// the user.
+//
+// This check is time-constant.
+func (u *rpcAuthUser) checkPassword(password string) bool {
+	return hmac.Equal(rpcAuthHash(u.salt, password), u.hash)
+}
+
+// allowsAddr returns whether the user may connect from the passed remote
+// address.  Users without allowed networks may connect from any address.
+func (u *rpcAuthUser) allowsAddr(remoteAddr string) bool {
+	if len(u.allowedNets) == 0 {
+		return true
+	}
+
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	for _, ipNet := range u.allowedNets {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// splitRPCAuthUser splits an option of the form <user>:<value> into the user
+// and value.
+func splitRPCAuthUser(option string) (string, string, error) {
+	parts := strings.SplitN(option, ":", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", fmt.Errorf("malformed value %q -- expected "+
+			"<user>:<value>", option)
+	}
+	return parts[0], parts[1], nil
+}
+
+// parseRPCAccess returns the access allowing the passed comma-separated list
+// of RPC methods and roles.
+func parseRPCAccess(list string) (*rpcAccess, error) {
+	methods := make(map[string]struct{})
+	for _, method := range strings.Split(list, ",") {
+		method = strings.TrimSpace(method)
+		switch method {
+		case rpcRoleAdmin:
+			return rpcAdminAccess, nil
+
+		case rpcRoleLimited:
+			for limited := range rpcLimited {
+				methods[limited] = struct{}{}
+			}
+			continue
+		}
+
+		_, isRPC := rpcHandlers[method]
+		_, isWebsocket := wsHandlers[method]
+		if !isRPC && !isWebsocket {
+			return nil, fmt.Errorf("unknown RPC method %q", method)
+		}
+		methods[method] = struct{}{}
+	}
+	return &rpcAccess{methods: methods}, nil
+}
+
+// parseIPNet parses the passed IP address or CIDR network.  A single address
+// is treated as a network containing only that address.
+func parseIPNet(s string) (*net.IPNet, error) {
+	if strings.Contains(s, "/") {
+		_, ipNet, err := net.ParseCIDR(s)
+		return ipNet, err
+	}
+
+	ip := net.ParseIP(s)
+	if ip == nil {
+		return nil, fmt.Errorf("invalid IP address %q", s)
+	}
+	bits := 8 * net.IPv6len
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+		bits = 8 * net.IPv4len
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, nil
+}
+
+// parseRPCAuthUsers parses the users of the --rpcauth options along with the
+// access rules of the --rpcauthmethods and --rpcauthallowip options.  Users
+// without allowed methods are given the limited role.
+func parseRPCAuthUsers(auths, methods, allowIPs []string) (map[string]*rpcAuthUser, error) {
+	users := make(map[string]*rpcAuthUser, len(auths))
+	for _, auth := range auths {
+		name, saltedHash, err := splitRPCAuthUser(auth)
+		if err != nil {
+			return nil, fmt.Errorf("rpcauth: %v", err)
+		}
+		parts := strings.SplitN(saltedHash, "$", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, fmt.Errorf("rpcauth: malformed hash for user "+
+				"%q -- expected <salt>$<hash>", name)
+		}
+		hash, err := hex.DecodeString(parts[1])
+		if err != nil || len(hash) != fastsha256.Size {
+			return nil, fmt.Errorf("rpcauth: hash for user %q must "+
+				"be %d hex-encoded bytes", name, fastsha256.Size)
+		}
+		if _, ok := users[name]; ok {
+			return nil, fmt.Errorf("rpcauth: duplicate user %q", name)
+		}
+		users[name] = &rpcAuthUser{
+			name:   name,
+			salt:   parts[0],
+			hash:   hash,
+			access: rpcLimitedAccess,
+		}
+	}
+
+	for _, option := range methods {
+		name, list, err := splitRPCAuthUser(option)
+		if err != nil {
+			return nil, fmt.Errorf("rpcauthmethods: %v", err)
+		}
+		user, ok := users[name]
+		if !ok {
+			return nil, fmt.Errorf("rpcauthmethods: unknown user %q",
+				name)
+		}
+		user.access, err = parseRPCAccess(list)
+		if err != nil {
+			return nil, fmt.Errorf("rpcauthmethods: user %q: %v",
+				name, err)
+		}
+	}
+
+	for _, option := range allowIPs {
+		name, addr, err := splitRPCAuthUser(option)
+		if err != nil {
+			return nil, fmt.Errorf("rpcauthallowip: %v", err)
+		}
+		user, ok := users[name]
+		if !ok {
+			return nil, fmt.Errorf("rpcauthallowip: unknown user %q",
+				name)
+		}
+		ipNet, err := parseIPNet(addr)
+		if err != nil {
+			return nil, fmt.Errorf("rpcauthallowip: user %q: %v",
+				name, err)
+		}
+		user.allowedNets = append(user.allowedNets, ipNet)
+	}
+
+	return users, nil
+}
+
+// checkAuthUser checks the passed credentials against the users configured
+// with the --rpcauth option and returns the access of the matching user, or
+// nil when no user matches or the user may not connect from the passed remote
+// address.
+func (s *rpcServer) checkAuthUser(name, password, remoteAddr string) *rpcAccess {
+	user, ok := cfg.rpcAuthUsers[name]
+	if !ok || !user.checkPassword(password) {
+		return nil
+	}
+	if !user.allowsAddr(remoteAddr) {
+		rpcsLog.Warnf("RPC user %s not allowed to connect from %s",
+			name, remoteAddr)
+		return nil
+	}
+	return user.access
+}
@@ -0,0 +1,254 @@
+// Copyright (c) 2015 PPCD developers.
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+// testAuthSalt and testAuthHash are the salt and the salted hash of the
+// password "password" used by the tests.
+const (
+	testAuthSalt = "cb77f0957de88ff388cf817ddbc7273"
+	testAuthHash = "9565c5c6ed9bb1f0f0f3207e04b8a36129e92c0569f97ed0293919de56aece06"
+)
+
+// TestParseRPCAuthUsers ensures the users of the rpcauth options and their
+// access rules are parsed and that malformed options are rejected.
+func TestParseRPCAuthUsers(t *testing.T) {
+	alice := "alice:" + testAuthSalt + "$" + testAuthHash
+	bob := "bob:" + testAuthSalt + "$" + testAuthHash
+
+	tests := []struct {
+		name     string
+		auths    []string
+		methods  []string
+		allowIPs []string
+		err      string
+	}{
+		{"valid", []string{alice, bob}, []string{"alice:getinfo"},
+			[]string{"alice:127.0.0.1", "bob:::1"}, ""},
+		{"no colon", []string{"alice"}, nil, nil, "expected <user>:<value>"},
+		{"no user", []string{":" + testAuthSalt + "$" + testAuthHash},
+			nil, nil, "expected <user>:<value>"},
+		{"no salt separator", []string{"alice:" + testAuthHash}, nil,
+			nil, "expected <salt>$<hash>"},
+		{"empty salt", []string{"alice:$" + testAuthHash}, nil, nil,
+			"expected <salt>$<hash>"},
+		{"non-hex hash", []string{"alice:salt$" +
+			strings.Repeat("zz", 32)}, nil, nil, "hex-encoded"},
+		{"short hash", []string{"alice:salt$" + testAuthHash[2:]}, nil,
+			nil, "hex-encoded"},
+		{"duplicate user", []string{alice, alice}, nil, nil,
+			"duplicate user"},
+		{"methods of unknown user", []string{alice},
+			[]string{"carol:getinfo"}, nil, "unknown user"},
+		{"unknown method", []string{alice},
+			[]string{"alice:getinfo,nosuchmethod"}, nil,
+			"unknown RPC method"},
+		{"allowed IP of unknown user", []string{alice}, nil,
+			[]string{"carol:127.0.0.1"}, "unknown user"},
+		{"invalid allowed IP", []string{alice}, nil,
+			[]string{"alice:localhost"}, "invalid IP address"},
+		{"invalid allowed network", []string{alice}, nil,
+			[]string{"alice:10.0.0.0/33"}, "invalid CIDR"},
+	}
+	for _, test := range tests {
+		users, err := parseRPCAuthUsers(test.auths, test.methods,
+			test.allowIPs)
+		if test.err == "" {
+			if err != nil {
+				t.Errorf("%s: unexpected error: %v", test.name, err)
+			} else if len(users) != len(test.auths) {
+				t.Errorf("%s: got %d users, want %d", test.name,
+					len(users), len(test.auths))
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%s: got error %v, want one containing %q",
+				test.name, err, test.err)
+		}
+	}
+
+	users, err := parseRPCAuthUsers([]string{alice, bob},
+		[]string{"alice:getinfo"}, []string{"bob:::1", "bob:10.0.0.0/8"})
+	if err != nil {
+		t.Fatalf("parseRPCAuthUsers: %v", err)
+	}
+	if users["bob"].access != rpcLimitedAccess {
+		t.Errorf("user without methods does not have the limited role")
+	}
+	if !users["alice"].access.allows("getinfo") ||
+		users["alice"].access.allows("getbestblock") {
+
+		t.Errorf("user access does not match the configured methods")
+	}
+	if len(users["bob"].allowedNets) != 2 {
+		t.Errorf("got %d allowed networks, want 2",
+			len(users["bob"].allowedNets))
+	}
+	if hex.EncodeToString(users["alice"].hash) != testAuthHash ||
+		users["alice"].salt != testAuthSalt {
+
+		t.Errorf("salted hash was not parsed")
+	}
+}
+
+// TestParseRPCAccess ensures lists of RPC methods and roles are parsed into the
+// expected access, with the admin role overriding every other entry.
+func TestParseRPCAccess(t *testing.T) {
+	tests := []struct {
+		list    string
+		allowed []string
+		denied  []string
+		admin   bool
+	}{
+		{"getinfo", []string{"getinfo"}, []string{"getbestblock", "stop"},
+			false},
+		{"getinfo, getbestblock", []string{"getinfo", "getbestblock"},
+			[]string{"stop"}, false},
+		{"notifyblocks", []string{"notifyblocks"}, []string{"getinfo"},
+			false},
+		{"limited", []string{"getinfo", "notifyblocks"},
+			[]string{"stop"}, false},
+		{"limited,stop", []string{"getinfo", "stop"}, nil, false},
+		{"admin", []string{"getinfo", "stop"}, nil, true},
+		{"getinfo,admin", []string{"getbestblock", "stop"}, nil, true},
+		{"admin,nosuchmethod", []string{"stop"}, nil, true},
+	}
+	for _, test := range tests {
+		access, err := parseRPCAccess(test.list)
+		if err != nil {
+			t.Errorf("parseRPCAccess(%q): %v", test.list, err)
+			continue
+		}
+		if (access == rpcAdminAccess) != test.admin {
+			t.Errorf("parseRPCAccess(%q): admin access %v, want %v",
+				test.list, access == rpcAdminAccess, test.admin)
+		}
+		for _, method := range test.allowed {
+			if !access.allows(method) {
+				t.Errorf("parseRPCAccess(%q): %s is not allowed",
+					test.list, method)
+			}
+		}
+		for _, method := range test.denied {
+			if access.allows(method) {
+				t.Errorf("parseRPCAccess(%q): %s is allowed",
+					test.list, method)
+			}
+		}
+	}
+
+	for _, list := range []string{"", "nosuchmethod", "getinfo,"} {
+		if _, err := parseRPCAccess(list); err == nil {
+			t.Errorf("parseRPCAccess(%q) succeeded", list)
+		}
+	}
+}
+
+// TestParseIPNet ensures single addresses and networks are parsed.
+func TestParseIPNet(t *testing.T) {
+	tests := []struct {
+		s    string
+		want string
+	}{
+		{"127.0.0.1", "127.0.0.1/32"},
+		{"10.1.2.3/8", "10.0.0.0/8"},
+		{"::1", "::1/128"},
+		{"fe80::1/64", "fe80::/64"},
+		{"::ffff:192.168.1.1", "192.168.1.1/32"},
+	}
+	for _, test := range tests {
+		ipNet, err := parseIPNet(test.s)
+		if err != nil {
+			t.Errorf("parseIPNet(%q): %v", test.s, err)
+			continue
+		}
+		if ipNet.String() != test.want {
+			t.Errorf("parseIPNet(%q): got %v, want %s", test.s, ipNet,
+				test.want)
+		}
+	}
+
+	for _, s := range []string{"", "localhost", "1.2.3", "10.0.0.0/33"} {
+		if _, err := parseIPNet(s); err == nil {
+			t.Errorf("parseIPNet(%q) succeeded", s)
+		}
+	}
+}
+
+// TestRPCAuthUserAllowsAddr ensures users may only connect from their allowed
+// networks.
+func TestRPCAuthUserAllowsAddr(t *testing.T) {
+	var user rpcAuthUser
+	if !user.allowsAddr("203.0.113.1:9904") {
+		t.Errorf("user without allowed networks was denied")
+	}
+	for _, s := range []string{"127.0.0.1", "::1", "10.0.0.0/8"} {
+		ipNet, err := parseIPNet(s)
+		if err != nil {
+			t.Fatalf("parseIPNet(%q): %v", s, err)
+		}
+		user.allowedNets = append(user.allowedNets, ipNet)
+	}
+
+	tests := []struct {
+		remoteAddr string
+		want       bool
+	}{
+		{"127.0.0.1:9904", true},
+		{"127.0.0.2:9904", false},
+		{"[::1]:9904", true},
+		{"[::2]:9904", false},
+		{"[::ffff:127.0.0.1]:9904", true},
+		{"10.20.30.40:9904", true},
+		{"11.0.0.1:9904", false},
+		{"10.1.1.1", true},
+		{"::1", true},
+		{"not an address", false},
+	}
+	for _, test := range tests {
+		if got := user.allowsAddr(test.remoteAddr); got != test.want {
+			t.Errorf("allowsAddr(%q): got %v, want %v",
+				test.remoteAddr, got, test.want)
+		}
+	}
+}
+
+// TestRPCAuthUserCheckPassword ensures only the password of the salted hash
+// is accepted.
+func TestRPCAuthUserCheckPassword(t *testing.T) {
+	hash, err := hex.DecodeString(testAuthHash)
+	if err != nil {
+		t.Fatalf("DecodeString: %v", err)
+	}
+	user := rpcAuthUser{salt: testAuthSalt, hash: hash}
+
+	tests := []struct {
+		password string
+		want     bool
+	}{
+		{"password", true},
+		{"Password", false},
+		{"password ", false},
+		{"", false},
+	}
+	for _, test := range tests {
+		if got := user.checkPassword(test.password); got != test.want {
+			t.Errorf("checkPassword(%q): got %v, want %v",
+				test.password, got, test.want)
+		}
+	}
+
+	// A different salt yields a different hash for the same password.
+	user.salt = "othersalt"
+	if user.checkPassword("password") {
+		t.Errorf("password accepted with a different salt")
+	}
+}
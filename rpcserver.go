@@ -21,6 +21,7 @@ import (
 	"net"
 	"net/http"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"sync"
@@ -46,6 +47,10 @@ const (
 	// is closed.
 	rpcAuthTimeoutSeconds = 10
 
+	// rpcMaxBatchRequests is the maximum number of requests allowed in a
+	// single JSON-RPC batch request.
+	rpcMaxBatchRequests = 10000
+
 	// uint256Size is the number of bytes needed to represent an unsigned
 	// 256-bit integer.
 	uint256Size = 32
@@ -101,7 +106,7 @@ var (
 	// block template generated by the getblocktemplate RPC.    It is
 	// declared here to avoid the overhead of creating the slice on every
 	// invocation for constant data.
-	gbtCapabilities = []string{"proposal"}
+	gbtCapabilities = []string{"proposal", "pos"} // ppc:
 )
 
 // Errors
@@ -134,11 +139,13 @@ var rpcHandlersBeforeInit = map[string]commandHandler{
 	"decoderawtransaction":  handleDecodeRawTransaction,
 	"decodescript":          handleDecodeScript,
 	"generate":              handleGenerate,
+	"generatepos":           ppcHandleGeneratePoS, // ppc:
 	"getaddednodeinfo":      handleGetAddedNodeInfo,
 	"getbestblock":          handleGetBestBlock,
 	"getbestblockhash":      handleGetBestBlockHash,
 	"getblock":              handleGetBlock,
 	"getblockcount":         handleGetBlockCount,
+	"getblockdownloadinfo":  handleGetBlockDownloadInfo,
 	"getblockhash":          handleGetBlockHash,
 	"getblocktemplate":      handleGetBlockTemplate,
 	"getconnectioncount":    handleGetConnectionCount,
@@ -147,6 +154,10 @@ var rpcHandlersBeforeInit = map[string]commandHandler{
 	"getgenerate":           handleGetGenerate,
 	"gethashespersec":       handleGetHashesPerSec,
 	"getinfo":               handleGetInfo,
+	"getmempoolancestors":   handleGetMempoolAncestors,
+	"getmempooldescendants": handleGetMempoolDescendants,
+	"getmempoolentry":       handleGetMempoolEntry,
+	"getmempoolinfo":        handleGetMempoolInfo,
 	"getmininginfo":         handleGetMiningInfo,
 	"getnettotals":          handleGetNetTotals,
 	"getnetworkhashps":      handleGetNetworkHashPS,
@@ -158,9 +169,11 @@ var rpcHandlersBeforeInit = map[string]commandHandler{
 	"help":                  handleHelp,
 	"node":                  handleNode,
 	"ping":                  handlePing,
+	"prioritisetransaction": handlePrioritiseTransaction,
 	"searchrawtransactions": handleSearchRawTransactions,
 	"sendrawtransaction":    handleSendRawTransaction,
 	"setgenerate":           handleSetGenerate,
+	"setmocktime":           handleSetMockTime,
 	"stop":                  handleStop,
 	"submitblock":           handleSubmitBlock,
 	"validateaddress":       handleValidateAddress,
@@ -170,6 +183,7 @@ var rpcHandlersBeforeInit = map[string]commandHandler{
 	"getkernelstakemodifier":   ppcHandleGetKernelStakeModifier,   // ppc:
 	"getnextrequiredtarget":    ppcHandleGetNextRequiredTarget,    // ppc:
 	"getlastproofofworkreward": ppcHandleGetLastProofOfWorkReward, // ppc:
+	"getstakeseeninfo":         ppcHandleGetStakeSeenInfo,         // ppc:
 	"sendcoinstaketransaction": ppcHandleSendCoinStakeTransaction, // ppc:
 	"sendmintblocksignature":   ppcHandleSendMintBlockSignature,   // ppc:
 }
@@ -236,11 +250,15 @@ var rpcUnimplemented = map[string]struct{}{
 // Commands that are available to a limited user
 var rpcLimited = map[string]struct{}{
 	// Websockets commands
+	"notifyalerts":          struct{}{},
 	"notifyblocks":          struct{}{},
+	"notifymempoolremovals": struct{}{},
 	"notifynewtransactions": struct{}{},
 	"notifyreceived":        struct{}{},
 	"notifyspent":           struct{}{},
+	"notifystakeevents":     struct{}{},
 	"rescan":                struct{}{},
+	"stoprescan":            struct{}{},
 
 	// Websockets AND HTTP/S commands
 	"help": struct{}{},
@@ -257,6 +275,10 @@ var rpcLimited = map[string]struct{}{
 	"getcurrentnet":         struct{}{},
 	"getdifficulty":         struct{}{},
 	"getinfo":               struct{}{},
+	"getmempoolancestors":   struct{}{},
+	"getmempooldescendants": struct{}{},
+	"getmempoolentry":       struct{}{},
+	"getmempoolinfo":        struct{}{},
 	"getnettotals":          struct{}{},
 	"getnetworkhashps":      struct{}{},
 	"getrawmempool":         struct{}{},
@@ -269,6 +291,7 @@ var rpcLimited = map[string]struct{}{
 	"verifymessage":         struct{}{},
 
 	//ppc:
+	"getstakeseeninfo":         struct{}{},
 	"sendcoinstaketransaction": struct{}{},
 }
 
@@ -619,6 +642,12 @@ func handleDebugLevel(s *rpcServer, cmd interface{}, closeChan <-chan struct{})
 		}
 	}
 
+	// Save the debug levels so they are restored on startup.
+	err = saveDebugLevels(filepath.Join(cfg.DataDir, debugLevelsFilename))
+	if err != nil {
+		rpcsLog.Warnf("Unable to save the debug levels: %v", err)
+	}
+
 	return "Done.", nil
 }
 
@@ -1010,6 +1039,13 @@ func handleGetBlock(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (i
 	}
 
 	// The verbose flag is set, so generate the JSON object and return it.
+	return blockVerboseResult(s, blk, c.VerboseTx != nil && *c.VerboseTx)
+}
+
+// blockVerboseResult returns the passed main chain block as a
+// btcjson.GetBlockVerboseResult that is ready to be encoded to JSON.  The
+// transactions of the block are included in full when verboseTx is set.
+func blockVerboseResult(s *rpcServer, blk *btcutil.Block, verboseTx bool) (*btcjson.GetBlockVerboseResult, error) {
 	buf, err := blk.Bytes()
 	if err != nil {
 		context := "Failed to get block bytes"
@@ -1022,9 +1058,10 @@ func handleGetBlock(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (i
 		return nil, internalRPCError(err.Error(), context)
 	}
 
+	sha := blk.Sha()
 	blockHeader := &blk.MsgBlock().Header
 	blockReply := btcjson.GetBlockVerboseResult{
-		Hash:          c.Hash,
+		Hash:          sha.String(),
 		Version:       blockHeader.Version,
 		MerkleRoot:    blockHeader.MerkleRoot.String(),
 		PreviousHash:  blockHeader.PrevBlock.String(),
@@ -1037,7 +1074,7 @@ func handleGetBlock(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (i
 		Difficulty:    getDifficultyRatio(blockHeader.Bits),
 	}
 
-	if c.VerboseTx == nil || !*c.VerboseTx {
+	if !verboseTx {
 		transactions := blk.Transactions()
 		txNames := make([]string, len(transactions))
 		for i, tx := range transactions {
@@ -1073,7 +1110,7 @@ func handleGetBlock(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (i
 		blockReply.NextHash = shaNext.String()
 	}
 
-	return blockReply, nil
+	return &blockReply, nil
 }
 
 // handleGetBlockCount implements the getblockcount command.
@@ -1090,6 +1127,11 @@ func handleGetBlockCount(s *rpcServer, cmd interface{}, closeChan <-chan struct{
 	return maxIdx, nil
 }
 
+// handleGetBlockDownloadInfo implements the getblockdownloadinfo command.
+func handleGetBlockDownloadInfo(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	return s.server.blockManager.BlockDownloadInfo(), nil
+}
+
 // handleGetBlockHash implements the getblockhash command.
 func handleGetBlockHash(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
 	c := cmd.(*btcjson.GetBlockHashCmd)
@@ -1382,34 +1424,11 @@ func (state *gbtWorkState) updateBlockTemplate(s *rpcServer, useCoinbaseValue bo
 	return nil
 }
 
-// blockTemplateResult returns the current block template associated with the
-// state as a btcjson.GetBlockTemplateResult that is ready to be encoded to JSON
-// and returned to the caller.
-//
-// This function MUST be called with the state locked.
-func (state *gbtWorkState) blockTemplateResult(useCoinbaseValue bool, submitOld *bool) (*btcjson.GetBlockTemplateResult, error) {
-	// Ensure the timestamps are still in valid range for the template.
-	// This should really only ever happen if the local clock is changed
-	// after the template is generated, but it's important to avoid serving
-	// invalid block templates.
-	template := state.template
+// blockTemplateTransactions converts each transaction in the passed block
+// template to a template result transaction.  The result does not include the
+// coinbase, so notice the adjustments to the various lengths and indices.
+func blockTemplateTransactions(template *BlockTemplate) ([]btcjson.GetBlockTemplateResultTx, error) {
 	msgBlock := template.block
-	header := &msgBlock.Header
-	adjustedTime := state.timeSource.AdjustedTime()
-	maxTime := adjustedTime.Add(time.Second * blockchain.MaxTimeOffsetSeconds)
-	if header.Timestamp.After(maxTime) {
-		return nil, &btcjson.RPCError{
-			Code: btcjson.ErrRPCOutOfRange,
-			Message: fmt.Sprintf("The template time is after the "+
-				"maximum allowed time for a block - template "+
-				"time %v, maximum time %v", adjustedTime,
-				maxTime),
-		}
-	}
-
-	// Convert each transaction in the block template to a template result
-	// transaction.  The result does not include the coinbase, so notice
-	// the adjustments to the various lengths and indices.
 	numTx := len(msgBlock.Transactions)
 	transactions := make([]btcjson.GetBlockTemplateResultTx, 0, numTx-1)
 	txIndex := make(map[wire.ShaHash]int64, numTx)
@@ -1456,6 +1475,39 @@ func (state *gbtWorkState) blockTemplateResult(useCoinbaseValue bool, submitOld
 		transactions = append(transactions, resultTx)
 	}
 
+	return transactions, nil
+}
+
+// blockTemplateResult returns the current block template associated with the
+// state as a btcjson.GetBlockTemplateResult that is ready to be encoded to JSON
+// and returned to the caller.
+//
+// This function MUST be called with the state locked.
+func (state *gbtWorkState) blockTemplateResult(useCoinbaseValue bool, submitOld *bool) (*btcjson.GetBlockTemplateResult, error) {
+	// Ensure the timestamps are still in valid range for the template.
+	// This should really only ever happen if the local clock is changed
+	// after the template is generated, but it's important to avoid serving
+	// invalid block templates.
+	template := state.template
+	msgBlock := template.block
+	header := &msgBlock.Header
+	adjustedTime := state.timeSource.AdjustedTime()
+	maxTime := adjustedTime.Add(time.Second * blockchain.MaxTimeOffsetSeconds)
+	if header.Timestamp.After(maxTime) {
+		return nil, &btcjson.RPCError{
+			Code: btcjson.ErrRPCOutOfRange,
+			Message: fmt.Sprintf("The template time is after the "+
+				"maximum allowed time for a block - template "+
+				"time %v, maximum time %v", adjustedTime,
+				maxTime),
+		}
+	}
+
+	transactions, err := blockTemplateTransactions(template)
+	if err != nil {
+		return nil, err
+	}
+
 	// Generate the block template reply.  Note that following mutations are
 	// implied by the included or omission of fields:
 	//  Including MinTime -> time/decrement
@@ -1875,6 +1927,8 @@ func handleGetBlockTemplate(s *rpcServer, cmd interface{}, closeChan <-chan stru
 		return handleGetBlockTemplateRequest(s, request, closeChan)
 	case "proposal":
 		return handleGetBlockTemplateProposal(s, request)
+	case "pos": // ppc:
+		return ppcHandleGetBlockTemplatePoS(s, request)
 	}
 
 	return nil, &btcjson.RPCError{
@@ -1956,11 +2010,34 @@ func handleGetInfo(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (in
 		Difficulty:      powDifficulty, // ppc: POW only
 		TestNet:         cfg.TestNet3,
 		RelayFee:        float64(minTxRelayFee) / btcutil.SatoshiPerBitcoin,
+		Errors:          s.server.alertManager.StatusBar(),
 	}
 
 	return ret, nil
 }
 
+// handleGetMempoolInfo implements the getmempoolinfo command.
+func handleGetMempoolInfo(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	info := s.server.txMemPool.Info()
+	var lastEvicted int64
+	if !info.LastEvicted.IsZero() {
+		lastEvicted = info.LastEvicted.Unix()
+	}
+	reply := &btcjson.GetMempoolInfoResult{
+		Size:          int64(info.Count),
+		Bytes:         info.Size,
+		Usage:         info.Usage,
+		MaxMempool:    info.MaxSize,
+		MempoolMinFee: btcutil.Amount(info.MinFeeRate).ToBTC(),
+		MinRelayTxFee: btcutil.Amount(info.MinRelayFeeRate).ToBTC(),
+		Orphans:       int64(info.NumOrphans),
+		Evicted:       info.NumEvicted,
+		EvictedBytes:  info.EvictedBytes,
+		LastEvicted:   lastEvicted,
+	}
+	return reply, nil
+}
+
 // handleGetMiningInfo implements the getmininginfo command. We only return the
 // fields that are not related to wallet functionality.
 func handleGetMiningInfo(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
@@ -2001,6 +2078,7 @@ func handleGetMiningInfo(s *rpcServer, cmd interface{}, closeChan <-chan struct{
 		CurrentBlockSize: uint64(len(blockBytes)),
 		CurrentBlockTx:   uint64(len(block.MsgBlock().Transactions)),
 		Difficulty:       getDifficultyRatio(block.MsgBlock().Header.Bits),
+		Errors:           s.server.alertManager.StatusBar(),
 		Generate:         s.server.cpuMiner.IsMining(),
 		GenProcLimit:     s.server.cpuMiner.NumWorkers(),
 		HashesPerSec:     int64(s.server.cpuMiner.HashesPerSecond()),
@@ -2123,10 +2201,18 @@ func handleGetPeerInfo(s *rpcServer, cmd interface{}, closeChan <-chan struct{})
 // handleGetRawMempool implements the getrawmempool command.
 func handleGetRawMempool(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
 	c := cmd.(*btcjson.GetRawMempoolCmd)
-	mp := s.server.txMemPool
-	descs := mp.TxDescs()
+	descs := s.server.txMemPool.TxDescs()
+	return mempoolTxDescsResult(s, descs, c.Verbose != nil && *c.Verbose)
+}
 
-	if c.Verbose != nil && *c.Verbose {
+// mempoolTxDescsResult returns the result of the getrawmempool,
+// getmempoolancestors, and getmempooldescendants commands for the passed
+// memory pool transaction descriptors.  It is either a map of transaction
+// hashes to details about the transactions when verbose is set, or an array
+// of the transaction hashes.
+func mempoolTxDescsResult(s *rpcServer, descs []*TxDesc, verbose bool) (interface{}, error) {
+	mp := s.server.txMemPool
+	if verbose {
 		result := make(map[string]*btcjson.GetRawMempoolVerboseResult,
 			len(descs))
 
@@ -2139,35 +2225,8 @@ func handleGetRawMempool(s *rpcServer, cmd interface{}, closeChan <-chan struct{
 		mp.RLock()
 		defer mp.RUnlock()
 		for _, desc := range descs {
-			// Calculate the starting and current priority from the
-			// the tx's inputs.  Use zeros if one or more of the
-			// input transactions can't be found for some reason.
-			var startingPriority, currentPriority float64
-			inputTxs, err := mp.fetchInputTransactions(desc.Tx)
-			if err == nil {
-				startingPriority = desc.StartingPriority(inputTxs)
-				currentPriority = desc.CurrentPriority(inputTxs,
-					newestHeight+1)
-			}
-
-			mpd := &btcjson.GetRawMempoolVerboseResult{
-				Size:             int32(desc.Tx.MsgTx().SerializeSize()),
-				Fee:              btcutil.Amount(desc.Fee).ToBTC(),
-				Time:             desc.Added.Unix(),
-				Height:           desc.Height,
-				StartingPriority: startingPriority,
-				CurrentPriority:  currentPriority,
-				Depends:          make([]string, 0),
-			}
-			for _, txIn := range desc.Tx.MsgTx().TxIn {
-				hash := &txIn.PreviousOutPoint.Hash
-				if s.server.txMemPool.haveTransaction(hash) {
-					mpd.Depends = append(mpd.Depends,
-						hash.String())
-				}
-			}
-
-			result[desc.Tx.Sha().String()] = mpd
+			result[desc.Tx.Sha().String()] = mempoolEntryResult(mp,
+				desc, newestHeight+1)
 		}
 
 		return result, nil
@@ -2183,6 +2242,114 @@ func handleGetRawMempool(s *rpcServer, cmd interface{}, closeChan <-chan struct{
 	return hashStrings, nil
 }
 
+// mempoolEntryResult returns the details about the passed memory pool
+// transaction descriptor which are returned by the getmempoolentry command and
+// the verbose forms of the getrawmempool, getmempoolancestors, and
+// getmempooldescendants commands.
+//
+// This function MUST be called with the mempool lock held (for reads).
+func mempoolEntryResult(mp *txMemPool, desc *TxDesc, nextBlockHeight int64) *btcjson.GetRawMempoolVerboseResult {
+	// Calculate the starting and current priority from the the tx's
+	// inputs.  Use zeros if one or more of the input transactions can't be
+	// found for some reason.
+	var startingPriority, currentPriority float64
+	inputTxs, err := mp.fetchInputTransactions(desc.Tx)
+	if err == nil {
+		startingPriority = desc.StartingPriority(inputTxs)
+		currentPriority = desc.CurrentPriority(inputTxs, nextBlockHeight)
+	}
+
+	delta := mp.priorityDelta(desc.Tx.Sha())
+	mpd := &btcjson.GetRawMempoolVerboseResult{
+		Size:             int32(desc.Tx.MsgTx().SerializeSize()),
+		Fee:              btcutil.Amount(desc.Fee).ToBTC(),
+		Time:             desc.Added.Unix(),
+		TxTime:           desc.Tx.MsgTx().Time.Unix(), // ppc:
+		Height:           desc.Height,
+		StartingPriority: startingPriority,
+		CurrentPriority:  currentPriority,
+		PriorityDelta:    delta.priority,
+		FeeDelta:         btcutil.Amount(delta.fee).ToBTC(),
+		DescendantCount:  desc.descendantPkg.count,
+		DescendantSize:   desc.descendantPkg.size,
+		DescendantFees:   btcutil.Amount(desc.descendantPkg.fees).ToBTC(),
+		AncestorCount:    desc.ancestorPkg.count,
+		AncestorSize:     desc.ancestorPkg.size,
+		AncestorFees:     btcutil.Amount(desc.ancestorPkg.fees).ToBTC(),
+		Depends:          make([]string, 0),
+	}
+	for _, txIn := range desc.Tx.MsgTx().TxIn {
+		hash := &txIn.PreviousOutPoint.Hash
+		if mp.haveTransaction(hash) {
+			mpd.Depends = append(mpd.Depends, hash.String())
+		}
+	}
+	return mpd
+}
+
+// handleGetMempoolEntry implements the getmempoolentry command.
+func handleGetMempoolEntry(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*btcjson.GetMempoolEntryCmd)
+	txHash, err := wire.NewShaHashFromStr(c.TxID)
+	if err != nil {
+		return nil, rpcDecodeHexError(c.TxID)
+	}
+
+	_, newestHeight, err := s.server.db.NewestSha()
+	if err != nil {
+		context := "Failed to get newest hash"
+		return nil, internalRPCError(err.Error(), context)
+	}
+
+	mp := s.server.txMemPool
+	mp.RLock()
+	defer mp.RUnlock()
+	desc, exists := mp.pool[*txHash]
+	if !exists {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCNoTxInfo,
+			Message: "Transaction not in memory pool",
+		}
+	}
+	return mempoolEntryResult(mp, desc, newestHeight+1), nil
+}
+
+// handleGetMempoolAncestors implements the getmempoolancestors command.
+func handleGetMempoolAncestors(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*btcjson.GetMempoolAncestorsCmd)
+	txHash, err := wire.NewShaHashFromStr(c.TxID)
+	if err != nil {
+		return nil, rpcDecodeHexError(c.TxID)
+	}
+
+	descs, err := s.server.txMemPool.TxAncestors(txHash)
+	if err != nil {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCNoTxInfo,
+			Message: "Transaction not in memory pool",
+		}
+	}
+	return mempoolTxDescsResult(s, descs, c.Verbose != nil && *c.Verbose)
+}
+
+// handleGetMempoolDescendants implements the getmempooldescendants command.
+func handleGetMempoolDescendants(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*btcjson.GetMempoolDescendantsCmd)
+	txHash, err := wire.NewShaHashFromStr(c.TxID)
+	if err != nil {
+		return nil, rpcDecodeHexError(c.TxID)
+	}
+
+	descs, err := s.server.txMemPool.TxDescendants(txHash)
+	if err != nil {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCNoTxInfo,
+			Message: "Transaction not in memory pool",
+		}
+	}
+	return mempoolTxDescsResult(s, descs, c.Verbose != nil && *c.Verbose)
+}
+
 // handleGetRawTransaction implements the getrawtransaction command.
 func handleGetRawTransaction(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
 	c := cmd.(*btcjson.GetRawTransactionCmd)
@@ -2776,6 +2943,19 @@ func handlePing(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (inter
 	return nil, nil
 }
 
+// handlePrioritiseTransaction implements the prioritisetransaction command.
+func handlePrioritiseTransaction(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*btcjson.PrioritiseTransactionCmd)
+	txHash, err := wire.NewShaHashFromStr(c.TxID)
+	if err != nil {
+		return nil, rpcDecodeHexError(c.TxID)
+	}
+
+	s.server.txMemPool.PrioritiseTransaction(txHash, c.PriorityDelta,
+		c.FeeDelta)
+	return true, nil
+}
+
 // handleSearchRawTransaction implements the searchrawtransactions command.
 func handleSearchRawTransactions(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
 	if !cfg.AddrIndex {
@@ -2999,6 +3179,38 @@ func handleSetGenerate(s *rpcServer, cmd interface{}, closeChan <-chan struct{})
 	return nil, nil
 }
 
+// handleSetMockTime implements the setmocktime command.
+func handleSetMockTime(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*btcjson.SetMockTimeCmd)
+
+	// Respond with an error if the local time can't be mocked on the
+	// current network.
+	if !s.server.clock.mockable {
+		return nil, &btcjson.RPCError{
+			Code: btcjson.ErrRPCInternal.Code,
+			Message: "No support for `setmocktime` on the current " +
+				"network, " + s.server.chainParams.Net.String() +
+				", as it is only available on the regtest and " +
+				"simnet networks.",
+		}
+	}
+	if c.Timestamp < 0 {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCInvalidParameter,
+			Message: "Timestamp must be 0 or greater",
+		}
+	}
+
+	// A timestamp of 0 releases the clock so it follows the system time
+	// again.
+	var mockTime time.Time
+	if c.Timestamp != 0 {
+		mockTime = time.Unix(c.Timestamp, 0)
+	}
+	s.server.clock.setMockTime(mockTime)
+	return nil, nil
+}
+
 // handleStop implements the stop command.
 func handleStop(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
 	s.server.Stop()
@@ -3305,6 +3517,25 @@ func (s *rpcServer) incrementClients() {
 	atomic.AddInt32(&s.numClients, 1)
 }
 
+// tryIncrementClients adds one to the number of connected RPC clients unless
+// that would exceed the maximum allowed RPC clients and returns whether it did.
+// Note this only applies to standard clients.
+//
+// This function is safe for concurrent access.
+func (s *rpcServer) tryIncrementClients() bool {
+	for {
+		numClients := atomic.LoadInt32(&s.numClients)
+		if int(numClients) >= cfg.RPCMaxClients {
+			return false
+		}
+		if atomic.CompareAndSwapInt32(&s.numClients, numClients,
+			numClients+1) {
+
+			return true
+		}
+	}
+}
+
 // decrementClients subtracts one from the number of connected RPC clients.
 // Note this only applies to standard clients.  Websocket clients have their own
 // limits and are tracked separately.
@@ -3321,21 +3552,20 @@ func (s *rpcServer) decrementClients() {
 //
 // This check is time-constant.
 //
-// The first bool return value signifies auth success (true if successful) and
-// the second bool return value specifies whether the user can change the state
-// of the server (true) or whether the user is limited (false). The second is
-// always false if the first is.
-func (s *rpcServer) checkAuth(r *http.Request, require bool) (bool, bool,
+// The bool return value signifies auth success (true if successful) and the
+// access return value specifies which RPC methods the user may invoke.  The
+// access is always nil if auth did not succeed.
+func (s *rpcServer) checkAuth(r *http.Request, require bool) (bool, *rpcAccess,
 	error) {
 	authhdr := r.Header["Authorization"]
 	if len(authhdr) <= 0 {
 		if require {
 			rpcsLog.Warnf("RPC authentication failure from %s",
 				r.RemoteAddr)
-			return false, false, errors.New("auth failure")
+			return false, nil, errors.New("auth failure")
 		}
 
-		return false, false, nil
+		return false, nil, nil
 	}
 
 	authsha := fastsha256.Sum256([]byte(authhdr[0]))
@@ -3344,18 +3574,26 @@ func (s *rpcServer) checkAuth(r *http.Request, require bool) (bool, bool,
 	// are probably expected to have a higher volume of calls
 	limitcmp := subtle.ConstantTimeCompare(authsha[:], s.limitauthsha[:])
 	if limitcmp == 1 {
-		return true, false, nil
+		return true, rpcLimitedAccess, nil
 	}
 
 	// Check for admin-level auth
 	cmp := subtle.ConstantTimeCompare(authsha[:], s.authsha[:])
 	if cmp == 1 {
-		return true, true, nil
+		return true, rpcAdminAccess, nil
 	}
 
-	// Request's auth doesn't match either user
+	// ppc: Check for the users configured with --rpcauth.
+	if user, password, ok := r.BasicAuth(); ok {
+		access := s.checkAuthUser(user, password, r.RemoteAddr)
+		if access != nil {
+			return true, access, nil
+		}
+	}
+
+	// Request's auth doesn't match any user
 	rpcsLog.Warnf("RPC authentication failure from %s", r.RemoteAddr)
-	return false, false, errors.New("auth failure")
+	return false, nil, errors.New("auth failure")
 }
 
 // parsedRPCCmd represents a JSON-RPC request object that has been parsed into
@@ -3440,9 +3678,160 @@ func createMarshalledReply(id, result interface{}, replyErr error) ([]byte, erro
 	return btcjson.MarshalResponse(id, result, jsonErr)
 }
 
+// processRequest checks the passed JSON-RPC request may be invoked by a client
+// with the passed access and returns the result of the command it contains.
+func (s *rpcServer) processRequest(request *btcjson.Request, access *rpcAccess,
+	closeChan <-chan struct{}) (interface{}, error) {
+
+	// Check if the user is limited and set error if method unauthorized
+	if !access.allows(request.Method) {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCInvalidParams.Code,
+			Message: "user not authorized for this method",
+		}
+	}
+
+	// Attempt to parse the JSON-RPC request into a known concrete command.
+	parsedCmd := parseCmd(request)
+	if parsedCmd.err != nil {
+		return nil, parsedCmd.err
+	}
+	return s.standardCmdResult(parsedCmd, closeChan)
+}
+
+// isBatchRequest returns whether the passed JSON-RPC request body is a batch of
+// requests, which is a JSON array rather than a request object.
+func isBatchRequest(body []byte) bool {
+	body = bytes.TrimLeft(body, " \t\r\n")
+	return len(body) > 0 && body[0] == '['
+}
+
+// batchElementReply returns the marshalled reply to the passed request of a
+// JSON-RPC batch request, or nil when the request is a notification which
+// must not have a reply per the JSON-RPC spec.
+func (s *rpcServer) batchElementReply(rawRequest json.RawMessage,
+	access *rpcAccess, closeChan <-chan struct{}) []byte {
+
+	var responseID interface{}
+	var jsonErr error
+	var result interface{}
+	var request btcjson.Request
+	if err := json.Unmarshal(rawRequest, &request); err != nil {
+		jsonErr = &btcjson.RPCError{
+			Code:    btcjson.ErrRPCParse.Code,
+			Message: "Failed to parse request: " + err.Error(),
+		}
+	} else {
+		if request.ID == nil {
+			return nil
+		}
+		responseID = request.ID
+		result, jsonErr = s.processRequest(&request, access, closeChan)
+	}
+
+	msg, err := createMarshalledReply(responseID, result, jsonErr)
+	if err != nil {
+		rpcsLog.Errorf("Failed to marshal reply: %v", err)
+		msg, _ = createMarshalledReply(responseID, nil,
+			internalRPCError(err.Error(), "Failed to marshal reply"))
+	}
+	return msg
+}
+
+// batchReply returns the marshalled reply to the passed JSON-RPC batch request,
+// which is an array of the replies to each of the requests it contains in the
+// same order.  Notifications do not have a reply, so nil is returned when the
+// batch only contains notifications.  The requests are processed concurrently
+// while there is room for more standard RPC clients, with each goroutine beyond
+// the first counting as a client, so batches can't use more resources than the
+// maximum number of clients together.
+func (s *rpcServer) batchReply(body []byte, access *rpcAccess,
+	closeChan <-chan struct{}) []byte {
+
+	var batch []json.RawMessage
+	var jsonErr *btcjson.RPCError
+	if err := json.Unmarshal(body, &batch); err != nil {
+		jsonErr = &btcjson.RPCError{
+			Code:    btcjson.ErrRPCParse.Code,
+			Message: "Failed to parse request: " + err.Error(),
+		}
+	} else if len(batch) == 0 || len(batch) > rpcMaxBatchRequests {
+		jsonErr = &btcjson.RPCError{
+			Code: btcjson.ErrRPCInvalidRequest.Code,
+			Message: fmt.Sprintf("Batch requests must contain "+
+				"between 1 and %d requests", rpcMaxBatchRequests),
+		}
+	}
+	if jsonErr != nil {
+		msg, err := createMarshalledReply(nil, nil, jsonErr)
+		if err != nil {
+			rpcsLog.Errorf("Failed to marshal reply: %v", err)
+			return nil
+		}
+		return msg
+	}
+
+	// Process the requests with a bounded number of goroutines.  The batch
+	// request itself already counts as a client, so only the additional
+	// goroutines take up more client slots, which are released once the
+	// batch is done.  Requests which have not been started are skipped once
+	// the client disconnects.
+	numWorkers := 1
+	for numWorkers < len(batch) && s.tryIncrementClients() {
+		numWorkers++
+	}
+	defer func() {
+		for i := 1; i < numWorkers; i++ {
+			s.decrementClients()
+		}
+	}()
+	replies := make([][]byte, len(batch))
+	indices := make(chan int)
+	var wg sync.WaitGroup
+	wg.Add(numWorkers)
+	for i := 0; i < numWorkers; i++ {
+		go func() {
+			defer wg.Done()
+			for idx := range indices {
+				replies[idx] = s.batchElementReply(batch[idx],
+					access, closeChan)
+			}
+		}()
+	}
+out:
+	for i := range batch {
+		select {
+		case indices <- i:
+		case <-closeChan:
+			break out
+		}
+	}
+	close(indices)
+	wg.Wait()
+
+	// Join the replies into an array, leaving out the notifications.
+	var msg bytes.Buffer
+	for _, reply := range replies {
+		if reply == nil {
+			continue
+		}
+		if msg.Len() == 0 {
+			msg.WriteByte('[')
+		} else {
+			msg.WriteByte(',')
+		}
+		msg.Write(reply)
+	}
+	if msg.Len() == 0 {
+		return nil
+	}
+	msg.WriteByte(']')
+	return msg.Bytes()
+}
+
 // jsonRPCRead handles reading and responding to RPC messages.
 func (s *rpcServer) jsonRPCRead(w http.ResponseWriter, r *http.Request,
-	isAdmin bool) {
+	access *rpcAccess) {
 	if atomic.LoadInt32(&s.shutdown) != 0 {
 		return
 	}
@@ -3490,16 +3879,20 @@ func (s *rpcServer) jsonRPCRead(w http.ResponseWriter, r *http.Request,
 	var jsonErr error
 	var result interface{}
 	var request btcjson.Request
-	if err := json.Unmarshal(body, &request); err != nil {
-		jsonErr = &btcjson.RPCError{
-			Code:    btcjson.ErrRPCParse.Code,
-			Message: "Failed to parse request: " + err.Error(),
+	var msg []byte
+	isBatch := isBatchRequest(body)
+	if !isBatch {
+		if err := json.Unmarshal(body, &request); err != nil {
+			jsonErr = &btcjson.RPCError{
+				Code:    btcjson.ErrRPCParse.Code,
+				Message: "Failed to parse request: " + err.Error(),
+			}
 		}
 	}
 	if jsonErr == nil {
 		// Requests with no ID (notifications) must not have a response
 		// per the JSON-RPC spec.
-		if request.ID == nil {
+		if !isBatch && request.ID == nil {
 			return
 		}
 
@@ -3517,33 +3910,26 @@ func (s *rpcServer) jsonRPCRead(w http.ResponseWriter, r *http.Request,
 			}
 		}()
 
-		// Check if the user is limited and set error if method unauthorized
-		if !isAdmin {
-			if _, ok := rpcLimited[request.Method]; !ok {
-				jsonErr = &btcjson.RPCError{
-					Code:    btcjson.ErrRPCInvalidParams.Code,
-					Message: "limited user not authorized for this method",
-				}
-			}
-		}
-
-		if jsonErr == nil {
-			// Attempt to parse the JSON-RPC request into a known concrete
-			// command.
-			parsedCmd := parseCmd(&request)
-			if parsedCmd.err != nil {
-				jsonErr = parsedCmd.err
-			} else {
-				result, jsonErr = s.standardCmdResult(parsedCmd, closeChan)
+		// ppc: Batch requests are replied to with an array of the
+		// replies to the requests they contain.
+		if isBatch {
+			msg = s.batchReply(body, access, closeChan)
+			if msg == nil {
+				return
 			}
+		} else {
+			result, jsonErr = s.processRequest(&request, access,
+				closeChan)
 		}
 	}
 
 	// Marshal the response.
-	msg, err := createMarshalledReply(responseID, result, jsonErr)
-	if err != nil {
-		rpcsLog.Errorf("Failed to marshal reply: %v", err)
-		return
+	if msg == nil {
+		msg, err = createMarshalledReply(responseID, result, jsonErr)
+		if err != nil {
+			rpcsLog.Errorf("Failed to marshal reply: %v", err)
+			return
+		}
 	}
 
 	// Write the response.
@@ -3591,19 +3977,19 @@ func (s *rpcServer) Start() {
 		// Keep track of the number of connected clients.
 		s.incrementClients()
 		defer s.decrementClients()
-		_, isAdmin, err := s.checkAuth(r, true)
+		_, access, err := s.checkAuth(r, true)
 		if err != nil {
 			jsonAuthFail(w)
 			return
 		}
 
 		// Read and respond to the request.
-		s.jsonRPCRead(w, r, isAdmin)
+		s.jsonRPCRead(w, r, access)
 	})
 
 	// Websocket endpoint.
 	rpcServeMux.HandleFunc("/ws", func(w http.ResponseWriter, r *http.Request) {
-		authenticated, isAdmin, err := s.checkAuth(r, false)
+		authenticated, access, err := s.checkAuth(r, false)
 		if err != nil {
 			jsonAuthFail(w)
 			return
@@ -3620,9 +4006,27 @@ func (s *rpcServer) Start() {
 			http.Error(w, "400 Bad Request.", http.StatusBadRequest)
 			return
 		}
-		s.WebsocketHandler(ws, r.RemoteAddr, authenticated, isAdmin)
+		s.WebsocketHandler(ws, r.RemoteAddr, authenticated, access)
 	})
 
+	// ppc: unauthenticated REST endpoint for read-only chain data.
+	if cfg.REST {
+		rpcServeMux.HandleFunc("/rest/", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Connection", "close")
+			r.Close = true
+
+			// Limit the number of connections to max allowed.
+			if s.limitConnections(w, r.RemoteAddr) {
+				return
+			}
+
+			// Keep track of the number of connected clients.
+			s.incrementClients()
+			defer s.decrementClients()
+			s.restHandler(w, r)
+		})
+	}
+
 	for _, listener := range s.listeners {
 		s.wg.Add(1)
 		go func(listener net.Listener) {
@@ -0,0 +1,380 @@
+// Copyright (c) 2015 PPCD developers.
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ppcsuite/btcutil"
+	"github.com/ppcsuite/ppcd/blockchain"
+	"github.com/ppcsuite/ppcd/btcjson"
+	"github.com/ppcsuite/ppcd/chaincfg"
+	"github.com/ppcsuite/ppcd/database"
+	"github.com/ppcsuite/ppcd/wire"
+)
+
+// TestIsBatchRequest ensures JSON-RPC batches are told apart from single
+// requests.
+func TestIsBatchRequest(t *testing.T) {
+	tests := []struct {
+		body string
+		want bool
+	}{
+		{`[{"method":"help","id":1}]`, true},
+		{" \r\n\t[]", true},
+		{`{"method":"help","id":1}`, false},
+		{` {"method":"help","id":1}`, false},
+		{"", false},
+		{"  ", false},
+	}
+	for _, test := range tests {
+		if got := isBatchRequest([]byte(test.body)); got != test.want {
+			t.Errorf("isBatchRequest(%q): got %v, want %v", test.body,
+				got, test.want)
+		}
+	}
+}
+
+// testBatchReply is the expected reply to a request of a batch.
+type testBatchReply struct {
+	id     interface{}
+	result string
+	code   btcjson.RPCErrorCode
+}
+
+// TestBatchReply ensures the replies to the requests of a batch are returned
+// in order, without replies to notifications, and that malformed, empty and
+// oversized batches are refused.
+func TestBatchReply(t *testing.T) {
+	oldCfg := cfg
+	defer func() { cfg = oldCfg }()
+	cfg = &config{RPCMaxClients: 3}
+	s := &rpcServer{}
+	limited := &rpcAccess{methods: map[string]struct{}{
+		"validateaddress": {},
+	}}
+
+	// manyRequests returns a batch of the passed number of requests.
+	manyRequests := func(n int) string {
+		requests := make([]string, n)
+		for i := range requests {
+			requests[i] = fmt.Sprintf(`{"method":"nosuchmethod",`+
+				`"params":[],"id":%d}`, i)
+		}
+		return "[" + strings.Join(requests, ",") + "]"
+	}
+	var manyReplies []testBatchReply
+	for i := 0; i < 50; i++ {
+		manyReplies = append(manyReplies, testBatchReply{float64(i), "",
+			btcjson.ErrRPCMethodNotFound.Code})
+	}
+
+	tests := []struct {
+		name   string
+		access *rpcAccess
+		body   string
+		want   []testBatchReply
+		err    btcjson.RPCErrorCode
+	}{
+		{
+			name:   "ordered replies",
+			access: rpcAdminAccess,
+			body: `[{"method":"validateaddress","params":["x"],"id":1},` +
+				`{"method":"nosuchmethod","params":[],"id":"two"},` +
+				`{"method":"help","params":["nosuch"],"id":3},` +
+				`{"method":"validateaddress"},` +
+				`{"method":"validateaddress","params":[],"id":5},` +
+				`42]`,
+			want: []testBatchReply{
+				{float64(1), `{"isvalid":false}`, 0},
+				{"two", "", btcjson.ErrRPCMethodNotFound.Code},
+				{float64(3), "", btcjson.ErrRPCInvalidParameter},
+				{float64(5), "", btcjson.ErrRPCInvalidParams.Code},
+				{nil, "", btcjson.ErrRPCParse.Code},
+			},
+		},
+		{
+			name:   "many requests",
+			access: rpcAdminAccess,
+			body:   manyRequests(50),
+			want:   manyReplies,
+		},
+		{
+			name:   "limited access",
+			access: limited,
+			body: `[{"method":"help","params":[],"id":1},` +
+				`{"method":"validateaddress","params":["x"],"id":2}]`,
+			want: []testBatchReply{
+				{float64(1), "", btcjson.ErrRPCInvalidParams.Code},
+				{float64(2), `{"isvalid":false}`, 0},
+			},
+		},
+		{
+			name:   "only notifications",
+			access: rpcAdminAccess,
+			body: `[{"method":"validateaddress","params":["x"]},` +
+				`{"method":"validateaddress","params":["x"],"id":null}]`,
+		},
+		{
+			name:   "empty",
+			access: rpcAdminAccess,
+			body:   "[]",
+			err:    btcjson.ErrRPCInvalidRequest.Code,
+		},
+		{
+			name:   "oversized",
+			access: rpcAdminAccess,
+			body:   manyRequests(rpcMaxBatchRequests + 1),
+			err:    btcjson.ErrRPCInvalidRequest.Code,
+		},
+		{
+			name:   "malformed",
+			access: rpcAdminAccess,
+			body:   `[{"method":"help"}`,
+			err:    btcjson.ErrRPCParse.Code,
+		},
+	}
+	for _, test := range tests {
+		msg := s.batchReply([]byte(test.body), test.access, nil)
+		if numClients := s.numClients; numClients != 0 {
+			t.Errorf("%s: %d clients left after the batch", test.name,
+				numClients)
+			s.numClients = 0
+		}
+
+		// Batches which are refused have a single error reply.
+		if test.err != 0 {
+			var reply btcjson.Response
+			err := json.Unmarshal(msg, &reply)
+			if err != nil || reply.Error == nil ||
+				reply.Error.Code != test.err {
+
+				t.Errorf("%s: got reply %s, want error %d",
+					test.name, msg, test.err)
+			}
+			continue
+		}
+
+		if test.want == nil {
+			if msg != nil {
+				t.Errorf("%s: got reply %s, want none", test.name,
+					msg)
+			}
+			continue
+		}
+		var replies []btcjson.Response
+		if err := json.Unmarshal(msg, &replies); err != nil {
+			t.Errorf("%s: malformed reply %s: %v", test.name, msg, err)
+			continue
+		}
+		if len(replies) != len(test.want) {
+			t.Errorf("%s: got %d replies, want %d", test.name,
+				len(replies), len(test.want))
+			continue
+		}
+		for i, reply := range replies {
+			want := test.want[i]
+			var id interface{}
+			if reply.ID != nil {
+				id = *reply.ID
+			}
+			var code btcjson.RPCErrorCode
+			if reply.Error != nil {
+				code = reply.Error.Code
+			}
+			result := string(reply.Result)
+			if result == "null" {
+				result = ""
+			}
+			if id != want.id || code != want.code ||
+				result != want.result {
+
+				t.Errorf("%s: reply %d: got id %v, result %q and "+
+					"error %d, want id %v, result %q and "+
+					"error %d", test.name, i, id, result, code,
+					want.id, want.result, want.code)
+			}
+		}
+	}
+}
+
+// TestBatchReplyClientLimit ensures batches only use additional goroutines
+// while there is room for more clients, so they still complete when the
+// maximum number of clients is reached.
+func TestBatchReplyClientLimit(t *testing.T) {
+	oldCfg := cfg
+	defer func() { cfg = oldCfg }()
+	cfg = &config{RPCMaxClients: 2}
+	s := &rpcServer{numClients: 2}
+	body := `[{"method":"validateaddress","params":["x"],"id":1},` +
+		`{"method":"validateaddress","params":["y"],"id":2}]`
+	msg := s.batchReply([]byte(body), rpcAdminAccess, nil)
+	var replies []btcjson.Response
+	if err := json.Unmarshal(msg, &replies); err != nil || len(replies) != 2 {
+		t.Errorf("got reply %s, want 2 replies", msg)
+	}
+	if s.numClients != 2 {
+		t.Errorf("got %d clients, want 2", s.numClients)
+	}
+
+	if s.tryIncrementClients() || s.numClients != 2 {
+		t.Errorf("tryIncrementClients exceeded the client limit")
+	}
+	s.numClients = 1
+	if !s.tryIncrementClients() || s.numClients != 2 {
+		t.Errorf("tryIncrementClients refused a client below the limit")
+	}
+}
+
+// newTestMempoolRPCServer returns an RPC server for the passed memory pool
+// backed by an in-memory database which only holds the genesis block.
+func newTestMempoolRPCServer(t *testing.T, mp *txMemPool) *rpcServer {
+	db, err := database.CreateDB("memdb")
+	if err != nil {
+		t.Fatalf("CreateDB: %v", err)
+	}
+	params := &chaincfg.RegressionNetParams
+	_, err = db.InsertBlock(btcutil.NewBlock(params.GenesisBlock))
+	if err != nil {
+		t.Fatalf("InsertBlock: %v", err)
+	}
+	mp.server.db = db
+	mp.server.blockManager = &blockManager{
+		blockChain: blockchain.New(db, params, nil),
+	}
+	mp.server.txMemPool = mp
+	return &rpcServer{server: mp.server}
+}
+
+// TestHandleGetMempoolEntry ensures getmempoolentry reports the details of a
+// transaction in the memory pool, including its ancestors, descendants and
+// prioritisation, and refuses unknown and malformed transaction ids.
+func TestHandleGetMempoolEntry(t *testing.T) {
+	oldCfg := cfg
+	defer func() { cfg = oldCfg }()
+	cfg = &config{MaxMempool: 300, MempoolExpiry: defaultMempoolExpiry}
+	now := time.Unix(1420070400, 0)
+	mp := newTestMemPool(now)
+	s := newTestMempoolRPCServer(t, mp)
+
+	parent := newTestPoolTx(nil, 1, 100)
+	child := newTestPoolTx(parent, 0, 200)
+	grandchild := newTestPoolTx(child, 0, 300)
+	mp.addTransaction(parent, 1, 10000)
+	mp.addTransaction(child, 2, 20000)
+	mp.addTransaction(grandchild, 3, 40000)
+	mp.PrioritiseTransaction(child.Sha(), 100, 5000)
+	parentSize := int64(parent.MsgTx().SerializeSize())
+	childSize := int64(child.MsgTx().SerializeSize())
+	grandchildSize := int64(grandchild.MsgTx().SerializeSize())
+
+	cmd := &btcjson.GetMempoolEntryCmd{TxID: child.Sha().String()}
+	result, err := handleGetMempoolEntry(s, cmd, nil)
+	if err != nil {
+		t.Fatalf("handleGetMempoolEntry: unexpected error: %v", err)
+	}
+	got := result.(*btcjson.GetRawMempoolVerboseResult)
+	want := &btcjson.GetRawMempoolVerboseResult{
+		Size:             int32(childSize),
+		Fee:              btcutil.Amount(20000).ToBTC(),
+		Time:             now.Unix(),
+		TxTime:           child.MsgTx().Time.Unix(),
+		Height:           2,
+		StartingPriority: got.StartingPriority,
+		CurrentPriority:  got.CurrentPriority,
+		PriorityDelta:    100,
+		FeeDelta:         btcutil.Amount(5000).ToBTC(),
+		DescendantCount:  2,
+		DescendantSize:   childSize + grandchildSize,
+		DescendantFees:   btcutil.Amount(60000).ToBTC(),
+		AncestorCount:    2,
+		AncestorSize:     parentSize + childSize,
+		AncestorFees:     btcutil.Amount(30000).ToBTC(),
+		Depends:          []string{parent.Sha().String()},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got entry %+v, want %+v", got, want)
+	}
+
+	tests := []struct {
+		name string
+		txID string
+		code btcjson.RPCErrorCode
+	}{
+		{"unknown txid", wire.ShaHash{}.String(), btcjson.ErrRPCNoTxInfo},
+		{"malformed txid", "xyz", btcjson.ErrRPCDecodeHexString},
+	}
+	for _, test := range tests {
+		cmd := &btcjson.GetMempoolEntryCmd{TxID: test.txID}
+		_, err := handleGetMempoolEntry(s, cmd, nil)
+		rpcErr, ok := err.(*btcjson.RPCError)
+		if !ok || rpcErr.Code != test.code {
+			t.Errorf("%s: got error %v, want code %d", test.name,
+				err, test.code)
+		}
+	}
+}
+
+// TestHandleGetMempoolInfo ensures getmempoolinfo reports the size, memory
+// usage, limits, fee rates, orphans and evictions of the memory pool.
+func TestHandleGetMempoolInfo(t *testing.T) {
+	oldCfg := cfg
+	defer func() { cfg = oldCfg }()
+	cfg = &config{MaxMempool: 300, MempoolExpiry: defaultMempoolExpiry}
+	mp := newTestMemPool(time.Unix(1420070400, 0))
+	s := &rpcServer{server: &server{txMemPool: mp}}
+
+	checkInfo := func(name string, want *btcjson.GetMempoolInfoResult) {
+		result, err := handleGetMempoolInfo(s, nil, nil)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", name, err)
+			return
+		}
+		got := result.(*btcjson.GetMempoolInfoResult)
+		if got.Usage < got.Bytes {
+			t.Errorf("%s: got usage %d below size %d", name,
+				got.Usage, got.Bytes)
+		}
+		want.Usage = got.Usage
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: got %+v, want %+v", name, got, want)
+		}
+	}
+
+	minRelayFee := btcutil.Amount(minRelayFeeRate()).ToBTC()
+	checkInfo("empty", &btcjson.GetMempoolInfoResult{
+		MaxMempool:    300000000,
+		MempoolMinFee: minRelayFee,
+		MinRelayTxFee: minRelayFee,
+	})
+
+	parent := newTestPoolTx(nil, 1, 100)
+	child := newTestPoolTx(parent, 0, 200)
+	mp.addTransaction(parent, 1, 10000)
+	mp.addTransaction(child, 1, 20000)
+	orphan := newTestPoolTx(nil, 2, 100)
+	mp.orphans[*orphan.Sha()] = orphan
+	lastEvicted := time.Unix(1420070300, 0)
+	mp.numEvicted = 3
+	mp.evictedBytes = 600
+	mp.lastEvicted = lastEvicted
+	checkInfo("filled", &btcjson.GetMempoolInfoResult{
+		Size: 2,
+		Bytes: int64(parent.MsgTx().SerializeSize() +
+			child.MsgTx().SerializeSize()),
+		MaxMempool:    300000000,
+		MempoolMinFee: minRelayFee,
+		MinRelayTxFee: minRelayFee,
+		Orphans:       1,
+		Evicted:       3,
+		EvictedBytes:  600,
+		LastEvicted:   lastEvicted.Unix(),
+	})
+}
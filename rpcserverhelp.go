@@ -20,7 +20,8 @@ var helpDescsEnUS = map[string]string{
 		"The levelspec can either a debug level or of the form:\n" +
 		"<subsystem>=<level>,<subsystem2>=<level2>,...\n" +
 		"The valid debug levels are trace, debug, info, warn, error, and critical.\n" +
-		"The valid subsystems are AMGR, ADXR, BCDB, BMGR, BTCD, CHAN, DISC, PEER, RPCS, SCRP, SRVR, and TXMP.\n" +
+		"The valid subsystems are AMGR, ADXR, BCDB, BMGR, BTCD, CHAN, DISC, PEER, RPCS, SCRP, SRVR, TXMP, and ZMQP.\n" +
+		"The levels are saved and restored when the server is restarted unless the debuglevel option is set to anything but info.\n" +
 		"Finally the keyword 'show' will return a list of the available subsystems.",
 	"debuglevel-levelspec":   "The debug level(s) to use or the keyword 'show'",
 	"debuglevel--condition0": "levelspec!=show",
@@ -105,6 +106,13 @@ var helpDescsEnUS = map[string]string{
 	"generate-numblocks": "Number of blocks to generate",
 	"generate--result0":  "The hashes, in order, of blocks generated by the call",
 
+	// GeneratePoSCmd help
+	"generatepos--synopsis": "Mints a set number of proof-of-stake blocks from the outputs of the keys specified via --testkey\n" +
+		" (simnet or regtest only) and returns a JSON array of their hashes.\n" +
+		"The time is advanced by the stake target spacing before each block.",
+	"generatepos-numblocks": "Number of blocks to mint",
+	"generatepos--result0":  "The hashes, in order, of blocks minted by the call",
+
 	// GetAddedNodeInfoResultAddr help.
 	"getaddednodeinforesultaddr-address":   "The ip address for this DNS entry",
 	"getaddednodeinforesultaddr-connected": "The connection 'direction' (inbound/outbound/false)",
@@ -175,13 +183,38 @@ var helpDescsEnUS = map[string]string{
 	"getblockcount--synopsis": "Returns the number of blocks in the longest block chain.",
 	"getblockcount--result0":  "The current block count",
 
+	// BlockDownloadPeerResult help.
+	"blockdownloadpeerresult-id":           "A unique node ID",
+	"blockdownloadpeerresult-addr":         "The ip address and port of the peer",
+	"blockdownloadpeerresult-inflight":     "Number of blocks currently requested from the peer",
+	"blockdownloadpeerresult-received":     "Total number of blocks received from the peer",
+	"blockdownloadpeerresult-stalls":       "Number of times the peer stalled and had its requests reassigned",
+	"blockdownloadpeerresult-lastprogress": "Time the peer last delivered a requested block, or was first asked for one, in seconds since 1 Jan 1970 GMT",
+
+	// GetBlockDownloadInfoResult help.
+	"getblockdownloadinforesult-headersfirst":       "Whether or not blocks are currently being downloaded in parallel in headers-first mode",
+	"getblockdownloadinforesult-syncpeer":           "The ip address and port of the sync peer headers are downloaded from",
+	"getblockdownloadinforesult-maxinflightperpeer": "Maximum number of blocks requested from a single peer at once",
+	"getblockdownloadinforesult-inflight":           "Number of blocks currently requested",
+	"getblockdownloadinforesult-buffered":           "Number of blocks received ahead of order which are waiting to be processed",
+	"getblockdownloadinforesult-reassigning":        "Number of blocks waiting to be requested from another peer",
+	"getblockdownloadinforesult-requested":          "Total number of blocks requested",
+	"getblockdownloadinforesult-received":           "Total number of requested blocks received",
+	"getblockdownloadinforesult-duplicates":         "Total number of blocks which were received more than once due to being reassigned",
+	"getblockdownloadinforesult-stalls":             "Total number of times a peer stalled",
+	"getblockdownloadinforesult-reassigned":         "Total number of blocks reassigned to another peer",
+	"getblockdownloadinforesult-peers":              "Download state of each peer blocks are downloaded from",
+
+	// GetBlockDownloadInfoCmd help.
+	"getblockdownloadinfo--synopsis": "Returns statistics about the blocks being downloaded in parallel from multiple peers during the initial sync.",
+
 	// GetBlockHashCmd help.
 	"getblockhash--synopsis": "Returns hash of the block in best block chain at the given height.",
 	"getblockhash-index":     "The block height",
 	"getblockhash--result0":  "The block hash",
 
 	// TemplateRequest help.
-	"templaterequest-mode":         "This is 'template', 'proposal', or omitted",
+	"templaterequest-mode":         "This is 'template', 'proposal', 'pos', or omitted",
 	"templaterequest-capabilities": "List of capabilities",
 	"templaterequest-longpollid":   "The long poll ID of a job to monitor for expiration; required and valid only for long poll requests ",
 	"templaterequest-sigoplimit":   "Number of signature operations allowed in blocks (this parameter is ignored)",
@@ -190,6 +223,7 @@ var helpDescsEnUS = map[string]string{
 	"templaterequest-target":       "The desired target for the block template (this parameter is ignored)",
 	"templaterequest-data":         "Hex-encoded block data (only for mode=proposal)",
 	"templaterequest-workid":       "The server provided workid if provided in block template (not applicable)",
+	"templaterequest-coinstake":    "Hex-encoded signed coinstake transaction (only for mode=pos)",
 
 	// GetBlockTemplateResultTx help.
 	"getblocktemplateresulttx-data":    "Hex-encoded transaction data (byte-for-byte)",
@@ -223,14 +257,16 @@ var helpDescsEnUS = map[string]string{
 	"getblocktemplateresult-mintime":           "Minimum allowed time",
 	"getblocktemplateresult-mutable":           "List of mutations the server explicitly allows",
 	"getblocktemplateresult-noncerange":        "Two concatenated hex-encoded big-endian 32-bit integers which represent the valid ranges of nonces the miner may scan",
-	"getblocktemplateresult-capabilities":      "List of server capabilities including 'proposal' to indicate support for block proposals",
+	"getblocktemplateresult-capabilities":      "List of server capabilities including 'proposal' to indicate support for block proposals and 'pos' to indicate support for proof-of-stake templates",
 	"getblocktemplateresult-reject-reason":     "Reason the proposal was invalid as-is (only applies to proposal responses)",
+	"getblocktemplateresult-coinstakereward":   "Maximum reward in satoshi the coinstake may claim (only for mode=pos)",
+	"getblocktemplateresult-signaturepubkey":   "Hex-encoded public key the block must be signed with (only for mode=pos)",
 
 	// GetBlockTemplateCmd help.
 	"getblocktemplate--synopsis": "Returns a JSON object with information necessary to construct a block to mine or accepts a proposal to validate.\n" +
 		"See BIP0022 and BIP0023 for the full specification.",
 	"getblocktemplate-request":     "Request object which controls the mode and several parameters",
-	"getblocktemplate--condition0": "mode=template",
+	"getblocktemplate--condition0": "mode=template or mode=pos",
 	"getblocktemplate--condition1": "mode=proposal, rejected",
 	"getblocktemplate--condition2": "mode=proposal, accepted",
 	"getblocktemplate--result1":    "An error string which represents why the proposal was rejected or nothing if accepted",
@@ -288,6 +324,41 @@ var helpDescsEnUS = map[string]string{
 	// GetInfoCmd help.
 	"getinfo--synopsis": "Returns a JSON object containing various state info.",
 
+	// GetMempoolAncestorsCmd help.
+	"getmempoolancestors--synopsis":   "Returns all in-pool ancestors of a transaction in the memory pool.",
+	"getmempoolancestors-txid":        "The hash of the transaction",
+	"getmempoolancestors-verbose":     "Returns JSON object when true or an array of transaction hashes when false",
+	"getmempoolancestors--condition0": "verbose=false",
+	"getmempoolancestors--condition1": "verbose=true",
+	"getmempoolancestors--result0":    "Array of transaction hashes",
+
+	// GetMempoolDescendantsCmd help.
+	"getmempooldescendants--synopsis":   "Returns all in-pool descendants of a transaction in the memory pool.",
+	"getmempooldescendants-txid":        "The hash of the transaction",
+	"getmempooldescendants-verbose":     "Returns JSON object when true or an array of transaction hashes when false",
+	"getmempooldescendants--condition0": "verbose=false",
+	"getmempooldescendants--condition1": "verbose=true",
+	"getmempooldescendants--result0":    "Array of transaction hashes",
+
+	// GetMempoolEntryCmd help.
+	"getmempoolentry--synopsis": "Returns information about a transaction in the memory pool.",
+	"getmempoolentry-txid":      "The hash of the transaction",
+
+	// GetMempoolInfoCmd help.
+	"getmempoolinfo--synopsis": "Returns a JSON object containing information about the memory pool and the transactions evicted to keep it within its size limit.",
+
+	// GetMempoolInfoResult help.
+	"getmempoolinforesult-size":          "Number of transactions in the memory pool",
+	"getmempoolinforesult-bytes":         "Total serialized size in bytes of the transactions in the memory pool",
+	"getmempoolinforesult-usage":         "Approximate total memory usage in bytes of the transactions in the memory pool",
+	"getmempoolinforesult-maxmempool":    "Maximum size in bytes of the memory pool",
+	"getmempoolinforesult-mempoolminfee": "Minimum fee in BTC/KB for a transaction to be accepted into the memory pool",
+	"getmempoolinforesult-minrelaytxfee": "Minimum fee in BTC/KB for a transaction to be relayed, charged per started kilobyte",
+	"getmempoolinforesult-orphans":       "Number of orphan transactions",
+	"getmempoolinforesult-evicted":       "Number of transactions evicted from the full memory pool",
+	"getmempoolinforesult-evictedbytes":  "Total serialized size in bytes of the evicted transactions",
+	"getmempoolinforesult-lastevicted":   "The time in seconds since 1 Jan 1970 GMT a transaction was last evicted, or 0 if none has been",
+
 	// GetMiningInfoResult help.
 	"getmininginforesult-blocks":           "Height of the latest best block",
 	"getmininginforesult-currentblocksize": "Size of the latest best block",
@@ -346,9 +417,18 @@ var helpDescsEnUS = map[string]string{
 	"getrawmempoolverboseresult-size":             "Transaction size in bytes",
 	"getrawmempoolverboseresult-fee":              "Transaction fee in bitcoins",
 	"getrawmempoolverboseresult-time":             "Local time transaction entered pool in seconds since 1 Jan 1970 GMT",
+	"getrawmempoolverboseresult-txtime":           "The transaction timestamp in seconds since 1 Jan 1970 GMT",
 	"getrawmempoolverboseresult-height":           "Block height when transaction entered the pool",
 	"getrawmempoolverboseresult-startingpriority": "Priority when transaction entered the pool",
 	"getrawmempoolverboseresult-currentpriority":  "Current priority",
+	"getrawmempoolverboseresult-prioritydelta":    "Priority delta set by prioritisetransaction",
+	"getrawmempoolverboseresult-feedelta":         "Fee delta in bitcoins set by prioritisetransaction",
+	"getrawmempoolverboseresult-descendantcount":  "Number of in-pool descendant transactions (including this one)",
+	"getrawmempoolverboseresult-descendantsize":   "Size in bytes of in-pool descendants (including this one)",
+	"getrawmempoolverboseresult-descendantfees":   "Fees in bitcoins of in-pool descendants (including this one)",
+	"getrawmempoolverboseresult-ancestorcount":    "Number of in-pool ancestor transactions (including this one)",
+	"getrawmempoolverboseresult-ancestorsize":     "Size in bytes of in-pool ancestors (including this one)",
+	"getrawmempoolverboseresult-ancestorfees":     "Fees in bitcoins of in-pool ancestors (including this one)",
 	"getrawmempoolverboseresult-depends":          "Unconfirmed transactions used as inputs for this transaction",
 
 	// GetRawMempoolCmd help.
@@ -405,6 +485,15 @@ var helpDescsEnUS = map[string]string{
 	"ping--synopsis": "Queues a ping to be sent to each connected peer.\n" +
 		"Ping times are provided by getpeerinfo via the pingtime and pingwait fields.",
 
+	// PrioritiseTransactionCmd help.
+	"prioritisetransaction--synopsis": "Adjusts the priority and fee of a transaction used when selecting transactions for new block templates.\n" +
+		"The deltas accumulate over multiple calls and are cleared once the transaction is mined.\n" +
+		"They only affect transaction selection and do not change the fee the transaction actually pays.",
+	"prioritisetransaction-txid":          "The hash of the transaction to prioritise",
+	"prioritisetransaction-prioritydelta": "The amount to add to the priority of the transaction",
+	"prioritisetransaction-feedelta":      "The amount in Satoshi to add to the fee of the transaction (may be negative)",
+	"prioritisetransaction--result0":      "Always true",
+
 	// SearchRawTransactionsCmd help.
 	"searchrawtransactions--synopsis": "Returns raw data for transactions involving the passed address.\n" +
 		"Returned transactions are pulled from both the database, and transactions currently in the mempool.\n" +
@@ -425,6 +514,11 @@ var helpDescsEnUS = map[string]string{
 	"sendrawtransaction-allowhighfees": "Whether or not to allow insanely high fees (btcd does not yet implement this parameter, so it has no effect)",
 	"sendrawtransaction--result0":      "The hash of the transaction",
 
+	// SetMockTimeCmd help.
+	"setmocktime--synopsis": "Sets the local time of the server to a fixed time (simnet or regtest only).\n" +
+		"The time stays fixed until it is set again, except that generating blocks advances it.",
+	"setmocktime-timestamp": "The time in seconds since 1 Jan 1970 GMT, or 0 to follow the system time again",
+
 	// SetGenerateCmd help.
 	"setgenerate--synopsis":    "Set the server to generate coins (mine) or not.",
 	"setgenerate-generate":     "Use true to enable generation, false to disable it",
@@ -472,14 +566,46 @@ var helpDescsEnUS = map[string]string{
 
 	// -------- Websocket-specific help --------
 
+	// NotifyAlertsCmd help.
+	"notifyalerts--synopsis": "Request an alert notification whenever a network alert signed with the network alert key is accepted or cancelled.",
+
+	// StopNotifyAlertsCmd help.
+	"stopnotifyalerts--synopsis": "Cancel registered notifications for whenever a network alert is accepted or cancelled.",
+
 	// NotifyBlocksCmd help.
 	"notifyblocks--synopsis": "Request notifications for whenever a block is connected or disconnected from the main (best) chain.",
+	"notifyblocks-verbose":   "Specifies which type of notification to receive. If verbose is true, then the caller receives blockconnectedverbose and blockdisconnectedverbose along with chainreorganized after a reorganization, otherwise the caller receives blockconnected and blockdisconnected",
+
+	// NotifyStakeEventsCmd help.
+	"notifystakeevents--synopsis": "Request notifications for whenever a block connected to the main (best) chain generates a new stake modifier or changes the proof-of-work or proof-of-stake difficulty.\n" +
+		"The notifications are sent as stakemodifier and difficultychanged.\n" +
+		"Additionally, a coinstakespent notification is sent whenever the coinstake of a block connected to the main chain spends one of the passed outpoints.",
+	"notifystakeevents-outpoints": "List of transaction outpoints to monitor for being spent by a coinstake",
+
+	// StopNotifyStakeEventsCmd help.
+	"stopnotifystakeevents--synopsis": "Cancel registered notifications for proof-of-stake events along with the monitored outpoints.",
+
+	// NotifyTemplatesCmd help.
+	"notifytemplates--synopsis": "Request a templatechanged notification whenever the block template returned by getblocktemplate changed since the last notification.\n" +
+		"This is the case when the main (best) chain has a new tip, the proof-of-work target difficulty of the template or the proof-of-stake target difficulty of the next block changed, or the fees of the transactions in the template increased by at least the --templatefeedelta option.\n" +
+		"The notification contains the ID of the new template, which is also its long poll ID, and the reason of the change.",
+	"notifytemplates-verbose": "Specifies whether the notifications include the full block template, as returned by getblocktemplate without capabilities",
+
+	// StopNotifyTemplatesCmd help.
+	"stopnotifytemplates--synopsis": "Cancel registered notifications for whenever the block template changed.",
 
 	// StopNotifyBlocksCmd help.
 	"stopnotifyblocks--synopsis": "Cancel registered notifications for whenever a block is connected or disconnected from the main (best) chain.",
 
+	// NotifyMempoolRemovalsCmd help.
+	"notifymempoolremovals--synopsis": "Send a txremoved notification whenever a transaction is removed from the mempool along with the reason it was removed: " +
+		"mined, doublespent (spends the same output as a transaction in a connected block), evicted, expired, reorg (depends on a transaction from a disconnected block which could not be added back), or replaced.",
+
+	// StopNotifyMempoolRemovalsCmd help.
+	"stopnotifymempoolremovals--synopsis": "Stop sending txremoved notifications when transactions are removed from the mempool.",
+
 	// NotifyNewTransactionsCmd help.
-	"notifynewtransactions--synopsis": "Send either a txaccepted or a txacceptedverbose notification when a new transaction is accepted into the mempool.",
+	"notifynewtransactions--synopsis": "Send either a txaccepted or a txacceptedverbose notification when a new transaction is accepted into the mempool and a txreplaced notification when a transaction is removed from the mempool since it was replaced.",
 	"notifynewtransactions-verbose":   "Specifies which type of notification to receive. If verbose is true, then the caller receives txacceptedverbose, otherwise the caller receives txaccepted",
 
 	// StopNotifyNewTransactionsCmd help.
@@ -516,6 +642,10 @@ var helpDescsEnUS = map[string]string{
 	"rescan-outpoints":  "List of transaction outpoints to include in the rescan",
 	"rescan-endblock":   "Hash of final block to rescan",
 
+	// StopRescanCmd help.
+	"stoprescan--synopsis": "Stop the running rescan of the client, which then returns a rescan stopped error.\n" +
+		"Rescans queued after the running rescan are not affected.",
+
 	// ppc:
 	"getkernelstakemodifier--synopsis":              "TODO(mably)",
 	"getkernelstakemodifier-verbose":                "TODO(mably)",
@@ -528,6 +658,15 @@ var helpDescsEnUS = map[string]string{
 	"nextrequiredtargetresult-target":               "TODO(mably)",
 	"getlastproofofworkreward--synopsis":            "TODO(mably)",
 	"sendcoinstaketransactioncmd-hextx":             "TODO(mably)",
+
+	// GetStakeSeenInfoCmd help.
+	"getstakeseeninfo--synopsis":             "Returns statistics about the proof-of-stake kernels tracked to reject blocks, including orphans, which reuse a kernel that was already seen.",
+	"getstakeseeninforesult-mainchain":       "The number of tracked kernels of main chain blocks",
+	"getstakeseeninforesult-maxmainchain":    "The maximum number of tracked kernels of main chain blocks",
+	"getstakeseeninforesult-orphans":         "The number of tracked kernels of orphan blocks",
+	"getstakeseeninforesult-maxorphans":      "The maximum number of tracked kernels of orphan blocks",
+	"getstakeseeninforesult-rejected":        "The number of blocks rejected for reusing a kernel of a main chain block",
+	"getstakeseeninforesult-rejectedorphans": "The number of orphan blocks rejected for reusing a kernel of another orphan block",
 }
 
 // rpcResultTypes specifies the result types that each RPC command can return.
@@ -540,11 +679,13 @@ var rpcResultTypes = map[string][]interface{}{
 	"decoderawtransaction":  []interface{}{(*btcjson.TxRawDecodeResult)(nil)},
 	"decodescript":          []interface{}{(*btcjson.DecodeScriptResult)(nil)},
 	"generate":              []interface{}{(*[]string)(nil)},
+	"generatepos":           []interface{}{(*[]string)(nil)},
 	"getaddednodeinfo":      []interface{}{(*[]string)(nil), (*[]btcjson.GetAddedNodeInfoResult)(nil)},
 	"getbestblock":          []interface{}{(*btcjson.GetBestBlockResult)(nil)},
 	"getbestblockhash":      []interface{}{(*string)(nil)},
 	"getblock":              []interface{}{(*string)(nil), (*btcjson.GetBlockVerboseResult)(nil)},
 	"getblockcount":         []interface{}{(*int64)(nil)},
+	"getblockdownloadinfo":  []interface{}{(*btcjson.GetBlockDownloadInfoResult)(nil)},
 	"getblockhash":          []interface{}{(*string)(nil)},
 	"getblocktemplate":      []interface{}{(*btcjson.GetBlockTemplateResult)(nil), (*string)(nil), nil},
 	"getconnectioncount":    []interface{}{(*int32)(nil)},
@@ -553,6 +694,10 @@ var rpcResultTypes = map[string][]interface{}{
 	"getgenerate":           []interface{}{(*bool)(nil)},
 	"gethashespersec":       []interface{}{(*float64)(nil)},
 	"getinfo":               []interface{}{(*btcjson.InfoChainResult)(nil)},
+	"getmempoolancestors":   []interface{}{(*[]string)(nil), (*btcjson.GetRawMempoolVerboseResult)(nil)},
+	"getmempooldescendants": []interface{}{(*[]string)(nil), (*btcjson.GetRawMempoolVerboseResult)(nil)},
+	"getmempoolentry":       []interface{}{(*btcjson.GetRawMempoolVerboseResult)(nil)},
+	"getmempoolinfo":        []interface{}{(*btcjson.GetMempoolInfoResult)(nil)},
 	"getmininginfo":         []interface{}{(*btcjson.GetMiningInfoResult)(nil)},
 	"getnettotals":          []interface{}{(*btcjson.GetNetTotalsResult)(nil)},
 	"getnetworkhashps":      []interface{}{(*int64)(nil)},
@@ -564,9 +709,11 @@ var rpcResultTypes = map[string][]interface{}{
 	"node":                  nil,
 	"help":                  []interface{}{(*string)(nil), (*string)(nil)},
 	"ping":                  nil,
+	"prioritisetransaction": []interface{}{(*bool)(nil)},
 	"searchrawtransactions": []interface{}{(*string)(nil), (*[]btcjson.TxRawResult)(nil)},
 	"sendrawtransaction":    []interface{}{(*string)(nil)},
 	"setgenerate":           nil,
+	"setmocktime":           nil,
 	"stop":                  []interface{}{(*string)(nil)},
 	"submitblock":           []interface{}{nil, (*string)(nil)},
 	"validateaddress":       []interface{}{(*btcjson.ValidateAddressChainResult)(nil)},
@@ -574,8 +721,16 @@ var rpcResultTypes = map[string][]interface{}{
 	"verifymessage":         []interface{}{(*bool)(nil)},
 
 	// Websocket commands.
+	"notifyalerts":              nil,
+	"stopnotifyalerts":          nil,
 	"notifyblocks":              nil,
 	"stopnotifyblocks":          nil,
+	"notifystakeevents":         nil,
+	"stopnotifystakeevents":     nil,
+	"notifytemplates":           nil,
+	"stopnotifytemplates":       nil,
+	"notifymempoolremovals":     nil,
+	"stopnotifymempoolremovals": nil,
 	"notifynewtransactions":     nil,
 	"stopnotifynewtransactions": nil,
 	"notifyreceived":            nil,
@@ -583,11 +738,13 @@ var rpcResultTypes = map[string][]interface{}{
 	"notifyspent":               nil,
 	"stopnotifyspent":           nil,
 	"rescan":                    nil,
+	"stoprescan":                nil,
 
 	// ppc:
 	"getkernelstakemodifier":   []interface{}{(*btcjson.KernelStakeModifierResult)(nil)},
 	"getnextrequiredtarget":    []interface{}{(*btcjson.NextRequiredTargetResult)(nil)},
 	"getlastproofofworkreward": []interface{}{(*btcjson.GetLastProofOfWorkRewardCmd)(nil)},
+	"getstakeseeninfo":         []interface{}{(*btcjson.GetStakeSeenInfoResult)(nil)},
 	"sendcoinstaketransaction": []interface{}{(*btcjson.SendCoinStakeTransactionCmd)(nil)},
 	"sendmintblocksignature":   []interface{}{(*btcjson.SendMintBlockSignatureCmd)(nil)},
 }
@@ -14,6 +14,8 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"math"
+	"strconv"
 	"sync"
 	"time"
 
@@ -21,6 +23,7 @@ import (
 	"github.com/btcsuite/golangcrypto/ripemd160"
 	"github.com/btcsuite/websocket"
 	"github.com/ppcsuite/btcutil"
+	"github.com/ppcsuite/ppcd/blockchain"
 	"github.com/ppcsuite/ppcd/btcjson"
 	"github.com/ppcsuite/ppcd/database"
 	"github.com/ppcsuite/ppcd/txscript"
@@ -50,15 +53,24 @@ type wsCommandHandler func(*wsClient, interface{}) (interface{}, error)
 var wsHandlers map[string]wsCommandHandler
 var wsHandlersBeforeInit = map[string]wsCommandHandler{
 	"help":                      handleWebsocketHelp,
+	"notifyalerts":              handleNotifyAlerts,
 	"notifyblocks":              handleNotifyBlocks,
+	"notifymempoolremovals":     handleNotifyMempoolRemovals,
 	"notifynewtransactions":     handleNotifyNewTransactions,
 	"notifyreceived":            handleNotifyReceived,
 	"notifyspent":               handleNotifySpent,
+	"notifystakeevents":         handleNotifyStakeEvents,
+	"notifytemplates":           handleNotifyTemplates,
+	"stopnotifyalerts":          handleStopNotifyAlerts,
 	"stopnotifyblocks":          handleStopNotifyBlocks,
+	"stopnotifymempoolremovals": handleStopNotifyMempoolRemovals,
 	"stopnotifynewtransactions": handleStopNotifyNewTransactions,
 	"stopnotifyspent":           handleStopNotifySpent,
+	"stopnotifystakeevents":     handleStopNotifyStakeEvents,
+	"stopnotifytemplates":       handleStopNotifyTemplates,
 	"stopnotifyreceived":        handleStopNotifyReceived,
 	"rescan":                    handleRescan,
+	"stoprescan":                handleStopRescan,
 }
 
 // wsAsyncHandlers holds the websocket commands which should be run
@@ -75,7 +87,7 @@ var wsAsyncHandlers = map[string]struct{}{
 // server handler which runs each new connection in a new goroutine thereby
 // satisfying the requirement.
 func (s *rpcServer) WebsocketHandler(conn *websocket.Conn, remoteAddr string,
-	authenticated bool, isAdmin bool) {
+	authenticated bool, access *rpcAccess) {
 
 	// Clear the read deadline that was set before the websocket hijacked
 	// the connection.
@@ -94,7 +106,7 @@ func (s *rpcServer) WebsocketHandler(conn *websocket.Conn, remoteAddr string,
 	// Create a new websocket client to handle the new websocket connection
 	// and wait for it to shutdown.  Once it has shutdown (and hence
 	// disconnected), remove it and any notifications it registered for.
-	client := newWebsocketClient(s, conn, remoteAddr, authenticated, isAdmin)
+	client := newWebsocketClient(s, conn, remoteAddr, authenticated, access)
 	s.ntfnMgr.AddClient(client)
 	client.Start()
 	client.WaitForShutdown()
@@ -125,6 +137,11 @@ type wsNotificationManager struct {
 	// Access channel for current number of connected clients.
 	numClients chan int
 
+	// templateUpdates feeds templateHandler with the websocket clients to
+	// notify of block template updates.  It holds at most the latest
+	// request so generating templates never holds up other notifications.
+	templateUpdates chan map[chan struct{}]*wsClient
+
 	// Shutdown handling
 	wg   sync.WaitGroup
 	quit chan struct{}
@@ -212,6 +229,20 @@ func (m *wsNotificationManager) NotifyBlockDisconnected(block *btcutil.Block) {
 	}
 }
 
+// NotifyChainReorganized passes the blocks disconnected and connected by a
+// reorganization of the best chain to the notification manager for block
+// notification processing.
+func (m *wsNotificationManager) NotifyChainReorganized(data *blockchain.ReorganizationNtfnsData) {
+	// As NotifyChainReorganized will be called by the block manager
+	// and the RPC server may no longer be running, use a select
+	// statement to unblock enqueueing the notification once the RPC
+	// server has begun shutting down.
+	select {
+	case m.queueNotification <- (*notificationChainReorganized)(data):
+	case <-m.quit:
+	}
+}
+
 // NotifyMempoolTx passes a transaction accepted by mempool to the
 // notification manager for transaction notification processing.  If
 // isNew is true, the tx is is a new transaction, rather than one
@@ -232,21 +263,103 @@ func (m *wsNotificationManager) NotifyMempoolTx(tx *btcutil.Tx, isNew bool) {
 	}
 }
 
+// NotifyMempoolTxReplaced passes a transaction which was removed from the
+// mempool since it, or a transaction it depends on, was replaced by the passed
+// conflicting transaction to the notification manager for transaction
+// notification processing.
+func (m *wsNotificationManager) NotifyMempoolTxReplaced(tx, replacedBy *btcutil.Tx) {
+	n := &notificationTxReplacedInMempool{
+		tx:         tx,
+		replacedBy: replacedBy,
+	}
+
+	// As NotifyMempoolTxReplaced will be called by mempool and the RPC
+	// server may no longer be running, use a select statement to unblock
+	// enqueueing the notification once the RPC server has begun shutting
+	// down.
+	select {
+	case m.queueNotification <- n:
+	case <-m.quit:
+	}
+}
+
+// NotifyMempoolTxRemoved passes a transaction removed from the mempool for the
+// passed reason to the notification manager for removal notification
+// processing.
+func (m *wsNotificationManager) NotifyMempoolTxRemoved(tx *btcutil.Tx, reason txRemovalReason) {
+	n := &notificationTxRemovedFromMempool{
+		tx:     tx,
+		reason: reason,
+	}
+
+	// As NotifyMempoolTxRemoved will be called by mempool and the RPC
+	// server may no longer be running, use a select statement to unblock
+	// enqueueing the notification once the RPC server has begun shutting
+	// down.
+	select {
+	case m.queueNotification <- n:
+	case <-m.quit:
+	}
+}
+
+// NotifyAlert passes an alert which was newly accepted, or cancelled by
+// another alert, to the notification manager for alert notification
+// processing.
+func (m *wsNotificationManager) NotifyAlert(alert *wire.Alert, cancelled bool) {
+	n := &notificationAlert{
+		alert:     alert,
+		cancelled: cancelled,
+	}
+
+	// As NotifyAlert will be called by the alert manager and the RPC
+	// server may no longer be running, use a select statement to unblock
+	// enqueueing the notification once the RPC server has begun shutting
+	// down.
+	select {
+	case m.queueNotification <- n:
+	case <-m.quit:
+	}
+}
+
 // Notification types
 type notificationBlockConnected btcutil.Block
 type notificationBlockDisconnected btcutil.Block
+type notificationChainReorganized blockchain.ReorganizationNtfnsData
 type notificationTxAcceptedByMempool struct {
 	isNew bool
 	tx    *btcutil.Tx
 }
+type notificationTxReplacedInMempool struct {
+	tx         *btcutil.Tx
+	replacedBy *btcutil.Tx
+}
+type notificationTxRemovedFromMempool struct {
+	tx     *btcutil.Tx
+	reason txRemovalReason
+}
+type notificationAlert struct {
+	alert     *wire.Alert
+	cancelled bool
+}
 
 // Notification control requests
 type notificationRegisterClient wsClient
 type notificationUnregisterClient wsClient
 type notificationRegisterBlocks wsClient
 type notificationUnregisterBlocks wsClient
+type notificationRegisterAlerts wsClient
+type notificationUnregisterAlerts wsClient
 type notificationRegisterNewMempoolTxs wsClient
 type notificationUnregisterNewMempoolTxs wsClient
+type notificationRegisterMempoolRemovals wsClient
+type notificationUnregisterMempoolRemovals wsClient
+type notificationRegisterStakeEvents struct {
+	wsc *wsClient
+	ops []*wire.OutPoint
+}
+type notificationUnregisterStakeEvents wsClient
+type notificationRegisterTemplates wsClient
+type notificationUnregisterTemplates wsClient
 type notificationRegisterSpent struct {
 	wsc *wsClient
 	ops []*wire.OutPoint
@@ -279,6 +392,10 @@ func (m *wsNotificationManager) notificationHandler() {
 	// since it is quite a bit more efficient than using the entire struct.
 	blockNotifications := make(map[chan struct{}]*wsClient)
 	txNotifications := make(map[chan struct{}]*wsClient)
+	alertNotifications := make(map[chan struct{}]*wsClient)
+	removalNotifications := make(map[chan struct{}]*wsClient)
+	stakeNotifications := make(map[chan struct{}]*wsClient)
+	templateNotifications := make(map[chan struct{}]*wsClient)
 	watchedOutPoints := make(map[wire.OutPoint]map[chan struct{}]*wsClient)
 	watchedAddrs := make(map[string]map[chan struct{}]*wsClient)
 
@@ -297,6 +414,13 @@ out:
 					m.notifyBlockConnected(blockNotifications,
 						block)
 				}
+				if len(stakeNotifications) != 0 {
+					m.notifyStakeEvents(stakeNotifications,
+						block)
+				}
+				if len(templateNotifications) != 0 {
+					m.queueTemplateUpdate(templateNotifications)
+				}
 
 				// Skip iterating through all txs if no
 				// tx notification requests exist.
@@ -313,11 +437,30 @@ out:
 				m.notifyBlockDisconnected(blockNotifications,
 					(*btcutil.Block)(n))
 
+			case *notificationChainReorganized:
+				m.notifyChainReorganized(blockNotifications,
+					(*blockchain.ReorganizationNtfnsData)(n))
+
 			case *notificationTxAcceptedByMempool:
 				if n.isNew && len(txNotifications) != 0 {
 					m.notifyForNewTx(txNotifications, n.tx)
 				}
 				m.notifyForTx(watchedOutPoints, watchedAddrs, n.tx, nil)
+				if len(templateNotifications) != 0 {
+					m.queueTemplateUpdate(templateNotifications)
+				}
+
+			case *notificationTxReplacedInMempool:
+				m.notifyTxReplaced(txNotifications, n.tx,
+					n.replacedBy)
+
+			case *notificationTxRemovedFromMempool:
+				m.notifyTxRemoved(removalNotifications, n.tx,
+					n.reason)
+
+			case *notificationAlert:
+				m.notifyAlert(alertNotifications, n.alert,
+					n.cancelled)
 
 			case *notificationRegisterBlocks:
 				wsc := (*wsClient)(n)
@@ -327,6 +470,14 @@ out:
 				wsc := (*wsClient)(n)
 				delete(blockNotifications, wsc.quit)
 
+			case *notificationRegisterAlerts:
+				wsc := (*wsClient)(n)
+				alertNotifications[wsc.quit] = wsc
+
+			case *notificationUnregisterAlerts:
+				wsc := (*wsClient)(n)
+				delete(alertNotifications, wsc.quit)
+
 			case *notificationRegisterClient:
 				wsc := (*wsClient)(n)
 				clients[wsc.quit] = wsc
@@ -337,6 +488,10 @@ out:
 				// the client itself.
 				delete(blockNotifications, wsc.quit)
 				delete(txNotifications, wsc.quit)
+				delete(alertNotifications, wsc.quit)
+				delete(removalNotifications, wsc.quit)
+				delete(stakeNotifications, wsc.quit)
+				delete(templateNotifications, wsc.quit)
 				for k := range wsc.spentRequests {
 					op := k
 					m.removeSpentRequest(watchedOutPoints, wsc, &op)
@@ -366,6 +521,33 @@ out:
 				wsc := (*wsClient)(n)
 				delete(txNotifications, wsc.quit)
 
+			case *notificationRegisterMempoolRemovals:
+				wsc := (*wsClient)(n)
+				removalNotifications[wsc.quit] = wsc
+
+			case *notificationUnregisterMempoolRemovals:
+				wsc := (*wsClient)(n)
+				delete(removalNotifications, wsc.quit)
+
+			case *notificationRegisterStakeEvents:
+				for _, op := range n.ops {
+					n.wsc.stakeRequests[*op] = struct{}{}
+				}
+				stakeNotifications[n.wsc.quit] = n.wsc
+
+			case *notificationUnregisterStakeEvents:
+				wsc := (*wsClient)(n)
+				wsc.stakeRequests = make(map[wire.OutPoint]struct{})
+				delete(stakeNotifications, wsc.quit)
+
+			case *notificationRegisterTemplates:
+				wsc := (*wsClient)(n)
+				templateNotifications[wsc.quit] = wsc
+
+			case *notificationUnregisterTemplates:
+				wsc := (*wsClient)(n)
+				delete(templateNotifications, wsc.quit)
+
 			default:
 				rpcsLog.Warn("Unhandled notification type")
 			}
@@ -405,6 +587,41 @@ func (m *wsNotificationManager) UnregisterBlockUpdates(wsc *wsClient) {
 	m.queueNotification <- (*notificationUnregisterBlocks)(wsc)
 }
 
+// blockVerboseDetails returns the header and proof-of-stake details of the
+// passed block for the verbose block notifications.
+func blockVerboseDetails(block *btcutil.Block) btcjson.BlockVerboseDetails {
+	header := &block.MsgBlock().Header
+	meta := block.Meta()
+	details := btcjson.BlockVerboseDetails{
+		Hash:              block.Sha().String(),
+		Height:            int32(block.Height()),
+		Version:           header.Version,
+		PreviousHash:      header.PrevBlock.String(),
+		MerkleRoot:        header.MerkleRoot.String(),
+		Time:              header.Timestamp.Unix(),
+		Bits:              strconv.FormatInt(int64(header.Bits), 16),
+		Nonce:             header.Nonce,
+		ProofOfStake:      meta.Flags&blockchain.FBlockProofOfStake != 0,
+		Mint:              btcutil.Amount(meta.Mint).ToBTC(),
+		MoneySupply:       btcutil.Amount(meta.MoneySupply).ToBTC(),
+		StakeModifier:     meta.StakeModifier,
+		GeneratedModifier: meta.Flags&blockchain.FBlockStakeModifier != 0,
+	}
+
+	// The kernel of a proof-of-stake block is the output spent by the first
+	// input of its coinstake.
+	if details.ProofOfStake {
+		kernel := &block.MsgBlock().Transactions[1].TxIn[0].PreviousOutPoint
+		details.Kernel = &btcjson.OutPoint{
+			Hash:  kernel.Hash.String(),
+			Index: kernel.Index,
+		}
+		details.ProofHash = meta.HashProofOfStake.String()
+	}
+
+	return details
+}
+
 // notifyBlockConnected notifies websocket clients that have registered for
 // block updates when a block is connected to the main chain.
 func (*wsNotificationManager) notifyBlockConnected(clients map[chan struct{}]*wsClient,
@@ -419,8 +636,26 @@ func (*wsNotificationManager) notifyBlockConnected(clients map[chan struct{}]*ws
 			"%v", err)
 		return
 	}
+
+	var marshalledJSONVerbose []byte
 	for _, wsc := range clients {
-		wsc.QueueNotification(marshalledJSON)
+		if !wsc.verboseBlockUpdates {
+			wsc.QueueNotification(marshalledJSON)
+			continue
+		}
+
+		if marshalledJSONVerbose == nil {
+			verboseNtfn := btcjson.NewBlockConnectedVerboseNtfn(
+				blockVerboseDetails(block))
+			marshalledJSONVerbose, err = btcjson.MarshalCmd(nil,
+				verboseNtfn)
+			if err != nil {
+				rpcsLog.Errorf("Failed to marshal verbose block "+
+					"connected notification: %v", err)
+				return
+			}
+		}
+		wsc.QueueNotification(marshalledJSONVerbose)
 	}
 }
 
@@ -443,6 +678,105 @@ func (*wsNotificationManager) notifyBlockDisconnected(clients map[chan struct{}]
 			"notification: %v", err)
 		return
 	}
+
+	var marshalledJSONVerbose []byte
+	for _, wsc := range clients {
+		if !wsc.verboseBlockUpdates {
+			wsc.QueueNotification(marshalledJSON)
+			continue
+		}
+
+		if marshalledJSONVerbose == nil {
+			verboseNtfn := btcjson.NewBlockDisconnectedVerboseNtfn(
+				blockVerboseDetails(block))
+			marshalledJSONVerbose, err = btcjson.MarshalCmd(nil,
+				verboseNtfn)
+			if err != nil {
+				rpcsLog.Errorf("Failed to marshal verbose block "+
+					"disconnected notification: %v", err)
+				return
+			}
+		}
+		wsc.QueueNotification(marshalledJSONVerbose)
+	}
+}
+
+// notifyChainReorganized notifies websocket clients that have registered for
+// verbose block updates when the main chain is reorganized.  The notification
+// follows the block disconnected and connected notifications of the
+// reorganization.
+func (*wsNotificationManager) notifyChainReorganized(clients map[chan struct{}]*wsClient,
+	data *blockchain.ReorganizationNtfnsData) {
+
+	if len(data.AttachedBlocks) == 0 {
+		return
+	}
+
+	var marshalledJSON []byte
+	for _, wsc := range clients {
+		if !wsc.verboseBlockUpdates {
+			continue
+		}
+
+		if marshalledJSON == nil {
+			disconnected := make([]string, 0, len(data.DetachedBlocks))
+			for _, block := range data.DetachedBlocks {
+				disconnected = append(disconnected,
+					block.Sha().String())
+			}
+			connected := make([]string, 0, len(data.AttachedBlocks))
+			for _, block := range data.AttachedBlocks {
+				connected = append(connected, block.Sha().String())
+			}
+
+			// The fork point is the parent of the first connected
+			// block.
+			first := data.AttachedBlocks[0]
+			ntfn := btcjson.NewChainReorganizedNtfn(
+				first.MsgBlock().Header.PrevBlock.String(),
+				int32(first.Height()-1), disconnected, connected)
+			var err error
+			marshalledJSON, err = btcjson.MarshalCmd(nil, ntfn)
+			if err != nil {
+				rpcsLog.Errorf("Failed to marshal chain "+
+					"reorganized notification: %v", err)
+				return
+			}
+		}
+		wsc.QueueNotification(marshalledJSON)
+	}
+}
+
+// RegisterAlertUpdates requests alert notifications to the passed websocket
+// client.
+func (m *wsNotificationManager) RegisterAlertUpdates(wsc *wsClient) {
+	m.queueNotification <- (*notificationRegisterAlerts)(wsc)
+}
+
+// UnregisterAlertUpdates removes alert notifications for the passed websocket
+// client.
+func (m *wsNotificationManager) UnregisterAlertUpdates(wsc *wsClient) {
+	m.queueNotification <- (*notificationUnregisterAlerts)(wsc)
+}
+
+// notifyAlert notifies websocket clients that have registered for alert
+// updates when a network alert is accepted or cancelled.
+func (*wsNotificationManager) notifyAlert(clients map[chan struct{}]*wsClient,
+	alert *wire.Alert, cancelled bool) {
+
+	// Skip notification creation if no clients have requested alert
+	// notifications.
+	if len(clients) == 0 {
+		return
+	}
+
+	ntfn := btcjson.NewAlertNtfn(alert.ID, alert.Priority,
+		alert.Expiration, alert.StatusBar, cancelled)
+	marshalledJSON, err := btcjson.MarshalCmd(nil, ntfn)
+	if err != nil {
+		rpcsLog.Errorf("Failed to marshal alert notification: %v", err)
+		return
+	}
 	for _, wsc := range clients {
 		wsc.QueueNotification(marshalledJSON)
 	}
@@ -460,6 +794,355 @@ func (m *wsNotificationManager) UnregisterNewMempoolTxsUpdates(wsc *wsClient) {
 	m.queueNotification <- (*notificationUnregisterNewMempoolTxs)(wsc)
 }
 
+// RegisterMempoolRemovalsUpdates requests notifications to the passed websocket
+// client when transactions are removed from the memory pool.
+func (m *wsNotificationManager) RegisterMempoolRemovalsUpdates(wsc *wsClient) {
+	m.queueNotification <- (*notificationRegisterMempoolRemovals)(wsc)
+}
+
+// UnregisterMempoolRemovalsUpdates removes notifications to the passed
+// websocket client when transactions are removed from the memory pool.
+func (m *wsNotificationManager) UnregisterMempoolRemovalsUpdates(wsc *wsClient) {
+	m.queueNotification <- (*notificationUnregisterMempoolRemovals)(wsc)
+}
+
+// RegisterStakeEventsUpdates requests proof-of-stake event notifications to the
+// passed websocket client.  The client is also notified when the coinstake of a
+// block connected to the main chain spends any of the passed outpoints.
+func (m *wsNotificationManager) RegisterStakeEventsUpdates(wsc *wsClient, ops []*wire.OutPoint) {
+	m.queueNotification <- &notificationRegisterStakeEvents{
+		wsc: wsc,
+		ops: ops,
+	}
+}
+
+// UnregisterStakeEventsUpdates removes proof-of-stake event notifications for
+// the passed websocket client along with its watched outpoints.
+func (m *wsNotificationManager) UnregisterStakeEventsUpdates(wsc *wsClient) {
+	m.queueNotification <- (*notificationUnregisterStakeEvents)(wsc)
+}
+
+// notifyStakeEvents notifies websocket clients that have registered for
+// proof-of-stake event updates when a block connected to the main chain
+// generates a new stake modifier, changes the proof-of-work or proof-of-stake
+// difficulty, or has a coinstake which spends one of their watched outpoints.
+//
+// There is no notification for received sync checkpoints since ppcd neither
+// processes nor relays checkpoint messages.
+func (m *wsNotificationManager) notifyStakeEvents(clients map[chan struct{}]*wsClient,
+	block *btcutil.Block) {
+
+	hash := block.Sha().String()
+	height := int32(block.Height())
+	header := &block.MsgBlock().Header
+	meta := block.Meta()
+	proofOfStake := meta.Flags&blockchain.FBlockProofOfStake != 0
+
+	var ntfns []interface{}
+	if meta.Flags&blockchain.FBlockStakeModifier != 0 {
+		ntfns = append(ntfns, btcjson.NewStakeModifierNtfn(hash, height,
+			meta.StakeModifier))
+	}
+
+	// The difficulty changed when the target differs from the one of the
+	// previous block of the same kind.
+	prevHeader, prevMeta, err := blockchain.GetLastBlockHeader(
+		m.server.server.db, &header.PrevBlock, proofOfStake)
+	switch {
+	case err != nil:
+		rpcsLog.Errorf("Failed to fetch the previous block of %v: %v",
+			hash, err)
+
+	case (prevMeta.Flags&blockchain.FBlockProofOfStake != 0) != proofOfStake:
+		// There is no previous block of the same kind.
+
+	case prevHeader.Bits != header.Bits:
+		ntfns = append(ntfns, btcjson.NewDifficultyChangedNtfn(hash,
+			height, proofOfStake, getDifficultyRatio(header.Bits),
+			getDifficultyRatio(prevHeader.Bits)))
+	}
+
+	marshalled := make([][]byte, 0, len(ntfns))
+	for _, ntfn := range ntfns {
+		marshalledJSON, err := btcjson.MarshalCmd(nil, ntfn)
+		if err != nil {
+			rpcsLog.Errorf("Failed to marshal stake event "+
+				"notification: %v", err)
+			return
+		}
+		marshalled = append(marshalled, marshalledJSON)
+	}
+
+	var coinStake *btcutil.Tx
+	if proofOfStake {
+		coinStake = block.Transactions()[1]
+	}
+	for _, wsc := range clients {
+		for _, marshalledJSON := range marshalled {
+			wsc.QueueNotification(marshalledJSON)
+		}
+		if coinStake == nil || len(wsc.stakeRequests) == 0 {
+			continue
+		}
+
+		// Notify the client when the coinstake spends one of its
+		// watched outpoints and stop watching it as it cannot be
+		// spent again.
+		for _, txIn := range coinStake.MsgTx().TxIn {
+			op := txIn.PreviousOutPoint
+			if _, ok := wsc.stakeRequests[op]; !ok {
+				continue
+			}
+			delete(wsc.stakeRequests, op)
+
+			ntfn := btcjson.NewCoinStakeSpentNtfn(hash, height,
+				coinStake.Sha().String(), btcjson.OutPoint{
+					Hash:  op.Hash.String(),
+					Index: op.Index,
+				})
+			marshalledJSON, err := btcjson.MarshalCmd(nil, ntfn)
+			if err != nil {
+				rpcsLog.Errorf("Failed to marshal coinstake spent "+
+					"notification: %v", err)
+				continue
+			}
+			wsc.QueueNotification(marshalledJSON)
+		}
+	}
+}
+
+// RegisterTemplateUpdates requests block template update notifications to the
+// passed websocket client.
+func (m *wsNotificationManager) RegisterTemplateUpdates(wsc *wsClient) {
+	m.queueNotification <- (*notificationRegisterTemplates)(wsc)
+}
+
+// UnregisterTemplateUpdates removes block template update notifications for the
+// passed websocket client.
+func (m *wsNotificationManager) UnregisterTemplateUpdates(wsc *wsClient) {
+	m.queueNotification <- (*notificationUnregisterTemplates)(wsc)
+}
+
+// queueTemplateUpdate requests templateHandler to notify the passed websocket
+// clients if the block template changed.  A pending request which has not been
+// handled yet is replaced, since the template is only checked for changes once
+// anyway.
+//
+// This function MUST only be called from the notification handler goroutine.
+func (m *wsNotificationManager) queueTemplateUpdate(clients map[chan struct{}]*wsClient) {
+	// The clients are copied since the map is modified by the notification
+	// handler while templateHandler uses it.
+	clientsCopy := make(map[chan struct{}]*wsClient, len(clients))
+	for quit, wsc := range clients {
+		clientsCopy[quit] = wsc
+	}
+
+	// The notification handler is the only sender, so there is room for
+	// the request once the pending one, if any, is dropped.
+	select {
+	case <-m.templateUpdates:
+	default:
+	}
+	m.templateUpdates <- clientsCopy
+}
+
+// templateHandler handles the block template update requests queued by the
+// notification handler.  Generating a block template can take a while, so it
+// is done in its own goroutine.
+func (m *wsNotificationManager) templateHandler() {
+	// lastTemplate is the block template the clients registered for block
+	// template updates were last notified of.
+	var lastTemplate notifiedTemplate
+
+out:
+	for {
+		select {
+		case clients := <-m.templateUpdates:
+			m.notifyTemplates(clients, &lastTemplate)
+
+		case <-m.quit:
+			break out
+		}
+	}
+	m.wg.Done()
+}
+
+// notifiedTemplate describes the block template websocket clients registered
+// for block template updates were last notified of.
+type notifiedTemplate struct {
+	prevHash wire.ShaHash
+	bits     uint32
+	posBits  uint32
+	fees     int64
+}
+
+// templateFeeDelta converts the passed minimum increase in PPC of the fees of a
+// block template set with the --templatefeedelta option to Satoshi, rounded to
+// the nearest Satoshi.  Clients are never notified of fee increases when it is
+// not a number or infinite.
+func templateFeeDelta(ppc float64) int64 {
+	amount, err := btcutil.NewAmount(ppc)
+	if err != nil {
+		return math.MaxInt64
+	}
+	return int64(amount)
+}
+
+// templateChangeReason returns the reason reported to websocket clients for
+// the change from the last notified block template to the current one, or an
+// empty string when the clients need not be notified.  The reason is "newtip"
+// when the best chain has a new tip, "difficulty" when the proof-of-work or the
+// proof-of-stake target difficulty changed, and "mempool" when the fees of the
+// transactions in the template increased by at least the passed fee delta.
+func templateChangeReason(last, cur *notifiedTemplate, feeDelta int64) string {
+	switch {
+	case !cur.prevHash.IsEqual(&last.prevHash):
+		return "newtip"
+	case cur.bits != last.bits || cur.posBits != last.posBits:
+		return "difficulty"
+	case cur.fees > last.fees && cur.fees-last.fees >= feeDelta:
+		return "mempool"
+	}
+	return ""
+}
+
+// notifyTemplates notifies websocket clients that have registered for block
+// template updates when the block template changed since they were last
+// notified.  This is the case when the best chain has a new tip, the
+// proof-of-work target difficulty of the template or the proof-of-stake target
+// difficulty of the next block changed, or the fees of the transactions in the
+// template increased by at least the --templatefeedelta option.  The template
+// is shared with getblocktemplate, so new templates are generated no more often
+// than for long poll clients.
+//
+// This function MUST only be called from the template handler goroutine.
+func (m *wsNotificationManager) notifyTemplates(clients map[chan struct{}]*wsClient,
+	last *notifiedTemplate) {
+
+	// No point in handing out work before the chain is synced.
+	bManager := m.server.server.blockManager
+	if !bManager.IsCurrent() {
+		return
+	}
+
+	// Stakers are notified of changes of the proof-of-stake difficulty too
+	// since they affect the templates of proof-of-stake blocks.
+	posBits, err := bManager.PPCCalcNextRequiredDifficulty(true)
+	if err != nil {
+		rpcsLog.Errorf("Failed to calculate the proof-of-stake "+
+			"difficulty: %v", err)
+		return
+	}
+
+	state := m.server.gbtWorkState
+	state.Lock()
+	defer state.Unlock()
+
+	if err := state.updateBlockTemplate(m.server, true); err != nil {
+		rpcsLog.Errorf("Failed to update block template: %v", err)
+		return
+	}
+
+	template := state.template
+	header := &template.block.Header
+	cur := notifiedTemplate{
+		prevHash: header.PrevBlock,
+		bits:     header.Bits,
+		posBits:  posBits,
+	}
+	for _, fee := range template.fees[1:] {
+		cur.fees += fee
+	}
+	feeDelta := templateFeeDelta(cfg.TemplateFeeDelta)
+	reason := templateChangeReason(last, &cur, feeDelta)
+	if reason == "" {
+		return
+	}
+	*last = cur
+
+	templateID := encodeTemplateID(state.prevHash, state.lastGenerated)
+	ntfn := btcjson.NewTemplateChangedNtfn(templateID, reason, nil)
+	marshalledJSON, err := btcjson.MarshalCmd(nil, ntfn)
+	if err != nil {
+		rpcsLog.Errorf("Failed to marshal template changed "+
+			"notification: %v", err)
+		return
+	}
+
+	var marshalledJSONVerbose []byte
+	for _, wsc := range clients {
+		if !wsc.verboseTemplateUpdates {
+			wsc.QueueNotification(marshalledJSON)
+			continue
+		}
+
+		if marshalledJSONVerbose == nil {
+			ntfn.Template, err = state.blockTemplateResult(true, nil)
+			if err != nil {
+				rpcsLog.Errorf("Failed to create block template "+
+					"result: %v", err)
+				return
+			}
+			marshalledJSONVerbose, err = btcjson.MarshalCmd(nil, ntfn)
+			if err != nil {
+				rpcsLog.Errorf("Failed to marshal verbose template "+
+					"changed notification: %v", err)
+				return
+			}
+		}
+		wsc.QueueNotification(marshalledJSONVerbose)
+	}
+}
+
+// notifyTxRemoved notifies websocket clients that have registered for removal
+// updates when a transaction is removed from the memory pool.
+func (*wsNotificationManager) notifyTxRemoved(clients map[chan struct{}]*wsClient,
+	tx *btcutil.Tx, reason txRemovalReason) {
+
+	// Skip notification creation if no clients have requested removal
+	// notifications.
+	if len(clients) == 0 {
+		return
+	}
+
+	ntfn := btcjson.NewTxRemovedNtfn(tx.Sha().String(), reason.String())
+	marshalledJSON, err := btcjson.MarshalCmd(nil, ntfn)
+	if err != nil {
+		rpcsLog.Errorf("Failed to marshal tx removed notification: %v",
+			err)
+		return
+	}
+	for _, wsc := range clients {
+		wsc.QueueNotification(marshalledJSON)
+	}
+}
+
+// notifyTxReplaced notifies websocket clients that have registered for updates
+// when new transactions are added to the memory pool that a transaction was
+// removed from the memory pool since it, or a transaction it depends on, was
+// replaced by a conflicting transaction.
+func (*wsNotificationManager) notifyTxReplaced(clients map[chan struct{}]*wsClient,
+	tx, replacedBy *btcutil.Tx) {
+
+	// Skip notification creation if no clients have requested new
+	// transaction notifications.
+	if len(clients) == 0 {
+		return
+	}
+
+	ntfn := btcjson.NewTxReplacedNtfn(tx.Sha().String(),
+		replacedBy.Sha().String())
+	marshalledJSON, err := btcjson.MarshalCmd(nil, ntfn)
+	if err != nil {
+		rpcsLog.Errorf("Failed to marshal tx replaced notification: %v",
+			err)
+		return
+	}
+	for _, wsc := range clients {
+		wsc.QueueNotification(marshalledJSON)
+	}
+}
+
 // notifyForNewTx notifies websocket clients that have registered for updates
 // when a new transaction is added to the memory pool.
 func (m *wsNotificationManager) notifyForNewTx(clients map[chan struct{}]*wsClient, tx *btcutil.Tx) {
@@ -797,9 +1480,10 @@ func (m *wsNotificationManager) RemoveClient(wsc *wsClient) {
 // Start starts the goroutines required for the manager to queue and process
 // websocket client notifications.
 func (m *wsNotificationManager) Start() {
-	m.wg.Add(2)
+	m.wg.Add(3)
 	go m.queueHandler()
 	go m.notificationHandler()
+	go m.templateHandler()
 }
 
 // WaitForShutdown blocks until all notification manager goroutines have
@@ -808,8 +1492,8 @@ func (m *wsNotificationManager) WaitForShutdown() {
 	m.wg.Wait()
 }
 
-// Shutdown shuts down the manager, stopping the notification queue and
-// notification handler goroutines.
+// Shutdown shuts down the manager, stopping the notification queue,
+// notification handler and template handler goroutines.
 func (m *wsNotificationManager) Shutdown() {
 	close(m.quit)
 }
@@ -822,6 +1506,7 @@ func newWsNotificationManager(server *rpcServer) *wsNotificationManager {
 		queueNotification: make(chan interface{}),
 		notificationMsgs:  make(chan interface{}),
 		numClients:        make(chan int),
+		templateUpdates:   make(chan map[chan struct{}]*wsClient, 1),
 		quit:              make(chan struct{}),
 	}
 }
@@ -868,14 +1553,23 @@ type wsClient struct {
 	// and therefore is allowed to communicated over the websocket.
 	authenticated bool
 
-	// isAdmin specifies whether a client may change the state of the server;
-	// false means its access is only to the limited set of RPC calls.
-	isAdmin bool
+	// access specifies which RPC methods a client may invoke once it has
+	// been authenticated.
+	access *rpcAccess
 
 	// verboseTxUpdates specifies whether a client has requested verbose
 	// information about all new transactions.
 	verboseTxUpdates bool
 
+	// verboseBlockUpdates specifies whether a client has requested verbose
+	// information about connected and disconnected blocks along with
+	// chain reorganization notifications.
+	verboseBlockUpdates bool
+
+	// verboseTemplateUpdates specifies whether a client has requested the
+	// full block template in block template update notifications.
+	verboseTemplateUpdates bool
+
 	// addrRequests is a set of addresses the caller has requested to be
 	// notified about.  It is maintained here so all requests can be removed
 	// when a wallet disconnects.  Owned by the notification manager.
@@ -886,6 +1580,19 @@ type wsClient struct {
 	// Owned by the notification manager.
 	spentRequests map[wire.OutPoint]struct{}
 
+	// stakeRequests is a set of Outpoints a client has requested
+	// notifications for when they are spent by the coinstake of a block
+	// connected to the main chain.  Owned by the notification manager.
+	stakeRequests map[wire.OutPoint]struct{}
+
+	// numRescans is the number of rescans the client has running or
+	// queued.  It is limited to the --rpcmaxrescans option.
+	numRescans int
+
+	// rescanQuit is closed by the stoprescan command to stop the running
+	// rescan and then replaced for the next one.
+	rescanQuit chan struct{}
+
 	// Networking infrastructure.
 	asyncStarted bool
 	asyncChan    chan *parsedRPCCmd
@@ -931,13 +1638,22 @@ func (c *wsClient) handleMessage(msg []byte) {
 		authSha := fastsha256.Sum256([]byte(auth))
 		cmp := subtle.ConstantTimeCompare(authSha[:], c.server.authsha[:])
 		limitcmp := subtle.ConstantTimeCompare(authSha[:], c.server.limitauthsha[:])
-		if cmp != 1 && limitcmp != 1 {
+		switch {
+		case cmp == 1:
+			c.access = rpcAdminAccess
+		case limitcmp == 1:
+			c.access = rpcLimitedAccess
+		default:
+			// ppc: Check for the users configured with --rpcauth.
+			c.access = c.server.checkAuthUser(authCmd.Username,
+				authCmd.Passphrase, c.addr)
+		}
+		if c.access == nil {
 			rpcsLog.Warnf("Auth failure.")
 			c.Disconnect()
 			return
 		}
 		c.authenticated = true
-		c.isAdmin = cmp == 1
 
 		// Marshal and send response.
 		reply, err := createMarshalledReply(parsedCmd.id, nil, nil)
@@ -975,22 +1691,20 @@ func (c *wsClient) handleMessage(msg []byte) {
 	}
 
 	// Check if the user is limited and disconnect client if unauthorized
-	if !c.isAdmin {
-		if _, ok := rpcLimited[request.Method]; !ok {
-			jsonErr := &btcjson.RPCError{
-				Code:    btcjson.ErrRPCInvalidParams.Code,
-				Message: "limited user not authorized for this method",
-			}
-			// Marshal and send response.
-			reply, err := createMarshalledReply(request.ID, nil, jsonErr)
-			if err != nil {
-				rpcsLog.Errorf("Failed to marshal parse failure "+
-					"reply: %v", err)
-				return
-			}
-			c.SendMessage(reply, nil)
+	if !c.access.allows(request.Method) {
+		jsonErr := &btcjson.RPCError{
+			Code:    btcjson.ErrRPCInvalidParams.Code,
+			Message: "user not authorized for this method",
+		}
+		// Marshal and send response.
+		reply, err := createMarshalledReply(request.ID, nil, jsonErr)
+		if err != nil {
+			rpcsLog.Errorf("Failed to marshal parse failure "+
+				"reply: %v", err)
 			return
 		}
+		c.SendMessage(reply, nil)
+		return
 	}
 
 	// Attempt to parse the JSON-RPC request into a known concrete command.
@@ -1020,6 +1734,20 @@ func (c *wsClient) handleMessage(msg []byte) {
 	// When the command is marked as a long-running command, send it off
 	// to the asyncHander goroutine for processing.
 	if _, ok := wsAsyncHandlers[cmd.method]; ok {
+		// Refuse rescans beyond the maximum number the client may
+		// have running or queued at once.
+		if cmd.method == "rescan" && !c.reserveRescan() {
+			reply, err := createMarshalledReply(cmd.id, nil,
+				&ErrRescanLimit)
+			if err != nil {
+				rpcsLog.Errorf("Failed to marshal reply for "+
+					"<%s> command: %v", cmd.method, err)
+				return
+			}
+			c.SendMessage(reply, nil)
+			return
+		}
+
 		// Start up the async goroutine for handling long-running
 		// requests asynchonrously if needed.
 		if !c.asyncStarted {
@@ -1362,6 +2090,47 @@ func (c *wsClient) Disconnect() {
 	c.disconnected = true
 }
 
+// reserveRescan counts a new rescan of the client and returns whether it is
+// within the maximum number of rescans the client may have running or queued.
+// Successful reservations must be released with releaseRescan.
+func (c *wsClient) reserveRescan() bool {
+	c.Lock()
+	defer c.Unlock()
+
+	if c.numRescans >= cfg.RPCMaxRescans {
+		return false
+	}
+	c.numRescans++
+	return true
+}
+
+// releaseRescan releases a rescan reserved with reserveRescan once it has
+// finished.
+func (c *wsClient) releaseRescan() {
+	c.Lock()
+	c.numRescans--
+	c.Unlock()
+}
+
+// rescanQuitChan returns the channel which is closed when the stoprescan
+// command is received while the calling rescan is running.
+func (c *wsClient) rescanQuitChan() <-chan struct{} {
+	c.Lock()
+	defer c.Unlock()
+
+	return c.rescanQuit
+}
+
+// StopRescan stops the running rescan of the client, if any.  Rescans queued
+// after it are not affected.
+func (c *wsClient) StopRescan() {
+	c.Lock()
+	defer c.Unlock()
+
+	close(c.rescanQuit)
+	c.rescanQuit = make(chan struct{})
+}
+
 // Start begins processing input and output messages.
 func (c *wsClient) Start() {
 	rpcsLog.Tracef("Starting websocket client %s", c.addr)
@@ -1380,22 +2149,25 @@ func (c *wsClient) WaitForShutdown() {
 }
 
 // newWebsocketClient returns a new websocket client given the notification
-// manager, websocket connection, remote address, and whether or not the client
-// has already been authenticated (via HTTP Basic access authentication).  The
-// returned client is ready to start.  Once started, the client will process
-// incoming and outgoing messages in separate goroutines complete with queueing
-// and asynchrous handling for long-running operations.
+// manager, websocket connection, remote address, whether or not the client has
+// already been authenticated (via HTTP Basic access authentication), and the
+// RPC methods it may invoke if it has.  The returned client is ready to start.
+// Once started, the client will process incoming and outgoing messages in
+// separate goroutines complete with queueing and asynchrous handling for
+// long-running operations.
 func newWebsocketClient(server *rpcServer, conn *websocket.Conn,
-	remoteAddr string, authenticated bool, isAdmin bool) *wsClient {
+	remoteAddr string, authenticated bool, access *rpcAccess) *wsClient {
 
 	return &wsClient{
 		conn:          conn,
 		addr:          remoteAddr,
 		authenticated: authenticated,
-		isAdmin:       isAdmin,
+		access:        access,
 		server:        server,
 		addrRequests:  make(map[string]struct{}),
 		spentRequests: make(map[wire.OutPoint]struct{}),
+		stakeRequests: make(map[wire.OutPoint]struct{}),
+		rescanQuit:    make(chan struct{}),
 		ntfnChan:      make(chan []byte, 1),        // nonblocking sync
 		asyncChan:     make(chan *parsedRPCCmd, 1), // nonblocking sync
 		sendChan:      make(chan wsResponse, websocketSendBufferSize),
@@ -1450,9 +2222,29 @@ func handleWebsocketHelp(wsc *wsClient, icmd interface{}) (interface{}, error) {
 	return help, nil
 }
 
+// handleNotifyAlerts implements the notifyalerts command extension for
+// websocket connections.
+func handleNotifyAlerts(wsc *wsClient, icmd interface{}) (interface{}, error) {
+	wsc.server.ntfnMgr.RegisterAlertUpdates(wsc)
+	return nil, nil
+}
+
+// handleStopNotifyAlerts implements the stopnotifyalerts command extension
+// for websocket connections.
+func handleStopNotifyAlerts(wsc *wsClient, icmd interface{}) (interface{}, error) {
+	wsc.server.ntfnMgr.UnregisterAlertUpdates(wsc)
+	return nil, nil
+}
+
 // handleNotifyBlocks implements the notifyblocks command extension for
 // websocket connections.
 func handleNotifyBlocks(wsc *wsClient, icmd interface{}) (interface{}, error) {
+	cmd, ok := icmd.(*btcjson.NotifyBlocksCmd)
+	if !ok {
+		return nil, btcjson.ErrRPCInternal
+	}
+
+	wsc.verboseBlockUpdates = cmd.Verbose != nil && *cmd.Verbose
 	wsc.server.ntfnMgr.RegisterBlockUpdates(wsc)
 	return nil, nil
 }
@@ -1481,6 +2273,20 @@ func handleNotifySpent(wsc *wsClient, icmd interface{}) (interface{}, error) {
 	return nil, nil
 }
 
+// handleNotifyMempoolRemovals implements the notifymempoolremovals command
+// extension for websocket connections.
+func handleNotifyMempoolRemovals(wsc *wsClient, icmd interface{}) (interface{}, error) {
+	wsc.server.ntfnMgr.RegisterMempoolRemovalsUpdates(wsc)
+	return nil, nil
+}
+
+// handleStopNotifyMempoolRemovals implements the stopnotifymempoolremovals
+// command extension for websocket connections.
+func handleStopNotifyMempoolRemovals(wsc *wsClient, icmd interface{}) (interface{}, error) {
+	wsc.server.ntfnMgr.UnregisterMempoolRemovalsUpdates(wsc)
+	return nil, nil
+}
+
 // handleNotifyNewTransations implements the notifynewtransactions command
 // extension for websocket connections.
 func handleNotifyNewTransactions(wsc *wsClient, icmd interface{}) (interface{}, error) {
@@ -1540,6 +2346,54 @@ func handleStopNotifySpent(wsc *wsClient, icmd interface{}) (interface{}, error)
 	return nil, nil
 }
 
+// handleNotifyStakeEvents implements the notifystakeevents command extension
+// for websocket connections.
+func handleNotifyStakeEvents(wsc *wsClient, icmd interface{}) (interface{}, error) {
+	cmd, ok := icmd.(*btcjson.NotifyStakeEventsCmd)
+	if !ok {
+		return nil, btcjson.ErrRPCInternal
+	}
+
+	var outpoints []*wire.OutPoint
+	if cmd.OutPoints != nil {
+		var err error
+		outpoints, err = deserializeOutpoints(*cmd.OutPoints)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	wsc.server.ntfnMgr.RegisterStakeEventsUpdates(wsc, outpoints)
+	return nil, nil
+}
+
+// handleStopNotifyStakeEvents implements the stopnotifystakeevents command
+// extension for websocket connections.
+func handleStopNotifyStakeEvents(wsc *wsClient, icmd interface{}) (interface{}, error) {
+	wsc.server.ntfnMgr.UnregisterStakeEventsUpdates(wsc)
+	return nil, nil
+}
+
+// handleNotifyTemplates implements the notifytemplates command extension for
+// websocket connections.
+func handleNotifyTemplates(wsc *wsClient, icmd interface{}) (interface{}, error) {
+	cmd, ok := icmd.(*btcjson.NotifyTemplatesCmd)
+	if !ok {
+		return nil, btcjson.ErrRPCInternal
+	}
+
+	wsc.verboseTemplateUpdates = cmd.Verbose != nil && *cmd.Verbose
+	wsc.server.ntfnMgr.RegisterTemplateUpdates(wsc)
+	return nil, nil
+}
+
+// handleStopNotifyTemplates implements the stopnotifytemplates command
+// extension for websocket connections.
+func handleStopNotifyTemplates(wsc *wsClient, icmd interface{}) (interface{}, error) {
+	wsc.server.ntfnMgr.UnregisterTemplateUpdates(wsc)
+	return nil, nil
+}
+
 // handleStopNotifyReceived implements the stopnotifyreceived command extension
 // for websocket connections.
 func handleStopNotifyReceived(wsc *wsClient, icmd interface{}) (interface{}, error) {
@@ -1616,6 +2470,54 @@ func (r *rescanKeys) unspentSlice() []*wire.OutPoint {
 	return ops
 }
 
+// contains returns whether the passed address, extracted from a transaction
+// output, is one of the rescanned addresses.
+func (r *rescanKeys) contains(addr btcutil.Address) bool {
+	switch a := addr.(type) {
+	case *btcutil.AddressPubKeyHash:
+		_, ok := r.pubKeyHashes[*a.Hash160()]
+		return ok
+
+	case *btcutil.AddressScriptHash:
+		_, ok := r.scriptHashes[*a.Hash160()]
+		return ok
+
+	case *btcutil.AddressPubKey:
+		switch sa := a.ScriptAddress(); len(sa) {
+		case 33: // Compressed
+			var key [33]byte
+			copy(key[:], sa)
+			if _, ok := r.compressedPubkeys[key]; ok {
+				return true
+			}
+
+		case 65: // Uncompressed
+			var key [65]byte
+			copy(key[:], sa)
+			if _, ok := r.uncompressedPubkeys[key]; ok {
+				return true
+			}
+
+		default:
+			rpcsLog.Warnf("Skipping rescanned pubkey of unknown "+
+				"serialized length %d", len(sa))
+			return false
+		}
+
+		// If the transaction output pays to the pubkey of a rescanned
+		// P2PKH address, include it as well.
+		pkh := a.AddressPubKeyHash()
+		_, ok := r.pubKeyHashes[*pkh.Hash160()]
+		return ok
+
+	default:
+		// A new address type must have been added.  Encode as a
+		// payment address string and check the fallback map.
+		_, ok := r.fallbacks[addr.EncodeAddress()]
+		return ok
+	}
+}
+
 // ErrRescanReorg defines the error that is returned when an unrecoverable
 // reorganize is detected during a rescan.
 var ErrRescanReorg = btcjson.RPCError{
@@ -1623,6 +2525,28 @@ var ErrRescanReorg = btcjson.RPCError{
 	Message: "Reorganize",
 }
 
+// ErrRescanStopped defines the error that is returned when a rescan is stopped
+// by the stoprescan command.
+var ErrRescanStopped = btcjson.RPCError{
+	Code:    btcjson.ErrRPCMisc,
+	Message: "Rescan stopped",
+}
+
+// ErrRescanLimit defines the error that is returned when a client requests a
+// rescan while it already has the maximum number of rescans running or queued.
+var ErrRescanLimit = btcjson.RPCError{
+	Code:    btcjson.ErrRPCMisc,
+	Message: "Too many rescans running or queued",
+}
+
+// rescanProgressInterval is the minimum interval between the rescanprogress
+// notifications sent to the client during a rescan.
+const rescanProgressInterval = 10 * time.Second
+
+// rescanIndexBatchSize is the number of transactions fetched from the address
+// index at once when looking up the blocks a rescan needs to fetch.
+const rescanIndexBatchSize = 1000
+
 // rescanBlock rescans all transactions in a single block.  This is a helper
 // function for handleRescan.
 func rescanBlock(wsc *wsClient, lookups *rescanKeys, blk *btcutil.Block) {
@@ -1670,57 +2594,8 @@ func rescanBlock(wsc *wsClient, lookups *rescanKeys, blk *btcutil.Block) {
 				txout.PkScript, wsc.server.server.chainParams)
 
 			for _, addr := range addrs {
-				switch a := addr.(type) {
-				case *btcutil.AddressPubKeyHash:
-					if _, ok := lookups.pubKeyHashes[*a.Hash160()]; !ok {
-						continue
-					}
-
-				case *btcutil.AddressScriptHash:
-					if _, ok := lookups.scriptHashes[*a.Hash160()]; !ok {
-						continue
-					}
-
-				case *btcutil.AddressPubKey:
-					found := false
-					switch sa := a.ScriptAddress(); len(sa) {
-					case 33: // Compressed
-						var key [33]byte
-						copy(key[:], sa)
-						if _, ok := lookups.compressedPubkeys[key]; ok {
-							found = true
-						}
-
-					case 65: // Uncompressed
-						var key [65]byte
-						copy(key[:], sa)
-						if _, ok := lookups.uncompressedPubkeys[key]; ok {
-							found = true
-						}
-
-					default:
-						rpcsLog.Warnf("Skipping rescanned pubkey of unknown "+
-							"serialized length %d", len(sa))
-						continue
-					}
-
-					// If the transaction output pays to the pubkey of
-					// a rescanned P2PKH address, include it as well.
-					if !found {
-						pkh := a.AddressPubKeyHash()
-						if _, ok := lookups.pubKeyHashes[*pkh.Hash160()]; !ok {
-							continue
-						}
-					}
-
-				default:
-					// A new address type must have been added.  Encode as a
-					// payment address string and check the fallback map.
-					addrStr := addr.EncodeAddress()
-					_, ok := lookups.fallbacks[addrStr]
-					if !ok {
-						continue
-					}
+				if !lookups.contains(addr) {
+					continue
 				}
 
 				outpoint := wire.OutPoint{
@@ -1776,7 +2651,7 @@ func recoverFromReorg(db database.Db, minBlock, maxBlock int64,
 	if lastBlock == nil || len(hashList) == 0 {
 		return hashList, nil
 	}
-	blk, err := db.FetchBlockBySha(&hashList[0])
+	header, _, err := db.FetchBlockHeaderBySha(&hashList[0])
 	if err != nil {
 		rpcsLog.Errorf("Error looking up possibly reorged block: %v",
 			err)
@@ -1785,17 +2660,18 @@ func recoverFromReorg(db database.Db, minBlock, maxBlock int64,
 			Message: "Database error: " + err.Error(),
 		}
 	}
-	jsonErr := descendantBlock(lastBlock, blk)
+	jsonErr := descendantBlock(lastBlock, header)
 	if jsonErr != nil {
 		return nil, jsonErr
 	}
 	return hashList, nil
 }
 
-// descendantBlock returns the appropiate JSON-RPC error if a current block
-// fetched during a reorganize is not a direct child of the parent block hash.
-func descendantBlock(prevHash *wire.ShaHash, curBlock *btcutil.Block) error {
-	curHash := &curBlock.MsgBlock().Header.PrevBlock
+// descendantBlock returns the appropiate JSON-RPC error if the header of a
+// current block fetched during a reorganize is not a direct child of the
+// parent block hash.
+func descendantBlock(prevHash *wire.ShaHash, curHeader *wire.BlockHeader) error {
+	curHash := &curHeader.PrevBlock
 	if !prevHash.IsEqual(curHash) {
 		rpcsLog.Errorf("Stopping rescan for reorged block %v "+
 			"(replaced by block %v)", prevHash, curHash)
@@ -1804,6 +2680,99 @@ func descendantBlock(prevHash *wire.ShaHash, curBlock *btcutil.Block) error {
 	return nil
 }
 
+// rescanIndexedBlocks uses the address index to look up the blocks in the
+// passed height range which contain transactions paying to or spending from
+// the rescanned addresses.  It returns the set of their hashes along with the
+// height of the address index tip, since the blocks above it are not covered
+// by the set.  A nil set is returned when the rescan can't be limited to these
+// blocks, which is the case when the address index is disabled or has not
+// caught up yet, or when some of the rescanned addresses or outpoints are not
+// covered by the index.
+func rescanIndexedBlocks(wsc *wsClient, lookups *rescanKeys,
+	addrs []btcutil.Address, outpoints []*wire.OutPoint,
+	minBlock, maxBlock int64) (map[wire.ShaHash]struct{}, int64) {
+
+	s := wsc.server.server
+	if !cfg.AddrIndex || s.addrIndexer == nil || !s.addrIndexer.IsCaughtUp() {
+		return nil, 0
+	}
+	if len(lookups.fallbacks) != 0 {
+		return nil, 0
+	}
+
+	// The spends of the outpoints are only found through the index when
+	// the outpoints pay to one of the rescanned addresses.
+	for _, outpoint := range outpoints {
+		replies, err := s.db.FetchTxBySha(&outpoint.Hash)
+		if err != nil || len(replies) == 0 {
+			return nil, 0
+		}
+		mtx := replies[len(replies)-1].Tx
+		if outpoint.Index >= uint32(len(mtx.TxOut)) {
+			return nil, 0
+		}
+		_, opAddrs, _, _ := txscript.ExtractPkScriptAddrs(
+			mtx.TxOut[outpoint.Index].PkScript, s.chainParams)
+		found := false
+		for _, addr := range opAddrs {
+			if lookups.contains(addr) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, 0
+		}
+	}
+
+	// Fetch the index tip before the transactions so every block at or
+	// below it is guaranteed to be covered by the set.
+	_, indexTip, err := s.db.FetchAddrIndexTip()
+	if err != nil {
+		rpcsLog.Warnf("Unable to fetch the address index tip: %v", err)
+		return nil, 0
+	}
+
+	blocks := make(map[wire.ShaHash]struct{})
+	for _, addr := range addrs {
+		for skip := 0; ; {
+			replies, err := s.db.FetchTxsForAddr(addr, skip,
+				rescanIndexBatchSize)
+			if err != nil {
+				rpcsLog.Warnf("Unable to fetch the transactions "+
+					"of %v from the address index: %v",
+					addr.EncodeAddress(), err)
+				return nil, 0
+			}
+			for _, reply := range replies {
+				if reply.Height >= minBlock && reply.Height < maxBlock {
+					blocks[*reply.BlkSha] = struct{}{}
+				}
+			}
+			if len(replies) < rescanIndexBatchSize {
+				break
+			}
+			skip += len(replies)
+		}
+	}
+
+	return blocks, indexTip
+}
+
+// rescanNeedsBlock returns whether the block with the passed hash and height
+// has to be fetched and rescanned in full given the blocks found in the address
+// index up to its tip by rescanIndexedBlocks.  That is the case for all blocks
+// when no blocks were found since the index does not cover the rescan.
+func rescanNeedsBlock(indexedBlocks map[wire.ShaHash]struct{}, indexTip int64,
+	hash *wire.ShaHash, height int64) bool {
+
+	if indexedBlocks == nil || height > indexTip {
+		return true
+	}
+	_, ok := indexedBlocks[*hash]
+	return ok
+}
+
 // handleRescan implements the rescan command extension for websocket
 // connections.
 //
@@ -1815,6 +2784,9 @@ func descendantBlock(prevHash *wire.ShaHash, curBlock *btcutil.Block) error {
 // the chain (perhaps from a rescanprogress notification) to resume their
 // rescan.
 func handleRescan(wsc *wsClient, icmd interface{}) (interface{}, error) {
+	// The rescan was reserved when the command was queued.
+	defer wsc.releaseRescan()
+
 	cmd, ok := icmd.(*btcjson.RescanCmd)
 	if !ok {
 		return nil, btcjson.ErrRPCInternal
@@ -1848,6 +2820,7 @@ func handleRescan(wsc *wsClient, icmd interface{}) (interface{}, error) {
 	}
 	var compressedPubkey [33]byte
 	var uncompressedPubkey [65]byte
+	addrs := make([]btcutil.Address, 0, len(cmd.Addresses))
 	for _, addrStr := range cmd.Addresses {
 		addr, err := btcutil.DecodeAddress(addrStr, activeNetParams.Params)
 		if err != nil {
@@ -1858,6 +2831,7 @@ func handleRescan(wsc *wsClient, icmd interface{}) (interface{}, error) {
 			}
 			return nil, &jsonErr
 		}
+		addrs = append(addrs, addr)
 		switch a := addr.(type) {
 		case *btcutil.AddressPubKeyHash:
 			lookups.pubKeyHashes[*a.Hash160()] = struct{}{}
@@ -1924,16 +2898,58 @@ func handleRescan(wsc *wsClient, icmd interface{}) (interface{}, error) {
 		}
 	}
 
-	// lastBlock and lastBlockHash track the previously-rescanned block.
-	// They equal nil when no previous blocks have been rescanned.
-	var lastBlock *btcutil.Block
+	// Refuse rescans of more blocks than allowed by the
+	// --rpcmaxrescanblocks option.  Rescans without an end block cover the
+	// blocks up to the current best block.
+	if cfg.RPCMaxRescanBlocks > 0 {
+		endBlock := maxBlock
+		if maxBlock == database.AllShas {
+			_, bestHeight, err := db.NewestSha()
+			if err != nil {
+				return nil, &btcjson.RPCError{
+					Code:    btcjson.ErrRPCDatabase,
+					Message: "Database error: " + err.Error(),
+				}
+			}
+			endBlock = bestHeight + 1
+		}
+		if numBlocks := endBlock - minBlock; numBlocks > cfg.RPCMaxRescanBlocks {
+			return nil, &btcjson.RPCError{
+				Code: btcjson.ErrRPCInvalidParameter,
+				Message: fmt.Sprintf("Rescan of %d blocks exceeds "+
+					"the maximum of %d", numBlocks,
+					cfg.RPCMaxRescanBlocks),
+			}
+		}
+	}
+
+	// When the address index covers the rescan, only the blocks it lists
+	// up to its tip need to be fetched and rescanned.  The blocks above
+	// the tip are always rescanned.
+	indexedBlocks, indexTip := rescanIndexedBlocks(wsc, &lookups, addrs,
+		outpoints, minBlock, maxBlock)
+	if indexedBlocks != nil {
+		rpcsLog.Debugf("Rescanning %d blocks found in the address index "+
+			"up to height %d", len(indexedBlocks), indexTip)
+	}
+
+	// lastHeader, lastHeight and lastBlockHash track the
+	// previously-rescanned block.  The header and hash equal nil when no
+	// previous blocks have been rescanned.
+	var lastHeader *wire.BlockHeader
+	var lastHeight int64
 	var lastBlockHash *wire.ShaHash
 
-	// A ticker is created to wait at least 10 seconds before notifying the
-	// websocket client of the current progress completed by the rescan.
-	ticker := time.NewTicker(10 * time.Second)
+	// A ticker is created to wait at least rescanProgressInterval before
+	// notifying the websocket client of the current progress completed by
+	// the rescan.
+	ticker := time.NewTicker(rescanProgressInterval)
 	defer ticker.Stop()
 
+	// The rescan is stopped when this channel is closed by the stoprescan
+	// command.
+	stop := wsc.rescanQuitChan()
+
 	// FetchHeightRange may not return a complete list of block shas for
 	// the given range, so fetch range as many times as necessary.
 fetchRange:
@@ -1993,7 +3009,20 @@ fetchRange:
 
 	loopHashList:
 		for i := range hashList {
-			blk, err := db.FetchBlockBySha(&hashList[i])
+			// Only the header is needed for the blocks which the
+			// address index shows to be irrelevant to the rescan.
+			height := minBlock + int64(i)
+			var blk *btcutil.Block
+			var header *wire.BlockHeader
+			if rescanNeedsBlock(indexedBlocks, indexTip, &hashList[i],
+				height) {
+				blk, err = db.FetchBlockBySha(&hashList[i])
+				if err == nil {
+					header = &blk.MsgBlock().Header
+				}
+			} else {
+				header, _, err = db.FetchBlockHeaderBySha(&hashList[i])
+			}
 			if err != nil {
 				// Only handle reorgs if a block could not be
 				// found for the hash.
@@ -2035,28 +3064,40 @@ fetchRange:
 				if len(hashList) == 0 {
 					break fetchRange
 				}
+
+				// The blocks found in the address index may
+				// have been replaced by the reorg, so every
+				// remaining block is rescanned in full.
+				indexedBlocks = nil
 				goto loopHashList
 			}
 			if i == 0 && lastBlockHash != nil {
 				// Ensure the new hashList is on the same fork
 				// as the last block from the old hashList.
-				jsonErr := descendantBlock(lastBlockHash, blk)
+				jsonErr := descendantBlock(lastBlockHash, header)
 				if jsonErr != nil {
 					return nil, jsonErr
 				}
 			}
 
 			// A select statement is used to stop rescans if the
-			// client requesting the rescan has disconnected.
+			// client requesting the rescan has disconnected or
+			// stopped it.
 			select {
 			case <-wsc.quit:
 				rpcsLog.Debugf("Stopped rescan at height %v "+
-					"for disconnected client", blk.Height())
+					"for disconnected client", height)
 				return nil, nil
+			case <-stop:
+				rpcsLog.Infof("Stopped rescan at height %v", height)
+				return nil, &ErrRescanStopped
 			default:
-				rescanBlock(wsc, &lookups, blk)
-				lastBlock = blk
-				lastBlockHash = blk.Sha()
+				if blk != nil {
+					rescanBlock(wsc, &lookups, blk)
+				}
+				lastHeader = header
+				lastHeight = height
+				lastBlockHash = &hashList[i]
 			}
 
 			// Periodically notify the client of the progress
@@ -2069,8 +3110,7 @@ fetchRange:
 			}
 
 			n := btcjson.NewRescanProgressNtfn(hashList[i].String(),
-				int32(blk.Height()),
-				blk.MsgBlock().Header.Timestamp.Unix())
+				int32(height), header.Timestamp.Unix())
 			mn, err := btcjson.MarshalCmd(nil, n)
 			if err != nil {
 				rpcsLog.Errorf("Failed to marshal rescan "+
@@ -2081,7 +3121,7 @@ fetchRange:
 			if err = wsc.QueueNotification(mn); err == ErrClientQuit {
 				// Finished if the client disconnected.
 				rpcsLog.Debugf("Stopped rescan at height %v "+
-					"for disconnected client", blk.Height())
+					"for disconnected client", height)
 				return nil, nil
 			}
 		}
@@ -2097,8 +3137,7 @@ fetchRange:
 	// is needed to safely inform clients that all rescan notifications have
 	// been sent.
 	n := btcjson.NewRescanFinishedNtfn(lastBlockHash.String(),
-		int32(lastBlock.Height()),
-		lastBlock.MsgBlock().Header.Timestamp.Unix())
+		int32(lastHeight), lastHeader.Timestamp.Unix())
 	if mn, err := btcjson.MarshalCmd(nil, n); err != nil {
 		rpcsLog.Errorf("Failed to marshal rescan finished "+
 			"notification: %v", err)
@@ -2112,6 +3151,13 @@ fetchRange:
 	return nil, nil
 }
 
+// handleStopRescan implements the stoprescan command extension for websocket
+// connections.
+func handleStopRescan(wsc *wsClient, icmd interface{}) (interface{}, error) {
+	wsc.StopRescan()
+	return nil, nil
+}
+
 func init() {
 	wsHandlers = wsHandlersBeforeInit
 }
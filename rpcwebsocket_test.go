@@ -0,0 +1,379 @@
+// Copyright (c) 2015 PPCD developers.
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/btcsuite/golangcrypto/ripemd160"
+	"github.com/ppcsuite/btcutil"
+	"github.com/ppcsuite/ppcd/chaincfg"
+	"github.com/ppcsuite/ppcd/database"
+	"github.com/ppcsuite/ppcd/txscript"
+	"github.com/ppcsuite/ppcd/wire"
+)
+
+// testRescanDb is a database which only provides the transactions and the
+// address index used to limit rescans.
+type testRescanDb struct {
+	database.Db
+	txs       map[wire.ShaHash]*wire.MsgTx
+	addrTxs   map[string][]*database.TxListReply
+	indexTip  int64
+	indexErrs bool
+}
+
+// FetchTxBySha returns the transaction with the passed hash.
+func (db *testRescanDb) FetchTxBySha(hash *wire.ShaHash) ([]*database.TxListReply, error) {
+	tx, ok := db.txs[*hash]
+	if !ok {
+		return nil, database.ErrTxShaMissing
+	}
+	return []*database.TxListReply{{Sha: hash, Tx: tx}}, nil
+}
+
+// FetchAddrIndexTip returns the height of the address index tip.
+func (db *testRescanDb) FetchAddrIndexTip() (*wire.ShaHash, int64, error) {
+	if db.indexErrs {
+		return nil, 0, database.ErrNotImplemented
+	}
+	return &wire.ShaHash{}, db.indexTip, nil
+}
+
+// FetchTxsForAddr returns at most limit transactions of the passed address
+// after skipping the first skip transactions.
+func (db *testRescanDb) FetchTxsForAddr(addr btcutil.Address, skip, limit int) ([]*database.TxListReply, error) {
+	replies := db.addrTxs[addr.EncodeAddress()]
+	if skip > len(replies) {
+		skip = len(replies)
+	}
+	replies = replies[skip:]
+	if len(replies) > limit {
+		replies = replies[:limit]
+	}
+	return replies, nil
+}
+
+// TestRescanIndexedBlocks ensures rescans are limited to the blocks found in
+// the address index only when the index covers all of the rescanned addresses
+// and outpoints, and fall back to rescanning every block otherwise.
+func TestRescanIndexedBlocks(t *testing.T) {
+	oldCfg := cfg
+	defer func() { cfg = oldCfg }()
+	params := &chaincfg.MainNetParams
+
+	newAddr := func(b byte) *btcutil.AddressPubKeyHash {
+		hash := make([]byte, ripemd160.Size)
+		hash[0] = b
+		addr, err := btcutil.NewAddressPubKeyHash(hash, params)
+		if err != nil {
+			t.Fatalf("NewAddressPubKeyHash: %v", err)
+		}
+		return addr
+	}
+	rescanned := newAddr(1)
+	other := newAddr(2)
+
+	// newTx returns a transaction paying to the passed address.
+	newTx := func(addr btcutil.Address) *wire.MsgTx {
+		pkScript, err := txscript.PayToAddrScript(addr)
+		if err != nil {
+			t.Fatalf("PayToAddrScript: %v", err)
+		}
+		msgTx := wire.NewMsgTx()
+		msgTx.AddTxIn(wire.NewTxIn(&wire.OutPoint{}, nil))
+		msgTx.AddTxOut(wire.NewTxOut(1000, pkScript))
+		return msgTx
+	}
+	paysRescanned := newTx(rescanned)
+	paysOther := newTx(other)
+	paysRescannedHash := paysRescanned.TxSha()
+	paysOtherHash := paysOther.TxSha()
+
+	// The rescanned address has transactions in more blocks than fetched
+	// from the index at once, both in and out of the rescanned range.
+	blockHash := func(height int64) *wire.ShaHash {
+		return &wire.ShaHash{byte(height), byte(height >> 8)}
+	}
+	var replies []*database.TxListReply
+	for height := int64(0); height <= rescanIndexBatchSize+10; height++ {
+		replies = append(replies, &database.TxListReply{
+			BlkSha: blockHash(height),
+			Height: height,
+		})
+	}
+	wantBlocks := make(map[wire.ShaHash]struct{})
+	for height := int64(5); height < rescanIndexBatchSize+5; height++ {
+		wantBlocks[*blockHash(height)] = struct{}{}
+	}
+
+	tests := []struct {
+		name      string
+		addrIndex bool
+		caughtUp  bool
+		indexErrs bool
+		fallback  bool
+		outpoints []*wire.OutPoint
+		want      map[wire.ShaHash]struct{}
+	}{
+		{
+			name:      "indexed",
+			addrIndex: true,
+			caughtUp:  true,
+			outpoints: []*wire.OutPoint{{Hash: paysRescannedHash}},
+			want:      wantBlocks,
+		},
+		{
+			name:     "index disabled",
+			caughtUp: true,
+		},
+		{
+			name:      "index not caught up",
+			addrIndex: true,
+		},
+		{
+			name:      "index tip unavailable",
+			addrIndex: true,
+			caughtUp:  true,
+			indexErrs: true,
+		},
+		{
+			name:      "fallback address",
+			addrIndex: true,
+			caughtUp:  true,
+			fallback:  true,
+		},
+		{
+			name:      "outpoint paying to other address",
+			addrIndex: true,
+			caughtUp:  true,
+			outpoints: []*wire.OutPoint{
+				{Hash: paysRescannedHash},
+				{Hash: paysOtherHash},
+			},
+		},
+		{
+			name:      "outpoint of unknown transaction",
+			addrIndex: true,
+			caughtUp:  true,
+			outpoints: []*wire.OutPoint{{Hash: wire.ShaHash{1}}},
+		},
+		{
+			name:      "outpoint index out of range",
+			addrIndex: true,
+			caughtUp:  true,
+			outpoints: []*wire.OutPoint{
+				{Hash: paysRescannedHash, Index: 1},
+			},
+		},
+	}
+	for _, test := range tests {
+		cfg = &config{AddrIndex: test.addrIndex}
+		db := &testRescanDb{
+			txs: map[wire.ShaHash]*wire.MsgTx{
+				paysRescannedHash: paysRescanned,
+				paysOtherHash:     paysOther,
+			},
+			addrTxs: map[string][]*database.TxListReply{
+				rescanned.EncodeAddress(): replies,
+			},
+			indexTip:  rescanIndexBatchSize + 10,
+			indexErrs: test.indexErrs,
+		}
+		indexer := &addrIndexer{}
+		if test.caughtUp {
+			indexer.state = indexMaintain
+		}
+		wsc := &wsClient{server: &rpcServer{server: &server{
+			db:          db,
+			chainParams: params,
+			addrIndexer: indexer,
+		}}}
+		lookups := &rescanKeys{
+			fallbacks: map[string]struct{}{},
+			pubKeyHashes: map[[ripemd160.Size]byte]struct{}{
+				*rescanned.Hash160(): {},
+			},
+		}
+		if test.fallback {
+			lookups.fallbacks["fallback"] = struct{}{}
+		}
+
+		blocks, tip := rescanIndexedBlocks(wsc, lookups,
+			[]btcutil.Address{rescanned}, test.outpoints, 5,
+			rescanIndexBatchSize+5)
+		if test.want == nil {
+			if blocks != nil {
+				t.Errorf("%s: got %d blocks, want fallback to "+
+					"all blocks", test.name, len(blocks))
+			}
+			continue
+		}
+		if !reflect.DeepEqual(blocks, test.want) {
+			t.Errorf("%s: got %d blocks, want %d", test.name,
+				len(blocks), len(test.want))
+		}
+		if tip != db.indexTip {
+			t.Errorf("%s: got index tip %d, want %d", test.name, tip,
+				db.indexTip)
+		}
+	}
+}
+
+// TestRescanNeedsBlock ensures rescans fetch the blocks found in the address
+// index, the blocks above the index tip, and every block when the index does
+// not cover the rescan.
+func TestRescanNeedsBlock(t *testing.T) {
+	indexed := wire.ShaHash{1}
+	notIndexed := wire.ShaHash{2}
+	indexedBlocks := map[wire.ShaHash]struct{}{indexed: {}}
+
+	tests := []struct {
+		name          string
+		indexedBlocks map[wire.ShaHash]struct{}
+		hash          wire.ShaHash
+		height        int64
+		want          bool
+	}{
+		{"indexed block", indexedBlocks, indexed, 10, true},
+		{"block not indexed", indexedBlocks, notIndexed, 10, false},
+		{"block at index tip", indexedBlocks, notIndexed, 100, false},
+		{"block above index tip", indexedBlocks, notIndexed, 101, true},
+		{"no index", nil, notIndexed, 10, true},
+	}
+	for _, test := range tests {
+		got := rescanNeedsBlock(test.indexedBlocks, 100, &test.hash,
+			test.height)
+		if got != test.want {
+			t.Errorf("%s: got %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+// TestReserveRescan ensures clients may only have as many rescans running or
+// queued as allowed by the --rpcmaxrescans option.
+func TestReserveRescan(t *testing.T) {
+	oldCfg := cfg
+	defer func() { cfg = oldCfg }()
+	cfg = &config{RPCMaxRescans: 2}
+	wsc := &wsClient{}
+
+	for i, want := range []bool{true, true, false} {
+		if got := wsc.reserveRescan(); got != want {
+			t.Errorf("reservation %d: got %v, want %v", i, got, want)
+		}
+	}
+	wsc.releaseRescan()
+	if !wsc.reserveRescan() {
+		t.Errorf("reservation after release refused")
+	}
+	if wsc.numRescans != 2 {
+		t.Errorf("got %d rescans, want 2", wsc.numRescans)
+	}
+}
+
+// TestStopRescan ensures the stoprescan command stops the running rescan but
+// not the rescans started after it.
+func TestStopRescan(t *testing.T) {
+	wsc := &wsClient{rescanQuit: make(chan struct{})}
+
+	stop := wsc.rescanQuitChan()
+	wsc.StopRescan()
+	select {
+	case <-stop:
+	default:
+		t.Fatalf("running rescan not stopped")
+	}
+
+	next := wsc.rescanQuitChan()
+	select {
+	case <-next:
+		t.Fatalf("next rescan stopped")
+	default:
+	}
+
+	// Stopping again stops the rescan started after the first one.
+	wsc.StopRescan()
+	select {
+	case <-next:
+	default:
+		t.Errorf("next rescan not stopped")
+	}
+}
+
+// TestTemplateChangeReason ensures notifytemplates clients are notified of new
+// best chain tips, difficulty changes and fee increases of at least the
+// --templatefeedelta option, in that order of precedence.
+func TestTemplateChangeReason(t *testing.T) {
+	last := notifiedTemplate{
+		prevHash: wire.ShaHash{1},
+		bits:     0x1d00ffff,
+		posBits:  0x1c00ffff,
+		fees:     50000,
+	}
+	feeDelta := templateFeeDelta(0.1)
+
+	tests := []struct {
+		name string
+		cur  notifiedTemplate
+		want string
+	}{
+		{"unchanged", last, ""},
+		{"new tip", notifiedTemplate{wire.ShaHash{2}, 0x1d00ffff,
+			0x1c00ffff, 50000}, "newtip"},
+		{"new tip with other changes", notifiedTemplate{wire.ShaHash{2},
+			0x1d00fffe, 0x1c00fffe, 1000000}, "newtip"},
+		{"proof-of-work difficulty", notifiedTemplate{wire.ShaHash{1},
+			0x1d00fffe, 0x1c00ffff, 50000}, "difficulty"},
+		{"proof-of-stake difficulty", notifiedTemplate{wire.ShaHash{1},
+			0x1d00ffff, 0x1c00fffe, 50000}, "difficulty"},
+		{"difficulty with fee increase", notifiedTemplate{wire.ShaHash{1},
+			0x1d00ffff, 0x1c00fffe, 1000000}, "difficulty"},
+		{"fee increase of delta", notifiedTemplate{wire.ShaHash{1},
+			0x1d00ffff, 0x1c00ffff, 50000 + feeDelta}, "mempool"},
+		{"fee increase below delta", notifiedTemplate{wire.ShaHash{1},
+			0x1d00ffff, 0x1c00ffff, 50000 + feeDelta - 1}, ""},
+		{"fee decrease", notifiedTemplate{wire.ShaHash{1}, 0x1d00ffff,
+			0x1c00ffff, 0}, ""},
+	}
+	for _, test := range tests {
+		got := templateChangeReason(&last, &test.cur, feeDelta)
+		if got != test.want {
+			t.Errorf("%s: got reason %q, want %q", test.name, got,
+				test.want)
+		}
+	}
+
+	// A zero fee delta notifies of any fee increase.
+	cur := last
+	cur.fees++
+	if got := templateChangeReason(&last, &cur, 0); got != "mempool" {
+		t.Errorf("zero fee delta: got reason %q, want %q", got,
+			"mempool")
+	}
+}
+
+// TestTemplateFeeDelta ensures the --templatefeedelta option is converted to
+// Satoshi without truncation errors.
+func TestTemplateFeeDelta(t *testing.T) {
+	tests := []struct {
+		ppc  float64
+		want int64
+	}{
+		{0, 0},
+		{0.1, btcutil.SatoshiPerBitcoin / 10},
+		{0.29, 29 * btcutil.SatoshiPerBitcoin / 100},
+		{2, 2 * btcutil.SatoshiPerBitcoin},
+		{math.Inf(1), math.MaxInt64},
+		{math.NaN(), math.MaxInt64},
+	}
+	for _, test := range tests {
+		if got := templateFeeDelta(test.ppc); got != test.want {
+			t.Errorf("%v: got %d, want %d", test.ppc, got, test.want)
+		}
+	}
+}
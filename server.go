@@ -100,6 +100,10 @@ type server struct {
 	addrIndexer          *addrIndexer
 	txMemPool            *txMemPool
 	cpuMiner             *CPUMiner
+	stratumServer        *stratumServer
+	publishers           []notificationPublisher
+	metricsServer        *metricsServer
+	alertManager         *alertManager
 	modifyRebroadcastInv chan interface{}
 	newPeers             chan *peer
 	donePeers            chan *peer
@@ -114,6 +118,10 @@ type server struct {
 	nat                  NAT
 	db                   database.Db
 	timeSource           blockchain.MedianTimeSource
+
+	// ppc: clock provides the local time which may be mocked on the test
+	// networks.
+	clock *nodeClock
 }
 
 type peerState struct {
@@ -465,7 +473,7 @@ func (s *server) handleQuery(querymsg interface{}, state *peerState) {
 				Inbound:        p.inbound,
 				StartingHeight: p.startingHeight,
 				CurrentHeight:  p.lastBlock,
-				BanScore:       0,
+				BanScore:       int32(p.banScore),
 				SyncNode:       p == syncPeer,
 			}
 			info.PingTime = float64(p.lastPingMicros)
@@ -809,6 +817,14 @@ out:
 	}
 	s.blockManager.Stop()
 	s.addrManager.Stop()
+
+	// Save the memory pool now that the block manager, which is the only
+	// remaining source of changes to it, has stopped.
+	if !cfg.NoPersistMempool {
+		if err := s.txMemPool.DumpMempool(); err != nil {
+			srvrLog.Errorf("Unable to save the memory pool: %v", err)
+		}
+	}
 	s.wg.Done()
 	srvrLog.Tracef("Peer handler done")
 }
@@ -832,8 +848,6 @@ func (s *server) RelayInventory(invVect *wire.InvVect, data interface{}) {
 // BroadcastMessage sends msg to all peers currently connected to the server
 // except those in the passed peers to exclude.
 func (s *server) BroadcastMessage(msg wire.Message, exclPeers ...*peer) {
-	// XXX: Need to determine if this is an alert that has already been
-	// broadcast and refrain from broadcasting again.
 	bmsg := broadcastMsg{message: msg, excludePeers: exclPeers}
 	s.broadcast <- bmsg
 }
@@ -1068,6 +1082,21 @@ func (s *server) Start() {
 		s.cpuMiner.Start()
 	}
 
+	// Start the stratum server if it is enabled.
+	if s.stratumServer != nil {
+		s.stratumServer.Start()
+	}
+
+	// Start the notification publishers.
+	for _, publisher := range s.publishers {
+		publisher.Start()
+	}
+
+	// Start the metrics server if it is enabled.
+	if s.metricsServer != nil {
+		s.metricsServer.Start()
+	}
+
 	if cfg.AddrIndex {
 		s.addrIndexer.Start()
 	}
@@ -1093,6 +1122,21 @@ func (s *server) Stop() error {
 		}
 	}
 
+	// Stop the stratum server if needed.
+	if s.stratumServer != nil {
+		s.stratumServer.Stop()
+	}
+
+	// Stop the notification publishers.
+	for _, publisher := range s.publishers {
+		publisher.Stop()
+	}
+
+	// Stop the metrics server if needed.
+	if s.metricsServer != nil {
+		s.metricsServer.Stop()
+	}
+
 	// Stop the CPU miner if needed
 	s.cpuMiner.Stop()
 
@@ -1384,6 +1428,11 @@ func newServer(listenAddrs []string, db database.Db, chainParams *chaincfg.Param
 		}
 	}
 
+	clock := newNodeClock(cfg.RegressionTest || cfg.SimNet)
+	if err := clock.advanceToBestBlock(db); err != nil {
+		return nil, err
+	}
+
 	s := server{
 		nonce:                nonce,
 		listeners:            listeners,
@@ -1401,7 +1450,8 @@ func newServer(listenAddrs []string, db database.Db, chainParams *chaincfg.Param
 		peerHeightsUpdate:    make(chan updatePeerHeightsMsg),
 		nat:                  nat,
 		db:                   db,
-		timeSource:           blockchain.NewMedianTime(),
+		clock:                clock,
+		timeSource:           blockchain.NewMedianTimeWithClock(clock.Now),
 	}
 	bm, err := newBlockManager(&s)
 	if err != nil {
@@ -1410,6 +1460,10 @@ func newServer(listenAddrs []string, db database.Db, chainParams *chaincfg.Param
 	s.blockManager = bm
 	s.txMemPool = newTxMemPool(&s)
 	s.cpuMiner = newCPUMiner(&s)
+	s.alertManager, err = newAlertManager(&s)
+	if err != nil {
+		return nil, err
+	}
 
 	if cfg.AddrIndex {
 		ai, err := newAddrIndexer(&s)
@@ -1426,6 +1480,28 @@ func newServer(listenAddrs []string, db database.Db, chainParams *chaincfg.Param
 		}
 	}
 
+	if len(cfg.StratumListeners) > 0 {
+		s.stratumServer, err = newStratumServer(cfg.StratumListeners, &s)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if addrTopics := zmqAddrTopics(); len(addrTopics) > 0 {
+		zmqPublisher, err := newZMQPublisher(addrTopics)
+		if err != nil {
+			return nil, err
+		}
+		s.publishers = append(s.publishers, zmqPublisher)
+	}
+
+	if len(cfg.MetricsListeners) > 0 {
+		s.metricsServer, err = newMetricsServer(cfg.MetricsListeners, &s)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	return &s, nil
 }
 
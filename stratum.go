@@ -0,0 +1,1001 @@
+// Copyright (c) 2015 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/big"
+	"math/rand"
+	"net"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ppcsuite/btcutil"
+	"github.com/ppcsuite/ppcd/blockchain"
+	"github.com/ppcsuite/ppcd/wire"
+)
+
+const (
+	// stratumExtraNonce1Size is the size in bytes of the extra nonce the
+	// server assigns to each client.
+	stratumExtraNonce1Size = 4
+
+	// stratumExtraNonce2Size is the size in bytes of the extra nonce each
+	// client is free to roll while searching for shares.
+	stratumExtraNonce2Size = 4
+
+	// stratumExtraNoncePlaceholder is the extra nonce used in the coinbase
+	// transaction of new jobs.  Its script encoding is exactly as long as
+	// both extra nonces combined, so the serialized coinbase transaction is
+	// split around it and clients fill the gap with their extra nonces.
+	stratumExtraNoncePlaceholder = 0x7fffffffffffffff
+
+	// stratumMaxClients is the maximum number of stratum clients which may
+	// be connected at the same time.
+	stratumMaxClients = 1000
+
+	// stratumMaxMessageSize is the maximum size in bytes of a single
+	// message read from a stratum client.
+	stratumMaxMessageSize = 4096
+
+	// stratumIdleTimeout is the duration after which clients that have not
+	// sent any messages are disconnected.
+	stratumIdleTimeout = time.Minute * 10
+
+	// stratumWriteTimeout is the maximum duration a write to a client may
+	// take before the client is disconnected.
+	stratumWriteTimeout = time.Second * 30
+
+	// stratumSendQueueSize is the number of messages which may be queued
+	// for a client before it is considered too slow and disconnected.
+	stratumSendQueueSize = 64
+
+	// stratumMaxJobs is the number of most recent jobs for which shares
+	// are still accepted.
+	stratumMaxJobs = 8
+
+	// stratumJobCheckInterval is the interval at which the server checks
+	// for a new best chain tip or new transactions to create a new job.
+	stratumJobCheckInterval = time.Second
+
+	// stratumJobRefreshInterval is the minimum duration between jobs which
+	// only update the transactions of the current job.
+	stratumJobRefreshInterval = time.Minute
+
+	// stratumShareInterval is the desired average duration between shares
+	// submitted by a client which the variable difficulty targets.
+	stratumShareInterval = time.Second * 10
+
+	// stratumRetargetInterval is the maximum duration between difficulty
+	// adjustments of a client.
+	stratumRetargetInterval = time.Minute * 2
+
+	// stratumRetargetShares is the number of shares which triggers a
+	// difficulty adjustment before the retarget interval has elapsed.
+	stratumRetargetShares = 30
+
+	// stratumMaxRetargetFactor is the maximum factor the difficulty of a
+	// client is adjusted by in either direction at once.
+	stratumMaxRetargetFactor = 16
+
+	// stratumMaxTimeOffset is the maximum duration the timestamp of a share
+	// may be ahead of the adjusted time.
+	stratumMaxTimeOffset = time.Hour * 2
+)
+
+// stratumDiff1Target is the target which corresponds to a share difficulty of
+// one as used by stratum mining software.
+var stratumDiff1Target = blockchain.CompactToBig(0x1d00ffff)
+
+// stratumError is an error returned to a stratum client in response to a
+// request.  It is marshalled as the array of an error code, a message and a
+// traceback expected by stratum clients.
+type stratumError struct {
+	Code    int
+	Message string
+}
+
+// MarshalJSON marshals the error in the format expected by stratum clients.
+func (e *stratumError) MarshalJSON() ([]byte, error) {
+	return json.Marshal([]interface{}{e.Code, e.Message, nil})
+}
+
+// Errors returned to stratum clients.
+var (
+	stratumErrUnknownMethod  = &stratumError{20, "Unknown method"}
+	stratumErrInvalidParams  = &stratumError{20, "Invalid parameters"}
+	stratumErrTimeOutOfRange = &stratumError{20, "Time out of range"}
+	stratumErrJobNotFound    = &stratumError{21, "Job not found"}
+	stratumErrDuplicateShare = &stratumError{22, "Duplicate share"}
+	stratumErrLowDifficulty  = &stratumError{23, "Low difficulty share"}
+	stratumErrUnauthorized   = &stratumError{24, "Unauthorized worker"}
+	stratumErrNotSubscribed  = &stratumError{25, "Not subscribed"}
+)
+
+// stratumRequest is a request received from a stratum client.
+type stratumRequest struct {
+	ID     interface{}       `json:"id"`
+	Method string            `json:"method"`
+	Params []json.RawMessage `json:"params"`
+}
+
+// stringParams unmarshals the first n parameters of the request as strings.
+func (r *stratumRequest) stringParams(n int) ([]string, bool) {
+	if len(r.Params) < n {
+		return nil, false
+	}
+	params := make([]string, n)
+	for i := range params {
+		if err := json.Unmarshal(r.Params[i], &params[i]); err != nil {
+			return nil, false
+		}
+	}
+	return params, true
+}
+
+// stratumResponse is a response sent to a stratum client.
+type stratumResponse struct {
+	ID     interface{}   `json:"id"`
+	Result interface{}   `json:"result"`
+	Error  *stratumError `json:"error"`
+}
+
+// stratumNotification is a notification sent to a stratum client.
+type stratumNotification struct {
+	ID     interface{}   `json:"id"`
+	Method string        `json:"method"`
+	Params []interface{} `json:"params"`
+}
+
+// stratumDifficultyTarget returns the target a share must not exceed to meet
+// the passed share difficulty.
+func stratumDifficultyTarget(difficulty float64) *big.Int {
+	target := new(big.Rat).SetInt(stratumDiff1Target)
+	target.Quo(target, new(big.Rat).SetFloat64(difficulty))
+	return new(big.Int).Quo(target.Num(), target.Denom())
+}
+
+// stratumMerkleBranch returns the merkle branch which leads from the coinbase
+// transaction of the passed transactions to the merkle root.  Hashing the
+// coinbase transaction hash with each of the branch hashes in order produces
+// the same merkle root as BuildMerkleTreeStore.
+func stratumMerkleBranch(txns []*wire.MsgTx) []*wire.ShaHash {
+	level := make([]*wire.ShaHash, 0, len(txns))
+	for _, tx := range txns[1:] {
+		hash := tx.TxSha()
+		level = append(level, &hash)
+	}
+
+	var branch []*wire.ShaHash
+	for len(level) > 0 {
+		branch = append(branch, level[0])
+
+		// The remaining hashes of the level are paired up while the
+		// first one is combined with the coinbase side of the tree.
+		// The last hash is duplicated when there is an odd number of
+		// them.
+		rest := level[1:]
+		if len(rest)%2 != 0 {
+			rest = append(rest, rest[len(rest)-1])
+		}
+		next := make([]*wire.ShaHash, 0, len(rest)/2)
+		for i := 0; i < len(rest); i += 2 {
+			next = append(next, blockchain.HashMerkleBranches(rest[i],
+				rest[i+1]))
+		}
+		level = next
+	}
+	return branch
+}
+
+// stratumJob houses a block template which is handed out to stratum clients
+// along with the pieces clients need to assemble block headers from it.
+type stratumJob struct {
+	id           string
+	template     *BlockTemplate
+	coinbase1    []byte
+	coinbase2    []byte
+	merkleBranch []*wire.ShaHash
+	shares       map[wire.ShaHash]struct{}
+	created      time.Time
+}
+
+// newStratumJob returns a new stratum job with the passed id for the passed
+// block template.  The extra nonce of the coinbase transaction of the template
+// is replaced with a placeholder in order to split the coinbase transaction
+// around it.
+func newStratumJob(id string, template *BlockTemplate) (*stratumJob, error) {
+	msgBlock := template.block
+	err := UpdateExtraNonce(msgBlock, template.height,
+		stratumExtraNoncePlaceholder)
+	if err != nil {
+		return nil, err
+	}
+
+	coinbaseTx := msgBlock.Transactions[0]
+	var buf bytes.Buffer
+	buf.Grow(coinbaseTx.SerializeSize())
+	if err := coinbaseTx.Serialize(&buf); err != nil {
+		return nil, err
+	}
+	serializedTx := buf.Bytes()
+
+	var placeholder [stratumExtraNonce1Size + stratumExtraNonce2Size]byte
+	binary.LittleEndian.PutUint64(placeholder[:],
+		stratumExtraNoncePlaceholder)
+	script := coinbaseTx.TxIn[0].SignatureScript
+	scriptOffset := bytes.Index(serializedTx, script)
+	nonceOffset := bytes.Index(script, placeholder[:])
+	if scriptOffset < 0 || nonceOffset < 0 {
+		return nil, errors.New("unable to locate the extra nonce in " +
+			"the coinbase transaction")
+	}
+	offset := scriptOffset + nonceOffset
+
+	return &stratumJob{
+		id:           id,
+		template:     template,
+		coinbase1:    serializedTx[:offset],
+		coinbase2:    serializedTx[offset+len(placeholder):],
+		merkleBranch: stratumMerkleBranch(msgBlock.Transactions),
+		shares:       make(map[wire.ShaHash]struct{}),
+		created:      time.Now(),
+	}, nil
+}
+
+// notification returns the mining.notify notification for the job.  Clients
+// are told to abandon their previous jobs when cleanJobs is set.
+func (j *stratumJob) notification(cleanJobs bool) *stratumNotification {
+	header := &j.template.block.Header
+
+	// The previous block hash is sent with the bytes of each 32-bit word
+	// reversed as expected by stratum mining software.
+	prevHash := header.PrevBlock
+	for i := 0; i < wire.HashSize; i += 4 {
+		prevHash[i], prevHash[i+3] = prevHash[i+3], prevHash[i]
+		prevHash[i+1], prevHash[i+2] = prevHash[i+2], prevHash[i+1]
+	}
+
+	merkleBranch := make([]string, 0, len(j.merkleBranch))
+	for _, hash := range j.merkleBranch {
+		merkleBranch = append(merkleBranch, hex.EncodeToString(hash[:]))
+	}
+
+	return &stratumNotification{
+		Method: "mining.notify",
+		Params: []interface{}{
+			j.id,
+			hex.EncodeToString(prevHash[:]),
+			hex.EncodeToString(j.coinbase1),
+			hex.EncodeToString(j.coinbase2),
+			merkleBranch,
+			fmt.Sprintf("%08x", uint32(header.Version)),
+			fmt.Sprintf("%08x", header.Bits),
+			fmt.Sprintf("%08x", uint32(header.Timestamp.Unix())),
+			cleanJobs,
+		},
+	}
+}
+
+// stratumServer provides a stratum mining server which hands out work for
+// proof-of-work blocks to external mining software and submits the blocks they
+// solve.
+type stratumServer struct {
+	started   int32 // atomic
+	shutdown  int32 // atomic
+	server    *server
+	listeners []net.Listener
+	wg        sync.WaitGroup
+	quit      chan struct{}
+
+	// The following fields are protected by the mutex.
+	mtx             sync.Mutex
+	clients         map[*stratumClient]struct{}
+	jobs            map[string]*stratumJob
+	jobOrder        []string
+	curJob          *stratumJob
+	nextJobID       uint64
+	nextExtraNonce1 uint32
+	lastTxUpdate    time.Time
+}
+
+// listenHandler accepts incoming connections on the passed listener.  It must
+// be run as a goroutine.
+func (s *stratumServer) listenHandler(listener net.Listener) {
+	minrLog.Infof("Stratum server listening on %s", listener.Addr())
+	for atomic.LoadInt32(&s.shutdown) == 0 {
+		conn, err := listener.Accept()
+		if err != nil {
+			// Only log the error if we're not forcibly shutting down.
+			if atomic.LoadInt32(&s.shutdown) == 0 {
+				minrLog.Errorf("Can't accept stratum connection: %v",
+					err)
+			}
+			continue
+		}
+
+		s.mtx.Lock()
+		if atomic.LoadInt32(&s.shutdown) != 0 {
+			s.mtx.Unlock()
+			conn.Close()
+			continue
+		}
+		if len(s.clients) >= stratumMaxClients {
+			s.mtx.Unlock()
+			minrLog.Infof("Max stratum clients exceeded [%d] - "+
+				"disconnecting client %s", stratumMaxClients,
+				conn.RemoteAddr())
+			conn.Close()
+			continue
+		}
+		client := newStratumClient(s, conn, s.nextExtraNonce1)
+		s.nextExtraNonce1++
+		s.clients[client] = struct{}{}
+		s.mtx.Unlock()
+
+		minrLog.Debugf("New stratum client %s", client.addr)
+		client.Start()
+	}
+	s.wg.Done()
+	minrLog.Tracef("Stratum listener done for %s", listener.Addr())
+}
+
+// removeClient removes the passed client from the server.
+//
+// This function is safe for concurrent access.
+func (s *stratumServer) removeClient(c *stratumClient) {
+	s.mtx.Lock()
+	delete(s.clients, c)
+	s.mtx.Unlock()
+}
+
+// connectedClients returns a snapshot of the currently connected clients.
+//
+// This function is safe for concurrent access.
+func (s *stratumServer) connectedClients() []*stratumClient {
+	s.mtx.Lock()
+	clients := make([]*stratumClient, 0, len(s.clients))
+	for client := range s.clients {
+		clients = append(clients, client)
+	}
+	s.mtx.Unlock()
+	return clients
+}
+
+// currentJob returns the most recent job or nil when there is none yet.
+//
+// This function is safe for concurrent access.
+func (s *stratumServer) currentJob() *stratumJob {
+	s.mtx.Lock()
+	job := s.curJob
+	s.mtx.Unlock()
+	return job
+}
+
+// job returns the job with the passed id or nil when it is unknown or no
+// longer valid.
+//
+// This function is safe for concurrent access.
+func (s *stratumServer) job(id string) *stratumJob {
+	s.mtx.Lock()
+	job := s.jobs[id]
+	s.mtx.Unlock()
+	return job
+}
+
+// recordShare records the share with the passed block hash for the passed job.
+// It returns false when the share was already submitted.
+//
+// This function is safe for concurrent access.
+func (s *stratumServer) recordShare(job *stratumJob, hash *wire.ShaHash) bool {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if _, exists := job.shares[*hash]; exists {
+		return false
+	}
+	job.shares[*hash] = struct{}{}
+	return true
+}
+
+// updateJob creates and broadcasts a new job when the best chain tip changed
+// or, once the current job is old enough, when the memory pool was updated.
+// Clients are told to abandon their previous jobs when the chain tip changed
+// since any shares for them would be stale.
+func (s *stratumServer) updateJob() {
+	s.mtx.Lock()
+	numClients := len(s.clients)
+	curJob := s.curJob
+	lastTxUpdate := s.lastTxUpdate
+	s.mtx.Unlock()
+
+	// There is no point in creating work without any clients, or without
+	// any peers since there is no way to relay a solved block.
+	if numClients == 0 || s.server.ConnectedCount() == 0 {
+		return
+	}
+
+	// No point in creating work before the chain is synced.  Also, grab
+	// the same lock as used for block submission, since the current block
+	// will be changing and this would otherwise end up building a new
+	// block template on a block that is in the process of becoming stale.
+	m := s.server.cpuMiner
+	m.submitBlockLock.Lock()
+	latestHash, curHeight := s.server.blockManager.chainState.Best()
+	if curHeight != 0 && !s.server.blockManager.IsCurrent() {
+		m.submitBlockLock.Unlock()
+		return
+	}
+	txUpdate := s.server.txMemPool.LastUpdated()
+	cleanJobs := curJob == nil ||
+		!curJob.template.block.Header.PrevBlock.IsEqual(latestHash)
+	if !cleanJobs && (txUpdate == lastTxUpdate ||
+		time.Since(curJob.created) < stratumJobRefreshInterval) {
+
+		m.submitBlockLock.Unlock()
+		return
+	}
+
+	// Choose a payment address at random and create a new block template
+	// using the available transactions in the memory pool.
+	payToAddr := cfg.miningAddrs[rand.Intn(len(cfg.miningAddrs))]
+	template, err := NewBlockTemplate(s.server.txMemPool, payToAddr, nil) // ppc:
+	m.submitBlockLock.Unlock()
+	if err != nil {
+		minrLog.Errorf("Failed to create new block template: %v", err)
+		return
+	}
+
+	s.mtx.Lock()
+	jobID := strconv.FormatUint(s.nextJobID, 16)
+	s.nextJobID++
+	s.mtx.Unlock()
+	job, err := newStratumJob(jobID, template)
+	if err != nil {
+		minrLog.Errorf("Failed to create new stratum job: %v", err)
+		return
+	}
+
+	s.mtx.Lock()
+	if cleanJobs {
+		s.jobs = make(map[string]*stratumJob)
+		s.jobOrder = nil
+	}
+	s.jobs[job.id] = job
+	s.jobOrder = append(s.jobOrder, job.id)
+	if len(s.jobOrder) > stratumMaxJobs {
+		delete(s.jobs, s.jobOrder[0])
+		s.jobOrder = s.jobOrder[1:]
+	}
+	s.curJob = job
+	s.lastTxUpdate = txUpdate
+	s.mtx.Unlock()
+
+	minrLog.Debugf("New stratum job %s for block height %d (%d "+
+		"transactions, clean %v)", job.id, template.height,
+		len(template.block.Transactions), cleanJobs)
+
+	for _, client := range s.connectedClients() {
+		client.sendJob(job, cleanJobs)
+	}
+}
+
+// jobHandler periodically updates the job handed out to clients and adjusts
+// the difficulty of the clients.  It must be run as a goroutine.
+func (s *stratumServer) jobHandler() {
+	ticker := time.NewTicker(stratumJobCheckInterval)
+	defer ticker.Stop()
+out:
+	for {
+		select {
+		case <-ticker.C:
+			s.updateJob()
+			for _, client := range s.connectedClients() {
+				client.retarget()
+			}
+
+		case <-s.quit:
+			break out
+		}
+	}
+	s.wg.Done()
+	minrLog.Tracef("Stratum job handler done")
+}
+
+// Start begins accepting stratum clients and handing out work to them.
+func (s *stratumServer) Start() {
+	if atomic.AddInt32(&s.started, 1) != 1 {
+		return
+	}
+
+	minrLog.Trace("Starting stratum server")
+	for _, listener := range s.listeners {
+		s.wg.Add(1)
+		go s.listenHandler(listener)
+	}
+	s.wg.Add(1)
+	go s.jobHandler()
+}
+
+// Stop stops the stratum server and disconnects all of its clients.
+func (s *stratumServer) Stop() error {
+	if atomic.AddInt32(&s.shutdown, 1) != 1 {
+		minrLog.Infof("Stratum server is already in the process of " +
+			"shutting down")
+		return nil
+	}
+	minrLog.Warnf("Stratum server shutting down")
+	for _, listener := range s.listeners {
+		err := listener.Close()
+		if err != nil {
+			minrLog.Errorf("Problem shutting down stratum server: %v",
+				err)
+			return err
+		}
+	}
+	close(s.quit)
+	for _, client := range s.connectedClients() {
+		client.Disconnect()
+	}
+	s.wg.Wait()
+	minrLog.Infof("Stratum server shutdown complete")
+	return nil
+}
+
+// newStratumServer returns a new stratum server listening on the passed
+// addresses.
+func newStratumServer(listenAddrs []string, s *server) (*stratumServer, error) {
+	ipv4ListenAddrs, ipv6ListenAddrs, _, err := parseListeners(listenAddrs)
+	if err != nil {
+		return nil, err
+	}
+	listeners := make([]net.Listener, 0,
+		len(ipv6ListenAddrs)+len(ipv4ListenAddrs))
+	for _, addr := range ipv4ListenAddrs {
+		listener, err := net.Listen("tcp4", addr)
+		if err != nil {
+			minrLog.Warnf("Can't listen on %s: %v", addr, err)
+			continue
+		}
+		listeners = append(listeners, listener)
+	}
+	for _, addr := range ipv6ListenAddrs {
+		listener, err := net.Listen("tcp6", addr)
+		if err != nil {
+			minrLog.Warnf("Can't listen on %s: %v", addr, err)
+			continue
+		}
+		listeners = append(listeners, listener)
+	}
+	if len(listeners) == 0 {
+		return nil, errors.New("STRATUM: No valid listen address")
+	}
+
+	return &stratumServer{
+		server:          s,
+		listeners:       listeners,
+		quit:            make(chan struct{}),
+		clients:         make(map[*stratumClient]struct{}),
+		jobs:            make(map[string]*stratumJob),
+		nextExtraNonce1: rand.Uint32(),
+	}, nil
+}
+
+// stratumClient is a mining client connected to the stratum server.
+type stratumClient struct {
+	server       *stratumServer
+	conn         net.Conn
+	addr         string
+	extraNonce1  []byte
+	sendQueue    chan []byte
+	quit         chan struct{}
+	disconnected int32 // atomic
+
+	// The following fields are protected by the mutex.
+	mtx            sync.Mutex
+	subscribed     bool
+	workers        map[string]struct{}
+	difficulty     float64
+	prevDifficulty float64
+	numShares      int
+	lastRetarget   time.Time
+}
+
+// newStratumClient returns a new stratum client for the passed connection
+// which is assigned the passed extra nonce.
+func newStratumClient(s *stratumServer, conn net.Conn, extraNonce1 uint32) *stratumClient {
+	c := &stratumClient{
+		server:       s,
+		conn:         conn,
+		addr:         conn.RemoteAddr().String(),
+		extraNonce1:  make([]byte, stratumExtraNonce1Size),
+		sendQueue:    make(chan []byte, stratumSendQueueSize),
+		quit:         make(chan struct{}),
+		workers:      make(map[string]struct{}),
+		difficulty:   cfg.StratumDifficulty,
+		lastRetarget: time.Now(),
+	}
+	binary.BigEndian.PutUint32(c.extraNonce1, extraNonce1)
+	return c
+}
+
+// Start begins processing messages from and to the client.
+func (c *stratumClient) Start() {
+	c.server.wg.Add(2)
+	go c.inHandler()
+	go c.outHandler()
+}
+
+// Disconnect disconnects the client.  It is safe to call multiple times.
+func (c *stratumClient) Disconnect() {
+	if atomic.AddInt32(&c.disconnected, 1) != 1 {
+		return
+	}
+	minrLog.Debugf("Disconnecting stratum client %s", c.addr)
+	close(c.quit)
+	c.conn.Close()
+}
+
+// inHandler reads and handles the newline delimited requests of the client.
+// It must be run as a goroutine.
+func (c *stratumClient) inHandler() {
+	reader := bufio.NewReaderSize(c.conn, stratumMaxMessageSize)
+out:
+	for {
+		c.conn.SetReadDeadline(time.Now().Add(stratumIdleTimeout))
+		line, err := reader.ReadSlice('\n')
+		if err != nil {
+			if err != io.EOF && atomic.LoadInt32(&c.disconnected) == 0 {
+				minrLog.Debugf("Can't read message from stratum "+
+					"client %s: %v", c.addr, err)
+			}
+			break out
+		}
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+
+		var request stratumRequest
+		if err := json.Unmarshal(line, &request); err != nil {
+			minrLog.Debugf("Malformed message from stratum client "+
+				"%s: %v", c.addr, err)
+			break out
+		}
+		result, jsonErr := c.handleRequest(&request)
+		c.queueMessage(&stratumResponse{
+			ID:     request.ID,
+			Result: result,
+			Error:  jsonErr,
+		})
+
+		// Newly subscribed clients need a difficulty and a job to
+		// start working on.
+		if request.Method == "mining.subscribe" && jsonErr == nil {
+			c.sendDifficulty()
+			if job := c.server.currentJob(); job != nil {
+				c.sendJob(job, true)
+			}
+		}
+	}
+
+	c.Disconnect()
+	c.server.removeClient(c)
+	c.server.wg.Done()
+	minrLog.Tracef("Stratum client input handler done for %s", c.addr)
+}
+
+// outHandler writes the queued messages to the client.  It must be run as a
+// goroutine.
+func (c *stratumClient) outHandler() {
+out:
+	for {
+		select {
+		case msg := <-c.sendQueue:
+			c.conn.SetWriteDeadline(time.Now().Add(stratumWriteTimeout))
+			if _, err := c.conn.Write(msg); err != nil {
+				if atomic.LoadInt32(&c.disconnected) == 0 {
+					minrLog.Debugf("Can't write message to "+
+						"stratum client %s: %v", c.addr, err)
+				}
+				c.Disconnect()
+				break out
+			}
+
+		case <-c.quit:
+			break out
+		}
+	}
+	c.server.wg.Done()
+	minrLog.Tracef("Stratum client output handler done for %s", c.addr)
+}
+
+// queueMessage marshals and queues the passed message to be sent to the
+// client.  Clients which do not keep up with their messages are disconnected.
+//
+// This function is safe for concurrent access.
+func (c *stratumClient) queueMessage(msg interface{}) {
+	marshalled, err := json.Marshal(msg)
+	if err != nil {
+		minrLog.Errorf("Failed to marshal stratum message: %v", err)
+		return
+	}
+	marshalled = append(marshalled, '\n')
+
+	select {
+	case c.sendQueue <- marshalled:
+	case <-c.quit:
+	default:
+		minrLog.Warnf("Send queue of stratum client %s is full - "+
+			"disconnecting", c.addr)
+		c.Disconnect()
+	}
+}
+
+// sendDifficulty sends the current share difficulty to the client.
+//
+// This function is safe for concurrent access.
+func (c *stratumClient) sendDifficulty() {
+	c.mtx.Lock()
+	difficulty := c.difficulty
+	c.mtx.Unlock()
+
+	c.queueMessage(&stratumNotification{
+		Method: "mining.set_difficulty",
+		Params: []interface{}{difficulty},
+	})
+}
+
+// sendJob sends the passed job to the client when it is subscribed.  Shares
+// meeting the previous difficulty of the client are no longer accepted once a
+// new job was sent.
+//
+// This function is safe for concurrent access.
+func (c *stratumClient) sendJob(job *stratumJob, cleanJobs bool) {
+	c.mtx.Lock()
+	subscribed := c.subscribed
+	c.prevDifficulty = 0
+	c.mtx.Unlock()
+
+	if subscribed {
+		c.queueMessage(job.notification(cleanJobs))
+	}
+}
+
+// retarget adjusts the share difficulty of the client so it submits shares at
+// about the rate of stratumShareInterval.  The difficulty is adjusted once the
+// retarget interval elapsed or enough shares were submitted and never drops
+// below the configured minimum difficulty.
+//
+// This function is safe for concurrent access.
+func (c *stratumClient) retarget() {
+	c.mtx.Lock()
+	elapsed := time.Since(c.lastRetarget)
+	if !c.subscribed || (elapsed < stratumRetargetInterval &&
+		c.numShares < stratumRetargetShares) {
+
+		c.mtx.Unlock()
+		return
+	}
+
+	rate := float64(c.numShares) / elapsed.Seconds()
+	factor := rate * stratumShareInterval.Seconds()
+	if factor > stratumMaxRetargetFactor {
+		factor = stratumMaxRetargetFactor
+	} else if factor < 1.0/stratumMaxRetargetFactor {
+		factor = 1.0 / stratumMaxRetargetFactor
+	}
+	newDifficulty := c.difficulty * factor
+	if newDifficulty < cfg.StratumDifficulty {
+		newDifficulty = cfg.StratumDifficulty
+	}
+	c.numShares = 0
+	c.lastRetarget = time.Now()
+
+	// Avoid bothering the client with insignificant adjustments.
+	if math.Abs(newDifficulty-c.difficulty) < c.difficulty*0.1 {
+		c.mtx.Unlock()
+		return
+	}
+	oldDifficulty := c.difficulty
+	c.difficulty = newDifficulty
+	c.mtx.Unlock()
+
+	minrLog.Debugf("Adjusted difficulty of stratum client %s from %v to "+
+		"%v", c.addr, oldDifficulty, newDifficulty)
+
+	// Clients only apply a new difficulty to the next job, so resend the
+	// current job after the difficulty.  Shares which still meet the old
+	// difficulty are accepted until then.
+	c.sendDifficulty()
+	job := c.server.currentJob()
+	if job != nil {
+		c.sendJob(job, false)
+	}
+	c.mtx.Lock()
+	c.prevDifficulty = oldDifficulty
+	c.mtx.Unlock()
+}
+
+// handleRequest handles the passed request of the client and returns the
+// result or the error to respond with.
+func (c *stratumClient) handleRequest(request *stratumRequest) (interface{}, *stratumError) {
+	switch request.Method {
+	case "mining.subscribe":
+		return c.handleSubscribe(request)
+	case "mining.authorize":
+		return c.handleAuthorize(request)
+	case "mining.submit":
+		return c.handleSubmit(request)
+	}
+	return nil, stratumErrUnknownMethod
+}
+
+// handleSubscribe handles the mining.subscribe request.  The result contains
+// the subscription details, the extra nonce assigned to the client and the
+// size of the extra nonce the client rolls.
+func (c *stratumClient) handleSubscribe(request *stratumRequest) (interface{}, *stratumError) {
+	c.mtx.Lock()
+	c.subscribed = true
+	c.mtx.Unlock()
+
+	id := hex.EncodeToString(c.extraNonce1)
+	subscriptions := [][]string{
+		{"mining.set_difficulty", id},
+		{"mining.notify", id},
+	}
+	return []interface{}{subscriptions, id, stratumExtraNonce2Size}, nil
+}
+
+// handleAuthorize handles the mining.authorize request.  Since all blocks pay
+// to the configured mining addresses, any worker name is accepted and the
+// password is ignored.  Authenticating clients is out of scope for the stratum
+// server, so access to it must be restricted by only listening on trusted
+// interfaces or by firewalling.
+func (c *stratumClient) handleAuthorize(request *stratumRequest) (interface{}, *stratumError) {
+	params, ok := request.stringParams(1)
+	if !ok {
+		return nil, stratumErrInvalidParams
+	}
+
+	c.mtx.Lock()
+	c.workers[params[0]] = struct{}{}
+	c.mtx.Unlock()
+
+	minrLog.Debugf("Stratum client %s authorized worker %s", c.addr,
+		params[0])
+	return true, nil
+}
+
+// handleSubmit handles the mining.submit request.
+func (c *stratumClient) handleSubmit(request *stratumRequest) (interface{}, *stratumError) {
+	params, ok := request.stringParams(5)
+	if !ok {
+		return nil, stratumErrInvalidParams
+	}
+
+	c.mtx.Lock()
+	subscribed := c.subscribed
+	_, authorized := c.workers[params[0]]
+	c.mtx.Unlock()
+	if !subscribed {
+		return nil, stratumErrNotSubscribed
+	}
+	if !authorized {
+		return nil, stratumErrUnauthorized
+	}
+
+	extraNonce2, err := hex.DecodeString(params[2])
+	if err != nil || len(extraNonce2) != stratumExtraNonce2Size {
+		return nil, stratumErrInvalidParams
+	}
+	ntime, err := strconv.ParseUint(params[3], 16, 32)
+	if err != nil {
+		return nil, stratumErrInvalidParams
+	}
+	nonce, err := strconv.ParseUint(params[4], 16, 32)
+	if err != nil {
+		return nil, stratumErrInvalidParams
+	}
+
+	job := c.server.job(params[1])
+	if job == nil {
+		return nil, stratumErrJobNotFound
+	}
+	return c.submitShare(params[0], job, extraNonce2, uint32(ntime),
+		uint32(nonce))
+}
+
+// submitShare validates the share of the passed worker described by the passed
+// job, extra nonce, timestamp and nonce and submits the resulting block when the share also
+// meets the target difficulty of the block.
+func (c *stratumClient) submitShare(worker string, job *stratumJob, extraNonce2 []byte, ntime, nonce uint32) (interface{}, *stratumError) {
+	// Rebuild the coinbase transaction with the extra nonces and calculate
+	// the resulting merkle root.
+	serializedTx := make([]byte, 0, len(job.coinbase1)+
+		stratumExtraNonce1Size+stratumExtraNonce2Size+len(job.coinbase2))
+	serializedTx = append(serializedTx, job.coinbase1...)
+	serializedTx = append(serializedTx, c.extraNonce1...)
+	serializedTx = append(serializedTx, extraNonce2...)
+	serializedTx = append(serializedTx, job.coinbase2...)
+	var coinbaseTx wire.MsgTx
+	if err := coinbaseTx.Deserialize(bytes.NewReader(serializedTx)); err != nil {
+		return nil, stratumErrInvalidParams
+	}
+	coinbaseHash := coinbaseTx.TxSha()
+	merkleRoot := &coinbaseHash
+	for _, hash := range job.merkleBranch {
+		merkleRoot = blockchain.HashMerkleBranches(merkleRoot, hash)
+	}
+
+	templateHeader := &job.template.block.Header
+	header := *templateHeader
+	header.MerkleRoot = *merkleRoot
+	header.Timestamp = time.Unix(int64(ntime), 0)
+	header.Nonce = nonce
+
+	// The timestamp may not be before the one of the template which is
+	// after the median time of the last several blocks and the timestamps
+	// of all transactions of the block.
+	maxTimestamp := c.server.server.timeSource.AdjustedTime().Add(
+		stratumMaxTimeOffset)
+	if header.Timestamp.Before(templateHeader.Timestamp) ||
+		header.Timestamp.After(maxTimestamp) {
+
+		return nil, stratumErrTimeOutOfRange
+	}
+
+	// Shares which meet the previous difficulty of the client are still
+	// accepted since the client might not have received the new difficulty
+	// yet.
+	c.mtx.Lock()
+	difficulty := c.difficulty
+	if c.prevDifficulty != 0 && c.prevDifficulty < difficulty {
+		difficulty = c.prevDifficulty
+	}
+	c.mtx.Unlock()
+
+	hash := header.BlockSha()
+	hashNum := blockchain.ShaHashToBig(&hash)
+	if hashNum.Cmp(stratumDifficultyTarget(difficulty)) > 0 {
+		return nil, stratumErrLowDifficulty
+	}
+	if !c.server.recordShare(job, &hash) {
+		return nil, stratumErrDuplicateShare
+	}
+
+	c.mtx.Lock()
+	c.numShares++
+	c.mtx.Unlock()
+
+	// Submit the block when the share also meets the target difficulty of
+	// the block.
+	if hashNum.Cmp(blockchain.CompactToBig(header.Bits)) <= 0 {
+		minrLog.Infof("Stratum client %s (worker %s) found block %v",
+			c.addr, worker, hash)
+
+		msgBlock := *job.template.block
+		msgBlock.Header = header
+		msgBlock.Transactions = make([]*wire.MsgTx,
+			len(job.template.block.Transactions))
+		copy(msgBlock.Transactions, job.template.block.Transactions)
+		msgBlock.Transactions[0] = &coinbaseTx
+		block := btcutil.NewBlock(&msgBlock)
+		block.SetHeight(job.template.height)
+		c.server.server.cpuMiner.submitBlock(block)
+	}
+
+	return true, nil
+}
@@ -0,0 +1,168 @@
+// Copyright (c) 2015 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/ppcsuite/btcutil"
+	"github.com/ppcsuite/ppcd/blockchain"
+	"github.com/ppcsuite/ppcd/wire"
+)
+
+// TestStratumDifficultyTarget ensures share difficulties are converted to the
+// expected targets.
+func TestStratumDifficultyTarget(t *testing.T) {
+	tests := []struct {
+		difficulty float64
+		want       string
+	}{
+		{1, "00000000ffff0000000000000000000000000000000000000000000000000000"},
+		{2, "000000007fff8000000000000000000000000000000000000000000000000000"},
+		{0.5, "00000001fffe0000000000000000000000000000000000000000000000000000"},
+		{3, "0000000055550000000000000000000000000000000000000000000000000000"},
+		{65536, "000000000000ffff000000000000000000000000000000000000000000000000"},
+	}
+	for _, test := range tests {
+		got := fmt.Sprintf("%064x", stratumDifficultyTarget(test.difficulty))
+		if got != test.want {
+			t.Errorf("stratumDifficultyTarget(%v): got %s, want %s",
+				test.difficulty, got, test.want)
+		}
+	}
+}
+
+// TestStratumMerkleBranch ensures the merkle branch of the coinbase transaction
+// has the expected hashes and leads to the merkle root of the transactions.
+func TestStratumMerkleBranch(t *testing.T) {
+	var txns []*wire.MsgTx
+	var hashes []*wire.ShaHash
+	for i := 0; i < 9; i++ {
+		tx := wire.NewMsgTx()
+		tx.LockTime = uint32(i)
+		hash := tx.TxSha()
+		txns = append(txns, tx)
+		hashes = append(hashes, &hash)
+	}
+
+	tests := []struct {
+		numTxns int
+		want    []*wire.ShaHash
+	}{
+		{1, nil},
+		{2, []*wire.ShaHash{hashes[1]}},
+		{3, []*wire.ShaHash{hashes[1],
+			blockchain.HashMerkleBranches(hashes[2], hashes[2])}},
+		{4, []*wire.ShaHash{hashes[1],
+			blockchain.HashMerkleBranches(hashes[2], hashes[3])}},
+		{5, []*wire.ShaHash{hashes[1],
+			blockchain.HashMerkleBranches(hashes[2], hashes[3]),
+			blockchain.HashMerkleBranches(
+				blockchain.HashMerkleBranches(hashes[4], hashes[4]),
+				blockchain.HashMerkleBranches(hashes[4], hashes[4]))}},
+	}
+	for _, test := range tests {
+		got := stratumMerkleBranch(txns[:test.numTxns])
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("stratumMerkleBranch with %d transactions: got "+
+				"%v, want %v", test.numTxns, got, test.want)
+		}
+	}
+
+	for n := 1; n <= len(txns); n++ {
+		utilTxns := make([]*btcutil.Tx, 0, n)
+		for _, tx := range txns[:n] {
+			utilTxns = append(utilTxns, btcutil.NewTx(tx))
+		}
+		merkles := blockchain.BuildMerkleTreeStore(utilTxns)
+		want := merkles[len(merkles)-1]
+
+		root := hashes[0]
+		for _, hash := range stratumMerkleBranch(txns[:n]) {
+			root = blockchain.HashMerkleBranches(root, hash)
+		}
+		if !root.IsEqual(want) {
+			t.Errorf("merkle root with %d transactions: got %v, "+
+				"want %v", n, root, want)
+		}
+	}
+}
+
+// TestNewStratumJob ensures the coinbase transaction of a new job is split
+// around the extra nonces and that the job is announced with the words of the
+// previous block hash swapped.
+func TestNewStratumJob(t *testing.T) {
+	coinbaseTx := wire.NewMsgTx()
+	coinbaseTx.Time = time.Unix(1420070400, 0)
+	coinbaseTx.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&wire.ShaHash{},
+		wire.MaxPrevOutIndex), nil))
+	coinbaseTx.AddTxOut(wire.NewTxOut(1000000, []byte{0x51}))
+
+	var prevHash wire.ShaHash
+	for i := range prevHash {
+		prevHash[i] = byte(i)
+	}
+	msgBlock := &wire.MsgBlock{
+		Header: wire.BlockHeader{
+			Version:   1,
+			PrevBlock: prevHash,
+			Timestamp: time.Unix(1420070400, 0),
+			Bits:      0x1d00ffff,
+		},
+		Transactions: []*wire.MsgTx{coinbaseTx},
+	}
+	template := &BlockTemplate{block: msgBlock, height: 100}
+
+	job, err := newStratumJob("1", template)
+	if err != nil {
+		t.Fatalf("newStratumJob: %v", err)
+	}
+
+	// The coinbase script pushes the height, the extra nonce placeholder
+	// and the coinbase flags, so the transaction is split right after the
+	// push opcode of the extra nonce.
+	wantCoinbase1 := "01000000008ea454010000000000000000000000000000" +
+		"000000000000000000000000000000000000ffffffff17016408"
+	wantCoinbase2 := "0b2f503253482f707063642fffffffff0140420f0000000000" +
+		"015100000000"
+	if got := hex.EncodeToString(job.coinbase1); got != wantCoinbase1 {
+		t.Errorf("coinbase1: got %s, want %s", got, wantCoinbase1)
+	}
+	if got := hex.EncodeToString(job.coinbase2); got != wantCoinbase2 {
+		t.Errorf("coinbase2: got %s, want %s", got, wantCoinbase2)
+	}
+
+	// Joining the pieces with the extra nonces must produce a valid
+	// coinbase transaction carrying them.
+	extraNonces := []byte{1, 2, 3, 4, 5, 6, 7, 8}
+	serializedTx := append(append(append([]byte{}, job.coinbase1...),
+		extraNonces...), job.coinbase2...)
+	var tx wire.MsgTx
+	if err := tx.Deserialize(bytes.NewReader(serializedTx)); err != nil {
+		t.Fatalf("Deserialize: %v", err)
+	}
+	if !bytes.Contains(tx.TxIn[0].SignatureScript, extraNonces) {
+		t.Errorf("coinbase script %x does not contain the extra "+
+			"nonces", tx.TxIn[0].SignatureScript)
+	}
+
+	params := job.notification(true).Params
+	wantPrevHash := "03020100070605040b0a09080f0e0d0c13121110171615141b1a1918" +
+		"1f1e1d1c"
+	if params[1] != wantPrevHash {
+		t.Errorf("previous block hash: got %v, want %s", params[1],
+			wantPrevHash)
+	}
+	wantParams := []interface{}{"00000001", "1d00ffff", "54a48e00", true}
+	if !reflect.DeepEqual(params[5:], wantParams) {
+		t.Errorf("header params: got %v, want %v", params[5:],
+			wantParams)
+	}
+}
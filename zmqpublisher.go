@@ -0,0 +1,604 @@
+// Copyright (c) 2015 PPCD developers.
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ppcsuite/btcutil"
+	"github.com/ppcsuite/ppcd/wire"
+)
+
+const (
+	// The topics of the messages published by the ZMQ publisher.  Hashes
+	// are published in the byte order used by the RPC server.
+	zmqTopicHashBlock = "hashblock"
+	zmqTopicHashTx    = "hashtx"
+	zmqTopicRawBlock  = "rawblock"
+	zmqTopicRawTx     = "rawtx"
+
+	// zmqMaxSubscribers is the maximum number of subscribers connected to
+	// a single ZMQ endpoint.
+	zmqMaxSubscribers = 100
+
+	// zmqSendQueueSize is the number of messages queued for a subscriber.
+	// Messages are dropped while the queue of a subscriber is full, which
+	// the subscriber detects by a gap in the sequence numbers.
+	zmqSendQueueSize = 1000
+
+	// zmqHandshakeTimeout is the time a subscriber has to complete the
+	// ZMTP handshake.
+	zmqHandshakeTimeout = 30 * time.Second
+
+	// zmqWriteTimeout is the time after which subscribers which do not
+	// read their messages are disconnected.
+	zmqWriteTimeout = 2 * time.Minute
+)
+
+// notificationPublisher describes a subsystem which publishes notifications
+// about blocks and transactions to consumers outside of the RPC server.
+type notificationPublisher interface {
+	// NotifyBlockConnected publishes a block connected to the main chain
+	// along with its transactions.
+	NotifyBlockConnected(block *btcutil.Block)
+
+	// NotifyTx publishes a transaction accepted to the memory pool.
+	NotifyTx(tx *btcutil.Tx)
+
+	// Start begins publishing notifications.
+	Start()
+
+	// Stop stops publishing notifications.
+	Stop() error
+}
+
+// zmqPublisher publishes raw and hashed blocks and transactions to ZeroMQ SUB
+// sockets over the ZMQ message transport protocol.  Each message is made of
+// the topic, the body and the sequence number of the message in its topic,
+// encoded as a 4-byte little-endian integer, which is the same format as the
+// ZMQ notifications of Bitcoin Core.
+type zmqPublisher struct {
+	started   int32 // atomic
+	shutdown  int32 // atomic
+	endpoints []*zmqEndpoint
+	topics    map[string]struct{}
+	wg        sync.WaitGroup
+
+	// mtx protects sequences and ensures messages are queued in the order
+	// of their sequence numbers.
+	mtx       sync.Mutex
+	sequences map[string]uint32
+}
+
+// Ensure zmqPublisher implements the notificationPublisher interface.
+var _ notificationPublisher = (*zmqPublisher)(nil)
+
+// wants returns whether messages with the passed topic are published.
+func (p *zmqPublisher) wants(topic string) bool {
+	_, ok := p.topics[topic]
+	return ok
+}
+
+// publish sends a message with the passed topic and body to the subscribers
+// of the topic.
+//
+// This function is safe for concurrent access.
+func (p *zmqPublisher) publish(topic string, body []byte) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	var sequence [4]byte
+	binary.LittleEndian.PutUint32(sequence[:], p.sequences[topic])
+	p.sequences[topic]++
+
+	msg := zmtpMessage([]byte(topic), body, sequence[:])
+	for _, e := range p.endpoints {
+		if _, ok := e.topics[topic]; !ok {
+			continue
+		}
+		for _, s := range e.connectedSubscribers() {
+			if s.subscribed(topic) {
+				s.queueMessage(msg)
+			}
+		}
+	}
+}
+
+// publishTx publishes the hash and the serialized passed transaction.
+func (p *zmqPublisher) publishTx(tx *btcutil.Tx) {
+	if p.wants(zmqTopicHashTx) {
+		p.publish(zmqTopicHashTx, reverseHash(tx.Sha()))
+	}
+	if p.wants(zmqTopicRawTx) {
+		var buf bytes.Buffer
+		buf.Grow(tx.MsgTx().SerializeSize())
+		if err := tx.MsgTx().Serialize(&buf); err != nil {
+			zmqpLog.Errorf("Failed to serialize transaction %v: %v",
+				tx.Sha(), err)
+			return
+		}
+		p.publish(zmqTopicRawTx, buf.Bytes())
+	}
+}
+
+// NotifyBlockConnected publishes the hash and the serialized passed block,
+// followed by its transactions.  It is part of the notificationPublisher
+// interface.
+//
+// This function is safe for concurrent access.
+func (p *zmqPublisher) NotifyBlockConnected(block *btcutil.Block) {
+	if p.wants(zmqTopicHashBlock) {
+		p.publish(zmqTopicHashBlock, reverseHash(block.Sha()))
+	}
+	if p.wants(zmqTopicRawBlock) {
+		buf, err := block.Bytes()
+		if err != nil {
+			zmqpLog.Errorf("Failed to serialize block %v: %v",
+				block.Sha(), err)
+		} else {
+			p.publish(zmqTopicRawBlock, buf)
+		}
+	}
+	for _, tx := range block.Transactions() {
+		p.publishTx(tx)
+	}
+}
+
+// NotifyTx publishes the hash and the serialized passed transaction.  It is
+// part of the notificationPublisher interface.
+//
+// This function is safe for concurrent access.
+func (p *zmqPublisher) NotifyTx(tx *btcutil.Tx) {
+	p.publishTx(tx)
+}
+
+// Start begins accepting subscribers.  It is part of the
+// notificationPublisher interface.
+func (p *zmqPublisher) Start() {
+	if atomic.AddInt32(&p.started, 1) != 1 {
+		return
+	}
+
+	zmqpLog.Trace("Starting ZMQ publisher")
+	for _, e := range p.endpoints {
+		p.wg.Add(1)
+		go e.listenHandler()
+	}
+}
+
+// Stop stops accepting subscribers and disconnects all of them.  It is part of
+// the notificationPublisher interface.
+func (p *zmqPublisher) Stop() error {
+	if atomic.AddInt32(&p.shutdown, 1) != 1 {
+		zmqpLog.Infof("ZMQ publisher is already in the process of " +
+			"shutting down")
+		return nil
+	}
+	zmqpLog.Warnf("ZMQ publisher shutting down")
+	for _, e := range p.endpoints {
+		if err := e.listener.Close(); err != nil {
+			zmqpLog.Errorf("Problem shutting down ZMQ publisher: %v",
+				err)
+			return err
+		}
+	}
+	for _, e := range p.endpoints {
+		for _, s := range e.connectedSubscribers() {
+			s.Disconnect()
+		}
+	}
+	p.wg.Wait()
+	zmqpLog.Infof("ZMQ publisher shutdown complete")
+	return nil
+}
+
+// zmqEndpointAddr returns the listen address of the passed ZMQ endpoint, which
+// may be given as an address with a port or as a ZMQ TCP endpoint of the form
+// tcp://<host>:<port>.  A host of * listens on all interfaces.
+func zmqEndpointAddr(endpoint string) (string, error) {
+	addr := strings.TrimPrefix(endpoint, "tcp://")
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "", err
+	}
+	if host == "*" {
+		host = ""
+	}
+	return net.JoinHostPort(host, port), nil
+}
+
+// zmqAddrTopics returns the map of listen addresses to the topics published on
+// each of them according to the --pub* options.
+func zmqAddrTopics() map[string][]string {
+	addrTopics := make(map[string][]string)
+	options := []struct {
+		topic string
+		addr  string
+	}{
+		{zmqTopicHashBlock, cfg.PubHashBlock},
+		{zmqTopicHashTx, cfg.PubHashTx},
+		{zmqTopicRawBlock, cfg.PubRawBlock},
+		{zmqTopicRawTx, cfg.PubRawTx},
+	}
+	for _, option := range options {
+		if option.addr != "" {
+			addrTopics[option.addr] = append(addrTopics[option.addr],
+				option.topic)
+		}
+	}
+	return addrTopics
+}
+
+// newZMQPublisher returns a new ZMQ publisher which publishes the topics of
+// the passed map of listen addresses to the topics published on each of them.
+func newZMQPublisher(addrTopics map[string][]string) (*zmqPublisher, error) {
+	p := &zmqPublisher{
+		topics:    make(map[string]struct{}),
+		sequences: make(map[string]uint32),
+	}
+	for addr, topics := range addrTopics {
+		listener, err := net.Listen("tcp", addr)
+		if err != nil {
+			for _, e := range p.endpoints {
+				e.listener.Close()
+			}
+			return nil, err
+		}
+		p.addEndpoint(listener, topics)
+	}
+	if len(p.endpoints) == 0 {
+		return nil, errors.New("ZMQ: No endpoint to publish on")
+	}
+
+	return p, nil
+}
+
+// addEndpoint adds an endpoint publishing the passed topics to the subscribers
+// accepted by the passed listener.
+func (p *zmqPublisher) addEndpoint(listener net.Listener, topics []string) {
+	e := &zmqEndpoint{
+		publisher:   p,
+		listener:    listener,
+		topics:      make(map[string]struct{}, len(topics)),
+		subscribers: make(map[*zmqSubscriber]struct{}),
+	}
+	for _, topic := range topics {
+		e.topics[topic] = struct{}{}
+		p.topics[topic] = struct{}{}
+	}
+	p.endpoints = append(p.endpoints, e)
+}
+
+// zmqEndpoint is an address of the ZMQ publisher which subscribers connect to
+// in order to receive the messages of its topics.
+type zmqEndpoint struct {
+	publisher *zmqPublisher
+	listener  net.Listener
+	topics    map[string]struct{}
+
+	// The following fields are protected by the mutex.
+	mtx         sync.Mutex
+	subscribers map[*zmqSubscriber]struct{}
+}
+
+// listenHandler accepts the subscribers connecting to the endpoint.  It must be
+// run as a goroutine.
+func (e *zmqEndpoint) listenHandler() {
+	p := e.publisher
+	zmqpLog.Infof("ZMQ publisher listening on %s", e.listener.Addr())
+	for atomic.LoadInt32(&p.shutdown) == 0 {
+		conn, err := e.listener.Accept()
+		if err != nil {
+			// Only log the error if we're not forcibly shutting down.
+			if atomic.LoadInt32(&p.shutdown) == 0 {
+				zmqpLog.Errorf("Can't accept ZMQ connection: %v",
+					err)
+			}
+			continue
+		}
+
+		e.mtx.Lock()
+		if atomic.LoadInt32(&p.shutdown) != 0 {
+			e.mtx.Unlock()
+			conn.Close()
+			continue
+		}
+		if len(e.subscribers) >= zmqMaxSubscribers {
+			e.mtx.Unlock()
+			zmqpLog.Infof("Max ZMQ subscribers exceeded [%d] - "+
+				"disconnecting subscriber %s", zmqMaxSubscribers,
+				conn.RemoteAddr())
+			conn.Close()
+			continue
+		}
+		s := newZMQSubscriber(e, conn)
+		e.subscribers[s] = struct{}{}
+		e.mtx.Unlock()
+
+		zmqpLog.Debugf("New ZMQ subscriber %s", s.addr)
+		s.Start()
+	}
+	p.wg.Done()
+	zmqpLog.Tracef("ZMQ listener done for %s", e.listener.Addr())
+}
+
+// removeSubscriber removes the passed subscriber from the endpoint.
+//
+// This function is safe for concurrent access.
+func (e *zmqEndpoint) removeSubscriber(s *zmqSubscriber) {
+	e.mtx.Lock()
+	delete(e.subscribers, s)
+	e.mtx.Unlock()
+}
+
+// connectedSubscribers returns a snapshot of the currently connected
+// subscribers.
+//
+// This function is safe for concurrent access.
+func (e *zmqEndpoint) connectedSubscribers() []*zmqSubscriber {
+	e.mtx.Lock()
+	subscribers := make([]*zmqSubscriber, 0, len(e.subscribers))
+	for s := range e.subscribers {
+		subscribers = append(subscribers, s)
+	}
+	e.mtx.Unlock()
+	return subscribers
+}
+
+// zmqSubscriber is a ZeroMQ SUB socket connected to an endpoint of the ZMQ
+// publisher.
+type zmqSubscriber struct {
+	endpoint     *zmqEndpoint
+	conn         net.Conn
+	addr         string
+	sendQueue    chan []byte
+	ready        chan struct{}
+	quit         chan struct{}
+	disconnected int32 // atomic
+
+	// The following fields are protected by the mutex.
+	mtx           sync.Mutex
+	subscriptions map[string]int
+}
+
+// newZMQSubscriber returns a new subscriber for the passed connection to the
+// passed endpoint.
+func newZMQSubscriber(e *zmqEndpoint, conn net.Conn) *zmqSubscriber {
+	return &zmqSubscriber{
+		endpoint:      e,
+		conn:          conn,
+		addr:          conn.RemoteAddr().String(),
+		sendQueue:     make(chan []byte, zmqSendQueueSize),
+		ready:         make(chan struct{}),
+		quit:          make(chan struct{}),
+		subscriptions: make(map[string]int),
+	}
+}
+
+// Start begins the handshake with the subscriber and processing its
+// subscriptions and messages.
+func (s *zmqSubscriber) Start() {
+	s.endpoint.publisher.wg.Add(2)
+	go s.inHandler()
+	go s.outHandler()
+}
+
+// Disconnect disconnects the subscriber.  It is safe to call multiple times.
+func (s *zmqSubscriber) Disconnect() {
+	if atomic.AddInt32(&s.disconnected, 1) != 1 {
+		return
+	}
+	zmqpLog.Debugf("Disconnecting ZMQ subscriber %s", s.addr)
+	close(s.quit)
+	s.conn.Close()
+}
+
+// handshake exchanges the greeting and the READY command with the subscriber,
+// which must be a SUB or XSUB socket.
+func (s *zmqSubscriber) handshake(r io.Reader) error {
+	s.conn.SetDeadline(time.Now().Add(zmqHandshakeTimeout))
+	defer s.conn.SetDeadline(time.Time{})
+
+	if _, err := s.conn.Write(zmtpGreeting()); err != nil {
+		return err
+	}
+	greeting := make([]byte, zmtpGreetingSize)
+	if _, err := io.ReadFull(r, greeting); err != nil {
+		return err
+	}
+	if err := checkZMTPGreeting(greeting); err != nil {
+		return err
+	}
+
+	if _, err := s.conn.Write(zmtpReadyCommand("PUB")); err != nil {
+		return err
+	}
+	flags, body, err := readZMTPFrame(r)
+	if err != nil {
+		return err
+	}
+	if flags&zmtpFlagCommand == 0 {
+		return errors.New("expected a READY command")
+	}
+	name, data, err := parseZMTPCommand(body)
+	if err != nil {
+		return err
+	}
+	if name != "READY" {
+		return errors.New("expected a READY command, got " + name)
+	}
+	properties, err := parseZMTPProperties(data)
+	if err != nil {
+		return err
+	}
+	switch socketType := properties["Socket-Type"]; socketType {
+	case "SUB", "XSUB":
+	default:
+		return errors.New("unsupported socket type " + socketType)
+	}
+	return nil
+}
+
+// readSubscriptions reads the subscriptions of the subscriber until the
+// connection is closed.
+func (s *zmqSubscriber) readSubscriptions(reader io.Reader) {
+	for {
+		flags, body, err := readZMTPFrame(reader)
+		if err != nil {
+			if err != io.EOF && atomic.LoadInt32(&s.disconnected) == 0 {
+				zmqpLog.Debugf("Can't read message from ZMQ "+
+					"subscriber %s: %v", s.addr, err)
+			}
+			return
+		}
+
+		// Subscriptions are messages starting with 1 to subscribe or 0
+		// to unsubscribe in version 3.0 of the protocol, and the
+		// SUBSCRIBE and CANCEL commands in later versions.  Anything
+		// else is ignored.
+		if flags&zmtpFlagCommand != 0 {
+			name, data, err := parseZMTPCommand(body)
+			if err != nil {
+				zmqpLog.Debugf("Malformed command from ZMQ "+
+					"subscriber %s: %v", s.addr, err)
+				return
+			}
+			switch name {
+			case "SUBSCRIBE":
+				s.subscribe(string(data), true)
+			case "CANCEL":
+				s.subscribe(string(data), false)
+			}
+			continue
+		}
+		if len(body) > 0 && flags&zmtpFlagMore == 0 {
+			switch body[0] {
+			case 1:
+				s.subscribe(string(body[1:]), true)
+			case 0:
+				s.subscribe(string(body[1:]), false)
+			}
+		}
+	}
+}
+
+// inHandler performs the handshake and then reads the subscriptions of the
+// subscriber.  It must be run as a goroutine.
+func (s *zmqSubscriber) inHandler() {
+	reader := bufio.NewReader(s.conn)
+	err := s.handshake(reader)
+	if err == nil {
+		close(s.ready)
+		s.readSubscriptions(reader)
+	} else if atomic.LoadInt32(&s.disconnected) == 0 {
+		zmqpLog.Debugf("ZMTP handshake with %s failed: %v", s.addr,
+			err)
+	}
+
+	s.Disconnect()
+	s.endpoint.removeSubscriber(s)
+	s.endpoint.publisher.wg.Done()
+	zmqpLog.Tracef("ZMQ subscriber input handler done for %s", s.addr)
+}
+
+// outHandler writes the queued messages to the subscriber once the handshake
+// is complete.  It must be run as a goroutine.
+func (s *zmqSubscriber) outHandler() {
+	select {
+	case <-s.ready:
+	case <-s.quit:
+		s.endpoint.publisher.wg.Done()
+		return
+	}
+
+out:
+	for {
+		select {
+		case msg := <-s.sendQueue:
+			s.conn.SetWriteDeadline(time.Now().Add(zmqWriteTimeout))
+			if _, err := s.conn.Write(msg); err != nil {
+				if atomic.LoadInt32(&s.disconnected) == 0 {
+					zmqpLog.Debugf("Can't write message to "+
+						"ZMQ subscriber %s: %v", s.addr, err)
+				}
+				s.Disconnect()
+				break out
+			}
+
+		case <-s.quit:
+			break out
+		}
+	}
+	s.endpoint.publisher.wg.Done()
+	zmqpLog.Tracef("ZMQ subscriber output handler done for %s", s.addr)
+}
+
+// subscribe adds or removes a subscription to the topics starting with the
+// passed prefix.  Like ZeroMQ, subscriptions are counted, so a prefix which
+// was subscribed to several times must be unsubscribed from as many times.
+//
+// This function is safe for concurrent access.
+func (s *zmqSubscriber) subscribe(prefix string, add bool) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if add {
+		s.subscriptions[prefix]++
+		return
+	}
+	if s.subscriptions[prefix] <= 1 {
+		delete(s.subscriptions, prefix)
+		return
+	}
+	s.subscriptions[prefix]--
+}
+
+// subscribed returns whether the subscriber subscribed to the passed topic.
+//
+// This function is safe for concurrent access.
+func (s *zmqSubscriber) subscribed(topic string) bool {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	for prefix := range s.subscriptions {
+		if strings.HasPrefix(topic, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// queueMessage queues the passed message to be sent to the subscriber.  The
+// message is dropped when the queue of the subscriber is full.
+//
+// This function is safe for concurrent access.
+func (s *zmqSubscriber) queueMessage(msg []byte) {
+	select {
+	case s.sendQueue <- msg:
+	case <-s.quit:
+	default:
+		zmqpLog.Debugf("Send queue of ZMQ subscriber %s is full - "+
+			"dropping message", s.addr)
+	}
+}
+
+// reverseHash returns the bytes of the passed hash in the byte order used by
+// the RPC server, which is the reverse of the internal byte order.
+func reverseHash(hash *wire.ShaHash) []byte {
+	reversed := make([]byte, wire.HashSize)
+	for i, b := range hash[:] {
+		reversed[wire.HashSize-1-i] = b
+	}
+	return reversed
+}
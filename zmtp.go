@@ -0,0 +1,180 @@
+// Copyright (c) 2015 PPCD developers.
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// This file implements the parts of version 3.0 of the ZeroMQ Message
+// Transport Protocol (ZMTP) needed to publish messages to ZeroMQ SUB sockets:
+// the greeting, the handshake of the NULL security mechanism and the framing of
+// messages and commands.
+
+const (
+	// zmtpGreetingSize is the size of the greeting exchanged by both peers
+	// when a connection is established.
+	zmtpGreetingSize = 64
+
+	// zmtpMajorVersion and zmtpMinorVersion are the version of the protocol
+	// announced in the greeting.
+	zmtpMajorVersion = 3
+	zmtpMinorVersion = 0
+
+	// zmtpMechanismNull is the security mechanism without authentication
+	// or encryption.
+	zmtpMechanismNull = "NULL"
+
+	// The flags of a frame.
+	zmtpFlagMore    = 0x01
+	zmtpFlagLong    = 0x02
+	zmtpFlagCommand = 0x04
+
+	// zmtpMaxReadFrameSize is the maximum size of the frames read from a
+	// peer.  The publisher only reads the handshake and subscriptions,
+	// which are much smaller.
+	zmtpMaxReadFrameSize = 4096
+)
+
+// zmtpGreeting returns the greeting sent to a peer when a connection is
+// established.  It announces the NULL security mechanism.
+func zmtpGreeting() []byte {
+	greeting := make([]byte, zmtpGreetingSize)
+	greeting[0] = 0xff
+	greeting[9] = 0x7f
+	greeting[10] = zmtpMajorVersion
+	greeting[11] = zmtpMinorVersion
+	copy(greeting[12:32], zmtpMechanismNull)
+	return greeting
+}
+
+// checkZMTPGreeting returns an error when the passed greeting of a peer does
+// not use version 3 or later of the protocol and the NULL security mechanism.
+func checkZMTPGreeting(greeting []byte) error {
+	if len(greeting) != zmtpGreetingSize || greeting[0] != 0xff ||
+		greeting[9]&0x01 != 0x01 {
+
+		return errors.New("invalid ZMTP greeting signature")
+	}
+	if greeting[10] < zmtpMajorVersion {
+		return fmt.Errorf("unsupported ZMTP version %d.%d", greeting[10],
+			greeting[11])
+	}
+	mechanism := string(bytes.TrimRight(greeting[12:32], "\x00"))
+	if mechanism != zmtpMechanismNull {
+		return fmt.Errorf("unsupported ZMTP security mechanism %q",
+			mechanism)
+	}
+	return nil
+}
+
+// appendZMTPFrame appends a frame with the passed flags and body to buf and
+// returns the extended buffer.  The long flag is set as needed.
+func appendZMTPFrame(buf []byte, flags byte, body []byte) []byte {
+	if len(body) > 0xff {
+		var size [8]byte
+		binary.BigEndian.PutUint64(size[:], uint64(len(body)))
+		buf = append(buf, flags|zmtpFlagLong)
+		buf = append(buf, size[:]...)
+	} else {
+		buf = append(buf, flags, byte(len(body)))
+	}
+	return append(buf, body...)
+}
+
+// zmtpMessage returns the frames of a message made of the passed parts.
+func zmtpMessage(parts ...[]byte) []byte {
+	size := 0
+	for _, part := range parts {
+		size += 9 + len(part)
+	}
+	buf := make([]byte, 0, size)
+	for i, part := range parts {
+		var flags byte
+		if i < len(parts)-1 {
+			flags = zmtpFlagMore
+		}
+		buf = appendZMTPFrame(buf, flags, part)
+	}
+	return buf
+}
+
+// zmtpReadyCommand returns the frame of the READY command which completes the
+// handshake of the NULL security mechanism for a socket of the passed type.
+func zmtpReadyCommand(socketType string) []byte {
+	const name, property = "READY", "Socket-Type"
+	body := make([]byte, 0, 2+len(name)+len(property)+4+len(socketType))
+	body = append(body, byte(len(name)))
+	body = append(body, name...)
+	body = append(body, byte(len(property)))
+	body = append(body, property...)
+	var size [4]byte
+	binary.BigEndian.PutUint32(size[:], uint32(len(socketType)))
+	body = append(body, size[:]...)
+	body = append(body, socketType...)
+	return appendZMTPFrame(nil, zmtpFlagCommand, body)
+}
+
+// readZMTPFrame reads a frame from r and returns its flags and body.  Frames
+// larger than zmtpMaxReadFrameSize are refused.
+func readZMTPFrame(r io.Reader) (byte, []byte, error) {
+	var header [9]byte
+	if _, err := io.ReadFull(r, header[:2]); err != nil {
+		return 0, nil, err
+	}
+	flags := header[0]
+	size := uint64(header[1])
+	if flags&zmtpFlagLong != 0 {
+		if _, err := io.ReadFull(r, header[2:]); err != nil {
+			return 0, nil, err
+		}
+		size = binary.BigEndian.Uint64(header[1:])
+	}
+	if size > zmtpMaxReadFrameSize {
+		return 0, nil, fmt.Errorf("ZMTP frame of %d bytes exceeds the "+
+			"maximum of %d", size, zmtpMaxReadFrameSize)
+	}
+
+	body := make([]byte, size)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return 0, nil, err
+	}
+	return flags, body, nil
+}
+
+// parseZMTPCommand returns the name and data of the command in the passed
+// frame body.
+func parseZMTPCommand(body []byte) (string, []byte, error) {
+	if len(body) < 1 || len(body) < 1+int(body[0]) {
+		return "", nil, errors.New("malformed ZMTP command")
+	}
+	nameSize := int(body[0])
+	return string(body[1 : 1+nameSize]), body[1+nameSize:], nil
+}
+
+// parseZMTPProperties returns the properties in the data of a READY command.
+func parseZMTPProperties(data []byte) (map[string]string, error) {
+	properties := make(map[string]string)
+	for len(data) > 0 {
+		nameSize := int(data[0])
+		if len(data) < 1+nameSize+4 {
+			return nil, errors.New("malformed ZMTP property")
+		}
+		name := string(data[1 : 1+nameSize])
+		data = data[1+nameSize:]
+		valueSize := binary.BigEndian.Uint32(data)
+		data = data[4:]
+		if uint64(len(data)) < uint64(valueSize) {
+			return nil, errors.New("malformed ZMTP property")
+		}
+		properties[name] = string(data[:valueSize])
+		data = data[valueSize:]
+	}
+	return properties, nil
+}
@@ -0,0 +1,248 @@
+// Copyright (c) 2015 PPCD developers.
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"reflect"
+	"testing"
+)
+
+// TestZMTPFrameRoundTrip ensures frames are encoded with a short or long size
+// as needed and are read back unchanged.
+func TestZMTPFrameRoundTrip(t *testing.T) {
+	tests := []struct {
+		name       string
+		flags      byte
+		size       int
+		headerSize int
+	}{
+		{"empty", 0, 0, 2},
+		{"short", zmtpFlagMore, 1, 2},
+		{"largest short", zmtpFlagMore, 255, 2},
+		{"smallest long", 0, 256, 9},
+		{"long command", zmtpFlagCommand, 1000, 9},
+		{"largest readable", 0, zmtpMaxReadFrameSize, 9},
+	}
+	for _, test := range tests {
+		body := bytes.Repeat([]byte{0xab}, test.size)
+		frame := appendZMTPFrame([]byte{0xee}, test.flags, body)[1:]
+		if len(frame) != test.headerSize+test.size {
+			t.Errorf("%s: got frame of %d bytes, want %d", test.name,
+				len(frame), test.headerSize+test.size)
+			continue
+		}
+		long := test.headerSize == 9
+		if (frame[0]&zmtpFlagLong != 0) != long {
+			t.Errorf("%s: got flags %#x, want long flag %v", test.name,
+				frame[0], long)
+		}
+
+		flags, got, err := readZMTPFrame(bytes.NewReader(frame))
+		if err != nil {
+			t.Errorf("%s: readZMTPFrame: %v", test.name, err)
+			continue
+		}
+		if flags&^zmtpFlagLong != test.flags || !bytes.Equal(got, body) {
+			t.Errorf("%s: got flags %#x and %d bytes, want flags %#x "+
+				"and %d bytes", test.name, flags, len(got),
+				test.flags, len(body))
+		}
+	}
+
+	// The size of long frames is big-endian.
+	frame := appendZMTPFrame(nil, 0, make([]byte, 256))
+	if want := "020000000000000100"; hex.EncodeToString(frame[:9]) != want {
+		t.Errorf("long frame header: got %x, want %s", frame[:9], want)
+	}
+}
+
+// TestReadZMTPFrameErrors ensures truncated and oversized frames are refused.
+func TestReadZMTPFrameErrors(t *testing.T) {
+	oversized := appendZMTPFrame(nil, 0, make([]byte, zmtpMaxReadFrameSize+1))
+	short := appendZMTPFrame(nil, 0, make([]byte, 10))
+	long := appendZMTPFrame(nil, 0, make([]byte, 300))
+	tests := []struct {
+		name  string
+		frame []byte
+	}{
+		{"empty", nil},
+		{"truncated header", short[:1]},
+		{"truncated long size", long[:5]},
+		{"truncated short body", short[:len(short)-1]},
+		{"truncated long body", long[:len(long)-1]},
+		{"oversized", oversized},
+	}
+	for _, test := range tests {
+		_, _, err := readZMTPFrame(bytes.NewReader(test.frame))
+		if err == nil {
+			t.Errorf("%s: readZMTPFrame succeeded", test.name)
+		}
+	}
+}
+
+// TestZMTPGreeting ensures the greeting announces version 3.0 and the NULL
+// security mechanism and that unsupported greetings of peers are refused.
+func TestZMTPGreeting(t *testing.T) {
+	greeting := zmtpGreeting()
+	want := "ff00000000000000007f03004e554c4c" +
+		"00000000000000000000000000000000" +
+		"00000000000000000000000000000000" +
+		"00000000000000000000000000000000"
+	if got := hex.EncodeToString(greeting); got != want {
+		t.Errorf("zmtpGreeting: got %s, want %s", got, want)
+	}
+	if err := checkZMTPGreeting(greeting); err != nil {
+		t.Errorf("checkZMTPGreeting of own greeting: %v", err)
+	}
+
+	// modified returns a copy of the greeting modified by the passed
+	// function.
+	modified := func(modify func([]byte)) []byte {
+		g := append([]byte{}, greeting...)
+		modify(g)
+		return g
+	}
+	tests := []struct {
+		name     string
+		greeting []byte
+		valid    bool
+	}{
+		{"version 3.1", modified(func(g []byte) { g[11] = 1 }), true},
+		{"as server", modified(func(g []byte) { g[32] = 1 }), true},
+		{"short", greeting[:10], false},
+		{"bad signature start", modified(func(g []byte) { g[0] = 0 }),
+			false},
+		{"bad signature end", modified(func(g []byte) { g[9] = 0x7e }),
+			false},
+		{"version 2", modified(func(g []byte) { g[10] = 2 }), false},
+		{"PLAIN mechanism", modified(func(g []byte) {
+			copy(g[12:32], "PLAIN")
+		}), false},
+	}
+	for _, test := range tests {
+		err := checkZMTPGreeting(test.greeting)
+		if (err == nil) != test.valid {
+			t.Errorf("%s: got error %v, want valid %v", test.name,
+				err, test.valid)
+		}
+	}
+}
+
+// TestZMTPReadyCommand ensures the READY command is encoded as expected and
+// that the commands and properties of peers are parsed.
+func TestZMTPReadyCommand(t *testing.T) {
+	frame := zmtpReadyCommand("PUB")
+	want := "0419055245414459" + "0b536f636b65742d54797065" + "00000003505542"
+	if got := hex.EncodeToString(frame); got != want {
+		t.Errorf("zmtpReadyCommand: got %s, want %s", got, want)
+	}
+
+	flags, body, err := readZMTPFrame(bytes.NewReader(frame))
+	if err != nil {
+		t.Fatalf("readZMTPFrame: %v", err)
+	}
+	if flags&zmtpFlagCommand == 0 {
+		t.Errorf("READY frame is not a command")
+	}
+	name, data, err := parseZMTPCommand(body)
+	if err != nil || name != "READY" {
+		t.Fatalf("parseZMTPCommand: got %q, %v, want READY", name, err)
+	}
+	properties, err := parseZMTPProperties(data)
+	if err != nil {
+		t.Fatalf("parseZMTPProperties: %v", err)
+	}
+	wantProperties := map[string]string{"Socket-Type": "PUB"}
+	if !reflect.DeepEqual(properties, wantProperties) {
+		t.Errorf("got properties %v, want %v", properties,
+			wantProperties)
+	}
+
+	// Properties with an empty value and several properties are parsed.
+	data = []byte("\x0bSocket-Type\x00\x00\x00\x03SUB" +
+		"\x08Identity\x00\x00\x00\x00")
+	properties, err = parseZMTPProperties(data)
+	wantProperties = map[string]string{"Socket-Type": "SUB", "Identity": ""}
+	if err != nil || !reflect.DeepEqual(properties, wantProperties) {
+		t.Errorf("got properties %v, %v, want %v", properties, err,
+			wantProperties)
+	}
+
+	for _, body := range [][]byte{nil, []byte("\x05READ")} {
+		if _, _, err := parseZMTPCommand(body); err == nil {
+			t.Errorf("parseZMTPCommand(%q) succeeded", body)
+		}
+	}
+	for _, data := range [][]byte{
+		[]byte("\x0bSocket-Type"),
+		[]byte("\x0bSocket-Type\x00\x00\x00"),
+		[]byte("\x0bSocket-Type\x00\x00\x00\x04SUB"),
+	} {
+		if _, err := parseZMTPProperties(data); err == nil {
+			t.Errorf("parseZMTPProperties(%q) succeeded", data)
+		}
+	}
+}
+
+// TestZMQSubscriptions ensures subscriptions are read both from the messages of
+// version 3.0 of the protocol and from the SUBSCRIBE and CANCEL commands of
+// later versions.
+func TestZMQSubscriptions(t *testing.T) {
+	command := func(name, topic string) []byte {
+		body := append([]byte{byte(len(name))}, name...)
+		return appendZMTPFrame(nil, zmtpFlagCommand, append(body, topic...))
+	}
+
+	tests := []struct {
+		name   string
+		frames [][]byte
+		want   map[string]bool
+	}{
+		{"3.0 subscribe", [][]byte{
+			zmtpMessage([]byte("\x01hashblock")),
+		}, map[string]bool{"hashblock": true, "hashtx": false}},
+		{"3.0 subscribe to everything", [][]byte{
+			zmtpMessage([]byte("\x01")),
+		}, map[string]bool{"hashblock": true, "rawtx": true}},
+		{"3.0 unsubscribe", [][]byte{
+			zmtpMessage([]byte("\x01hash")),
+			zmtpMessage([]byte("\x01hash")),
+			zmtpMessage([]byte("\x00hash")),
+		}, map[string]bool{"hashblock": true}},
+		{"3.0 unsubscribe all", [][]byte{
+			zmtpMessage([]byte("\x01hash")),
+			zmtpMessage([]byte("\x00hash")),
+		}, map[string]bool{"hashblock": false}},
+		{"multipart message ignored", [][]byte{
+			zmtpMessage([]byte("\x01hashblock"), []byte("x")),
+		}, map[string]bool{"hashblock": false}},
+		{"SUBSCRIBE command", [][]byte{
+			command("SUBSCRIBE", "rawtx"),
+		}, map[string]bool{"rawtx": true, "rawblock": false}},
+		{"CANCEL command", [][]byte{
+			command("SUBSCRIBE", "rawtx"),
+			command("CANCEL", "rawtx"),
+		}, map[string]bool{"rawtx": false}},
+		{"unknown command ignored", [][]byte{
+			command("PING", "rawtx"),
+		}, map[string]bool{"rawtx": false}},
+	}
+	for _, test := range tests {
+		var buf bytes.Buffer
+		for _, frame := range test.frames {
+			buf.Write(frame)
+		}
+		s := &zmqSubscriber{subscriptions: make(map[string]int)}
+		s.readSubscriptions(&buf)
+		for topic, want := range test.want {
+			if got := s.subscribed(topic); got != want {
+				t.Errorf("%s: subscribed to %s %v, want %v",
+					test.name, topic, got, want)
+			}
+		}
+	}
+}